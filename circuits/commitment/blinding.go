@@ -0,0 +1,16 @@
+//go:build !detproof
+
+package commitment
+
+import "io"
+
+// DeterministicProofs reports whether ProveWithRand reads the Groth16
+// blinding from its rng. Only builds with the detproof tag do.
+const DeterministicProofs = false
+
+// UseRand is a no-op outside detproof builds: gnark samples the Groth16
+// blinding from crypto/rand with no hook, and swapping the process-wide
+// reader would hand rng to every other crypto/rand user as well.
+func UseRand(io.Reader) (restore func()) {
+	return func() {}
+}
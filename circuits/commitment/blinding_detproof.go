@@ -0,0 +1,34 @@
+//go:build detproof
+
+package commitment
+
+import (
+	"crypto/rand"
+	"io"
+	"sync"
+)
+
+// DeterministicProofs reports whether ProveWithRand reads the Groth16
+// blinding from its rng. Only builds with the detproof tag do.
+const DeterministicProofs = true
+
+// randMutex serializes provers that override crypto/rand.Reader
+var randMutex sync.Mutex
+
+// UseRand installs rng as crypto/rand.Reader until the returned function is
+// called, holding a lock shared by every prover in this module so concurrent
+// provers never see each other's reader:
+//
+//	defer commitment.UseRand(rng)()
+//
+// Everything else in the process reads rng meanwhile, which is why this only
+// exists in test and tooling builds (-tags detproof).
+func UseRand(rng io.Reader) (restore func()) {
+	randMutex.Lock()
+	orig := rand.Reader
+	rand.Reader = rng
+	return func() {
+		rand.Reader = orig
+		randMutex.Unlock()
+	}
+}
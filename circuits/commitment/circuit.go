@@ -33,27 +33,36 @@ type Circuit struct {
 }
 
 func (c *Circuit) Define(api frontend.API) error {
+	cCalc, err := Commit(api, c.R2Hi, c.R2Lo, c.CtxHash)
+	if err != nil {
+		return err
+	}
+
+	// Assert commitment matches
+	api.AssertIsEqual(cCalc, c.C)
+
+	return nil
+}
+
+// Commit computes MiMC(DST, r2_hi, r2_lo, ctx_hash) in-circuit, matching
+// ComputeCommitmentHash. Circuits that relate commitments use it too.
+func Commit(api frontend.API, r2Hi, r2Lo, ctxHash frontend.Variable) (frontend.Variable, error) {
 	// DST as field element (hash of "VTE_COMMIT_V2")
 	// SHA256("VTE_COMMIT_V2") -> big.Int -> Field Element
 	// 0x6e8e6b18... derived from echo -n "VTE_COMMIT_V2" | sha256sum
 	dst := big.NewInt(0)
-	dst.SetString("22834383894294698501250269098734612248590623067142646399676774643038477038930", 10)
+	dst.SetString(DSTValue, 10)
 
 	// Create MiMC hasher (native BN254 support)
 	h, err := mimc.NewMiMC(api)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Hash: DST || r2_hi || r2_lo || ctx_hash
 	h.Write(dst)
-	h.Write(c.R2Hi)
-	h.Write(c.R2Lo)
-	h.Write(c.CtxHash)
-	cCalc := h.Sum()
-
-	// Assert commitment matches
-	api.AssertIsEqual(cCalc, c.C)
-
-	return nil
+	h.Write(r2Hi)
+	h.Write(r2Lo)
+	h.Write(ctxHash)
+	return h.Sum(), nil
 }
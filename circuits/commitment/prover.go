@@ -3,6 +3,7 @@ package commitment
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"math/big"
 	"sync"
 	"time"
@@ -157,6 +158,17 @@ func ComputeCommitmentHash(r2, ctxHash []byte) ([]byte, error) {
 
 // Prove generates a commitment proof
 func Prove(keys *ProvingKeys, input *WitnessInput) (*ProverResult, error) {
+	return ProveWithRand(keys, input, nil)
+}
+
+// ProveWithRand generates a commitment proof. In detproof builds the Groth16
+// blinding factors (r, s) are read from rng (see UseRand); otherwise they
+// come from crypto/rand and rng is ignored. A nil rng behaves like Prove.
+func ProveWithRand(keys *ProvingKeys, input *WitnessInput, rng io.Reader) (*ProverResult, error) {
+	if rng != nil {
+		defer UseRand(rng)()
+	}
+
 	startTime := time.Now()
 	result := &ProverResult{}
 
@@ -0,0 +1,42 @@
+package equality
+
+import (
+	"github.com/consensys/gnark/frontend"
+
+	"vte-tlock/circuits/commitment"
+)
+
+// Circuit proves that two commitments hide the same r2 under different
+// context hashes:
+// COld = MiMC(DST, r2_hi, r2_lo, CtxHashOld) and
+// CNew = MiMC(DST, r2_hi, r2_lo, CtxHashNew)
+//
+// It links a package to its relocked successor (see vte.Relock) without
+// revealing r2. The limbs and DST are those of the commitment circuit.
+type Circuit struct {
+	// Public Inputs
+	CtxHashOld frontend.Variable `gnark:",public"`
+	COld       frontend.Variable `gnark:",public"`
+	CtxHashNew frontend.Variable `gnark:",public"`
+	CNew       frontend.Variable `gnark:",public"`
+
+	// Secret Witness: r2 split into two 128-bit limbs, shared by both commitments
+	R2Hi frontend.Variable
+	R2Lo frontend.Variable
+}
+
+func (c *Circuit) Define(api frontend.API) error {
+	cOld, err := commitment.Commit(api, c.R2Hi, c.R2Lo, c.CtxHashOld)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(cOld, c.COld)
+
+	cNew, err := commitment.Commit(api, c.R2Hi, c.R2Lo, c.CtxHashNew)
+	if err != nil {
+		return err
+	}
+	api.AssertIsEqual(cNew, c.CNew)
+
+	return nil
+}
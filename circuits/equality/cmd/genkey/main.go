@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"vte-tlock/circuits/equality"
+)
+
+// This tool generates and saves the PK and VK of the equality circuit for embedding
+// Run: go run circuits/equality/cmd/genkey/main.go
+func main() {
+	fmt.Println("Generating equality circuit keys (trusted setup)...")
+
+	var c equality.Circuit
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &c)
+	if err != nil {
+		fmt.Printf("Circuit compilation failed: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Circuit compiled with %d constraints\n", ccs.GetNbConstraints())
+
+	fmt.Println("Running Groth16 trusted setup...")
+	pk, vk, err := groth16.Setup(ccs)
+	if err != nil {
+		fmt.Printf("Setup failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	var vkBuf, pkBuf bytes.Buffer
+	if _, err := vk.WriteTo(&vkBuf); err != nil {
+		fmt.Printf("VK serialization failed: %v\n", err)
+		os.Exit(1)
+	}
+	if _, err := pk.WriteTo(&pkBuf); err != nil {
+		fmt.Printf("PK serialization failed: %v\n", err)
+		os.Exit(1)
+	}
+	vkHash := sha256.Sum256(vkBuf.Bytes())
+
+	fmt.Printf("VK size: %d bytes\n", vkBuf.Len())
+	fmt.Printf("PK size: %d bytes\n", pkBuf.Len())
+	fmt.Printf("VK hash (circuit_id): %s\n", hex.EncodeToString(vkHash[:]))
+
+	files := map[string][]byte{
+		"circuits/equality/vk.bin": vkBuf.Bytes(),
+		"circuits/equality/pk.bin": pkBuf.Bytes(),
+		"circuits/equality/vk_embed.go": []byte(fmt.Sprintf(`package equality
+
+// AUTO-GENERATED - DO NOT EDIT
+// Generated by: go run circuits/equality/cmd/genkey/main.go
+// This file contains the embedded proving and verifying keys from trusted setup
+// VK Hash: %s
+
+import _ "embed"
+
+//go:embed vk.bin
+var EmbeddedVK []byte
+
+//go:embed pk.bin
+var EmbeddedPK []byte
+
+// CircuitID is the SHA256 hash of the VK (first 16 bytes hex)
+const CircuitID = "%s"
+
+// FullVKHash is the complete SHA256 hash of the VK
+const FullVKHash = "%s"
+`, hex.EncodeToString(vkHash[:16]), hex.EncodeToString(vkHash[:16]), hex.EncodeToString(vkHash[:]))),
+	}
+	for path, data := range files {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			fmt.Printf("Failed to write %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Saved %s\n", path)
+	}
+
+	fmt.Println("\n✅ Done! Keys are now ready for embedding.")
+}
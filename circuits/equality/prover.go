@@ -0,0 +1,122 @@
+package equality
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"vte-tlock/circuits/commitment"
+)
+
+// ProvingKeys holds Groth16 keys for the equality circuit
+type ProvingKeys struct {
+	PK  groth16.ProvingKey
+	VK  groth16.VerifyingKey
+	CCS constraint.ConstraintSystem
+}
+
+var (
+	cachedKeys *ProvingKeys
+	keysMutex  sync.Mutex
+)
+
+// Setup loads the embedded proving and verifying keys. Unlike the commitment
+// circuit there is no fallback setup: proofs made with fresh keys would not
+// verify anywhere else.
+func Setup() (*ProvingKeys, error) {
+	keysMutex.Lock()
+	defer keysMutex.Unlock()
+
+	if cachedKeys != nil {
+		return cachedKeys, nil
+	}
+
+	var c Circuit
+	ccs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &c)
+	if err != nil {
+		return nil, fmt.Errorf("equality circuit compilation failed: %w", err)
+	}
+
+	pk := groth16.NewProvingKey(ecc.BN254)
+	if _, err := pk.ReadFrom(bytes.NewReader(EmbeddedPK)); err != nil {
+		return nil, fmt.Errorf("failed to load embedded PK: %w", err)
+	}
+	vk, err := getEmbeddedVK()
+	if err != nil {
+		return nil, err
+	}
+
+	cachedKeys = &ProvingKeys{PK: pk, VK: vk, CCS: ccs}
+	return cachedKeys, nil
+}
+
+// WitnessInput contains the values for proof generation
+type WitnessInput struct {
+	// Secret witness: r2 scalar (32 bytes, big-endian)
+	R2 []byte
+
+	// Public inputs (32 bytes each)
+	CtxHashOld []byte
+	COld       []byte
+	CtxHashNew []byte
+	CNew       []byte
+}
+
+// Prove generates an equality proof
+func Prove(keys *ProvingKeys, input *WitnessInput) ([]byte, error) {
+	return ProveWithRand(keys, input, nil)
+}
+
+// ProveWithRand generates an equality proof, with the Groth16 blinding read
+// from rng in detproof builds (see commitment.UseRand). A nil rng behaves
+// like Prove.
+func ProveWithRand(keys *ProvingKeys, input *WitnessInput, rng io.Reader) ([]byte, error) {
+	if len(input.R2) != 32 {
+		return nil, fmt.Errorf("R2 must be 32 bytes")
+	}
+	if keys == nil {
+		var err error
+		if keys, err = Setup(); err != nil {
+			return nil, err
+		}
+	}
+	if rng != nil {
+		defer commitment.UseRand(rng)()
+	}
+
+	witness := publicWitness(input.CtxHashOld, input.COld, input.CtxHashNew, input.CNew)
+	witness.R2Hi = new(big.Int).SetBytes(input.R2[:16])
+	witness.R2Lo = new(big.Int).SetBytes(input.R2[16:])
+
+	fullWitness, err := frontend.NewWitness(witness, ecc.BN254.ScalarField())
+	if err != nil {
+		return nil, fmt.Errorf("witness creation failed: %w", err)
+	}
+	proof, err := groth16.Prove(keys.CCS, keys.PK, fullWitness)
+	if err != nil {
+		return nil, fmt.Errorf("proof generation failed: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := proof.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("proof serialization failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func publicWitness(ctxHashOld, cOld, ctxHashNew, cNew []byte) *Circuit {
+	return &Circuit{
+		CtxHashOld: new(big.Int).SetBytes(ctxHashOld),
+		COld:       new(big.Int).SetBytes(cOld),
+		CtxHashNew: new(big.Int).SetBytes(ctxHashNew),
+		CNew:       new(big.Int).SetBytes(cNew),
+	}
+}
@@ -0,0 +1,42 @@
+package equality
+
+import (
+	"testing"
+
+	"vte-tlock/circuits/commitment"
+)
+
+func TestEqualityProof(t *testing.T) {
+	r2 := make([]byte, 32)
+	ctxOld := make([]byte, 32)
+	ctxNew := make([]byte, 32)
+	for i := range r2 {
+		r2[i] = byte(i + 1)
+		ctxOld[i] = byte(i + 100)
+		ctxNew[i] = byte(i + 200)
+	}
+	cOld, _ := commitment.ComputeCommitmentHash(r2, ctxOld)
+	cNew, _ := commitment.ComputeCommitmentHash(r2, ctxNew)
+
+	proof, err := Prove(nil, &WitnessInput{R2: r2, CtxHashOld: ctxOld, COld: cOld, CtxHashNew: ctxNew, CNew: cNew})
+	if err != nil {
+		t.Fatalf("Prove failed: %v", err)
+	}
+	if err := VerifyWithEmbeddedVK(proof, ctxOld, cOld, ctxNew, cNew); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+
+	// Swapped contexts and a commitment to another r2 must not verify
+	if err := VerifyWithEmbeddedVK(proof, ctxNew, cOld, ctxOld, cNew); err == nil {
+		t.Fatal("Proof verified with swapped contexts")
+	}
+	other := append([]byte(nil), r2...)
+	other[0] ^= 1
+	cOther, _ := commitment.ComputeCommitmentHash(other, ctxNew)
+	if err := VerifyWithEmbeddedVK(proof, ctxOld, cOld, ctxNew, cOther); err == nil {
+		t.Fatal("Proof verified for a different secret")
+	}
+	if _, err := Prove(nil, &WitnessInput{R2: other, CtxHashOld: ctxOld, COld: cOld, CtxHashNew: ctxNew, CNew: cNew}); err == nil {
+		t.Fatal("Proved equality for a secret that opens neither commitment")
+	}
+}
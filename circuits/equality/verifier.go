@@ -0,0 +1,52 @@
+package equality
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+)
+
+var (
+	embeddedVKCache groth16.VerifyingKey
+	embeddedVKOnce  sync.Once
+	embeddedVKErr   error
+)
+
+// getEmbeddedVK returns the deserialized embedded VK (cached)
+func getEmbeddedVK() (groth16.VerifyingKey, error) {
+	embeddedVKOnce.Do(func() {
+		embeddedVKCache = groth16.NewVerifyingKey(ecc.BN254)
+		if _, err := embeddedVKCache.ReadFrom(bytes.NewReader(EmbeddedVK)); err != nil {
+			embeddedVKErr = fmt.Errorf("failed to deserialize embedded VK: %w", err)
+		}
+	})
+	return embeddedVKCache, embeddedVKErr
+}
+
+// VerifyWithEmbeddedVK verifies that COld and CNew commit to the same r2
+// under ctxHashOld and ctxHashNew, using ONLY the embedded VK
+func VerifyWithEmbeddedVK(proofBytes, ctxHashOld, cOld, ctxHashNew, cNew []byte) error {
+	vk, err := getEmbeddedVK()
+	if err != nil {
+		return err
+	}
+
+	pubWitness, err := frontend.NewWitness(publicWitness(ctxHashOld, cOld, ctxHashNew, cNew), ecc.BN254.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return fmt.Errorf("public witness creation failed: %w", err)
+	}
+
+	proof := groth16.NewProof(ecc.BN254)
+	if _, err := proof.ReadFrom(bytes.NewReader(proofBytes)); err != nil {
+		return fmt.Errorf("proof deserialization failed: %w", err)
+	}
+
+	if err := groth16.Verify(proof, vk, pubWitness); err != nil {
+		return fmt.Errorf("proof verification failed: %w", err)
+	}
+	return nil
+}
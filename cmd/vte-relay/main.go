@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"vte-tlock/internal/flagutil"
+	"vte-tlock/pkg/relay"
+	"vte-tlock/pkg/vte"
+)
+
+// vte-relay serves the drand HTTP API from upstream endpoints, verifying and
+// caching every beacon. Point DrandEndpoints (or the web app) at it.
+// Run: go run ./cmd/vte-relay -listen :8080 -cache-db beacons.db
+func main() {
+	os.Exit(run())
+}
+
+// run returns the exit code, so the beacon cache is closed before main exits
+func run() int {
+	listen := flag.String("listen", ":8080", "address to listen on")
+	upstreams := flag.String("upstream", "", "comma-separated drand endpoints (default: quicknet endpoints from the network registry)")
+	network := flag.String("network", "quicknet", "registered network served by the unprefixed /info and /public routes (empty: none)")
+	cacheDir := flag.String("cache-dir", "", "directory for a file beacon cache")
+	cacheDB := flag.String("cache-db", "", "path of a bbolt beacon cache (takes precedence over -cache-dir)")
+	cacheSize := flag.Int("cache-size", vte.DefaultMemoryBeacons, "beacons kept by the in-memory cache used without -cache-dir or -cache-db")
+	rate := flag.Float64("rate", 10, "requests per second per client (0 disables rate limiting)")
+	burst := flag.Int("burst", 20, "request burst per client")
+	origins := flag.String("cors-origins", "*", "comma-separated allowed CORS origins")
+	trustProxy := flag.Bool("trust-proxy", false, "identify clients by X-Forwarded-For (only behind a proxy)")
+	flag.Parse()
+
+	cfg := relay.Config{
+		Upstreams:         flagutil.SplitList(*upstreams),
+		RateLimit:         *rate,
+		Burst:             *burst,
+		AllowedOrigins:    flagutil.SplitList(*origins),
+		TrustForwardedFor: *trustProxy,
+		CacheSize:         *cacheSize,
+	}
+
+	if *network != "" {
+		n, err := vte.Networks.Lookup(*network)
+		if err != nil {
+			log.Printf("Unknown network: %v", err)
+			return 2
+		}
+		cfg.DefaultChain = fmt.Sprintf("%x", n.ChainHash)
+		if len(cfg.Upstreams) == 0 {
+			cfg.Upstreams = n.Endpoints
+		}
+	}
+
+	switch {
+	case *cacheDB != "":
+		store, err := vte.OpenBoltBeaconStore(*cacheDB)
+		if err != nil {
+			log.Printf("Failed to open cache: %v", err)
+			return 1
+		}
+		cfg.Cache = vte.NewBeaconCache(store)
+		defer cfg.Cache.Close()
+	case *cacheDir != "":
+		store, err := vte.NewFileBeaconStore(*cacheDir)
+		if err != nil {
+			log.Printf("Failed to open cache: %v", err)
+			return 1
+		}
+		cfg.Cache = vte.NewBeaconCache(store)
+	}
+
+	server, err := relay.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 2
+	}
+
+	httpServer := &http.Server{
+		Addr:              *listen,
+		Handler:           server,
+		ReadHeaderTimeout: 10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+	}
+	log.Printf("vte-relay listening on %s, upstreams %s", *listen, strings.Join(cfg.Upstreams, ", "))
+	if err := httpServer.ListenAndServe(); err != nil {
+		log.Printf("Server failed: %v", err)
+		return 1
+	}
+	return 0
+}
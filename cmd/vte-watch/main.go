@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"vte-tlock/internal/flagutil"
+	"vte-tlock/pkg/vte"
+	"vte-tlock/pkg/watch"
+)
+
+// vte-watch opens every package in a directory as soon as its drand round is
+// reached and delivers r2 to the configured sinks. State survives restarts.
+// Run: go run ./cmd/vte-watch -dir packages -stdout -webhook https://example.com/hook
+func main() {
+	os.Exit(run())
+}
+
+// run returns the exit code, so deferred cleanup such as closing the beacon
+// cache runs before main exits
+func run() int {
+	dir := flag.String("dir", "", "directory of VTE package files (*.json)")
+	endpoints := flag.String("endpoints", "", "comma-separated drand endpoints (default: the registry endpoints of each package's chain)")
+	stateFile := flag.String("state", "", "state file (default: <dir>/.vte-watch-state.json)")
+	outDir := flag.String("out", "", "write each result to <out>/<ctx_hash>.json")
+	stdout := flag.Bool("stdout", false, "print each result as a JSON line on stdout")
+	webhook := flag.String("webhook", "", "POST each result as JSON to this URL")
+	secretEnv := flag.String("webhook-secret-env", "VTE_WATCH_WEBHOOK_SECRET", "environment variable holding the webhook HMAC secret")
+	cacheDB := flag.String("cache-db", "", "path of a bbolt beacon cache")
+	poll := flag.Duration("poll", 10*time.Second, "directory rescan interval")
+	retry := flag.Duration("retry", 5*time.Second, "first retry delay, doubled per consecutive failure")
+	maxRetry := flag.Duration("max-retry", 10*time.Minute, "longest retry delay")
+	maxAttempts := flag.Int("max-attempts", 0, "give up on a package after this many consecutive failures (0: never)")
+	once := flag.Bool("once", false, "process due packages once and exit")
+	flag.Parse()
+
+	if *dir == "" {
+		fmt.Fprintln(os.Stderr, "-dir is required")
+		return 2
+	}
+
+	var sinks []watch.Sink
+	if *outDir != "" {
+		if same, _ := filepath.Rel(*dir, *outDir); same == "." {
+			fmt.Fprintln(os.Stderr, "-out must not be the watched directory")
+			return 2
+		}
+		sinks = append(sinks, &watch.FileSink{Dir: *outDir})
+	}
+	if *stdout {
+		sinks = append(sinks, watch.NewStdoutSink())
+	}
+	if *webhook != "" {
+		sinks = append(sinks, &watch.WebhookSink{URL: *webhook, Secret: []byte(os.Getenv(*secretEnv))})
+	}
+
+	var cache *vte.BeaconCache
+	if *cacheDB != "" {
+		store, err := vte.OpenBoltBeaconStore(*cacheDB)
+		if err != nil {
+			log.Printf("Failed to open cache: %v", err)
+			return 1
+		}
+		cache = vte.NewBeaconCache(store)
+		defer cache.Close()
+	}
+
+	w, err := watch.New(watch.Config{
+		Dir:              *dir,
+		Endpoints:        flagutil.SplitList(*endpoints),
+		Cache:            cache,
+		Sinks:            sinks,
+		StatePath:        *stateFile,
+		PollInterval:     *poll,
+		RetryInterval:    *retry,
+		MaxRetryInterval: *maxRetry,
+		MaxAttempts:      *maxAttempts,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration: %v\n", err)
+		return 2
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *once {
+		err = w.RunOnce(ctx)
+	} else {
+		log.Printf("vte-watch watching %s", *dir)
+		if err = w.Run(ctx); err == context.Canceled {
+			err = nil
+		}
+	}
+	if err != nil {
+		log.Printf("vte-watch failed: %v", err)
+		return 1
+	}
+	return 0
+}
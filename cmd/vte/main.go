@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+
+	"github.com/drand/tlock"
+
+	"vte-tlock/pkg/vte"
+)
+
+// vte generates, verifies, inspects and opens VTE packages without the
+// browser. Packages are read from a file or stdin ("-") and written to a file
+// or stdout. The exit code tells scripts what kind of failure happened.
+// Run: go run ./cmd/vte generate -network quicknet -at 1h -plaintext secret > pkg.json
+//
+//	go run ./cmd/vte verify -in pkg.json -session swap-1
+//	go run ./cmd/vte decrypt -in pkg.json
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// Exit codes, by failure class
+const (
+	exitOK           = 0
+	exitFailure      = 1 // anything not covered below
+	exitUsage        = 2 // bad command line
+	exitInvalidInput = 3 // malformed package, hex, round or time
+	exitVerification = 4 // the package failed a binding, proof or policy check
+	exitTooEarly     = 5 // the drand round is not out yet
+	exitNetwork      = 6 // no drand endpoint answered, or one served bad data
+)
+
+// errUsage marks command line mistakes
+var errUsage = errors.New("usage")
+
+type command struct {
+	name    string
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+var commands = []command{
+	{"generate", "encrypt r2 to a drand round and write the package", (*cli).generate},
+	{"verify", "check a package's bindings and proofs and print the report", (*cli).verify},
+	{"decrypt", "open a package once its round is out and print r2", (*cli).decrypt},
+	{"inspect", "summarize a package", (*cli).inspect},
+	{"ctxhash", "compute a context hash from fields or recompute a package's", (*cli).ctxhash},
+	{"round", "convert between times and drand rounds", (*cli).round},
+}
+
+// cli carries the streams and context of one invocation
+type cli struct {
+	ctx    context.Context
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	c := &cli{ctx: ctx, stdin: stdin, stdout: stdout, stderr: stderr}
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		c.usage()
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	i := slices.IndexFunc(commands, func(cmd command) bool { return cmd.name == args[0] })
+	if i < 0 {
+		fmt.Fprintf(stderr, "vte: unknown command %q\n", args[0])
+		c.usage()
+		return exitUsage
+	}
+	err := commands[i].run(c, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if err != nil {
+		code := exitCode(err)
+		if code == exitUsage {
+			fmt.Fprintf(stderr, "vte %s: %v\n", args[0], err)
+		} else {
+			fmt.Fprintf(stderr, "vte %s: %s: %v\n", args[0], vte.ErrorClass(err), err)
+		}
+		return code
+	}
+	return exitOK
+}
+
+func (c *cli) usage() {
+	fmt.Fprintln(c.stderr, "usage: vte <command> [flags]")
+	fmt.Fprintln(c.stderr)
+	for _, cmd := range commands {
+		fmt.Fprintf(c.stderr, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, "Run vte <command> -h for its flags.")
+}
+
+// exitCode maps an error to its exit code
+func exitCode(err error) int {
+	var endpoints *vte.EndpointsError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, tlock.ErrTooEarly):
+		return exitTooEarly
+	}
+
+	switch vte.ErrorClass(err) {
+	case "error_invalid_input", "error_round_out_of_range":
+		return exitInvalidInput
+	case "error_chain_info_mismatch", "error_beacon_invalid":
+		return exitNetwork
+	case "error_other":
+		if errors.As(err, &endpoints) {
+			return exitNetwork
+		}
+		return exitFailure
+	default:
+		return exitVerification
+	}
+}
+
+// flags returns a flag set whose errors are returned, not printed and exited on
+func (c *cli) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("vte "+name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	return fs
+}
+
+// parse parses args and rejects positional arguments
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%w: unexpected argument %q", errUsage, fs.Arg(0))
+	}
+	return nil
+}
+
+// readPackage reads a package from path, or stdin for "-"
+func (c *cli) readPackage(path string) (*vte.VTEPackageV2, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(c.stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read package: %w", err)
+	}
+	var pkg vte.VTEPackageV2
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("%w: not a VTE package: %v", vte.ErrInvalidInput, err)
+	}
+	return &pkg, nil
+}
+
+// writeJSON writes v as indented JSON to path, or stdout for "-"
+func (c *cli) writeJSON(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = c.stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/crypto"
+
+	"vte-tlock/internal/drandtest"
+	"vte-tlock/pkg/drandsim"
+	"vte-tlock/pkg/vte"
+)
+
+// vteRun runs the CLI with stdin and returns its exit code and stdout
+func vteRun(t *testing.T, stdin string, args ...string) (int, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	if stderr.Len() > 0 {
+		t.Logf("vte %s: %s", strings.Join(args, " "), stderr.String())
+	}
+	return code, stdout.String()
+}
+
+func TestCLI(t *testing.T) {
+	saved := vte.Beacons
+	vte.Beacons = vte.NewBeaconCache(vte.NewMemoryBeaconStore())
+	t.Cleanup(func() { vte.Beacons = saved })
+
+	network, clock, server := drandtest.Start(t, drandsim.Config{Scheme: crypto.SigsOnG1ID, Seed: []byte("cli")})
+	clock.Advance(time.Hour)
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+
+	chain := network.ChainHash()
+	round := strconv.FormatUint(network.LatestRound()+2, 10)
+	pkgPath := filepath.Join(t.TempDir(), "pkg.json")
+	r2 := vte.PlaintextToR2("cli secret")
+
+	code, _ := vteRun(t, "", "generate", "-network", chain, "-endpoints", server.URL, "-round", round,
+		"-r2", hex.EncodeToString(r2), "-session", "cli", "-o", pkgPath)
+	if code != exitOK {
+		t.Fatalf("generate exited %d", code)
+	}
+
+	code, out := vteRun(t, "", "verify", "-in", pkgPath, "-session", "other")
+	var report vte.VerificationReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil || code != exitVerification {
+		t.Fatalf("verify printed %q, exit %d", out, code)
+	}
+	if c := report.Check(vte.CheckPolicy); report.ErrorClass != "error_session_mismatch" || c.Status != vte.CheckFail {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+
+	policyPath := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(policyPath, []byte("require:\n  tle: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		stdin string
+		args  []string
+		code  int
+	}{
+		{"verify", "", []string{"verify", "-in", pkgPath, "-network", chain, "-round", round, "-session", "cli"}, exitOK},
+		{"verify session", "", []string{"verify", "-in", pkgPath, "-session", "other"}, exitVerification},
+		{"verify policy", "", []string{"verify", "-in", pkgPath, "-policy", policyPath}, exitVerification},
+		{"verify garbage", "not json", []string{"verify"}, exitInvalidInput},
+		{"ctxhash", "", []string{"ctxhash", "-in", pkgPath}, exitOK},
+		{"ctxhash field", "", []string{"ctxhash", "-network", chain, "-round", round, "-capsule-hash", strings.Repeat("00", 32), "-field", "amount:amount=5"}, exitOK},
+		{"ctxhash bad field", "", []string{"ctxhash", "-network", chain, "-round", round, "-capsule-hash", strings.Repeat("00", 32), "-field", "amount:amount=five"}, exitUsage},
+		{"inspect", "", []string{"inspect", "-in", pkgPath}, exitOK},
+		{"too early", "", []string{"decrypt", "-in", pkgPath, "-endpoints", server.URL}, exitTooEarly},
+		{"no round", "", []string{"generate", "-plaintext", "x"}, exitUsage},
+		{"unknown", "", []string{"sign"}, exitUsage},
+	} {
+		if code, _ := vteRun(t, tc.stdin, tc.args...); code != tc.code {
+			t.Errorf("%s: exit code %d, want %d", tc.name, code, tc.code)
+		}
+	}
+
+	clock.Advance(3 * network.Info().Period)
+	if code, _ := vteRun(t, "", "decrypt", "-in", pkgPath, "-endpoints", dead.URL); code != exitNetwork {
+		t.Errorf("decrypt from a dead endpoint exited %d, want %d", code, exitNetwork)
+	}
+	code, out = vteRun(t, "", "decrypt", "-in", pkgPath, "-endpoints", server.URL)
+	if code != exitOK {
+		t.Fatalf("decrypt exited %d", code)
+	}
+	var result decryptOutput
+	if err := json.Unmarshal([]byte(out), &result); err != nil || result.R2 != hex.EncodeToString(r2) {
+		t.Fatalf("decrypt printed %q (%v)", out, err)
+	}
+
+	code, out = vteRun(t, "", "inspect", "-in", pkgPath, "-json")
+	var s summary
+	if err := json.Unmarshal([]byte(out), &s); err != nil || code != exitOK {
+		t.Fatalf("inspect -json printed %q (%v)", out, err)
+	}
+	if s.Binding != "success" || s.CtxHash != result.CtxHash || s.Capsules[0].ChainHash != chain {
+		t.Fatalf("Unexpected summary %+v", s)
+	}
+}
+
+func TestRound(t *testing.T) {
+	info, err := vte.LookupNetworkInfo("quicknet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Unix(info.GenesisTime+3*info.Period, 0).UTC()
+	code, out := vteRun(t, "", "round", "-at", at.Format(time.RFC3339))
+	if code != exitOK || strings.TrimSpace(out) != "4" {
+		t.Fatalf("round -at printed %q, exit %d", out, code)
+	}
+	// A second past round 4 is too late for it: the first round due after is 5
+	code, out = vteRun(t, "", "round", "-at", at.Add(time.Second).Format(time.RFC3339))
+	if code != exitOK || strings.TrimSpace(out) != "5" {
+		t.Fatalf("round -at one second later printed %q, exit %d", out, code)
+	}
+	code, out = vteRun(t, "", "round", "-round", "4")
+	if code != exitOK || strings.TrimSpace(out) != at.Format(time.RFC3339) {
+		t.Fatalf("round -round printed %q, exit %d", out, code)
+	}
+}
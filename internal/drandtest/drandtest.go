@@ -0,0 +1,41 @@
+// Package drandtest starts simulated drand networks (see package drandsim) for
+// tests
+package drandtest
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"vte-tlock/pkg/drandsim"
+)
+
+// Genesis is where the clock of a network made without one starts, and so
+// its genesis time
+var Genesis = time.Unix(1692803367, 0)
+
+// Network makes a simulated network. Without cfg.Clock it runs on a new
+// ManualClock at Genesis, which is returned; a ManualClock passed in is
+// returned as is, to share one between networks.
+func Network(t testing.TB, cfg drandsim.Config) (*drandsim.Network, *drandsim.ManualClock) {
+	t.Helper()
+	if cfg.Clock == nil {
+		cfg.Clock = drandsim.NewManualClock(Genesis)
+	}
+	clock, _ := cfg.Clock.(*drandsim.ManualClock)
+	network, err := drandsim.New(cfg)
+	if err != nil {
+		t.Fatalf("drandsim.New failed: %v", err)
+	}
+	return network, clock
+}
+
+// Start makes a network like Network and serves its drand HTTP API until the
+// test ends
+func Start(t testing.TB, cfg drandsim.Config) (*drandsim.Network, *drandsim.ManualClock, *httptest.Server) {
+	t.Helper()
+	network, clock := Network(t, cfg)
+	server := network.NewServer()
+	t.Cleanup(server.Close)
+	return network, clock, server
+}
@@ -0,0 +1,15 @@
+// Package flagutil holds flag parsing helpers shared by the commands
+package flagutil
+
+import "strings"
+
+// SplitList splits a comma-separated flag value, dropping empty items
+func SplitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+// Package adaptor implements adaptor signatures over secp256k1 keyed to the
+// lockpoint of a VTE package, R2 = r2·G.
+//
+// A pre-signature is a signature that only becomes valid once it is
+// completed with r2. Whoever sees both the pre-signature and the completed
+// signature on chain learns r2. In a swap, each side pre-signs its payment
+// with R2: opening the VTE package (or one side publishing) gives the other
+// side what it needs to complete its own payment.
+package adaptor
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+var (
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrInvalidPreSignature = errors.New("invalid adaptor pre-signature")
+	ErrInvalidSignature    = errors.New("invalid signature")
+	ErrSecretMismatch      = errors.New("secret does not match the adaptor point")
+)
+
+// Scheme is an adaptor signature scheme. Adaptor points are SEC1 compressed
+// (as in R2Info.Value) and secrets are 32-byte scalars (as in
+// DecryptResult.R2). Messages are 32-byte hashes. Pre-signatures are opaque
+// to callers; signatures are in the chain's native encoding.
+type Scheme interface {
+	// Name identifies the scheme in swap messages
+	Name() string
+
+	// PreSign pre-signs msg under key for the adaptor point
+	PreSign(key *btcec.PrivateKey, msg, adaptor []byte) ([]byte, error)
+
+	// VerifyPreSignature checks that preSig completes, with the discrete
+	// log of adaptor, to a signature of msg under pub
+	VerifyPreSignature(pub *btcec.PublicKey, msg, adaptor, preSig []byte) error
+
+	// Complete turns a pre-signature into a signature with the secret
+	Complete(preSig, secret []byte) ([]byte, error)
+
+	// Extract recovers the secret from a pre-signature and the signature
+	// completed from it
+	Extract(preSig, sig, adaptor []byte) ([]byte, error)
+
+	// Verify checks a completed signature the way the chain does
+	Verify(pub *btcec.PublicKey, msg, sig []byte) error
+}
+
+// parsePoint parses a compressed adaptor point
+func parsePoint(b []byte) (*btcec.JacobianPoint, error) {
+	if len(b) != 33 {
+		return nil, fmt.Errorf("%w: adaptor point must be 33 bytes compressed", ErrInvalidInput)
+	}
+	pub, err := btcec.ParsePubKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: adaptor point: %v", ErrInvalidInput, err)
+	}
+	var p btcec.JacobianPoint
+	pub.AsJacobian(&p)
+	return &p, nil
+}
+
+// parseSecret parses a secret scalar, reduced mod n like
+// btcec.PrivKeyFromBytes (and so ComputeR2Point)
+func parseSecret(b []byte) (*btcec.ModNScalar, error) {
+	if len(b) != 32 {
+		return nil, fmt.Errorf("%w: secret must be 32 bytes", ErrInvalidInput)
+	}
+	var t btcec.ModNScalar
+	t.SetByteSlice(b)
+	if t.IsZero() {
+		return nil, fmt.Errorf("%w: secret is zero", ErrInvalidInput)
+	}
+	return &t, nil
+}
+
+// parseScalar parses a scalar that must be below n
+func parseScalar(b []byte) (*btcec.ModNScalar, bool) {
+	var s btcec.ModNScalar
+	if len(b) != 32 || s.SetByteSlice(b) {
+		return nil, false
+	}
+	return &s, true
+}
+
+func checkMsg(msg []byte) error {
+	if len(msg) != 32 {
+		return fmt.Errorf("%w: message must be a 32-byte hash", ErrInvalidInput)
+	}
+	return nil
+}
+
+// basePoint returns s·G
+func basePoint(s *btcec.ModNScalar) *btcec.JacobianPoint {
+	var p btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(s, &p)
+	return &p
+}
+
+// add returns a + b in affine coordinates
+func add(a, b *btcec.JacobianPoint) *btcec.JacobianPoint {
+	var sum btcec.JacobianPoint
+	btcec.AddNonConst(a, b, &sum)
+	sum.ToAffine()
+	return &sum
+}
+
+// equal compares two points by their affine coordinates
+func equal(a, b *btcec.JacobianPoint) bool {
+	a.ToAffine()
+	b.ToAffine()
+	return a.X.Equals(&b.X) && a.Y.Equals(&b.Y) && a.Z.Equals(&b.Z)
+}
+
+func isInfinity(p *btcec.JacobianPoint) bool {
+	return (p.X.IsZero() && p.Y.IsZero()) || p.Z.IsZero()
+}
+
+// compress serializes a point SEC1 compressed
+func compress(p *btcec.JacobianPoint) []byte {
+	p.ToAffine()
+	return btcec.NewPublicKey(&p.X, &p.Y).SerializeCompressed()
+}
+
+func scalarBytes(s *btcec.ModNScalar) []byte {
+	b := s.Bytes()
+	return b[:]
+}
+
+func randBytes(r io.Reader, n int) ([]byte, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("read randomness: %w", err)
+	}
+	return b, nil
+}
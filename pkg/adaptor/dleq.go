@@ -0,0 +1,72 @@
+package adaptor
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+var (
+	tagDLEQNonce     = []byte("VTE/adaptor/dleq/nonce")
+	tagDLEQChallenge = []byte("VTE/adaptor/dleq/challenge")
+)
+
+// dleqSize is the size of an encoded DLEQ proof: c || z
+const dleqSize = 64
+
+// proveDLEQ proves that A = k·G and B = k·Y share the discrete log k, as a
+// Fiat-Shamir Chaum-Pedersen proof (c, z): Q1 = q·G, Q2 = q·Y,
+// c = H(Y || A || B || Q1 || Q2), z = q + c·k
+func proveDLEQ(k *btcec.ModNScalar, Y, A, B *btcec.JacobianPoint, r io.Reader) ([]byte, error) {
+	for {
+		aux, err := randBytes(r, 32)
+		if err != nil {
+			return nil, err
+		}
+		var q btcec.ModNScalar
+		q.SetByteSlice(chainhash.TaggedHash(tagDLEQNonce, scalarBytes(k), compress(Y), aux)[:])
+		if q.IsZero() {
+			continue
+		}
+		var Q2 btcec.JacobianPoint
+		btcec.ScalarMultNonConst(&q, Y, &Q2)
+		c := dleqChallenge(Y, A, B, basePoint(&q), &Q2)
+		z := new(btcec.ModNScalar).Mul2(c, k).Add(&q)
+		q.Zero()
+		return append(scalarBytes(c), scalarBytes(z)...), nil
+	}
+}
+
+// verifyDLEQ checks a proveDLEQ proof: Q1 = z·G - c·A, Q2 = z·Y - c·B and
+// c must hash back from them
+func verifyDLEQ(proof []byte, Y, A, B *btcec.JacobianPoint) error {
+	if len(proof) != dleqSize {
+		return fmt.Errorf("%w: DLEQ proof must be %d bytes", ErrInvalidPreSignature, dleqSize)
+	}
+	c, okC := parseScalar(proof[:32])
+	z, okZ := parseScalar(proof[32:])
+	if !okC || !okZ {
+		return fmt.Errorf("%w: DLEQ scalar not below the group order", ErrInvalidPreSignature)
+	}
+	negC := new(btcec.ModNScalar).Set(c).Negate()
+
+	var cA, zY, cB btcec.JacobianPoint
+	btcec.ScalarMultNonConst(negC, A, &cA)
+	Q1 := add(basePoint(z), &cA)
+	btcec.ScalarMultNonConst(z, Y, &zY)
+	btcec.ScalarMultNonConst(negC, B, &cB)
+	Q2 := add(&zY, &cB)
+
+	if !dleqChallenge(Y, A, B, Q1, Q2).Equals(c) {
+		return fmt.Errorf("%w: DLEQ proof does not verify", ErrInvalidPreSignature)
+	}
+	return nil
+}
+
+func dleqChallenge(Y, A, B, Q1, Q2 *btcec.JacobianPoint) *btcec.ModNScalar {
+	var c btcec.ModNScalar
+	c.SetByteSlice(chainhash.TaggedHash(tagDLEQChallenge, compress(Y), compress(A), compress(B), compress(Q1), compress(Q2))[:])
+	return &c
+}
@@ -0,0 +1,228 @@
+package adaptor
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// ECDSAScheme identifies ECDSA adaptor signatures
+const ECDSAScheme = "ecdsa_adaptor"
+
+var tagECDSANonce = []byte("VTE/adaptor/ecdsa/nonce")
+
+// ecdsaPreSigSize is R || R' || s' || DLEQ proof
+const ecdsaPreSigSize = 33 + 33 + 32 + dleqSize
+
+// ECDSA is an ECDSA adaptor signature scheme for chains without Schnorr.
+// A pre-signature is (R, R', s', π) with R' = k·G, R = k·Y for the adaptor
+// point Y, r = R.x mod n and s' = k⁻¹(m + r·x). The DLEQ proof π shows R and
+// R' share k, which ECDSA needs since r comes from R but s' only checks
+// against R' = s'⁻¹(m·G + r·P). Completing with y gives the signature
+// (r, s'·y⁻¹), low-s normalized; s'·s⁻¹ = ±y gives y back.
+//
+// Pre-signatures are 162 bytes: R || R' compressed || s' || π. Signatures
+// are DER encoded.
+type ECDSA struct {
+	// Rand supplies the auxiliary nonce randomness. Nil uses crypto/rand.
+	Rand io.Reader
+}
+
+var _ Scheme = ECDSA{}
+
+func (ECDSA) Name() string { return ECDSAScheme }
+
+func (a ECDSA) PreSign(key *btcec.PrivateKey, msg, adaptor []byte) ([]byte, error) {
+	if err := checkMsg(msg); err != nil {
+		return nil, err
+	}
+	Y, err := parsePoint(adaptor)
+	if err != nil {
+		return nil, err
+	}
+	m := messageScalar(msg)
+
+	for {
+		aux, err := randBytes(a.Rand, 32)
+		if err != nil {
+			return nil, err
+		}
+		var k btcec.ModNScalar
+		k.SetByteSlice(chainhash.TaggedHash(tagECDSANonce, scalarBytes(&key.Key), adaptor, msg, aux)[:])
+		if k.IsZero() {
+			continue
+		}
+		var R btcec.JacobianPoint
+		btcec.ScalarMultNonConst(&k, Y, &R)
+		R.ToAffine()
+		r := xScalar(&R)
+		if r.IsZero() {
+			continue
+		}
+
+		// s' = k⁻¹(m + r·x)
+		s := new(btcec.ModNScalar).Mul2(r, &key.Key).Add(m)
+		s.Mul(new(btcec.ModNScalar).InverseValNonConst(&k))
+		if s.IsZero() {
+			continue
+		}
+
+		Rp := basePoint(&k)
+		proof, err := proveDLEQ(&k, Y, Rp, &R, a.Rand)
+		k.Zero()
+		if err != nil {
+			return nil, err
+		}
+		preSig := append(compress(&R), compress(Rp)...)
+		preSig = append(preSig, scalarBytes(s)...)
+		return append(preSig, proof...), nil
+	}
+}
+
+func (ECDSA) VerifyPreSignature(pub *btcec.PublicKey, msg, adaptor, preSig []byte) error {
+	if err := checkMsg(msg); err != nil {
+		return err
+	}
+	Y, err := parsePoint(adaptor)
+	if err != nil {
+		return err
+	}
+	p, err := parseECDSAPreSig(preSig)
+	if err != nil {
+		return err
+	}
+	if err := verifyDLEQ(p.proof, Y, p.Rp, p.R); err != nil {
+		return err
+	}
+
+	// R' == s'⁻¹(m·G + r·P)
+	r := xScalar(p.R)
+	if r.IsZero() {
+		return fmt.Errorf("%w: r is zero", ErrInvalidPreSignature)
+	}
+	sInv := new(btcec.ModNScalar).InverseValNonConst(p.s)
+	u1 := new(btcec.ModNScalar).Mul2(messageScalar(msg), sInv)
+	u2 := new(btcec.ModNScalar).Mul2(r, sInv)
+	var P, u2P btcec.JacobianPoint
+	pub.AsJacobian(&P)
+	btcec.ScalarMultNonConst(u2, &P, &u2P)
+	if !equal(add(basePoint(u1), &u2P), p.Rp) {
+		return fmt.Errorf("%w: s'·R' != m·G + r·P", ErrInvalidPreSignature)
+	}
+	return nil
+}
+
+// Complete returns the DER signature (r, s'·y⁻¹)
+func (ECDSA) Complete(preSig, secret []byte) ([]byte, error) {
+	p, err := parseECDSAPreSig(preSig)
+	if err != nil {
+		return nil, err
+	}
+	y, err := parseSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	// R = k·Y = y·R' only for the right secret
+	var yRp btcec.JacobianPoint
+	btcec.ScalarMultNonConst(y, p.Rp, &yRp)
+	if !equal(&yRp, p.R) {
+		return nil, fmt.Errorf("%w: the pre-signature is not for this secret", ErrSecretMismatch)
+	}
+
+	s := new(btcec.ModNScalar).InverseValNonConst(y).Mul(p.s)
+	if s.IsOverHalfOrder() {
+		s.Negate()
+	}
+	return ecdsa.NewSignature(xScalar(p.R), s).Serialize(), nil
+}
+
+// Extract returns y = ±s'·s⁻¹, the sign picked by y·G being the adaptor point
+func (ECDSA) Extract(preSig, sig, adaptor []byte) ([]byte, error) {
+	Y, err := parsePoint(adaptor)
+	if err != nil {
+		return nil, err
+	}
+	p, err := parseECDSAPreSig(preSig)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := ecdsa.ParseDERSignature(sig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	r, s := parsed.R(), parsed.S()
+	if !r.Equals(xScalar(p.R)) {
+		return nil, fmt.Errorf("%w: signature r does not match the pre-signature", ErrInvalidSignature)
+	}
+
+	y := new(btcec.ModNScalar).InverseValNonConst(&s).Mul(p.s)
+	if equal(basePoint(y), Y) {
+		return scalarBytes(y), nil
+	}
+	if y.Negate(); equal(basePoint(y), Y) {
+		return scalarBytes(y), nil
+	}
+	return nil, ErrSecretMismatch
+}
+
+// Verify checks a DER ECDSA signature, rejecting high s as Bitcoin does
+func (ECDSA) Verify(pub *btcec.PublicKey, msg, sig []byte) error {
+	if err := checkMsg(msg); err != nil {
+		return err
+	}
+	parsed, err := ecdsa.ParseDERSignature(sig)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if s := parsed.S(); s.IsOverHalfOrder() {
+		return fmt.Errorf("%w: high s", ErrInvalidSignature)
+	}
+	if !parsed.Verify(msg, pub) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+type ecdsaPreSig struct {
+	R, Rp *btcec.JacobianPoint
+	s     *btcec.ModNScalar
+	proof []byte
+}
+
+func parseECDSAPreSig(preSig []byte) (*ecdsaPreSig, error) {
+	if len(preSig) != ecdsaPreSigSize {
+		return nil, fmt.Errorf("%w: want %d bytes, got %d", ErrInvalidPreSignature, ecdsaPreSigSize, len(preSig))
+	}
+	R, err := parsePoint(preSig[:33])
+	if err != nil {
+		return nil, fmt.Errorf("%w: R: %v", ErrInvalidPreSignature, err)
+	}
+	Rp, err := parsePoint(preSig[33:66])
+	if err != nil {
+		return nil, fmt.Errorf("%w: R': %v", ErrInvalidPreSignature, err)
+	}
+	s, ok := parseScalar(preSig[66:98])
+	if !ok || s.IsZero() {
+		return nil, fmt.Errorf("%w: s' must be in [1, n)", ErrInvalidPreSignature)
+	}
+	return &ecdsaPreSig{R: R, Rp: Rp, s: s, proof: preSig[98:]}, nil
+}
+
+// messageScalar is the ECDSA message scalar of a 32-byte hash
+func messageScalar(msg []byte) *btcec.ModNScalar {
+	var m btcec.ModNScalar
+	m.SetByteSlice(msg)
+	return &m
+}
+
+// xScalar returns the x coordinate of an affine point reduced mod n
+func xScalar(p *btcec.JacobianPoint) *btcec.ModNScalar {
+	p.ToAffine()
+	x := p.X.Bytes()
+	var r btcec.ModNScalar
+	r.SetByteSlice(x[:])
+	return &r
+}
@@ -0,0 +1,97 @@
+package adaptor
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+)
+
+func TestECDSAAdaptor(t *testing.T) {
+	scheme := ECDSA{}
+	msg := sha256.Sum256([]byte("spend"))
+	for i, key := range testKeys(t, 8) {
+		secret, point := testAdaptor(string(rune('a' + i)))
+		pub := key.PubKey()
+
+		preSig, err := scheme.PreSign(key, msg[:], point)
+		if err != nil {
+			t.Fatalf("PreSign failed: %v", err)
+		}
+		if err := scheme.VerifyPreSignature(pub, msg[:], point, preSig); err != nil {
+			t.Fatalf("Key %d: VerifyPreSignature failed: %v", i, err)
+		}
+
+		sig, err := scheme.Complete(preSig, secret)
+		if err != nil {
+			t.Fatalf("Complete failed: %v", err)
+		}
+		// Check against the plain ECDSA verifier
+		parsed, err := ecdsa.ParseDERSignature(sig)
+		if err != nil || !parsed.Verify(msg[:], pub) {
+			t.Fatalf("Key %d: completed signature fails ECDSA verification (%v)", i, err)
+		}
+		if s := parsed.S(); s.IsOverHalfOrder() {
+			t.Fatalf("Key %d: completed signature has a high s", i)
+		}
+
+		extracted, err := scheme.Extract(preSig, sig, point)
+		if err != nil {
+			t.Fatalf("Extract failed: %v", err)
+		}
+		if !bytes.Equal(extracted, secret) {
+			t.Fatalf("Key %d: extracted %x, want %x", i, extracted, secret)
+		}
+	}
+}
+
+func TestECDSAAdaptorRejects(t *testing.T) {
+	scheme := ECDSA{}
+	keys := testKeys(t, 2)
+	key, other := keys[0], keys[1]
+	msg := sha256.Sum256([]byte("spend"))
+	otherMsg := sha256.Sum256([]byte("other"))
+	secret, point := testAdaptor("secret")
+	otherSecret, otherPoint := testAdaptor("other secret")
+
+	preSig, err := scheme.PreSign(key, msg[:], point)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tamper := func(i int) []byte {
+		b := append([]byte{}, preSig...)
+		b[i] ^= 1
+		return b
+	}
+	// R replaced by another point on the curve: only the DLEQ proof catches it
+	swapped := append([]byte{}, preSig...)
+	copy(swapped[:33], otherPoint)
+
+	for name, err := range map[string]error{
+		"other key":     scheme.VerifyPreSignature(other.PubKey(), msg[:], point, preSig),
+		"other message": scheme.VerifyPreSignature(key.PubKey(), otherMsg[:], point, preSig),
+		"other adaptor": scheme.VerifyPreSignature(key.PubKey(), msg[:], otherPoint, preSig),
+		"swapped R":     scheme.VerifyPreSignature(key.PubKey(), msg[:], point, swapped),
+		"tampered s'":   scheme.VerifyPreSignature(key.PubKey(), msg[:], point, tamper(97)),
+		"tampered DLEQ": scheme.VerifyPreSignature(key.PubKey(), msg[:], point, tamper(ecdsaPreSigSize-1)),
+		"short":         scheme.VerifyPreSignature(key.PubKey(), msg[:], point, preSig[:100]),
+	} {
+		if !errors.Is(err, ErrInvalidPreSignature) {
+			t.Errorf("%s: expected ErrInvalidPreSignature, got %v", name, err)
+		}
+	}
+
+	if _, err := scheme.Complete(preSig, otherSecret); !errors.Is(err, ErrSecretMismatch) {
+		t.Errorf("Complete with the wrong secret: %v", err)
+	}
+	sig, _ := scheme.Complete(preSig, secret)
+	unrelated := ecdsa.Sign(key, msg[:]).Serialize()
+	if _, err := scheme.Extract(preSig, unrelated, point); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Unrelated signature: %v", err)
+	}
+	if _, err := scheme.Extract(preSig, sig, otherPoint); !errors.Is(err, ErrSecretMismatch) {
+		t.Errorf("Wrong adaptor point: %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package adaptor
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// SchnorrScheme identifies BIP-340 adaptor signatures
+const SchnorrScheme = "bip340_adaptor"
+
+var tagSchnorrNonce = []byte("VTE/adaptor/bip340/nonce")
+
+// Schnorr is a BIP-340 adaptor signature scheme. A pre-signature is
+// (R', s') with s'·G = R' + e·P, where R = R' + T has an even y and
+// e = H_BIP0340/challenge(R.x || P.x || m). Completing with t (T = t·G) gives
+// the BIP-340 signature (R.x, s' + t); subtracting s' from its s gives t
+// back.
+//
+// Pre-signatures are 65 bytes: R' compressed || s'.
+type Schnorr struct {
+	// Rand supplies the auxiliary nonce randomness. Nil uses crypto/rand.
+	Rand io.Reader
+}
+
+var _ Scheme = Schnorr{}
+
+func (Schnorr) Name() string { return SchnorrScheme }
+
+// PreSign pre-signs msg. The nonce is derived from the key, message, adaptor
+// point and fresh randomness, and drawn again until R has an even y.
+func (a Schnorr) PreSign(key *btcec.PrivateKey, msg, adaptor []byte) ([]byte, error) {
+	if err := checkMsg(msg); err != nil {
+		return nil, err
+	}
+	T, err := parsePoint(adaptor)
+	if err != nil {
+		return nil, err
+	}
+	d, pubX := evenKey(key)
+
+	for {
+		aux, err := randBytes(a.Rand, 32)
+		if err != nil {
+			return nil, err
+		}
+		var k btcec.ModNScalar
+		k.SetByteSlice(chainhash.TaggedHash(tagSchnorrNonce, scalarBytes(d), pubX, adaptor, msg, aux)[:])
+		if k.IsZero() {
+			continue
+		}
+		Rp := basePoint(&k)
+		R := add(Rp, T)
+		if isInfinity(R) || R.Y.IsOdd() {
+			continue
+		}
+
+		e := challenge(R, pubX, msg)
+		s := new(btcec.ModNScalar).Mul2(e, d).Add(&k)
+		k.Zero()
+		return append(compress(Rp), scalarBytes(s)...), nil
+	}
+}
+
+func (Schnorr) VerifyPreSignature(pub *btcec.PublicKey, msg, adaptor, preSig []byte) error {
+	if err := checkMsg(msg); err != nil {
+		return err
+	}
+	T, err := parsePoint(adaptor)
+	if err != nil {
+		return err
+	}
+	Rp, s, err := parseSchnorrPreSig(preSig)
+	if err != nil {
+		return err
+	}
+	R := add(Rp, T)
+	if isInfinity(R) || R.Y.IsOdd() {
+		return fmt.Errorf("%w: R' + T must have an even y", ErrInvalidPreSignature)
+	}
+
+	// s'·G == R' + e·P, with P lifted to an even y as in BIP-340
+	P, pubX, err := liftX(pub)
+	if err != nil {
+		return err
+	}
+	var eP btcec.JacobianPoint
+	btcec.ScalarMultNonConst(challenge(R, pubX, msg), P, &eP)
+	if !equal(basePoint(s), add(Rp, &eP)) {
+		return fmt.Errorf("%w: s'·G != R' + e·P", ErrInvalidPreSignature)
+	}
+	return nil
+}
+
+// Complete returns the 64-byte BIP-340 signature (R.x, s' + t)
+func (Schnorr) Complete(preSig, secret []byte) ([]byte, error) {
+	Rp, s, err := parseSchnorrPreSig(preSig)
+	if err != nil {
+		return nil, err
+	}
+	t, err := parseSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	R := add(Rp, basePoint(t))
+	if isInfinity(R) || R.Y.IsOdd() {
+		return nil, fmt.Errorf("%w: the pre-signature is not for this secret", ErrSecretMismatch)
+	}
+	s.Add(t)
+	return schnorr.NewSignature(&R.X, s).Serialize(), nil
+}
+
+// Extract returns t = s - s' after checking that the signature completes
+// the pre-signature and that t·G is the adaptor point
+func (Schnorr) Extract(preSig, sig, adaptor []byte) ([]byte, error) {
+	T, err := parsePoint(adaptor)
+	if err != nil {
+		return nil, err
+	}
+	Rp, sp, err := parseSchnorrPreSig(preSig)
+	if err != nil {
+		return nil, err
+	}
+	if len(sig) != schnorr.SignatureSize {
+		return nil, fmt.Errorf("%w: BIP-340 signatures are 64 bytes", ErrInvalidSignature)
+	}
+	rx := add(Rp, T).X.Bytes()
+	if !bytes.Equal(sig[:32], rx[:]) {
+		return nil, fmt.Errorf("%w: signature nonce does not match the pre-signature", ErrInvalidSignature)
+	}
+	s, ok := parseScalar(sig[32:])
+	if !ok {
+		return nil, fmt.Errorf("%w: s is not below the group order", ErrInvalidSignature)
+	}
+
+	t := new(btcec.ModNScalar).Set(sp).Negate().Add(s)
+	if !equal(basePoint(t), T) {
+		return nil, ErrSecretMismatch
+	}
+	return scalarBytes(t), nil
+}
+
+// Verify checks a BIP-340 signature
+func (Schnorr) Verify(pub *btcec.PublicKey, msg, sig []byte) error {
+	if err := checkMsg(msg); err != nil {
+		return err
+	}
+	parsed, err := schnorr.ParseSignature(sig)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if !parsed.Verify(msg, pub) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func parseSchnorrPreSig(preSig []byte) (*btcec.JacobianPoint, *btcec.ModNScalar, error) {
+	if len(preSig) != 65 {
+		return nil, nil, fmt.Errorf("%w: want 65 bytes, got %d", ErrInvalidPreSignature, len(preSig))
+	}
+	Rp, err := parsePoint(preSig[:33])
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: R': %v", ErrInvalidPreSignature, err)
+	}
+	s, ok := parseScalar(preSig[33:])
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: s' is not below the group order", ErrInvalidPreSignature)
+	}
+	return Rp, s, nil
+}
+
+// evenKey returns the BIP-340 signing scalar of key, negated if its point
+// has an odd y, and the x-only public key
+func evenKey(key *btcec.PrivateKey) (*btcec.ModNScalar, []byte) {
+	d := new(btcec.ModNScalar).Set(&key.Key)
+	pub := key.PubKey().SerializeCompressed()
+	if pub[0] == 0x03 {
+		d.Negate()
+	}
+	return d, pub[1:]
+}
+
+// liftX returns the even-y point with pub's x coordinate and that x
+func liftX(pub *btcec.PublicKey) (*btcec.JacobianPoint, []byte, error) {
+	pubX := schnorr.SerializePubKey(pub)
+	even, err := schnorr.ParsePubKey(pubX)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: public key: %v", ErrInvalidInput, err)
+	}
+	var P btcec.JacobianPoint
+	even.AsJacobian(&P)
+	return &P, pubX, nil
+}
+
+// challenge is the BIP-340 challenge e = H(R.x || P.x || m) mod n
+func challenge(R *btcec.JacobianPoint, pubX, msg []byte) *btcec.ModNScalar {
+	R.ToAffine()
+	rx := R.X.Bytes()
+	var e btcec.ModNScalar
+	e.SetByteSlice(chainhash.TaggedHash(chainhash.TagBIP0340Challenge, rx[:], pubX, msg)[:])
+	return &e
+}
@@ -0,0 +1,175 @@
+package adaptor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/drand/drand/v2/crypto"
+
+	"vte-tlock/internal/drandtest"
+	"vte-tlock/pkg/drandsim"
+	"vte-tlock/pkg/vte"
+)
+
+// testKeys returns n deterministic keys, odd and even y mixed
+func testKeys(t *testing.T, n int) []*btcec.PrivateKey {
+	t.Helper()
+	var keys []*btcec.PrivateKey
+	for i := range n {
+		seed := sha256.Sum256([]byte{byte(i)})
+		key, _ := btcec.PrivKeyFromBytes(seed[:])
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// testAdaptor returns a secret and its compressed point
+func testAdaptor(label string) ([]byte, []byte) {
+	secret := vte.PlaintextToR2(label)
+	point, _ := vte.ComputeR2Point(secret)
+	return secret, point
+}
+
+func TestSchnorrAdaptor(t *testing.T) {
+	scheme := Schnorr{}
+	msg := sha256.Sum256([]byte("spend"))
+	for i, key := range testKeys(t, 8) {
+		secret, point := testAdaptor(string(rune('a' + i)))
+		pub := key.PubKey()
+
+		preSig, err := scheme.PreSign(key, msg[:], point)
+		if err != nil {
+			t.Fatalf("PreSign failed: %v", err)
+		}
+		if err := scheme.VerifyPreSignature(pub, msg[:], point, preSig); err != nil {
+			t.Fatalf("Key %d: VerifyPreSignature failed: %v", i, err)
+		}
+
+		// The pre-signature alone is not a valid signature
+		rx := preSig[1:33]
+		if scheme.Verify(pub, msg[:], append(append([]byte{}, rx...), preSig[33:]...)) == nil {
+			t.Fatalf("Key %d: pre-signature verifies as a signature", i)
+		}
+
+		sig, err := scheme.Complete(preSig, secret)
+		if err != nil {
+			t.Fatalf("Complete failed: %v", err)
+		}
+		// Check against the BIP-340 verifier directly
+		parsed, err := schnorr.ParseSignature(sig)
+		if err != nil || !parsed.Verify(msg[:], pub) {
+			t.Fatalf("Key %d: completed signature fails BIP-340 verification (%v)", i, err)
+		}
+
+		extracted, err := scheme.Extract(preSig, sig, point)
+		if err != nil {
+			t.Fatalf("Extract failed: %v", err)
+		}
+		if hex.EncodeToString(extracted) != hex.EncodeToString(secret) {
+			t.Fatalf("Key %d: extracted %x, want %x", i, extracted, secret)
+		}
+	}
+}
+
+func TestSchnorrAdaptorRejects(t *testing.T) {
+	scheme := Schnorr{}
+	key := testKeys(t, 1)[0]
+	other := testKeys(t, 2)[1]
+	msg := sha256.Sum256([]byte("spend"))
+	otherMsg := sha256.Sum256([]byte("other"))
+	secret, point := testAdaptor("secret")
+	otherSecret, otherPoint := testAdaptor("other secret")
+
+	preSig, err := scheme.PreSign(key, msg[:], point)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, preSig...)
+	tampered[64] ^= 1
+
+	for name, err := range map[string]error{
+		"other key":     scheme.VerifyPreSignature(other.PubKey(), msg[:], point, preSig),
+		"other message": scheme.VerifyPreSignature(key.PubKey(), otherMsg[:], point, preSig),
+		"other adaptor": scheme.VerifyPreSignature(key.PubKey(), msg[:], otherPoint, preSig),
+		"tampered s'":   scheme.VerifyPreSignature(key.PubKey(), msg[:], point, tampered),
+		"short":         scheme.VerifyPreSignature(key.PubKey(), msg[:], point, preSig[:64]),
+	} {
+		if !errors.Is(err, ErrInvalidPreSignature) {
+			t.Errorf("%s: expected ErrInvalidPreSignature, got %v", name, err)
+		}
+	}
+	if _, err := scheme.PreSign(key, msg[:16], point); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Short message: %v", err)
+	}
+	if _, err := scheme.PreSign(key, msg[:], point[1:]); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("x-only adaptor point: %v", err)
+	}
+
+	// Completing with the wrong secret does not give a valid signature
+	if sig, err := scheme.Complete(preSig, otherSecret); err == nil && scheme.Verify(key.PubKey(), msg[:], sig) == nil {
+		t.Fatal("Wrong secret completed the pre-signature")
+	}
+
+	// Extraction needs the signature completed from this pre-signature
+	sig, _ := scheme.Complete(preSig, secret)
+	unrelated, _ := schnorr.Sign(key, msg[:])
+	if _, err := scheme.Extract(preSig, unrelated.Serialize(), point); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("Unrelated signature: %v", err)
+	}
+	if _, err := scheme.Extract(preSig, sig, otherPoint); err == nil {
+		t.Error("Extracted against the wrong adaptor point")
+	}
+}
+
+// TestAdaptorWithVTE pre-signs with the R2 of a VTE package under every
+// scheme and completes once the package opens
+func TestAdaptorWithVTE(t *testing.T) {
+	network, clock, server := drandtest.Start(t, drandsim.Config{Scheme: crypto.SigsOnG1ID})
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+
+	round := network.LatestRound() + 2
+	pkg, err := vte.GenerateVTE(&vte.GenerateVTEParams{
+		Round:          round,
+		ChainHash:      chainHash,
+		FormatID:       "tlock_v1_age_pairing",
+		SessionID:      "adaptor",
+		R2:             vte.PlaintextToR2("adaptor"),
+		DrandEndpoints: []string{server.URL},
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE failed: %v", err)
+	}
+
+	key := testKeys(t, 1)[0]
+	msg := sha256.Sum256([]byte("claim"))
+	schemes := []Scheme{Schnorr{}, ECDSA{}}
+	preSigs := make([][]byte, len(schemes))
+	for i, scheme := range schemes {
+		if preSigs[i], err = scheme.PreSign(key, msg[:], pkg.Public.R2.Value); err != nil {
+			t.Fatalf("%s: %v", scheme.Name(), err)
+		}
+		if err := scheme.VerifyPreSignature(key.PubKey(), msg[:], pkg.Public.R2.Value, preSigs[i]); err != nil {
+			t.Fatalf("%s: %v", scheme.Name(), err)
+		}
+	}
+
+	clock.Advance(3 * network.Info().Period)
+	result, err := vte.DecryptVTE(context.Background(), pkg, []string{server.URL})
+	if err != nil {
+		t.Fatalf("DecryptVTE failed: %v", err)
+	}
+	for i, scheme := range schemes {
+		sig, err := scheme.Complete(preSigs[i], result.R2)
+		if err != nil {
+			t.Fatalf("%s: %v", scheme.Name(), err)
+		}
+		if err := scheme.Verify(key.PubKey(), msg[:], sig); err != nil {
+			t.Fatalf("%s: completed signature invalid: %v", scheme.Name(), err)
+		}
+	}
+}
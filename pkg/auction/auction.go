@@ -0,0 +1,350 @@
+// Package auction runs sealed-bid auctions on VTE packages.
+//
+// A bidder seals amount || salt as the r2 of a package locked to the
+// auction's close round. The package binds the auction ID, the bidder key
+// and a bid commitment H(auction || bidder || amount || salt) as ctx_v3
+// fields. The bidder signs its ctx hash. Nobody, the aggregator included,
+// can read a bid before the round, and no bidder can change one after
+// sealing it.
+//
+// An Aggregator collects and verifies bids until it closes, or until the
+// drand chain is within SafetyRounds of the close round. After the round
+// it opens them all at once (the beacon is fetched once and served from
+// vte.Beacons for the rest) and checks each opening against its package
+// commitment and its bid commitment. It then ranks the valid bids by the
+// auction's Rules.
+//
+// The bids and the Result are meant to be published. With them, Audit lets
+// any bidder check the outcome: every bid is accounted for, every opening
+// matches its bid without decryption, every rejection is confirmed by
+// decrypting, and the winner and price follow from the rules.
+package auction
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"vte-tlock/pkg/vte"
+)
+
+// DefaultSafetyRounds is the cut-off used when Aggregator.SafetyRounds is
+// zero
+const DefaultSafetyRounds = 1
+
+var (
+	ErrInvalidBid   = errors.New("invalid bid")
+	ErrDuplicateBid = errors.New("duplicate bid")
+	ErrClosed       = errors.New("auction closed")
+	ErrAuditFailed  = errors.New("auction audit failed")
+)
+
+// Rules decide the winner and the price
+type Rules struct {
+	// Lowest makes the lowest bid win, as in a procurement auction
+	Lowest bool `json:"lowest,omitempty"`
+
+	// SecondPrice makes the winner pay the runner-up's bid (Vickrey), or
+	// the reserve if there is no runner-up
+	SecondPrice bool `json:"second_price,omitempty"`
+
+	// Reserve is the worst acceptable bid: the minimum when the highest bid
+	// wins, the maximum when the lowest does. Zero means none.
+	Reserve uint64 `json:"reserve,omitempty"`
+}
+
+// Auction is the public description of an auction
+type Auction struct {
+	ID         string `json:"id"`
+	ChainHash  []byte `json:"drand_chain_hash"`
+	CloseRound uint64 `json:"close_round"`
+	Rules      Rules  `json:"rules"`
+}
+
+// Rejection is a bid that could not be opened or did not match its
+// commitment
+type Rejection struct {
+	Bidder []byte `json:"bidder"`
+	Reason string `json:"reason"`
+}
+
+// Result is the outcome of an auction. Openings are ranked best first;
+// Winner is nil when no bid meets the reserve.
+type Result struct {
+	AuctionID string      `json:"auction_id"`
+	Openings  []Opening   `json:"openings"`
+	Rejected  []Rejection `json:"rejected,omitempty"`
+	Winner    []byte      `json:"winner,omitempty"`
+	Price     uint64      `json:"price,omitempty"`
+}
+
+// Opening returns the opening of a bidder's bid, or nil
+func (r *Result) Opening(bidder []byte) *Opening {
+	for i := range r.Openings {
+		if bytes.Equal(r.Openings[i].Bidder, bidder) {
+			return &r.Openings[i]
+		}
+	}
+	return nil
+}
+
+func (a *Auction) validate() error {
+	if a.ID == "" || len(a.ChainHash) != 32 || a.CloseRound == 0 {
+		return fmt.Errorf("%w: an auction needs an ID, a 32-byte drand chain hash and a close round", vte.ErrInvalidInput)
+	}
+	return nil
+}
+
+// Aggregator collects the bids of one auction
+type Aggregator struct {
+	// SafetyRounds is how many rounds before CloseRound Submit stops
+	// taking bids. Zero uses DefaultSafetyRounds. Set it before the first
+	// Submit.
+	SafetyRounds uint64
+
+	// Now is the clock compared with the drand rounds. Nil uses time.Now.
+	Now func() time.Time
+
+	auction Auction
+	policy  *vte.VerificationPolicy
+	network vte.DrandNetworkInfo
+
+	mu     sync.Mutex
+	bids   []*Bid
+	closed bool
+}
+
+// NewAggregator returns an open aggregator. Bids are checked with
+// Auction.VerifyBid under policy; nil uses vte.DefaultPolicy. The chain's
+// round timing, for the cut-off, is fetched from endpoints unless the chain
+// is pinned in the registry.
+func NewAggregator(ctx context.Context, a Auction, policy *vte.VerificationPolicy, endpoints []string) (*Aggregator, error) {
+	if err := a.validate(); err != nil {
+		return nil, err
+	}
+	trusted, err := vte.FetchChainInfo(ctx, a.ChainHash, endpoints)
+	if err != nil {
+		return nil, fmt.Errorf("drand chain timing: %w", err)
+	}
+	network := vte.DrandNetworkInfo{
+		ChainHash:   trusted.ChainHash,
+		GenesisTime: trusted.GenesisTime,
+		Period:      trusted.Period,
+		SchemeID:    trusted.SchemeID,
+	}
+	return &Aggregator{auction: a, policy: policy, network: network}, nil
+}
+
+// Submit verifies and records a bid. Each bidder bids once. Bids are refused
+// with ErrClosed once the chain's current round is within SafetyRounds of
+// the close round, since a bid made later could be made knowing the others.
+func (g *Aggregator) Submit(bid *Bid) error {
+	if err := g.auction.VerifyBid(bid, g.policy); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return ErrClosed
+	}
+	margin := g.SafetyRounds
+	if margin == 0 {
+		margin = DefaultSafetyRounds
+	}
+	scheduler := &vte.Scheduler{Network: g.network, Now: g.Now}
+	if current := scheduler.CurrentRound(); current+margin >= g.auction.CloseRound {
+		return fmt.Errorf("%w: round %d is within %d rounds of the close round %d", ErrClosed, current, margin, g.auction.CloseRound)
+	}
+	for _, b := range g.bids {
+		if bytes.Equal(b.Bidder, bid.Bidder) {
+			return fmt.Errorf("%w: bidder %x", ErrDuplicateBid, bid.Bidder)
+		}
+	}
+	g.bids = append(g.bids, bid)
+	return nil
+}
+
+// Close stops accepting bids. Close before the round: once it is out, bids
+// can be read by anyone.
+func (g *Aggregator) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+}
+
+// Bids returns the collected bids, to publish with the result
+func (g *Aggregator) Bids() []*Bid {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]*Bid(nil), g.bids...)
+}
+
+// Reveal closes the auction, opens every bid and decides it. Before the
+// round it fails with tlock.ErrTooEarly and the auction stays closed.
+func (g *Aggregator) Reveal(ctx context.Context, endpoints []string) (*Result, error) {
+	g.Close()
+	bids := g.Bids()
+
+	result := &Result{AuctionID: g.auction.ID}
+	for _, bid := range bids {
+		opening, err := g.auction.open(ctx, bid, endpoints)
+		if unopenable(err) {
+			result.Rejected = append(result.Rejected, Rejection{Bidder: bid.Bidder, Reason: err.Error()})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.Openings = append(result.Openings, *opening)
+	}
+	g.auction.decide(result)
+	return result, nil
+}
+
+// open decrypts a bid and checks the opening against the bid commitment
+func (a *Auction) open(ctx context.Context, bid *Bid, endpoints []string) (*Opening, error) {
+	decrypted, err := vte.DecryptVTE(ctx, bid.Package, endpoints)
+	if err != nil {
+		return nil, err
+	}
+	opening, err := openSecret(bid.Bidder, decrypted.R2)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.checkOpening(bid, opening); err != nil {
+		return nil, err
+	}
+	return opening, nil
+}
+
+// unopenable tells a bid at fault apart from a round not out yet or a
+// network failure
+func unopenable(err error) bool {
+	return errors.Is(err, ErrInvalidBid) || errors.Is(err, vte.ErrCommitmentMismatch) ||
+		errors.Is(err, vte.ErrMalformedCapsule) || errors.Is(err, vte.ErrFormatMismatch)
+}
+
+// decide ranks the openings and sets the winner and price
+func (a *Auction) decide(r *Result) {
+	sort.SliceStable(r.Openings, func(i, j int) bool { return a.better(&r.Openings[i], &r.Openings[j]) })
+	r.Winner, r.Price = nil, 0
+
+	var qualified []Opening
+	for _, o := range r.Openings {
+		if a.meetsReserve(o.Amount) {
+			qualified = append(qualified, o)
+		}
+	}
+	if len(qualified) == 0 {
+		return
+	}
+	r.Winner = qualified[0].Bidder
+	r.Price = qualified[0].Amount
+	if a.Rules.SecondPrice {
+		switch {
+		case len(qualified) > 1:
+			r.Price = qualified[1].Amount
+		case a.Rules.Reserve != 0:
+			r.Price = a.Rules.Reserve
+		}
+	}
+}
+
+// better orders bids best first. Equal amounts are ordered by bid
+// commitment, which no bidder can aim for without knowing the other salts.
+func (a *Auction) better(x, y *Opening) bool {
+	if x.Amount != y.Amount {
+		return (x.Amount > y.Amount) != a.Rules.Lowest
+	}
+	return bytes.Compare(x.Commitment(a.ID), y.Commitment(a.ID)) < 0
+}
+
+func (a *Auction) meetsReserve(amount uint64) bool {
+	switch {
+	case a.Rules.Reserve == 0:
+		return true
+	case a.Rules.Lowest:
+		return amount <= a.Rules.Reserve
+	default:
+		return amount >= a.Rules.Reserve
+	}
+}
+
+// Audit checks a published result against the published bids. Each bid
+// must verify and appear once in the result, opened or rejected. Openings
+// are checked against the package and bid commitments. Rejections are
+// confirmed by decrypting with endpoints, and the winner and price are
+// decided again. A bidder also checks that its own bid is in bids.
+//
+// Audit trusts the aggregator's cut-off: a bid carries no submission time,
+// so nothing here shows that it was taken before the close round and not by
+// someone who already read the others.
+func Audit(ctx context.Context, a Auction, policy *vte.VerificationPolicy, bids []*Bid, result *Result, endpoints []string) error {
+	if err := a.validate(); err != nil {
+		return err
+	}
+	if result.AuctionID != a.ID {
+		return fmt.Errorf("%w: result is for auction %q", ErrAuditFailed, result.AuctionID)
+	}
+
+	byBidder := make(map[string]*Bid)
+	for _, bid := range bids {
+		if err := a.VerifyBid(bid, policy); err != nil {
+			return fmt.Errorf("%w: bid of %x: %w", ErrAuditFailed, bid.Bidder, err)
+		}
+		if byBidder[string(bid.Bidder)] != nil {
+			return fmt.Errorf("%w: two bids from %x", ErrAuditFailed, bid.Bidder)
+		}
+		byBidder[string(bid.Bidder)] = bid
+	}
+
+	seen := make(map[string]bool)
+	take := func(bidder []byte) (*Bid, error) {
+		bid := byBidder[string(bidder)]
+		if bid == nil || seen[string(bidder)] {
+			return nil, fmt.Errorf("%w: result lists %x, which has no bid or is listed twice", ErrAuditFailed, bidder)
+		}
+		seen[string(bidder)] = true
+		return bid, nil
+	}
+	for i := range result.Openings {
+		o := &result.Openings[i]
+		bid, err := take(o.Bidder)
+		if err != nil {
+			return err
+		}
+		if err := a.checkOpening(bid, o); err != nil {
+			return fmt.Errorf("%w: opening of %x: %w", ErrAuditFailed, o.Bidder, err)
+		}
+	}
+	for _, r := range result.Rejected {
+		bid, err := take(r.Bidder)
+		if err != nil {
+			return err
+		}
+		if _, err := a.open(ctx, bid, endpoints); err == nil {
+			return fmt.Errorf("%w: the bid of %x opens correctly but was rejected", ErrAuditFailed, r.Bidder)
+		} else if !unopenable(err) {
+			return fmt.Errorf("%w: rejection of %x cannot be confirmed: %w", ErrAuditFailed, r.Bidder, err)
+		}
+	}
+	if len(seen) != len(byBidder) {
+		return fmt.Errorf("%w: result leaves out %d bids", ErrAuditFailed, len(byBidder)-len(seen))
+	}
+
+	decided := &Result{Openings: append([]Opening(nil), result.Openings...)}
+	a.decide(decided)
+	if !bytes.Equal(decided.Winner, result.Winner) || decided.Price != result.Price {
+		return fmt.Errorf("%w: rules give winner %x at %d, result says %x at %d", ErrAuditFailed, decided.Winner, decided.Price, result.Winner, result.Price)
+	}
+	for i := range decided.Openings {
+		if !bytes.Equal(decided.Openings[i].Bidder, result.Openings[i].Bidder) {
+			return fmt.Errorf("%w: openings are not ranked by the rules", ErrAuditFailed)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+package auction
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock"
+
+	"vte-tlock/internal/drandtest"
+	"vte-tlock/pkg/drandsim"
+	"vte-tlock/pkg/vte"
+)
+
+var testPolicy = &vte.VerificationPolicy{Require: vte.ProofRequirements{Schnorr: true}}
+
+type testEnv struct {
+	network  *drandsim.Network
+	clock    *drandsim.ManualClock
+	endpoint string
+	auction  Auction
+}
+
+func newEnv(t *testing.T, rules Rules) *testEnv {
+	t.Helper()
+	saved := vte.Beacons
+	vte.Beacons = vte.NewBeaconCache(vte.NewMemoryBeaconStore())
+	t.Cleanup(func() { vte.Beacons = saved })
+
+	network, clock, server := drandtest.Start(t, drandsim.Config{Scheme: crypto.SigsOnG1ID, Seed: []byte("auction")})
+	clock.Advance(time.Hour)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	return &testEnv{
+		network:  network,
+		clock:    clock,
+		endpoint: server.URL,
+		auction:  Auction{ID: "lot-7", ChainHash: chainHash, CloseRound: network.LatestRound() + 3, Rules: rules},
+	}
+}
+
+func (e *testEnv) close() {
+	for e.network.LatestRound() < e.auction.CloseRound {
+		e.clock.Advance(e.network.Info().Period)
+	}
+}
+
+// aggregator returns an aggregator on the simulated clock
+func (e *testEnv) aggregator(t *testing.T) *Aggregator {
+	t.Helper()
+	agg, err := NewAggregator(context.Background(), e.auction, testPolicy, []string{e.endpoint})
+	if err != nil {
+		t.Fatalf("NewAggregator failed: %v", err)
+	}
+	agg.Now = e.clock.Now
+	return agg
+}
+
+func testKey(label string) *btcec.PrivateKey {
+	seed := sha256.Sum256([]byte(label))
+	key, _ := btcec.PrivKeyFromBytes(seed[:])
+	return key
+}
+
+func (e *testEnv) bid(t *testing.T, bidder string, amount uint64) (*Bid, *Opening) {
+	t.Helper()
+	bid, opening, err := e.auction.NewBid(&BidParams{
+		Key:            testKey(bidder),
+		Amount:         amount,
+		DrandEndpoints: []string{e.endpoint},
+		Rand:           vte.NewSeededRand([]byte(bidder)),
+	})
+	if err != nil {
+		t.Fatalf("NewBid failed: %v", err)
+	}
+	return bid, opening
+}
+
+func TestAuctionEndToEnd(t *testing.T) {
+	e := newEnv(t, Rules{SecondPrice: true})
+	ctx := context.Background()
+	agg := e.aggregator(t)
+
+	amounts := map[string]uint64{"alice": 120, "bob": 250, "carol": 180}
+	openings := make(map[string]*Opening)
+	for _, name := range []string{"alice", "bob", "carol"} {
+		bid, opening := e.bid(t, name, amounts[name])
+		if err := agg.Submit(bid); err != nil {
+			t.Fatalf("%s: Submit failed: %v", name, err)
+		}
+		openings[name] = opening
+	}
+
+	if _, err := agg.Reveal(ctx, []string{e.endpoint}); !errors.Is(err, tlock.ErrTooEarly) {
+		t.Fatalf("Reveal before the round: %v", err)
+	}
+	late, _ := e.bid(t, "dave", 999)
+	if err := agg.Submit(late); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Bid after close: %v", err)
+	}
+
+	e.close()
+	result, err := agg.Reveal(ctx, []string{e.endpoint})
+	if err != nil {
+		t.Fatalf("Reveal failed: %v", err)
+	}
+	if !bytes.Equal(result.Winner, openings["bob"].Bidder) || result.Price != 180 {
+		t.Fatalf("Winner %x at %d, want bob at 180", result.Winner, result.Price)
+	}
+	if len(result.Openings) != 3 || len(result.Rejected) != 0 {
+		t.Fatalf("Result %+v", result)
+	}
+
+	// Every bidder audits the published bids and result and finds its bid
+	for name, want := range openings {
+		if err := Audit(ctx, e.auction, testPolicy, agg.Bids(), result, []string{e.endpoint}); err != nil {
+			t.Fatalf("%s: Audit failed: %v", name, err)
+		}
+		if got := result.Opening(want.Bidder); got == nil || got.Amount != want.Amount || !bytes.Equal(got.Salt, want.Salt) {
+			t.Fatalf("%s: opening %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+func TestAuctionRejectsMismatchedBid(t *testing.T) {
+	e := newEnv(t, Rules{})
+	ctx := context.Background()
+	agg := e.aggregator(t)
+
+	honest, _ := e.bid(t, "alice", 100)
+	// mallory seals 500 but commits to 50, hoping to pick one after the fact
+	mallory := testKey("mallory")
+	sealed := &Opening{Bidder: mallory.PubKey().SerializeCompressed(), Amount: 500, Salt: bytes.Repeat([]byte{7}, saltSize)}
+	claimed := &Opening{Bidder: sealed.Bidder, Amount: 50, Salt: sealed.Salt}
+	cheat, err := e.auction.seal(&BidParams{Key: mallory, DrandEndpoints: []string{e.endpoint}}, sealed, claimed.Commitment(e.auction.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bid := range []*Bid{honest, cheat} {
+		if err := agg.Submit(bid); err != nil {
+			t.Fatalf("Submit failed: %v", err)
+		}
+	}
+
+	e.close()
+	result, err := agg.Reveal(ctx, []string{e.endpoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Rejected) != 1 || !bytes.Equal(result.Rejected[0].Bidder, sealed.Bidder) {
+		t.Fatalf("Rejected %+v, want mallory", result.Rejected)
+	}
+	if !bytes.Equal(result.Winner, honest.Bidder) || result.Price != 100 {
+		t.Fatalf("Winner %x at %d, want alice at 100", result.Winner, result.Price)
+	}
+	if err := Audit(ctx, e.auction, testPolicy, agg.Bids(), result, []string{e.endpoint}); err != nil {
+		t.Fatalf("Audit failed: %v", err)
+	}
+}
+
+func TestAuditCatchesTampering(t *testing.T) {
+	e := newEnv(t, Rules{})
+	ctx := context.Background()
+	agg := e.aggregator(t)
+	for name, amount := range map[string]uint64{"alice": 100, "bob": 200} {
+		bid, _ := e.bid(t, name, amount)
+		if err := agg.Submit(bid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e.close()
+	result, err := agg.Reveal(ctx, []string{e.endpoint})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bids := agg.Bids()
+
+	clone := func() *Result {
+		r := *result
+		r.Openings = append([]Opening(nil), result.Openings...)
+		return &r
+	}
+	for name, tamper := range map[string]func(*Result){
+		"winner":  func(r *Result) { r.Winner = r.Openings[1].Bidder },
+		"price":   func(r *Result) { r.Price++ },
+		"amount":  func(r *Result) { r.Openings[0].Amount = 300; r.Price = 300 },
+		"dropped": func(r *Result) { r.Openings = r.Openings[:1] },
+		"order":   func(r *Result) { r.Openings[0], r.Openings[1] = r.Openings[1], r.Openings[0] },
+		"rejected": func(r *Result) {
+			r.Rejected = []Rejection{{Bidder: r.Openings[1].Bidder, Reason: "made up"}}
+			r.Openings = r.Openings[:1]
+		},
+	} {
+		r := clone()
+		tamper(r)
+		if err := Audit(ctx, e.auction, testPolicy, bids, r, []string{e.endpoint}); !errors.Is(err, ErrAuditFailed) {
+			t.Errorf("%s: expected ErrAuditFailed, got %v", name, err)
+		}
+	}
+}
+
+func TestSubmitRejects(t *testing.T) {
+	e := newEnv(t, Rules{})
+	agg := e.aggregator(t)
+	bid, _ := e.bid(t, "alice", 100)
+	if err := agg.Submit(bid); err != nil {
+		t.Fatal(err)
+	}
+	if err := agg.Submit(bid); !errors.Is(err, ErrDuplicateBid) {
+		t.Errorf("Second bid: %v", err)
+	}
+
+	other := e.auction
+	other.ID = "lot-8"
+	elsewhere, _, _ := other.NewBid(&BidParams{Key: testKey("bob"), Amount: 5, DrandEndpoints: []string{e.endpoint}})
+	if err := agg.Submit(elsewhere); !errors.Is(err, ErrInvalidBid) {
+		t.Errorf("Bid for another auction: %v", err)
+	}
+
+	forged := *bid
+	forged.Bidder = testKey("carol").PubKey().SerializeCompressed()
+	if err := agg.Submit(&forged); !errors.Is(err, ErrInvalidBid) {
+		t.Errorf("Bid under another key: %v", err)
+	}
+	resigned, _ := e.bid(t, "dave", 100)
+	resigned.Sig = append([]byte{}, resigned.Sig...)
+	resigned.Sig[10] ^= 1
+	if err := agg.Submit(resigned); !errors.Is(err, ErrInvalidBid) {
+		t.Errorf("Bad signature: %v", err)
+	}
+	if _, _, err := e.auction.NewBid(&BidParams{Key: testKey("erin"), Amount: 0}); !errors.Is(err, ErrInvalidBid) {
+		t.Errorf("Zero bid: %v", err)
+	}
+
+	// Within the cut-off, even an open aggregator refuses bids
+	late, _ := e.bid(t, "frank", 100)
+	for e.network.LatestRound()+DefaultSafetyRounds < e.auction.CloseRound {
+		e.clock.Advance(e.network.Info().Period)
+	}
+	if err := agg.Submit(late); !errors.Is(err, ErrClosed) {
+		t.Errorf("Bid at the cut-off: %v", err)
+	}
+}
+
+func TestRules(t *testing.T) {
+	openings := []Opening{
+		{Bidder: []byte("a"), Amount: 30, Salt: []byte("1")},
+		{Bidder: []byte("b"), Amount: 50, Salt: []byte("2")},
+		{Bidder: []byte("c"), Amount: 10, Salt: []byte("3")},
+	}
+	for _, tc := range []struct {
+		name   string
+		rules  Rules
+		winner string
+		price  uint64
+	}{
+		{"first price", Rules{}, "b", 50},
+		{"second price", Rules{SecondPrice: true}, "b", 30},
+		{"reserve", Rules{Reserve: 60}, "", 0},
+		{"second price to reserve", Rules{SecondPrice: true, Reserve: 40}, "b", 40},
+		{"lowest", Rules{Lowest: true}, "c", 10},
+		{"lowest second price", Rules{Lowest: true, SecondPrice: true}, "c", 30},
+		{"lowest reserve", Rules{Lowest: true, Reserve: 5}, "", 0},
+	} {
+		a := &Auction{ID: "rules", Rules: tc.rules}
+		r := &Result{Openings: append([]Opening(nil), openings...)}
+		a.decide(r)
+		if string(r.Winner) != tc.winner || r.Price != tc.price {
+			t.Errorf("%s: winner %q at %d, want %q at %d", tc.name, r.Winner, r.Price, tc.winner, tc.price)
+		}
+	}
+
+	// Ties go by bid commitment, whatever the submission order
+	a := &Auction{ID: "ties"}
+	tied := []Opening{{Bidder: []byte("x"), Amount: 7, Salt: []byte("1")}, {Bidder: []byte("y"), Amount: 7, Salt: []byte("2")}}
+	r1 := &Result{Openings: []Opening{tied[0], tied[1]}}
+	r2 := &Result{Openings: []Opening{tied[1], tied[0]}}
+	a.decide(r1)
+	a.decide(r2)
+	if !bytes.Equal(r1.Winner, r2.Winner) {
+		t.Errorf("Tie winner depends on order: %q vs %q", r1.Winner, r2.Winner)
+	}
+}
@@ -0,0 +1,218 @@
+package auction
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+
+	"vte-tlock/circuits/commitment"
+	"vte-tlock/pkg/vte"
+)
+
+// FormatID is the package format of bids
+const FormatID = "tlock_v1_age_pairing"
+
+// saltSize is the salt length: r2 is amount (8 bytes) || salt
+const saltSize = 24
+
+var (
+	tagBidCommitment = []byte("VTE/auction/bid")
+	tagBidSignature  = []byte("VTE/auction/bid-sig")
+)
+
+// Bid is a sealed bid: a VTE package whose r2 is the amount and salt,
+// locked to the close round and signed by the bidder over its ctx hash
+type Bid struct {
+	Bidder  []byte            `json:"bidder"` // SEC1 compressed
+	Package *vte.VTEPackageV2 `json:"package"`
+	Sig     []byte            `json:"sig"` // BIP-340
+}
+
+// Opening is a bid once its package is open
+type Opening struct {
+	Bidder []byte `json:"bidder"`
+	Amount uint64 `json:"amount"`
+	Salt   []byte `json:"salt"`
+}
+
+// secret is the r2 of the bid: amount big-endian || salt. Amounts below
+// 2^64 - 1 keep it below the secp256k1 order.
+func (o *Opening) secret() []byte {
+	r2 := binary.BigEndian.AppendUint64(nil, o.Amount)
+	return append(r2, o.Salt...)
+}
+
+// Commitment is the bid commitment bound in the package ctx:
+// H(auction ID || bidder || amount || salt)
+func (o *Opening) Commitment(auctionID string) []byte {
+	var amount [8]byte
+	binary.BigEndian.PutUint64(amount[:], o.Amount)
+	h := chainhash.TaggedHash(tagBidCommitment, []byte(auctionID), []byte{0}, o.Bidder, amount[:], o.Salt)
+	return h[:]
+}
+
+// openSecret splits a decrypted r2 into an opening
+func openSecret(bidder, r2 []byte) (*Opening, error) {
+	if len(r2) != 8+saltSize {
+		return nil, fmt.Errorf("%w: r2 is %d bytes", ErrInvalidBid, len(r2))
+	}
+	return &Opening{Bidder: bidder, Amount: binary.BigEndian.Uint64(r2[:8]), Salt: r2[8:]}, nil
+}
+
+// BidParams are the inputs of Auction.NewBid
+type BidParams struct {
+	Key    *btcec.PrivateKey
+	Amount uint64
+
+	DrandEndpoints []string
+	GenerateProof  bool
+
+	// Rand supplies the salt and package randomness. Nil uses crypto/rand.
+	Rand io.Reader
+}
+
+// NewBid seals a bid of p.Amount. The opening holds the salt; a bidder keeps
+// it to check the result.
+func (a *Auction) NewBid(p *BidParams) (*Bid, *Opening, error) {
+	if p.Key == nil {
+		return nil, nil, fmt.Errorf("%w: a bidder key is required", ErrInvalidBid)
+	}
+	if p.Amount == 0 || p.Amount == ^uint64(0) {
+		return nil, nil, fmt.Errorf("%w: amount must be in [1, 2^64-1)", ErrInvalidBid)
+	}
+	r := p.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, nil, fmt.Errorf("read randomness: %w", err)
+	}
+	opening := &Opening{Bidder: p.Key.PubKey().SerializeCompressed(), Amount: p.Amount, Salt: salt}
+	bid, err := a.seal(p, opening, opening.Commitment(a.ID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return bid, opening, nil
+}
+
+// seal locks opening in a package that binds bidCommitment
+func (a *Auction) seal(p *BidParams, opening *Opening, bidCommitment []byte) (*Bid, error) {
+	pkg, err := vte.GenerateVTE(&vte.GenerateVTEParams{
+		Round:          a.CloseRound,
+		ChainHash:      a.ChainHash,
+		FormatID:       FormatID,
+		SessionID:      a.ID,
+		R2:             opening.secret(),
+		CtxFields:      a.ctxFields(opening.Bidder, bidCommitment),
+		DrandEndpoints: p.DrandEndpoints,
+		GenerateProof:  p.GenerateProof,
+		Rand:           p.Rand,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("generate the bid package: %w", err)
+	}
+	sig, err := schnorr.Sign(p.Key, bidMessage(pkg.Context.CtxHash))
+	if err != nil {
+		return nil, err
+	}
+	return &Bid{Bidder: opening.Bidder, Package: pkg, Sig: sig.Serialize()}, nil
+}
+
+// VerifyBid checks a sealed bid before its round: the bidder signature, the
+// package under the policy (with Round and SessionID set for the auction and
+// AllowedCtxSchemas set to ctx_v3) and the ctx_v3 binding to this auction
+// and bidder
+func (a *Auction) VerifyBid(bid *Bid, policy *vte.VerificationPolicy) error {
+	pub, err := btcec.ParsePubKey(bid.Bidder)
+	if err != nil || len(bid.Bidder) != 33 {
+		return fmt.Errorf("%w: bidder key: %v", ErrInvalidBid, err)
+	}
+	pkg := bid.Package
+	if pkg == nil {
+		return fmt.Errorf("%w: no package", ErrInvalidBid)
+	}
+	if pkg.Lock != nil || !bytes.Equal(pkg.Tlock.DrandChainHash, a.ChainHash) {
+		return fmt.Errorf("%w: package is not on the auction's drand chain", ErrInvalidBid)
+	}
+
+	p := vte.DefaultPolicy()
+	if policy != nil {
+		c := *policy
+		p = &c
+	}
+	p.Round = a.CloseRound
+	p.SessionID = a.ID
+	p.AllowedCtxSchemas = []string{vte.CtxSchemaV3}
+	if err := p.Verify(pkg); err != nil {
+		return fmt.Errorf("%w: package: %w", ErrInvalidBid, err)
+	}
+
+	for _, want := range []vte.CtxField{vte.StringField("auction", a.ID), vte.PubkeyField("bidder", bid.Bidder)} {
+		if got := pkg.Context.Field(want.Name); got == nil || *got != want {
+			return fmt.Errorf("%w: package does not bind %s", ErrInvalidBid, want.Name)
+		}
+	}
+	if _, err := bidCommitment(pkg); err != nil {
+		return err
+	}
+
+	sig, err := schnorr.ParseSignature(bid.Sig)
+	if err != nil || !sig.Verify(bidMessage(pkg.Context.CtxHash), pub) {
+		return fmt.Errorf("%w: bidder signature", ErrInvalidBid)
+	}
+	return nil
+}
+
+// checkOpening checks that an opening is the r2 of a bid's package and
+// matches the bid commitment, without decrypting
+func (a *Auction) checkOpening(bid *Bid, o *Opening) error {
+	if !bytes.Equal(o.Bidder, bid.Bidder) || len(o.Salt) != saltSize {
+		return fmt.Errorf("%w: opening is not for this bidder", ErrInvalidBid)
+	}
+	r2 := o.secret()
+	c, err := commitment.ComputeCommitmentHash(r2, bid.Package.Context.CtxHash)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(c, bid.Package.Public.Commitment) {
+		return fmt.Errorf("%w: opening does not match the package commitment", vte.ErrCommitmentMismatch)
+	}
+	want, _ := bidCommitment(bid.Package)
+	if !bytes.Equal(o.Commitment(a.ID), want) {
+		return fmt.Errorf("%w: opening does not match the bid commitment", ErrInvalidBid)
+	}
+	return nil
+}
+
+func (a *Auction) ctxFields(bidder, bidCommitment []byte) []vte.CtxField {
+	return []vte.CtxField{
+		vte.StringField("auction", a.ID),
+		vte.PubkeyField("bidder", bidder),
+		vte.BytesField("bid_commitment", bidCommitment),
+	}
+}
+
+// bidCommitment returns the bid commitment a package binds
+func bidCommitment(pkg *vte.VTEPackageV2) ([]byte, error) {
+	f := pkg.Context.Field("bid_commitment")
+	if f == nil || f.Type != vte.CtxBytes {
+		return nil, fmt.Errorf("%w: package does not bind bid_commitment", ErrInvalidBid)
+	}
+	c, err := f.Encode()
+	if err != nil || len(c) != 32 {
+		return nil, fmt.Errorf("%w: bid_commitment must be 32 bytes", ErrInvalidBid)
+	}
+	return c, nil
+}
+
+func bidMessage(ctxHash []byte) []byte {
+	h := chainhash.TaggedHash(tagBidSignature, ctxHash)
+	return h[:]
+}
@@ -0,0 +1,305 @@
+// Package drandsim is an in-process drand network for offline tests.
+//
+// A Network owns a BLS key pair, signs rounds according to an injectable
+// clock, implements tlock.Network directly and serves the public drand HTTP
+// API (/info, /public/{round}, optionally prefixed by the chain hash) so that
+// HTTP clients such as tlock's networks/http can be pointed at it.
+package drandsim
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/drand/v2/protobuf/drand"
+	"github.com/drand/kyber"
+	"github.com/drand/kyber/util/random"
+	"github.com/drand/tlock"
+)
+
+var _ tlock.Network = (*Network)(nil)
+
+// ErrRoundNotReached is returned when a signature is requested for a round
+// the simulated clock has not reached yet
+var ErrRoundNotReached = errors.New("round not reached")
+
+// Clock supplies the current time to a Network
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// ManualClock is a Clock that only moves when told to
+type ManualClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewManualClock returns a ManualClock set to now
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
+
+// Now returns the current simulated time
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set moves the clock to t
+func (c *ManualClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// Advance moves the clock forward by d
+func (c *ManualClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Config describes a simulated network. Zero values pick quicknet-like defaults.
+type Config struct {
+	Scheme      string        // drand scheme ID (default bls-unchained-g1-rfc9380)
+	Period      time.Duration // round period (default 3s)
+	GenesisTime int64         // unix time of round 1 (default: clock time at New)
+	BeaconID    string        // beacon ID, part of the chain hash (default "simnet")
+	Seed        []byte        // derives the key pair; nil picks a random key
+	Clock       Clock         // time source (default system clock)
+}
+
+// Network is a single-node drand chain
+type Network struct {
+	scheme *crypto.Scheme
+	secret kyber.Scalar
+	info   *chain.Info
+	hash   string
+	clock  Clock
+}
+
+// New creates a simulated network. Only unchained schemes are supported,
+// since those are the only ones tlock can encrypt to.
+func New(cfg Config) (*Network, error) {
+	if cfg.Scheme == "" {
+		cfg.Scheme = crypto.SigsOnG1ID
+	}
+	if cfg.Period == 0 {
+		cfg.Period = 3 * time.Second
+	}
+	if cfg.Period < time.Second || cfg.Period%time.Second != 0 {
+		return nil, fmt.Errorf("period must be a whole number of seconds, got %s", cfg.Period)
+	}
+	if cfg.BeaconID == "" {
+		cfg.BeaconID = "simnet"
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = systemClock{}
+	}
+	if cfg.GenesisTime == 0 {
+		cfg.GenesisTime = cfg.Clock.Now().Unix()
+	}
+
+	switch cfg.Scheme {
+	case crypto.SigsOnG1ID, crypto.UnchainedSchemeID, crypto.ShortSigSchemeID:
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q: tlock needs an unchained scheme", cfg.Scheme)
+	}
+	scheme, err := crypto.SchemeFromName(cfg.Scheme)
+	if err != nil {
+		return nil, fmt.Errorf("unknown scheme %q: %w", cfg.Scheme, err)
+	}
+
+	var secret kyber.Scalar
+	if cfg.Seed != nil {
+		digest := sha256.Sum256(cfg.Seed)
+		secret = scheme.KeyGroup.Scalar().SetBytes(digest[:])
+	} else {
+		secret = scheme.KeyGroup.Scalar().Pick(random.New())
+	}
+	pubKey := scheme.KeyGroup.Point().Mul(secret, nil)
+
+	pubBytes, err := pubKey.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	genesisSeed := sha256.Sum256(pubBytes)
+
+	info := &chain.Info{
+		PublicKey:   pubKey,
+		ID:          cfg.BeaconID,
+		Period:      cfg.Period,
+		Scheme:      scheme.Name,
+		GenesisTime: cfg.GenesisTime,
+		GenesisSeed: genesisSeed[:],
+	}
+
+	return &Network{
+		scheme: scheme,
+		secret: secret,
+		info:   info,
+		hash:   info.HashString(),
+		clock:  cfg.Clock,
+	}, nil
+}
+
+// ChainHash returns the hex chain hash of the simulated chain
+func (n *Network) ChainHash() string { return n.hash }
+
+// Current returns the latest round at time t
+func (n *Network) Current(t time.Time) uint64 {
+	if t.Unix() < n.info.GenesisTime {
+		return 0
+	}
+	return common.CurrentRound(t.Unix(), n.info.Period, n.info.GenesisTime)
+}
+
+// PublicKey returns the group public key
+func (n *Network) PublicKey() kyber.Point { return n.info.PublicKey }
+
+// Scheme returns the drand scheme of the chain
+func (n *Network) Scheme() crypto.Scheme { return *n.scheme }
+
+// Signature signs round if the clock has reached it
+func (n *Network) Signature(round uint64) ([]byte, error) {
+	beacon, err := n.Beacon(round)
+	if err != nil {
+		return nil, err
+	}
+	return beacon.Signature, nil
+}
+
+// SwitchChainHash only accepts the chain hash of this network
+func (n *Network) SwitchChainHash(h string) error {
+	if h != n.hash {
+		return fmt.Errorf("simulated network only serves chain %s, not %s", n.hash, h)
+	}
+	return nil
+}
+
+// Info returns the chain info of the simulated chain
+func (n *Network) Info() *chain.Info { return n.info }
+
+// ChainInfoJSON returns the chain info as served by /info
+func (n *Network) ChainInfoJSON() string {
+	var buf bytes.Buffer
+	// Encoding a well-formed info into a buffer cannot fail
+	_ = n.info.ToJSON(&buf, &drand.Metadata{BeaconID: n.info.ID})
+	return strings.TrimSpace(buf.String())
+}
+
+// LatestRound returns the latest round according to the network clock
+func (n *Network) LatestRound() uint64 {
+	return n.Current(n.clock.Now())
+}
+
+// Beacon returns the signed beacon for round if the clock has reached it
+func (n *Network) Beacon(round uint64) (*common.Beacon, error) {
+	if round == 0 {
+		return nil, fmt.Errorf("round 0 is not signed")
+	}
+	if latest := n.LatestRound(); round > latest {
+		return nil, fmt.Errorf("%w: round %d, latest %d", ErrRoundNotReached, round, latest)
+	}
+
+	beacon := &common.Beacon{Round: round}
+	sig, err := n.scheme.AuthScheme.Sign(n.secret, n.scheme.DigestBeacon(beacon))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign round %d: %w", round, err)
+	}
+	beacon.Signature = sig
+	return beacon, nil
+}
+
+// NewServer starts an httptest server for the network. Callers must Close it.
+func (n *Network) NewServer() *httptest.Server {
+	return httptest.NewServer(n.Handler())
+}
+
+// Handler serves the public drand HTTP API for the network:
+//
+//	GET [/{chainhash}]/info
+//	GET [/{chainhash}]/public/latest
+//	GET [/{chainhash}]/public/{round}
+func (n *Network) Handler() http.Handler {
+	return http.HandlerFunc(n.serveHTTP)
+}
+
+func (n *Network) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) > 0 && len(parts[0]) == 2*sha256.Size {
+		if _, err := hex.DecodeString(parts[0]); err == nil {
+			if parts[0] != n.hash {
+				http.Error(w, "unknown chain hash", http.StatusNotFound)
+				return
+			}
+			parts = parts[1:]
+		}
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "info":
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(n.ChainInfoJSON()))
+
+	case len(parts) == 2 && parts[0] == "public":
+		round := n.LatestRound()
+		if parts[1] != "latest" {
+			parsed, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				http.Error(w, "invalid round", http.StatusBadRequest)
+				return
+			}
+			round = parsed
+		}
+
+		beacon, err := n.Beacon(round)
+		if errors.Is(err, ErrRoundNotReached) {
+			http.Error(w, err.Error(), http.StatusTooEarly)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(beaconJSON{
+			Round:      beacon.Round,
+			Randomness: hex.EncodeToString(crypto.RandomnessFromSignature(beacon.Signature)),
+			Signature:  hex.EncodeToString(beacon.Signature),
+		})
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// beaconJSON is the /public/{round} response of unchained drand networks
+type beaconJSON struct {
+	Round      uint64 `json:"round"`
+	Randomness string `json:"randomness"`
+	Signature  string `json:"signature"`
+}
@@ -0,0 +1,136 @@
+package drandsim
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	tlockHttp "github.com/drand/tlock/networks/http"
+)
+
+var genesis = time.Unix(1700000000, 0)
+
+func newTestNetwork(t *testing.T, scheme string) (*Network, *ManualClock) {
+	t.Helper()
+	clock := NewManualClock(genesis)
+	network, err := New(Config{Scheme: scheme, Seed: []byte(scheme), Clock: clock})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return network, clock
+}
+
+// TestBeaconsFollowClock checks that rounds are only signed once the clock reaches them
+func TestBeaconsFollowClock(t *testing.T) {
+	for _, scheme := range []string{crypto.SigsOnG1ID, crypto.UnchainedSchemeID} {
+		t.Run(scheme, func(t *testing.T) {
+			network, clock := newTestNetwork(t, scheme)
+
+			if got := network.LatestRound(); got != 1 {
+				t.Fatalf("LatestRound at genesis = %d, want 1", got)
+			}
+			if _, err := network.Signature(5); !errors.Is(err, ErrRoundNotReached) {
+				t.Fatalf("Expected ErrRoundNotReached, got %v", err)
+			}
+
+			clock.Advance(4 * 3 * time.Second)
+			beacon, err := network.Beacon(5)
+			if err != nil {
+				t.Fatalf("Beacon failed: %v", err)
+			}
+
+			sch := network.Scheme()
+			if err := sch.VerifyBeacon(beacon, network.PublicKey()); err != nil {
+				t.Fatalf("Beacon does not verify: %v", err)
+			}
+		})
+	}
+}
+
+// TestSeedIsDeterministic checks that equal configs give equal chains
+func TestSeedIsDeterministic(t *testing.T) {
+	a, _ := newTestNetwork(t, crypto.SigsOnG1ID)
+	b, _ := newTestNetwork(t, crypto.SigsOnG1ID)
+	if a.ChainHash() != b.ChainHash() {
+		t.Fatalf("Chain hashes differ: %s vs %s", a.ChainHash(), b.ChainHash())
+	}
+
+	c, err := New(Config{Seed: []byte("other"), GenesisTime: genesis.Unix()})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if a.ChainHash() == c.ChainHash() {
+		t.Fatal("Different seeds produced the same chain")
+	}
+}
+
+// TestRejectsChainedScheme checks that schemes tlock cannot use are refused
+func TestRejectsChainedScheme(t *testing.T) {
+	if _, err := New(Config{Scheme: crypto.DefaultSchemeID}); err == nil {
+		t.Fatal("Expected chained scheme to be rejected")
+	}
+}
+
+// TestHTTPAPI checks the server against the drand HTTP client used by tlock
+func TestHTTPAPI(t *testing.T) {
+	for _, scheme := range []string{crypto.SigsOnG1ID, crypto.UnchainedSchemeID} {
+		t.Run(scheme, func(t *testing.T) {
+			network, clock := newTestNetwork(t, scheme)
+			server := network.NewServer()
+			defer server.Close()
+
+			// /info is a valid drand chain info with the advertised hash
+			resp, err := http.Get(server.URL + "/info")
+			if err != nil {
+				t.Fatalf("GET /info failed: %v", err)
+			}
+			info, err := chain.InfoFromJSON(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				t.Fatalf("InfoFromJSON failed: %v", err)
+			}
+			if info.HashString() != network.ChainHash() {
+				t.Fatalf("Served hash %s, want %s", info.HashString(), network.ChainHash())
+			}
+			if !strings.Contains(network.ChainInfoJSON(), `"hash":"`+network.ChainHash()+`"`) {
+				t.Fatal("ChainInfoJSON does not carry the chain hash")
+			}
+
+			// Chain-hash prefixed routes, as requested by tlock
+			client, err := tlockHttp.NewNetwork(server.URL, network.ChainHash())
+			if err != nil {
+				t.Fatalf("tlock http NewNetwork failed: %v", err)
+			}
+
+			if _, err := client.Signature(3); err == nil {
+				t.Fatal("Expected future round to be refused")
+			}
+
+			clock.Advance(time.Minute)
+			got, err := client.Signature(3)
+			if err != nil {
+				t.Fatalf("Signature failed: %v", err)
+			}
+			want, _ := network.Signature(3)
+			if !bytes.Equal(got, want) {
+				t.Fatalf("Served signature %x, want %x", got, want)
+			}
+
+			// Unknown chain hashes are not served
+			resp, err = http.Get(server.URL + "/" + hex.EncodeToString(make([]byte, 32)) + "/info")
+			if err != nil {
+				t.Fatalf("GET failed: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusNotFound {
+				t.Fatalf("Unknown chain hash status %d, want 404", resp.StatusCode)
+			}
+		})
+	}
+}
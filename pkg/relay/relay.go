@@ -0,0 +1,334 @@
+// Package relay is a caching drand HTTP relay.
+//
+// A Server serves the public drand HTTP API (/{chainhash}/info and
+// /{chainhash}/public/{round|latest}) from a set of upstream endpoints. Chain
+// info is cross-checked across upstreams, every beacon is verified against the
+// chain key before it is served or cached, and verified beacons are served from
+// a vte.BeaconCache afterwards. Its URL is a drop-in drand endpoint for
+// vte.Decrypt, GenerateVTEParams.DrandEndpoints and tlock's HTTP network.
+package relay
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock"
+	"golang.org/x/sync/singleflight"
+
+	"vte-tlock/pkg/vte"
+)
+
+// Config configures a relay Server
+type Config struct {
+	// Upstreams are the drand endpoints the relay fetches from
+	Upstreams []string
+
+	// Cache holds chain info and verified beacons. Nil uses an in-memory
+	// cache of CacheSize beacons, evicting the oldest.
+	Cache *vte.BeaconCache
+
+	// CacheSize bounds the in-memory cache. Zero uses
+	// vte.DefaultMemoryBeacons.
+	CacheSize int
+
+	// DefaultChain is the hex chain hash served by the unprefixed /info and
+	// /public routes. Empty leaves them unrouted.
+	DefaultChain string
+
+	// RateLimit is the sustained number of requests per second allowed per
+	// client, with bursts up to Burst. Zero disables rate limiting.
+	RateLimit float64
+	Burst     int
+
+	// AllowedOrigins lists the origins allowed by CORS; empty allows any
+	AllowedOrigins []string
+
+	// TrustForwardedFor identifies clients by the first X-Forwarded-For
+	// address. Only enable it behind a proxy that sets the header.
+	TrustForwardedFor bool
+
+	// Now supplies the time used to tell future rounds apart. Nil uses time.Now.
+	Now func() time.Time
+}
+
+// Server is a drand relay; it implements http.Handler
+type Server struct {
+	cfg     Config
+	cache   *vte.BeaconCache
+	limiter *rateLimiter
+	flight  singleflight.Group
+}
+
+// New validates the config and returns a relay
+func New(cfg Config) (*Server, error) {
+	if len(cfg.Upstreams) == 0 {
+		return nil, fmt.Errorf("%w: at least one upstream is required", vte.ErrInvalidInput)
+	}
+	if cfg.DefaultChain != "" {
+		hash, err := hex.DecodeString(cfg.DefaultChain)
+		if err != nil || len(hash) != 32 {
+			return nil, fmt.Errorf("%w: default chain must be a 32-byte hex chain hash", vte.ErrInvalidInput)
+		}
+		if known, err := vte.Networks.LookupHash(hash); err == nil && !known.Tlock() {
+			return nil, fmt.Errorf("%w: default chain %s uses chained scheme %s, the relay only serves unchained chains", vte.ErrInvalidInput, known.Name, known.SchemeID)
+		}
+	}
+	if cfg.RateLimit < 0 || cfg.Burst < 0 || cfg.CacheSize < 0 {
+		return nil, fmt.Errorf("%w: rate limit and cache size must not be negative", vte.ErrInvalidInput)
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+
+	s := &Server{cfg: cfg, cache: cfg.Cache}
+	if s.cache == nil {
+		s.cache = vte.NewBeaconCache(vte.NewMemoryBeaconStoreSize(cfg.CacheSize))
+	}
+	if cfg.RateLimit > 0 {
+		burst := cfg.Burst
+		if burst == 0 {
+			burst = int(cfg.RateLimit) + 1
+		}
+		s.limiter = newRateLimiter(cfg.RateLimit, burst, cfg.Now)
+	}
+	return s, nil
+}
+
+// ServeHTTP serves:
+//
+//	GET /health
+//	GET [/{chainhash}]/info
+//	GET [/{chainhash}]/public/latest
+//	GET [/{chainhash}]/public/{round}
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.setCORS(w, r)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.limiter != nil && !s.limiter.allow(s.clientID(r)) {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 && parts[0] == "health" {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok\n"))
+		return
+	}
+
+	chainHex := s.cfg.DefaultChain
+	if len(parts) > 1 && len(parts[0]) == 64 {
+		chainHex, parts = strings.ToLower(parts[0]), parts[1:]
+	}
+	chainHash, err := hex.DecodeString(chainHex)
+	if err != nil || len(chainHash) != 32 {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "info":
+		s.serveInfo(w, r, chainHash)
+	case len(parts) == 2 && parts[0] == "public":
+		s.serveBeacon(w, r, chainHash, parts[1])
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *Server) serveInfo(w http.ResponseWriter, r *http.Request, chainHash []byte) {
+	trusted, err := s.chainInfo(r.Context(), chainHash)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	data, err := trusted.ChainInfoJSON()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// Chain info never changes for a chain hash
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+func (s *Server) serveBeacon(w http.ResponseWriter, r *http.Request, chainHash []byte, which string) {
+	trusted, err := s.chainInfo(r.Context(), chainHash)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	period := time.Duration(trusted.Period) * time.Second
+	current := common.CurrentRound(s.cfg.Now().Unix(), period, trusted.GenesisTime)
+
+	var round uint64
+	latest := which == "latest"
+	if latest {
+		round = current
+	} else if round, err = strconv.ParseUint(which, 10, 64); err != nil || round == 0 {
+		http.Error(w, "invalid round", http.StatusBadRequest)
+		return
+	}
+	// Allow one round of clock skew before refusing without asking upstream
+	if round > current+1 {
+		http.Error(w, fmt.Sprintf("round %d not reached yet", round), http.StatusTooEarly)
+		return
+	}
+
+	sig, err := s.beacon(r.Context(), trusted, round)
+	if latest && errors.Is(err, tlock.ErrTooEarly) && round > 1 {
+		// Upstreams may lag our clock by a moment
+		round--
+		sig, err = s.beacon(r.Context(), trusted, round)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if latest {
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", trusted.Period))
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(beaconJSON{
+		Round:      round,
+		Randomness: hex.EncodeToString(crypto.RandomnessFromSignature(sig)),
+		Signature:  hex.EncodeToString(sig),
+	})
+}
+
+// chainInfo returns cached chain info, or fetches it from the upstreams and
+// caches it. Concurrent misses for one chain share a single fetch. Chained
+// chains are refused: beaconJSON carries no previous signature.
+func (s *Server) chainInfo(ctx context.Context, chainHash []byte) (*vte.TrustedChainInfo, error) {
+	trusted, err := s.cache.ChainInfo(chainHash)
+	if err != nil {
+		v, err, _ := s.flight.Do("info/"+hex.EncodeToString(chainHash), func() (interface{}, error) {
+			trusted, err := vte.FetchChainInfo(context.WithoutCancel(ctx), chainHash, s.cfg.Upstreams)
+			if err != nil {
+				return nil, err
+			}
+			if !vte.UnchainedScheme(trusted.SchemeID) {
+				return trusted, nil
+			}
+			data, err := trusted.ChainInfoJSON()
+			if err != nil {
+				return nil, err
+			}
+			if err := s.cache.AddChainInfo(data, chainHash); err != nil {
+				return nil, err
+			}
+			return trusted, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		trusted = v.(*vte.TrustedChainInfo)
+	}
+	if !vte.UnchainedScheme(trusted.SchemeID) {
+		return nil, fmt.Errorf("%w: chain %x uses chained scheme %s, the relay only serves unchained chains", vte.ErrInvalidInput, chainHash, trusted.SchemeID)
+	}
+	return trusted, nil
+}
+
+// beacon returns a verified signature for round from the cache or the
+// upstreams. Upstream beacons that fail verification are never served.
+func (s *Server) beacon(ctx context.Context, trusted *vte.TrustedChainInfo, round uint64) ([]byte, error) {
+	if sig, err := s.cache.Signature(trusted.ChainHash, round); err == nil {
+		return sig, nil
+	}
+
+	key := fmt.Sprintf("beacon/%x/%d", trusted.ChainHash, round)
+	v, err, _ := s.flight.Do(key, func() (interface{}, error) {
+		sig, err := vte.FetchBeacon(context.WithoutCancel(ctx), trusted, round, s.cfg.Upstreams)
+		if err != nil {
+			return nil, err
+		}
+		if err := s.cache.AddBeacon(trusted.ChainHash, round, sig); err != nil {
+			return nil, err
+		}
+		return sig, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+// writeError maps relay failures to drand-compatible statuses
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, tlock.ErrTooEarly):
+		status = http.StatusTooEarly
+	case errors.Is(err, vte.ErrInvalidInput):
+		status = http.StatusBadRequest
+	case errors.Is(err, context.DeadlineExceeded):
+		status = http.StatusGatewayTimeout
+	}
+	http.Error(w, err.Error(), status)
+}
+
+func (s *Server) setCORS(w http.ResponseWriter, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	allowed := "*"
+	if len(s.cfg.AllowedOrigins) > 0 {
+		allowed = ""
+		for _, o := range s.cfg.AllowedOrigins {
+			if o == "*" || o == origin {
+				allowed = o
+				break
+			}
+		}
+		if allowed == "" {
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+	}
+	w.Header().Set("Access-Control-Allow-Origin", allowed)
+	w.Header().Set("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type")
+	w.Header().Set("Access-Control-Max-Age", "86400")
+}
+
+// clientID identifies a client for rate limiting
+func (s *Server) clientID(r *http.Request) string {
+	if s.cfg.TrustForwardedFor {
+		if fwd := r.Header.Get("X-Forwarded-For"); fwd != "" {
+			return strings.TrimSpace(strings.Split(fwd, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// beaconJSON is the drand /public/{round} response of unchained networks
+type beaconJSON struct {
+	Round      uint64 `json:"round"`
+	Randomness string `json:"randomness"`
+	Signature  string `json:"signature"`
+}
@@ -0,0 +1,219 @@
+package relay
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/crypto"
+
+	"vte-tlock/internal/drandtest"
+	"vte-tlock/pkg/drandsim"
+	"vte-tlock/pkg/vte"
+)
+
+func simulated(t *testing.T, seed string) (*drandsim.Network, *drandsim.ManualClock, *httptest.Server) {
+	t.Helper()
+	network, clock, server := drandtest.Start(t, drandsim.Config{Scheme: crypto.SigsOnG1ID, Seed: []byte(seed)})
+	clock.Advance(time.Hour)
+	return network, clock, server
+}
+
+func startRelay(t *testing.T, cfg Config) *httptest.Server {
+	t.Helper()
+	server, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	ts := httptest.NewServer(server)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func get(t *testing.T, url string) (*http.Response, string) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestRelayServesAndCaches(t *testing.T) {
+	network, clock, upstream := simulated(t, "relay")
+	relay := startRelay(t, Config{Upstreams: []string{upstream.URL}, Now: clock.Now})
+	base := relay.URL + "/" + network.ChainHash()
+
+	resp, body := get(t, base+"/info")
+	if resp.StatusCode != http.StatusOK || body != network.ChainInfoJSON() {
+		t.Fatalf("info: %d %s", resp.StatusCode, body)
+	}
+
+	round := network.LatestRound()
+	resp, body = get(t, base+"/public/"+strconv.FormatUint(round, 10))
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("beacon: %d %s", resp.StatusCode, body)
+	}
+	var beacon beaconJSON
+	_ = json.Unmarshal([]byte(body), &beacon)
+	want, _ := network.Signature(round)
+	if beacon.Round != round || beacon.Signature != hex.EncodeToString(want) {
+		t.Fatalf("Unexpected beacon %+v", beacon)
+	}
+	if !strings.Contains(resp.Header.Get("Cache-Control"), "immutable") {
+		t.Fatalf("Past beacons should be immutable, got %q", resp.Header.Get("Cache-Control"))
+	}
+
+	// Served from cache once the upstream is gone
+	upstream.Close()
+	if resp, body := get(t, base+"/public/"+strconv.FormatUint(round, 10)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("cached beacon: %d %s", resp.StatusCode, body)
+	}
+	if resp, _ := get(t, base+"/public/"+strconv.FormatUint(round-1, 10)); resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Expected 502 for an uncached beacon with no upstream, got %d", resp.StatusCode)
+	}
+
+	if resp, _ := get(t, base+"/public/"+strconv.FormatUint(round+10, 10)); resp.StatusCode != http.StatusTooEarly {
+		t.Fatalf("Expected 425 for a future round, got %d", resp.StatusCode)
+	}
+	if resp, _ := get(t, base+"/public/zero"); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for a bad round, got %d", resp.StatusCode)
+	}
+}
+
+func TestRelayRefusesForgedBeacons(t *testing.T) {
+	network, clock, good := simulated(t, "honest")
+	forger, err := drandsim.New(drandsim.Config{Seed: []byte("forger"), GenesisTime: network.Info().GenesisTime, Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Correct chain info, beacons signed with another key
+	forged := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/info") {
+			network.Handler().ServeHTTP(w, r)
+			return
+		}
+		r.URL.Path = strings.Replace(r.URL.Path, network.ChainHash(), forger.ChainHash(), 1)
+		forger.Handler().ServeHTTP(w, r)
+	}))
+	defer forged.Close()
+
+	round := strconv.FormatUint(network.LatestRound(), 10)
+	onlyForged := startRelay(t, Config{Upstreams: []string{forged.URL}, Now: clock.Now})
+	if resp, body := get(t, onlyForged.URL+"/"+network.ChainHash()+"/public/"+round); resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("Expected 502 for a forged beacon, got %d %s", resp.StatusCode, body)
+	}
+
+	both := startRelay(t, Config{Upstreams: []string{forged.URL, good.URL}, Now: clock.Now})
+	if resp, body := get(t, both.URL+"/"+network.ChainHash()+"/public/"+round); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Relay did not fail over past the forged upstream: %d %s", resp.StatusCode, body)
+	}
+}
+
+func TestRelayRateLimitAndCORS(t *testing.T) {
+	network, clock, upstream := simulated(t, "limits")
+	relay := startRelay(t, Config{
+		Upstreams:      []string{upstream.URL},
+		DefaultChain:   network.ChainHash(),
+		RateLimit:      1,
+		Burst:          2,
+		AllowedOrigins: []string{"https://app.example"},
+		Now:            clock.Now,
+	})
+
+	req, _ := http.NewRequest(http.MethodOptions, relay.URL+"/info", nil)
+	req.Header.Set("Origin", "https://app.example")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent || resp.Header.Get("Access-Control-Allow-Origin") != "https://app.example" {
+		t.Fatalf("Preflight: %d, allow-origin %q", resp.StatusCode, resp.Header.Get("Access-Control-Allow-Origin"))
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, relay.URL+"/info", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+		t.Fatal("Disallowed origin got a CORS header")
+	}
+
+	// Preflights are free; the GETs use the burst of 2 and the clock is frozen
+	if resp, _ := get(t, relay.URL+"/info"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the second request to pass, got %d", resp.StatusCode)
+	}
+	if resp, _ := get(t, relay.URL+"/info"); resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", resp.StatusCode)
+	}
+	clock.Advance(time.Second)
+	if resp, _ := get(t, relay.URL+"/info"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the bucket to refill, got %d", resp.StatusCode)
+	}
+}
+
+// TestRelayAsDrandEndpoint uses the relay as the only endpoint for vte
+func TestRelayAsDrandEndpoint(t *testing.T) {
+	network, clock, upstream := simulated(t, "drop-in")
+	relay := startRelay(t, Config{Upstreams: []string{upstream.URL}, Now: clock.Now})
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	ctx := context.Background()
+
+	round := network.LatestRound() + 2
+	r2 := vte.PlaintextToR2("relayed")
+	capsule, err := vte.Encrypt(ctx, chainHash, round, r2, []string{relay.URL})
+	if err != nil {
+		t.Fatalf("Encrypt through the relay failed: %v", err)
+	}
+	clock.Advance(2 * network.Info().Period)
+
+	got, err := vte.Decrypt(ctx, chainHash, round, capsule, []string{relay.URL})
+	if err != nil {
+		t.Fatalf("Decrypt through the relay failed: %v", err)
+	}
+	if string(got) != string(r2) {
+		t.Fatalf("Decrypted %x, want %x", got, r2)
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	for _, cfg := range []Config{
+		{},
+		{Upstreams: []string{"http://x"}, DefaultChain: "nothex"},
+		{Upstreams: []string{"http://x"}, RateLimit: -1},
+		{Upstreams: []string{"http://x"}, DefaultChain: mainnetHash},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) should fail", cfg)
+		}
+	}
+}
+
+const mainnetHash = "8990e7a9aaed2ffed73dbd7092123d6f289930540d7651336225dc172e51b2ce"
+
+func TestRelayRefusesChainedChains(t *testing.T) {
+	s, err := New(Config{Upstreams: []string{"http://127.0.0.1:1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"/" + mainnetHash + "/info", "/" + mainnetHash + "/public/1"} {
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET %s: status %d, want %d", path, rec.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package swap
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"sync"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+var tagSpend = []byte("VTE/swap/spend")
+
+// SpendPath is one of the two ways out of a lock
+type SpendPath string
+
+const (
+	PathClaim  SpendPath = "claim"  // pays the counterparty of the funder
+	PathRefund SpendPath = "refund" // pays the funder back
+)
+
+// Lock is a swap output. Each path pays a fixed party and needs one
+// signature: the claim is signed by the funder (ClaimKey) and the refund by
+// the counterparty (RefundKey). On a real chain this is a 2-of-2 output with
+// the beneficiary's signature added; refunds need no chain timelock since
+// the refund signature is only completed with a VTE-locked secret.
+type Lock struct {
+	ID        string `json:"id"`
+	Chain     string `json:"chain"`
+	Amount    uint64 `json:"amount"`
+	Scheme    string `json:"scheme"`     // adaptor scheme of both signatures
+	ClaimKey  []byte `json:"claim_key"`  // SEC1 compressed
+	RefundKey []byte `json:"refund_key"` // SEC1 compressed
+}
+
+// Spend spends a lock by one path
+type Spend struct {
+	LockID string    `json:"lock_id"`
+	Path   SpendPath `json:"path"`
+	Sig    []byte    `json:"sig"`
+}
+
+// LockStatus is a funded lock and how it was spent, if it was
+type LockStatus struct {
+	Lock  Lock   `json:"lock"`
+	Spent *Spend `json:"spent,omitempty"`
+}
+
+// Chain is where a swap leg settles. Implementations check spend signatures
+// the way the chain would, with the lock's adaptor scheme Verify.
+type Chain interface {
+	// Fund publishes a lock. Lock IDs are unique per chain.
+	Fund(ctx context.Context, lock *Lock) error
+
+	// Lock returns a funded lock, or ErrLockNotFound
+	Lock(ctx context.Context, id string) (*LockStatus, error)
+
+	// Spend publishes a spend. ErrLockSpent if the lock is already spent.
+	Spend(ctx context.Context, spend *Spend) error
+}
+
+// SpendMessage is the 32-byte message signed to spend a lock by path
+func SpendMessage(lock *Lock, path SpendPath) []byte {
+	var amount [8]byte
+	binary.BigEndian.PutUint64(amount[:], lock.Amount)
+	h := chainhash.TaggedHash(tagSpend, []byte(lock.Chain), []byte{0}, []byte(lock.ID), []byte{0}, amount[:], []byte(path))
+	return h[:]
+}
+
+// signer returns the key that signs a path
+func (l *Lock) signer(path SpendPath) ([]byte, error) {
+	switch path {
+	case PathClaim:
+		return l.ClaimKey, nil
+	case PathRefund:
+		return l.RefundKey, nil
+	}
+	return nil, fmt.Errorf("%w: unknown spend path %q", ErrInvalidSpend, path)
+}
+
+// equal compares every field of two locks
+func (l *Lock) equal(o *Lock) bool {
+	return l.ID == o.ID && l.Chain == o.Chain && l.Amount == o.Amount && l.Scheme == o.Scheme &&
+		string(l.ClaimKey) == string(o.ClaimKey) && string(l.RefundKey) == string(o.RefundKey)
+}
+
+// SimChain is an in-memory Chain for tests and demos: funding is final at
+// once and spends are checked and applied atomically
+type SimChain struct {
+	name string
+
+	mu    sync.Mutex
+	locks map[string]*LockStatus
+}
+
+// NewSimChain returns an empty chain that accepts locks named for it
+func NewSimChain(name string) *SimChain {
+	return &SimChain{name: name, locks: make(map[string]*LockStatus)}
+}
+
+func (c *SimChain) Fund(_ context.Context, lock *Lock) error {
+	if lock.Chain != c.name {
+		return fmt.Errorf("%w: lock is for chain %q, not %q", ErrInvalidSpend, lock.Chain, c.name)
+	}
+	if lock.ID == "" || lock.Amount == 0 {
+		return fmt.Errorf("%w: lock needs an ID and an amount", ErrInvalidSpend)
+	}
+	if _, err := schemeByName(lock.Scheme); err != nil {
+		return err
+	}
+	for _, key := range [][]byte{lock.ClaimKey, lock.RefundKey} {
+		if _, err := btcec.ParsePubKey(key); err != nil {
+			return fmt.Errorf("%w: lock key: %v", ErrInvalidSpend, err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.locks[lock.ID]; ok {
+		return fmt.Errorf("%w: lock %s already exists", ErrInvalidSpend, lock.ID)
+	}
+	c.locks[lock.ID] = &LockStatus{Lock: *lock}
+	return nil
+}
+
+func (c *SimChain) Lock(_ context.Context, id string) (*LockStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status, ok := c.locks[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrLockNotFound, id)
+	}
+	out := *status
+	if status.Spent != nil {
+		spent := *status.Spent
+		out.Spent = &spent
+	}
+	return &out, nil
+}
+
+func (c *SimChain) Spend(_ context.Context, spend *Spend) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status, ok := c.locks[spend.LockID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrLockNotFound, spend.LockID)
+	}
+	if status.Spent != nil {
+		return fmt.Errorf("%w: %s by %s", ErrLockSpent, spend.LockID, status.Spent.Path)
+	}
+
+	lock := &status.Lock
+	key, err := lock.signer(spend.Path)
+	if err != nil {
+		return err
+	}
+	pub, err := btcec.ParsePubKey(key)
+	if err != nil {
+		return fmt.Errorf("%w: lock key: %v", ErrInvalidSpend, err)
+	}
+	scheme, err := schemeByName(lock.Scheme)
+	if err != nil {
+		return err
+	}
+	if err := scheme.Verify(pub, SpendMessage(lock, spend.Path), spend.Sig); err != nil {
+		return fmt.Errorf("%w: %s of %s: %v", ErrInvalidSpend, spend.Path, spend.LockID, err)
+	}
+	s := *spend
+	status.Spent = &s
+	return nil
+}
@@ -0,0 +1,138 @@
+package swap
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"vte-tlock/pkg/vte"
+)
+
+// MessageType names a protocol message on the wire
+type MessageType string
+
+const (
+	MsgOffer    MessageType = "offer"
+	MsgAccept   MessageType = "accept"
+	MsgPackage  MessageType = "package"
+	MsgFunded   MessageType = "funded"
+	MsgClaimSig MessageType = "claim_sig"
+)
+
+// Message is one protocol step. Messages travel over any transport as the
+// JSON envelope of EncodeMessage.
+type Message interface {
+	Type() MessageType
+	Swap() string
+}
+
+// Asset is an amount on a chain
+type Asset struct {
+	Chain  string `json:"chain"`
+	Amount uint64 `json:"amount"`
+}
+
+// Offer opens a swap (maker → taker). The maker locks Give and wants Want.
+// The taker's refund opens at TakerRefundRound and the maker's at the later
+// MakerRefundRound, both on the drand chain ChainHash: the maker must claim
+// before the first, the taker before the second.
+type Offer struct {
+	SwapID           string `json:"swap_id"`
+	Scheme           string `json:"scheme"`
+	MakerPub         []byte `json:"maker_pub"`
+	Give             Asset  `json:"give"`
+	Want             Asset  `json:"want"`
+	ChainHash        []byte `json:"drand_chain_hash"`
+	TakerRefundRound uint64 `json:"taker_refund_round"`
+	MakerRefundRound uint64 `json:"maker_refund_round"`
+}
+
+// Accept takes an offer (taker → maker). Package locks, to
+// MakerRefundRound, the secret that completes RefundPreSig: the taker's
+// pre-signature of the maker's refund.
+type Accept struct {
+	SwapID       string            `json:"swap_id"`
+	TakerPub     []byte            `json:"taker_pub"`
+	Package      *vte.VTEPackageV2 `json:"package"`
+	RefundPreSig []byte            `json:"refund_pre_sig"`
+}
+
+// Package answers an accept (maker → taker) with the maker's package, locked
+// to TakerRefundRound, its pre-signature of the taker's refund, and the
+// adaptor point both claims are pre-signed with
+type Package struct {
+	SwapID       string            `json:"swap_id"`
+	Package      *vte.VTEPackageV2 `json:"package"`
+	RefundPreSig []byte            `json:"refund_pre_sig"`
+	ClaimPoint   []byte            `json:"claim_point"`
+}
+
+// Funded announces a funded lock. The maker's carries its pre-signature of
+// the taker's claim.
+type Funded struct {
+	SwapID      string `json:"swap_id"`
+	Lock        Lock   `json:"lock"`
+	ClaimPreSig []byte `json:"claim_pre_sig,omitempty"`
+}
+
+// ClaimSig carries the taker's pre-signature of the maker's claim, the last
+// message of a swap
+type ClaimSig struct {
+	SwapID string `json:"swap_id"`
+	PreSig []byte `json:"pre_sig"`
+}
+
+func (*Offer) Type() MessageType    { return MsgOffer }
+func (*Accept) Type() MessageType   { return MsgAccept }
+func (*Package) Type() MessageType  { return MsgPackage }
+func (*Funded) Type() MessageType   { return MsgFunded }
+func (*ClaimSig) Type() MessageType { return MsgClaimSig }
+
+func (m *Offer) Swap() string    { return m.SwapID }
+func (m *Accept) Swap() string   { return m.SwapID }
+func (m *Package) Swap() string  { return m.SwapID }
+func (m *Funded) Swap() string   { return m.SwapID }
+func (m *ClaimSig) Swap() string { return m.SwapID }
+
+type envelope struct {
+	Type MessageType     `json:"type"`
+	Body json.RawMessage `json:"body"`
+}
+
+// EncodeMessage wraps a message in a typed JSON envelope
+func EncodeMessage(m Message) ([]byte, error) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{Type: m.Type(), Body: body})
+}
+
+// DecodeMessage parses an EncodeMessage envelope
+func DecodeMessage(data []byte) (Message, error) {
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMessage, err)
+	}
+	var m Message
+	switch env.Type {
+	case MsgOffer:
+		m = &Offer{}
+	case MsgAccept:
+		m = &Accept{}
+	case MsgPackage:
+		m = &Package{}
+	case MsgFunded:
+		m = &Funded{}
+	case MsgClaimSig:
+		m = &ClaimSig{}
+	default:
+		return nil, fmt.Errorf("%w: unknown message type %q", ErrInvalidMessage, env.Type)
+	}
+	if err := json.Unmarshal(env.Body, m); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidMessage, env.Type, err)
+	}
+	if m.Swap() == "" {
+		return nil, fmt.Errorf("%w: %s without a swap ID", ErrInvalidMessage, env.Type)
+	}
+	return m, nil
+}
@@ -0,0 +1,862 @@
+// Package swap runs a two-party atomic swap around VTE packages as a
+// persisted state machine.
+//
+// The maker locks Give on one chain and the taker locks Want on another.
+// Claims are adaptor signatures (see package adaptor) on the maker's claim
+// point T = t·G. The maker claims the taker's lock by completing the taker's
+// pre-signature with t, which publishes t. The taker then extracts t from
+// that claim and completes the maker's pre-signature of its own claim.
+//
+// Refunds need no chain timelock. Each lock is refunded with a signature of
+// the counterparty, pre-signed on the R2 of a VTE package the counterparty
+// made. The taker's refund opens with the maker's package at
+// TakerRefundRound and the maker's with the taker's package at the later
+// MakerRefundRound. If one party goes silent, the other refunds with
+// vte.DecryptVTE once the round is out. Neither party funds or sends its
+// claim pre-signature within Config.SafetyRounds of TakerRefundRound, so a
+// claim does not race the taker's refund.
+//
+//	maker                                 taker
+//	Offer    ──────────────────────────▶
+//	         ◀──────────────────────────  Accept   (taker package, refund pre-sig)
+//	Package  ──────────────────────────▶           (maker package, refund pre-sig, T)
+//	         ◀──────────────────────────  Funded   (taker lock)
+//	Funded   ──────────────────────────▶           (maker lock, claim pre-sig)
+//	         ◀──────────────────────────  ClaimSig
+//	claim the taker lock, publishing t    extract t, claim the maker lock
+//
+// Every package is checked with a vte.VerificationPolicy pinned to the swap:
+// the refund round, session ID = swap ID, and refund tx = the refund spend
+// message. It must also bind both keys and the refunded lock in ctx_v3
+// fields.
+//
+// Trust assumption: there is no TLE proof yet, so nothing checks that the
+// counterparty's capsule encrypts the r2 behind its R2. The proofs show the
+// counterparty knows r2, not that the drand round will reveal it. A party
+// funds its lock trusting that capsule; if it encrypts anything else, the
+// refund cannot be completed, which only shows when the round is out. Set
+// Require.TLE in Config.Policy once a TLE verifier exists.
+//
+// Handle takes the next message and returns the reply. Tick watches the
+// chains and refunds or claims. Both save the state file before and after
+// every broadcast. The state file holds the party's secrets, so keep it
+// private.
+package swap
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/drand/tlock"
+
+	"vte-tlock/pkg/adaptor"
+	"vte-tlock/pkg/vte"
+)
+
+// StateVersion is the version tag of the state file
+const StateVersion = "vte-swap/1"
+
+// FormatID is the package format used for refund packages
+const FormatID = "tlock_v1_age_pairing"
+
+// DefaultSafetyRounds is the safety margin used when Config.SafetyRounds is
+// zero
+const DefaultSafetyRounds = 2
+
+var (
+	ErrInvalidMessage    = errors.New("invalid swap message")
+	ErrUnexpectedMessage = errors.New("unexpected swap message")
+	ErrRejected          = errors.New("swap rejected")
+	ErrLockNotFound      = errors.New("lock not found")
+	ErrLockSpent         = errors.New("lock already spent")
+	ErrInvalidSpend      = errors.New("invalid spend")
+	ErrTooLate           = errors.New("too close to the refund round")
+)
+
+// Role is the side of a swap
+type Role string
+
+const (
+	RoleMaker Role = "maker"
+	RoleTaker Role = "taker"
+)
+
+// State is the progress of a swap
+type State string
+
+const (
+	StateOffered   State = "offered"   // maker: offer sent
+	StateAccepted  State = "accepted"  // taker: package and refund pre-signature sent
+	StatePackaged  State = "packaged"  // maker: packages exchanged, waiting for the taker's lock
+	StateFunded    State = "funded"    // own lock funded, waiting for the counterparty
+	StatePresigned State = "presigned" // taker: claim pre-signature sent, waiting for the maker's claim
+	StateCompleted State = "completed" // claimed the counterparty's lock
+	StateRefunded  State = "refunded"  // own lock refunded
+	StateAborted   State = "aborted"   // stopped before any funds were locked
+)
+
+// Leg is one lock of a swap and what spends it
+type Leg struct {
+	Lock Lock `json:"lock"`
+
+	// ClaimPreSig is the funder's pre-signature of the claim, on the claim
+	// point
+	ClaimPreSig []byte `json:"claim_pre_sig,omitempty"`
+
+	// RefundPreSig is the counterparty's pre-signature of the refund, on the
+	// R2 of RefundPackage, which the counterparty made
+	RefundPreSig  []byte            `json:"refund_pre_sig,omitempty"`
+	RefundPackage *vte.VTEPackageV2 `json:"refund_package,omitempty"`
+}
+
+// Swap is the persisted state of one swap
+type Swap struct {
+	ID       string `json:"id"`
+	Role     Role   `json:"role"`
+	State    State  `json:"state"`
+	Offer    *Offer `json:"offer"`
+	TakerPub []byte `json:"taker_pub,omitempty"`
+
+	// Maker is the lock the maker funds (Give), Taker the one the taker
+	// funds (Want)
+	Maker Leg `json:"maker"`
+	Taker Leg `json:"taker"`
+
+	ClaimPoint []byte `json:"claim_point,omitempty"`
+
+	// PackageSecret is the r2 of this party's package. ClaimSecret is t:
+	// the maker's from the start, the taker's once extracted.
+	PackageSecret []byte `json:"package_secret,omitempty"`
+	ClaimSecret   []byte `json:"claim_secret,omitempty"`
+
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Config configures a Party
+type Config struct {
+	Key *btcec.PrivateKey
+
+	// Chains by the names used in Offer.Give and Offer.Want
+	Chains map[string]Chain
+
+	// Endpoints are the drand endpoints used to make and open packages
+	Endpoints []string
+
+	// Policy is applied to the counterparty's package, with Round,
+	// SessionID and RefundTxHex set for the swap and AllowedCtxSchemas set
+	// to ctx_v3. Nil uses
+	// vte.DefaultPolicy, which requires a commitment proof.
+	Policy *vte.VerificationPolicy
+
+	// GenerateProof adds a commitment proof to this party's package
+	GenerateProof bool
+
+	// Rand supplies secrets, nonces and package randomness. Nil uses
+	// crypto/rand.
+	Rand io.Reader
+
+	// StatePath is the state file. Empty keeps the state in memory only.
+	StatePath string
+
+	// SafetyRounds is how many rounds before TakerRefundRound this party
+	// still funds a lock or sends its claim pre-signature, and the least gap
+	// it accepts between the two refund rounds. Zero uses
+	// DefaultSafetyRounds.
+	SafetyRounds uint64
+
+	// Now is the clock compared with the drand rounds. Nil uses time.Now.
+	Now func() time.Time
+}
+
+// Party is one side of one swap
+type Party struct {
+	cfg Config
+
+	mu   sync.Mutex
+	swap *Swap
+}
+
+// Propose starts a swap as maker and returns the offer to send. MakerPub is
+// set from the key and an empty Scheme is adaptor.SchnorrScheme.
+func Propose(cfg Config, offer Offer) (*Party, Message, error) {
+	if cfg.Key == nil {
+		return nil, nil, fmt.Errorf("%w: a key is required", ErrInvalidMessage)
+	}
+	if offer.Scheme == "" {
+		offer.Scheme = adaptor.SchnorrScheme
+	}
+	offer.MakerPub = cfg.Key.PubKey().SerializeCompressed()
+	p := &Party{cfg: cfg, swap: &Swap{ID: offer.SwapID, Role: RoleMaker, State: StateOffered, Offer: &offer}}
+	if err := p.validateOffer(); err != nil {
+		return nil, nil, err
+	}
+	if err := p.save(); err != nil {
+		return nil, nil, err
+	}
+	out := offer
+	return p, &out, nil
+}
+
+// Join takes an offer as taker and returns the accept to send
+func Join(ctx context.Context, cfg Config, offer *Offer) (*Party, Message, error) {
+	if cfg.Key == nil {
+		return nil, nil, fmt.Errorf("%w: a key is required", ErrInvalidMessage)
+	}
+	o := *offer
+	p := &Party{cfg: cfg, swap: &Swap{
+		ID:       o.SwapID,
+		Role:     RoleTaker,
+		State:    StateAccepted,
+		Offer:    &o,
+		TakerPub: cfg.Key.PubKey().SerializeCompressed(),
+	}}
+	if err := p.validateOffer(); err != nil {
+		return nil, nil, err
+	}
+	if err := p.beforeDeadline(ctx, "joining"); err != nil {
+		return nil, nil, err
+	}
+	s := p.swap
+	s.Maker.Lock, s.Taker.Lock = p.locks()
+
+	pkg, secret, preSig, err := p.refundPackage(&s.Maker.Lock, o.MakerRefundRound)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.PackageSecret = secret
+	if err := p.save(); err != nil {
+		return nil, nil, err
+	}
+	return p, &Accept{SwapID: s.ID, TakerPub: s.TakerPub, Package: pkg, RefundPreSig: preSig}, nil
+}
+
+// Resume loads a swap from cfg.StatePath
+func Resume(cfg Config) (*Party, error) {
+	data, err := os.ReadFile(cfg.StatePath)
+	if err != nil {
+		return nil, fmt.Errorf("read state: %w", err)
+	}
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("%w: state file %s: %v", vte.ErrInvalidInput, cfg.StatePath, err)
+	}
+	if state.Version != StateVersion {
+		return nil, fmt.Errorf("%w: state file %s is %q, expected %q", vte.ErrVersionMismatch, cfg.StatePath, state.Version, StateVersion)
+	}
+	if state.Swap == nil || state.Swap.Offer == nil {
+		return nil, fmt.Errorf("%w: state file %s has no swap", vte.ErrInvalidInput, cfg.StatePath)
+	}
+	p := &Party{cfg: cfg, swap: state.Swap}
+	if cfg.Key == nil || !bytes.Equal(p.ownPub(), cfg.Key.PubKey().SerializeCompressed()) {
+		return nil, fmt.Errorf("%w: the key is not the %s of swap %s", vte.ErrInvalidInput, p.swap.Role, p.swap.ID)
+	}
+	return p, nil
+}
+
+// Swap returns a copy of the swap state
+func (p *Party) Swap() Swap {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return *p.swap
+}
+
+// Handle processes a message from the counterparty and returns the reply,
+// nil when there is none. A message that fails verification before this
+// party locked funds aborts the swap; after that, it is only returned as an
+// error and Tick still refunds when the time comes.
+func (p *Party) Handle(ctx context.Context, m Message) (Message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.swap
+	switch m.(type) {
+	case *Offer, *Accept, *Package, *Funded, *ClaimSig:
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrInvalidMessage, m)
+	}
+	if m.Swap() != s.ID {
+		return nil, fmt.Errorf("%w: message for swap %q, this is %q", ErrUnexpectedMessage, m.Swap(), s.ID)
+	}
+
+	var reply Message
+	var err error
+	switch {
+	case s.Role == RoleMaker && s.State == StateOffered && m.Type() == MsgAccept:
+		reply, err = p.handleAccept(m.(*Accept))
+		if err != nil {
+			p.abort(err)
+		}
+	case s.Role == RoleTaker && s.State == StateAccepted && m.Type() == MsgPackage:
+		reply, err = p.handlePackage(ctx, m.(*Package))
+		if err != nil && s.State == StateAccepted {
+			p.abort(err)
+		}
+	case s.Role == RoleMaker && s.State == StatePackaged && m.Type() == MsgFunded:
+		reply, err = p.handleTakerFunded(ctx, m.(*Funded))
+		if errors.Is(err, ErrTooLate) {
+			p.abort(err)
+		}
+	case s.Role == RoleTaker && s.State == StateFunded && m.Type() == MsgFunded:
+		reply, err = p.handleMakerFunded(ctx, m.(*Funded))
+	case s.Role == RoleMaker && s.State == StateFunded && m.Type() == MsgClaimSig:
+		err = p.handleClaimSig(ctx, m.(*ClaimSig))
+	default:
+		return nil, fmt.Errorf("%w: %s in state %s of the %s", ErrUnexpectedMessage, m.Type(), s.State, s.Role)
+	}
+	if err != nil {
+		s.LastError = err.Error()
+	} else {
+		s.LastError = ""
+	}
+	if saveErr := p.save(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Tick watches the chains and takes the swap further without the
+// counterparty. It finishes a claim once the counterparty's claim reveals
+// t, refunds once the refund package opens (tlock.ErrTooEarly before that
+// is not an error), and funds again a lock whose broadcast was cut short.
+func (p *Party) Tick(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s := p.swap
+
+	var err error
+	switch {
+	case s.State == StateFunded || s.State == StatePresigned:
+		if err = p.ensureFunded(ctx); err == nil {
+			if s.Role == RoleMaker {
+				err = p.tickMaker(ctx)
+			} else {
+				err = p.tickTaker(ctx)
+			}
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		s.LastError = err.Error()
+	}
+	if saveErr := p.save(); saveErr != nil && err == nil {
+		err = saveErr
+	}
+	return err
+}
+
+func (p *Party) handleAccept(m *Accept) (Message, error) {
+	s := p.swap
+	if _, err := btcec.ParsePubKey(m.TakerPub); err != nil {
+		return nil, fmt.Errorf("%w: taker key: %v", ErrInvalidMessage, err)
+	}
+	s.TakerPub = m.TakerPub
+	s.Maker.Lock, s.Taker.Lock = p.locks()
+	if err := p.verifyRefund(&s.Maker.Lock, s.Offer.MakerRefundRound, m.Package, m.RefundPreSig); err != nil {
+		return nil, err
+	}
+	s.Maker.RefundPackage, s.Maker.RefundPreSig = m.Package, m.RefundPreSig
+
+	pkg, secret, preSig, err := p.refundPackage(&s.Taker.Lock, s.Offer.TakerRefundRound)
+	if err != nil {
+		return nil, err
+	}
+	t, err := randSecret(p.cfg.Rand)
+	if err != nil {
+		return nil, err
+	}
+	if s.ClaimPoint, err = vte.ComputeR2Point(t); err != nil {
+		return nil, err
+	}
+	s.PackageSecret, s.ClaimSecret = secret, t
+	s.State = StatePackaged
+	return &Package{SwapID: s.ID, Package: pkg, RefundPreSig: preSig, ClaimPoint: s.ClaimPoint}, nil
+}
+
+func (p *Party) handlePackage(ctx context.Context, m *Package) (Message, error) {
+	s := p.swap
+	if err := p.verifyRefund(&s.Taker.Lock, s.Offer.TakerRefundRound, m.Package, m.RefundPreSig); err != nil {
+		return nil, err
+	}
+	if _, err := btcec.ParsePubKey(m.ClaimPoint); err != nil {
+		return nil, fmt.Errorf("%w: claim point: %v", ErrInvalidMessage, err)
+	}
+	s.Taker.RefundPackage, s.Taker.RefundPreSig = m.Package, m.RefundPreSig
+	s.ClaimPoint = m.ClaimPoint
+
+	if err := p.beforeDeadline(ctx, "funding"); err != nil {
+		return nil, err
+	}
+	if err := p.fund(ctx, &s.Taker.Lock); err != nil {
+		return nil, err
+	}
+	return &Funded{SwapID: s.ID, Lock: s.Taker.Lock}, nil
+}
+
+func (p *Party) handleTakerFunded(ctx context.Context, m *Funded) (Message, error) {
+	s := p.swap
+	if err := p.checkFunded(ctx, &s.Taker.Lock, &m.Lock); err != nil {
+		return nil, err
+	}
+	if err := p.beforeDeadline(ctx, "funding"); err != nil {
+		return nil, err
+	}
+	preSig, err := p.scheme().PreSign(p.cfg.Key, SpendMessage(&s.Maker.Lock, PathClaim), s.ClaimPoint)
+	if err != nil {
+		return nil, err
+	}
+	s.Maker.ClaimPreSig = preSig
+	if err := p.fund(ctx, &s.Maker.Lock); err != nil {
+		return nil, err
+	}
+	return &Funded{SwapID: s.ID, Lock: s.Maker.Lock, ClaimPreSig: preSig}, nil
+}
+
+func (p *Party) handleMakerFunded(ctx context.Context, m *Funded) (Message, error) {
+	s := p.swap
+	if err := p.checkFunded(ctx, &s.Maker.Lock, &m.Lock); err != nil {
+		return nil, err
+	}
+	makerPub, _ := btcec.ParsePubKey(s.Offer.MakerPub)
+	if err := p.scheme().VerifyPreSignature(makerPub, SpendMessage(&s.Maker.Lock, PathClaim), s.ClaimPoint, m.ClaimPreSig); err != nil {
+		return nil, fmt.Errorf("%w: maker claim pre-signature: %w", ErrRejected, err)
+	}
+	// Too late to claim safely: the maker could still claim after the
+	// taker's refund opens. Stay funded and let Tick refund.
+	if err := p.beforeDeadline(ctx, "sending the claim pre-signature"); err != nil {
+		return nil, err
+	}
+	preSig, err := p.scheme().PreSign(p.cfg.Key, SpendMessage(&s.Taker.Lock, PathClaim), s.ClaimPoint)
+	if err != nil {
+		return nil, err
+	}
+	s.Maker.ClaimPreSig, s.Taker.ClaimPreSig = m.ClaimPreSig, preSig
+	s.State = StatePresigned
+	return &ClaimSig{SwapID: s.ID, PreSig: preSig}, nil
+}
+
+func (p *Party) handleClaimSig(ctx context.Context, m *ClaimSig) error {
+	s := p.swap
+	takerPub, _ := btcec.ParsePubKey(s.TakerPub)
+	if err := p.scheme().VerifyPreSignature(takerPub, SpendMessage(&s.Taker.Lock, PathClaim), s.ClaimPoint, m.PreSig); err != nil {
+		return fmt.Errorf("%w: taker claim pre-signature: %w", ErrRejected, err)
+	}
+	s.Taker.ClaimPreSig = m.PreSig
+	if err := p.save(); err != nil {
+		return err
+	}
+	return p.claim(ctx, &s.Taker)
+}
+
+// tickMaker claims when a claim pre-signature is in hand and refunds the
+// maker lock once the taker's package opens
+func (p *Party) tickMaker(ctx context.Context) error {
+	s := p.swap
+	taker, err := p.chain(&s.Taker.Lock).Lock(ctx, s.Taker.Lock.ID)
+	if err != nil {
+		return err
+	}
+	if taker.Spent != nil && taker.Spent.Path == PathClaim {
+		s.State = StateCompleted
+		return nil
+	}
+	if taker.Spent == nil && s.Taker.ClaimPreSig != nil {
+		if err := p.claim(ctx, &s.Taker); !errors.Is(err, ErrLockSpent) {
+			return err
+		}
+	}
+	return p.refund(ctx, &s.Maker)
+}
+
+// tickTaker claims once the maker's claim reveals t and refunds the taker
+// lock once the maker's package opens
+func (p *Party) tickTaker(ctx context.Context) error {
+	s := p.swap
+	taker, err := p.chain(&s.Taker.Lock).Lock(ctx, s.Taker.Lock.ID)
+	if err != nil {
+		return err
+	}
+	if taker.Spent == nil {
+		return p.refund(ctx, &s.Taker)
+	}
+	if taker.Spent.Path == PathRefund {
+		s.State = StateRefunded
+		return nil
+	}
+
+	if s.ClaimSecret == nil {
+		t, err := p.scheme().Extract(s.Taker.ClaimPreSig, taker.Spent.Sig, s.ClaimPoint)
+		if err != nil {
+			return fmt.Errorf("extract the claim secret: %w", err)
+		}
+		s.ClaimSecret = t
+		if err := p.save(); err != nil {
+			return err
+		}
+	}
+	return p.claim(ctx, &s.Maker)
+}
+
+// claim completes leg's claim pre-signature with t and spends it
+func (p *Party) claim(ctx context.Context, leg *Leg) error {
+	sig, err := p.scheme().Complete(leg.ClaimPreSig, p.swap.ClaimSecret)
+	if err != nil {
+		return err
+	}
+	if err := p.spend(ctx, &leg.Lock, PathClaim, sig); err != nil {
+		return err
+	}
+	p.swap.State = StateCompleted
+	return nil
+}
+
+// refund opens leg's refund package and spends the refund, or does nothing
+// before the package's round
+func (p *Party) refund(ctx context.Context, leg *Leg) error {
+	status, err := p.chain(&leg.Lock).Lock(ctx, leg.Lock.ID)
+	if err != nil {
+		return err
+	}
+	if status.Spent != nil {
+		if status.Spent.Path == PathRefund {
+			p.swap.State = StateRefunded
+			return nil
+		}
+		return fmt.Errorf("%w: %s was claimed by the counterparty", ErrLockSpent, leg.Lock.ID)
+	}
+
+	result, err := vte.DecryptVTE(ctx, leg.RefundPackage, p.cfg.Endpoints)
+	if errors.Is(err, tlock.ErrTooEarly) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open the refund package: %w", err)
+	}
+	sig, err := p.scheme().Complete(leg.RefundPreSig, result.R2)
+	if err != nil {
+		return err
+	}
+	if err := p.spend(ctx, &leg.Lock, PathRefund, sig); err != nil {
+		return err
+	}
+	p.swap.State = StateRefunded
+	return nil
+}
+
+func (p *Party) spend(ctx context.Context, lock *Lock, path SpendPath, sig []byte) error {
+	return p.chain(lock).Spend(ctx, &Spend{LockID: lock.ID, Path: path, Sig: sig})
+}
+
+// fund records the funded state, then publishes the lock: a crash in
+// between leaves a state that ensureFunded repairs
+func (p *Party) fund(ctx context.Context, lock *Lock) error {
+	p.swap.State = StateFunded
+	if err := p.save(); err != nil {
+		return err
+	}
+	return p.chain(lock).Fund(ctx, lock)
+}
+
+// ensureFunded publishes this party's lock if the chain does not have it
+func (p *Party) ensureFunded(ctx context.Context) error {
+	lock := &p.swap.Maker.Lock
+	if p.swap.Role == RoleTaker {
+		lock = &p.swap.Taker.Lock
+	}
+	_, err := p.chain(lock).Lock(ctx, lock.ID)
+	if errors.Is(err, ErrLockNotFound) {
+		return p.chain(lock).Fund(ctx, lock)
+	}
+	return err
+}
+
+// checkFunded checks an announced lock against the expected one and the chain
+func (p *Party) checkFunded(ctx context.Context, want, got *Lock) error {
+	if !want.equal(got) {
+		return fmt.Errorf("%w: announced lock %s does not match the offer", ErrRejected, got.ID)
+	}
+	status, err := p.chain(want).Lock(ctx, want.ID)
+	if err != nil {
+		return err
+	}
+	if !want.equal(&status.Lock) {
+		return fmt.Errorf("%w: lock %s on chain does not match the offer", ErrRejected, want.ID)
+	}
+	if status.Spent != nil {
+		return fmt.Errorf("%w: %s", ErrLockSpent, want.ID)
+	}
+	return nil
+}
+
+// refundPackage makes this party's package for the counterparty's refund
+// of lock and pre-signs the refund on its R2
+func (p *Party) refundPackage(lock *Lock, round uint64) (*vte.VTEPackageV2, []byte, []byte, error) {
+	secret, err := randSecret(p.cfg.Rand)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	refund := SpendMessage(lock, PathRefund)
+	pkg, err := vte.GenerateVTE(&vte.GenerateVTEParams{
+		Round:          round,
+		ChainHash:      p.swap.Offer.ChainHash,
+		FormatID:       FormatID,
+		SessionID:      p.swap.ID,
+		R2:             secret,
+		RefundTx:       refund,
+		CtxFields:      p.ctxFields(lock),
+		DrandEndpoints: p.cfg.Endpoints,
+		GenerateProof:  p.cfg.GenerateProof,
+		Rand:           p.cfg.Rand,
+	})
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("generate the refund package: %w", err)
+	}
+	preSig, err := p.scheme().PreSign(p.cfg.Key, refund, pkg.Public.R2.Value)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return pkg, secret, preSig, nil
+}
+
+// verifyRefund checks the counterparty's package for this party's refund of
+// lock under the policy, and its pre-signature of the refund. It cannot check
+// that the capsule encrypts r2 (see the package doc).
+func (p *Party) verifyRefund(lock *Lock, round uint64, pkg *vte.VTEPackageV2, preSig []byte) error {
+	s := p.swap
+	if pkg == nil {
+		return fmt.Errorf("%w: no package", ErrInvalidMessage)
+	}
+	if pkg.Lock != nil || !bytes.Equal(pkg.Tlock.DrandChainHash, s.Offer.ChainHash) {
+		return fmt.Errorf("%w: package is not on the offer's drand chain", ErrRejected)
+	}
+
+	policy := vte.DefaultPolicy()
+	if p.cfg.Policy != nil {
+		c := *p.cfg.Policy
+		policy = &c
+	}
+	refund := SpendMessage(lock, PathRefund)
+	policy.Round = round
+	policy.SessionID = s.ID
+	policy.RefundTxHex = hex.EncodeToString(refund)
+	policy.AllowedCtxSchemas = []string{vte.CtxSchemaV3}
+	if err := policy.Verify(pkg); err != nil {
+		return fmt.Errorf("%w: package: %w", ErrRejected, err)
+	}
+
+	for _, want := range p.ctxFields(lock) {
+		if got := pkg.Context.Field(want.Name); got == nil || *got != want {
+			return fmt.Errorf("%w: package does not bind %s", ErrRejected, want.Name)
+		}
+	}
+
+	counterparty := s.TakerPub
+	if s.Role == RoleTaker {
+		counterparty = s.Offer.MakerPub
+	}
+	pub, _ := btcec.ParsePubKey(counterparty)
+	if err := p.scheme().VerifyPreSignature(pub, refund, pkg.Public.R2.Value, preSig); err != nil {
+		return fmt.Errorf("%w: refund pre-signature: %w", ErrRejected, err)
+	}
+	return nil
+}
+
+// ctxFields are the ctx_v3 fields a refund package for lock binds
+func (p *Party) ctxFields(lock *Lock) []vte.CtxField {
+	return []vte.CtxField{
+		vte.PubkeyField("maker", p.swap.Offer.MakerPub),
+		vte.PubkeyField("taker", p.swap.TakerPub),
+		vte.StringField("lock", lock.ID),
+	}
+}
+
+// locks are the maker's and the taker's lock of the swap
+func (p *Party) locks() (Lock, Lock) {
+	s := p.swap
+	maker := Lock{
+		ID:        s.ID + "/maker",
+		Chain:     s.Offer.Give.Chain,
+		Amount:    s.Offer.Give.Amount,
+		Scheme:    s.Offer.Scheme,
+		ClaimKey:  s.Offer.MakerPub,
+		RefundKey: s.TakerPub,
+	}
+	taker := Lock{
+		ID:        s.ID + "/taker",
+		Chain:     s.Offer.Want.Chain,
+		Amount:    s.Offer.Want.Amount,
+		Scheme:    s.Offer.Scheme,
+		ClaimKey:  s.TakerPub,
+		RefundKey: s.Offer.MakerPub,
+	}
+	return maker, taker
+}
+
+func (p *Party) validateOffer() error {
+	o := p.swap.Offer
+	switch {
+	case o.SwapID == "":
+		return fmt.Errorf("%w: offer without a swap ID", ErrInvalidMessage)
+	case len(o.ChainHash) != 32:
+		return fmt.Errorf("%w: offer needs a 32-byte drand chain hash", ErrInvalidMessage)
+	case o.TakerRefundRound == 0 || o.MakerRefundRound <= o.TakerRefundRound:
+		return fmt.Errorf("%w: the maker's refund round must come after the taker's", ErrInvalidMessage)
+	case o.MakerRefundRound-o.TakerRefundRound < p.safetyRounds():
+		return fmt.Errorf("%w: the refund rounds must be at least %d rounds apart", ErrInvalidMessage, p.safetyRounds())
+	case o.Give.Amount == 0 || o.Want.Amount == 0:
+		return fmt.Errorf("%w: offer amounts must be positive", ErrInvalidMessage)
+	}
+	if _, err := newScheme(o.Scheme, nil); err != nil {
+		return err
+	}
+	if _, err := btcec.ParsePubKey(o.MakerPub); err != nil {
+		return fmt.Errorf("%w: maker key: %v", ErrInvalidMessage, err)
+	}
+	for _, chain := range []string{o.Give.Chain, o.Want.Chain} {
+		if p.cfg.Chains[chain] == nil {
+			return fmt.Errorf("%w: no chain %q configured", vte.ErrInvalidInput, chain)
+		}
+	}
+	return nil
+}
+
+// beforeDeadline returns ErrTooLate unless the current round of the offer's
+// drand chain is at least the safety margin before TakerRefundRound
+func (p *Party) beforeDeadline(ctx context.Context, action string) error {
+	o := p.swap.Offer
+	trusted, err := vte.FetchChainInfo(ctx, o.ChainHash, p.cfg.Endpoints)
+	if err != nil {
+		return fmt.Errorf("drand chain timing: %w", err)
+	}
+	scheduler := &vte.Scheduler{
+		Network: vte.DrandNetworkInfo{
+			ChainHash:   trusted.ChainHash,
+			GenesisTime: trusted.GenesisTime,
+			Period:      trusted.Period,
+			SchemeID:    trusted.SchemeID,
+		},
+		Now: p.cfg.Now,
+	}
+	if current := scheduler.CurrentRound(); current+p.safetyRounds() > o.TakerRefundRound {
+		return fmt.Errorf("%w: %s at round %d, less than %d rounds before the taker's refund round %d",
+			ErrTooLate, action, current, p.safetyRounds(), o.TakerRefundRound)
+	}
+	return nil
+}
+
+func (p *Party) safetyRounds() uint64 {
+	if p.cfg.SafetyRounds == 0 {
+		return DefaultSafetyRounds
+	}
+	return p.cfg.SafetyRounds
+}
+
+func (p *Party) abort(err error) {
+	p.swap.State = StateAborted
+	p.swap.LastError = err.Error()
+}
+
+func (p *Party) ownPub() []byte {
+	if p.swap.Role == RoleMaker {
+		return p.swap.Offer.MakerPub
+	}
+	return p.swap.TakerPub
+}
+
+func (p *Party) scheme() adaptor.Scheme {
+	scheme, _ := newScheme(p.swap.Offer.Scheme, p.cfg.Rand)
+	return scheme
+}
+
+func (p *Party) chain(lock *Lock) Chain {
+	return p.cfg.Chains[lock.Chain]
+}
+
+// newScheme returns the adaptor scheme of a name
+func newScheme(name string, r io.Reader) (adaptor.Scheme, error) {
+	switch name {
+	case adaptor.SchnorrScheme:
+		return adaptor.Schnorr{Rand: r}, nil
+	case adaptor.ECDSAScheme:
+		return adaptor.ECDSA{Rand: r}, nil
+	}
+	return nil, fmt.Errorf("%w: unknown adaptor scheme %q", ErrInvalidMessage, name)
+}
+
+func schemeByName(name string) (adaptor.Scheme, error) {
+	scheme, err := newScheme(name, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSpend, err)
+	}
+	return scheme, nil
+}
+
+// randSecret returns a random nonzero scalar below the group order
+func randSecret(r io.Reader) ([]byte, error) {
+	if r == nil {
+		r = rand.Reader
+	}
+	for {
+		b := make([]byte, 32)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return nil, fmt.Errorf("read randomness: %w", err)
+		}
+		var s btcec.ModNScalar
+		if overflow := s.SetByteSlice(b); !overflow && !s.IsZero() {
+			return b, nil
+		}
+	}
+}
+
+type stateFile struct {
+	Version string `json:"version"`
+	Swap    *Swap  `json:"swap"`
+}
+
+func (p *Party) save() error {
+	if p.cfg.StatePath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(stateFile{Version: StateVersion, Swap: p.swap}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(p.cfg.StatePath, data, 0o600); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path so readers never see a partial file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,536 @@
+package swap
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/drand/drand/v2/crypto"
+
+	"vte-tlock/internal/drandtest"
+	"vte-tlock/pkg/adaptor"
+	"vte-tlock/pkg/drandsim"
+	"vte-tlock/pkg/vte"
+)
+
+type testEnv struct {
+	network *drandsim.Network
+	clock   *drandsim.ManualClock
+	chains  map[string]Chain
+	maker   Config
+	taker   Config
+	offer   Offer
+}
+
+func newEnv(t *testing.T, scheme string) *testEnv {
+	t.Helper()
+	saved := vte.Beacons
+	vte.Beacons = vte.NewBeaconCache(vte.NewMemoryBeaconStore())
+	t.Cleanup(func() { vte.Beacons = saved })
+
+	network, clock, server := drandtest.Start(t, drandsim.Config{Scheme: crypto.SigsOnG1ID, Seed: []byte("swap")})
+	clock.Advance(time.Hour)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+
+	chains := map[string]Chain{"btc": NewSimChain("btc"), "ltc": NewSimChain("ltc")}
+	policy := &vte.VerificationPolicy{Require: vte.ProofRequirements{Schnorr: true}}
+	config := func(label string) Config {
+		seed := sha256.Sum256([]byte(label))
+		key, _ := btcec.PrivKeyFromBytes(seed[:])
+		return Config{
+			Key:       key,
+			Chains:    chains,
+			Endpoints: []string{server.URL},
+			Policy:    policy,
+			Rand:      vte.NewSeededRand([]byte(label)),
+			Now:       clock.Now,
+		}
+	}
+	latest := network.LatestRound()
+	return &testEnv{
+		network: network,
+		clock:   clock,
+		chains:  chains,
+		maker:   config("maker"),
+		taker:   config("taker"),
+		offer: Offer{
+			SwapID:           "swap-1",
+			Scheme:           scheme,
+			Give:             Asset{Chain: "btc", Amount: 100_000},
+			Want:             Asset{Chain: "ltc", Amount: 2_500_000},
+			ChainHash:        chainHash,
+			TakerRefundRound: latest + 5,
+			MakerRefundRound: latest + 10,
+		},
+	}
+}
+
+// advanceTo moves the clock past round
+func (e *testEnv) advanceTo(round uint64) {
+	for e.network.LatestRound() < round {
+		e.clock.Advance(e.network.Info().Period)
+	}
+}
+
+func (e *testEnv) lock(t *testing.T, id string) *LockStatus {
+	t.Helper()
+	for _, chain := range e.chains {
+		if status, err := chain.Lock(context.Background(), id); err == nil {
+			return status
+		}
+	}
+	return nil
+}
+
+// relay sends m over the wire encoding and returns the reply
+func relay(t *testing.T, to *Party, m Message) Message {
+	t.Helper()
+	data, err := EncodeMessage(m)
+	if err != nil {
+		t.Fatalf("EncodeMessage failed: %v", err)
+	}
+	decoded, err := DecodeMessage(data)
+	if err != nil {
+		t.Fatalf("DecodeMessage failed: %v", err)
+	}
+	reply, err := to.Handle(context.Background(), decoded)
+	if err != nil {
+		t.Fatalf("%s: Handle(%s) failed: %v", to.Swap().Role, m.Type(), err)
+	}
+	return reply
+}
+
+// start runs a swap from the offer until the taker has sent stop, which is
+// returned undelivered
+func (e *testEnv) start(t *testing.T, stop MessageType) (*Party, *Party, Message) {
+	t.Helper()
+	ctx := context.Background()
+	maker, offer, err := Propose(e.maker, e.offer)
+	if err != nil {
+		t.Fatalf("Propose failed: %v", err)
+	}
+	taker, m, err := Join(ctx, e.taker, offer.(*Offer))
+	if err != nil {
+		t.Fatalf("Join failed: %v", err)
+	}
+	for m.Type() != stop {
+		m = relay(t, maker, m)
+		if m.Type() == stop {
+			break
+		}
+		m = relay(t, taker, m)
+	}
+	return maker, taker, m
+}
+
+func TestSwapCompletes(t *testing.T) {
+	for _, scheme := range []string{adaptor.SchnorrScheme, adaptor.ECDSAScheme} {
+		t.Run(scheme, func(t *testing.T) {
+			e := newEnv(t, scheme)
+			ctx := context.Background()
+			maker, taker, claimSig := e.start(t, MsgClaimSig)
+			if s := taker.Swap(); s.State != StatePresigned {
+				t.Fatalf("Taker state %s, want presigned", s.State)
+			}
+
+			if reply := relay(t, maker, claimSig); reply != nil {
+				t.Fatalf("Maker replied %s to the claim signature", reply.Type())
+			}
+			if s := maker.Swap(); s.State != StateCompleted {
+				t.Fatalf("Maker state %s, want completed", s.State)
+			}
+			if err := taker.Tick(ctx); err != nil {
+				t.Fatalf("Taker Tick failed: %v", err)
+			}
+			if s := taker.Swap(); s.State != StateCompleted || !bytes.Equal(s.ClaimSecret, maker.Swap().ClaimSecret) {
+				t.Fatalf("Taker state %s, secret %x", s.State, s.ClaimSecret)
+			}
+			for _, id := range []string{"swap-1/maker", "swap-1/taker"} {
+				if status := e.lock(t, id); status == nil || status.Spent == nil || status.Spent.Path != PathClaim {
+					t.Errorf("%s: %+v, want claimed", id, status)
+				}
+			}
+
+			// Nothing left to do once completed
+			e.advanceTo(e.offer.MakerRefundRound)
+			if err := maker.Tick(ctx); err != nil || maker.Swap().State != StateCompleted {
+				t.Errorf("Completed maker ticked to %s (%v)", maker.Swap().State, err)
+			}
+		})
+	}
+}
+
+func TestSwapTakerRefundsWhenMakerStalls(t *testing.T) {
+	e := newEnv(t, adaptor.SchnorrScheme)
+	ctx := context.Background()
+	_, taker, _ := e.start(t, MsgFunded)
+
+	// Before the maker's package opens the taker waits
+	if err := taker.Tick(ctx); err != nil || taker.Swap().State != StateFunded {
+		t.Fatalf("Early Tick: state %s (%v)", taker.Swap().State, err)
+	}
+
+	e.advanceTo(e.offer.TakerRefundRound)
+	if err := taker.Tick(ctx); err != nil {
+		t.Fatalf("Tick failed: %v", err)
+	}
+	if s := taker.Swap(); s.State != StateRefunded {
+		t.Fatalf("Taker state %s, want refunded", s.State)
+	}
+	if status := e.lock(t, "swap-1/taker"); status.Spent == nil || status.Spent.Path != PathRefund {
+		t.Fatalf("Taker lock %+v, want refunded", status)
+	}
+	if status := e.lock(t, "swap-1/maker"); status != nil {
+		t.Fatalf("Maker lock was funded: %+v", status)
+	}
+}
+
+func TestSwapBothRefundWhenClaimSigIsWithheld(t *testing.T) {
+	e := newEnv(t, adaptor.SchnorrScheme)
+	ctx := context.Background()
+	maker, taker, claimSig := e.start(t, MsgClaimSig)
+
+	// The claim signature never reaches the maker. The taker refunds at its
+	// round; the maker's refund opens only at the later one.
+	e.advanceTo(e.offer.TakerRefundRound)
+	for _, p := range []*Party{maker, taker} {
+		if err := p.Tick(ctx); err != nil {
+			t.Fatalf("%s Tick failed: %v", p.Swap().Role, err)
+		}
+	}
+	if maker.Swap().State != StateFunded || taker.Swap().State != StateRefunded {
+		t.Fatalf("Maker %s, taker %s, want funded and refunded", maker.Swap().State, taker.Swap().State)
+	}
+
+	e.advanceTo(e.offer.MakerRefundRound)
+	if err := maker.Tick(ctx); err != nil {
+		t.Fatalf("Maker Tick failed: %v", err)
+	}
+	if s := maker.Swap(); s.State != StateRefunded {
+		t.Fatalf("Maker state %s, want refunded", s.State)
+	}
+	if status := e.lock(t, "swap-1/maker"); status.Spent == nil || status.Spent.Path != PathRefund {
+		t.Fatalf("Maker lock %+v, want refunded", status)
+	}
+
+	// The late claim signature is refused
+	if _, err := maker.Handle(ctx, claimSig); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Fatalf("Late claim signature: %v", err)
+	}
+}
+
+func TestSwapLateClaimFallsBackToRefund(t *testing.T) {
+	e := newEnv(t, adaptor.SchnorrScheme)
+	ctx := context.Background()
+	maker, taker, claimSig := e.start(t, MsgClaimSig)
+
+	// The claim signature arrives after the taker refunded: the claim fails
+	// and the maker refunds later
+	e.advanceTo(e.offer.TakerRefundRound)
+	if err := taker.Tick(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := maker.Handle(ctx, claimSig); !errors.Is(err, ErrLockSpent) {
+		t.Fatalf("Claim after the refund: %v", err)
+	}
+	if s := maker.Swap(); s.State != StateFunded || s.LastError == "" {
+		t.Fatalf("Maker state %s, last error %q", s.State, s.LastError)
+	}
+	e.advanceTo(e.offer.MakerRefundRound)
+	if err := maker.Tick(ctx); err != nil || maker.Swap().State != StateRefunded {
+		t.Fatalf("Maker state %s (%v), want refunded", maker.Swap().State, err)
+	}
+}
+
+func TestSwapTakerWithholdsLateClaimSig(t *testing.T) {
+	e := newEnv(t, adaptor.SchnorrScheme)
+	ctx := context.Background()
+	maker, taker, funded := e.start(t, MsgFunded)
+	makerFunded := relay(t, maker, funded)
+
+	// The maker's lock shows up one round inside the taker's safety margin:
+	// the taker keeps its claim pre-signature and refunds
+	e.advanceTo(e.offer.TakerRefundRound - DefaultSafetyRounds + 1)
+	if _, err := taker.Handle(ctx, makerFunded); !errors.Is(err, ErrTooLate) {
+		t.Fatalf("Late maker funding: %v", err)
+	}
+	if s := taker.Swap(); s.State != StateFunded || s.Taker.ClaimPreSig != nil {
+		t.Fatalf("Taker state %s with claim pre-signature %x", s.State, s.Taker.ClaimPreSig)
+	}
+	e.advanceTo(e.offer.TakerRefundRound)
+	if err := taker.Tick(ctx); err != nil || taker.Swap().State != StateRefunded {
+		t.Fatalf("Taker state %s (%v), want refunded", taker.Swap().State, err)
+	}
+	e.advanceTo(e.offer.MakerRefundRound)
+	if err := maker.Tick(ctx); err != nil || maker.Swap().State != StateRefunded {
+		t.Fatalf("Maker state %s (%v), want refunded", maker.Swap().State, err)
+	}
+}
+
+// flakyChain fails the first Fund after publishing nothing
+type flakyChain struct {
+	Chain
+	failed bool
+}
+
+func (c *flakyChain) Fund(ctx context.Context, lock *Lock) error {
+	if !c.failed {
+		c.failed = true
+		return errors.New("connection reset")
+	}
+	return c.Chain.Fund(ctx, lock)
+}
+
+func TestSwapResumesFromState(t *testing.T) {
+	e := newEnv(t, adaptor.ECDSAScheme)
+	ctx := context.Background()
+	dir := t.TempDir()
+	e.maker.StatePath = filepath.Join(dir, "maker.json")
+	e.taker.StatePath = filepath.Join(dir, "taker.json")
+	ltc := &flakyChain{Chain: e.chains["ltc"]}
+	e.taker.Chains = map[string]Chain{"btc": e.chains["btc"], "ltc": ltc}
+
+	maker, offer, err := Propose(e.maker, e.offer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taker, accept, err := Join(ctx, e.taker, offer.(*Offer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkg := relay(t, maker, accept)
+
+	// The taker's funding broadcast fails: the state says funded and Tick
+	// publishes the lock again
+	if _, err := taker.Handle(ctx, pkg); err == nil {
+		t.Fatal("Expected the funding broadcast to fail")
+	}
+	if s := taker.Swap(); s.State != StateFunded {
+		t.Fatalf("Taker state %s, want funded", s.State)
+	}
+	if err := taker.Tick(ctx); err != nil {
+		t.Fatalf("Tick failed: %v", err)
+	}
+	if e.lock(t, "swap-1/taker") == nil {
+		t.Fatal("Tick did not fund the taker lock")
+	}
+
+	// Both parties restart from their state files
+	resume := func(cfg Config) *Party {
+		p, err := Resume(cfg)
+		if err != nil {
+			t.Fatalf("Resume failed: %v", err)
+		}
+		return p
+	}
+	maker, taker = resume(e.maker), resume(e.taker)
+	funded := relay(t, maker, &Funded{SwapID: "swap-1", Lock: taker.Swap().Taker.Lock})
+	maker, taker = resume(e.maker), resume(e.taker)
+	claimSig := relay(t, taker, funded)
+	maker, taker = resume(e.maker), resume(e.taker)
+	relay(t, maker, claimSig)
+	taker = resume(e.taker)
+	if err := taker.Tick(ctx); err != nil || taker.Swap().State != StateCompleted {
+		t.Fatalf("Taker state %s (%v), want completed", taker.Swap().State, err)
+	}
+
+	info, err := os.Stat(e.maker.StatePath)
+	if err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("State file mode %v (%v)", info.Mode(), err)
+	}
+	var state stateFile
+	data, _ := os.ReadFile(e.taker.StatePath)
+	if err := json.Unmarshal(data, &state); err != nil || state.Version != StateVersion || state.Swap.State != StateCompleted {
+		t.Fatalf("State file: %+v (%v)", state, err)
+	}
+
+	// A state file is only resumed with its own key
+	if _, err := Resume(Config{Key: e.maker.Key, StatePath: e.taker.StatePath}); !errors.Is(err, vte.ErrInvalidInput) {
+		t.Errorf("Resume with the other key: %v", err)
+	}
+}
+
+func TestSwapRejects(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("offer", func(t *testing.T) {
+		e := newEnv(t, adaptor.SchnorrScheme)
+		for name, edit := range map[string]func(*Offer){
+			"refund order":  func(o *Offer) { o.MakerRefundRound = o.TakerRefundRound },
+			"refund gap":    func(o *Offer) { o.MakerRefundRound = o.TakerRefundRound + 1 },
+			"scheme":        func(o *Offer) { o.Scheme = "musig" },
+			"unknown chain": func(o *Offer) { o.Want.Chain = "doge" },
+			"no amount":     func(o *Offer) { o.Give.Amount = 0 },
+		} {
+			offer := e.offer
+			edit(&offer)
+			if _, _, err := Propose(e.maker, offer); err == nil {
+				t.Errorf("%s: Propose accepted the offer", name)
+			}
+		}
+	})
+
+	t.Run("accept", func(t *testing.T) {
+		e := newEnv(t, adaptor.SchnorrScheme)
+		maker, offer, _ := Propose(e.maker, e.offer)
+		_, m, err := Join(ctx, e.taker, offer.(*Offer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		accept := *m.(*Accept)
+		accept.RefundPreSig = append([]byte{}, accept.RefundPreSig...)
+		accept.RefundPreSig[64] ^= 1
+		if _, err := maker.Handle(ctx, &accept); !errors.Is(err, ErrRejected) || !errors.Is(err, adaptor.ErrInvalidPreSignature) {
+			t.Fatalf("Tampered refund pre-signature: %v", err)
+		}
+		if s := maker.Swap(); s.State != StateAborted || s.LastError == "" {
+			t.Fatalf("Maker state %s, want aborted", s.State)
+		}
+	})
+
+	t.Run("package policy", func(t *testing.T) {
+		e := newEnv(t, adaptor.SchnorrScheme)
+		e.taker.Policy = &vte.VerificationPolicy{Require: vte.ProofRequirements{Schnorr: true}, PinnedChains: []string{"quicknet"}}
+		maker, offer, _ := Propose(e.maker, e.offer)
+		taker, accept, _ := Join(ctx, e.taker, offer.(*Offer))
+		pkg := relay(t, maker, accept)
+		if _, err := taker.Handle(ctx, pkg); !errors.Is(err, ErrRejected) || !errors.Is(err, vte.ErrNetworkMismatch) {
+			t.Fatalf("Package off the pinned chain: %v", err)
+		}
+		if s := taker.Swap(); s.State != StateAborted {
+			t.Fatalf("Taker state %s, want aborted", s.State)
+		}
+		if e.lock(t, "swap-1/taker") != nil {
+			t.Fatal("Taker funded after rejecting the package")
+		}
+	})
+
+	t.Run("late package", func(t *testing.T) {
+		e := newEnv(t, adaptor.SchnorrScheme)
+		maker, offer, _ := Propose(e.maker, e.offer)
+		taker, accept, _ := Join(ctx, e.taker, offer.(*Offer))
+		pkg := relay(t, maker, accept)
+		e.advanceTo(e.offer.TakerRefundRound - DefaultSafetyRounds + 1)
+		if _, err := taker.Handle(ctx, pkg); !errors.Is(err, ErrTooLate) {
+			t.Fatalf("Package inside the safety margin: %v", err)
+		}
+		if s := taker.Swap(); s.State != StateAborted {
+			t.Fatalf("Taker state %s, want aborted", s.State)
+		}
+		if e.lock(t, "swap-1/taker") != nil {
+			t.Fatal("Taker funded inside the safety margin")
+		}
+	})
+
+	t.Run("package binding", func(t *testing.T) {
+		e := newEnv(t, adaptor.SchnorrScheme)
+		maker, offer, _ := Propose(e.maker, e.offer)
+		taker, accept, _ := Join(ctx, e.taker, offer.(*Offer))
+		// The maker answers with the taker's own package, bound to the other lock
+		pkg := *relay(t, maker, accept).(*Package)
+		pkg.Package = accept.(*Accept).Package
+		if _, err := taker.Handle(ctx, &pkg); !errors.Is(err, ErrRejected) {
+			t.Fatalf("Package for the other lock: %v", err)
+		}
+	})
+
+	t.Run("funded", func(t *testing.T) {
+		e := newEnv(t, adaptor.SchnorrScheme)
+		maker, taker, funded := e.start(t, MsgFunded)
+		wrong := *funded.(*Funded)
+		wrong.Lock.Amount--
+		if _, err := maker.Handle(ctx, &wrong); !errors.Is(err, ErrRejected) {
+			t.Fatalf("Wrong lock: %v", err)
+		}
+		if s := maker.Swap(); s.State != StatePackaged {
+			t.Fatalf("Maker state %s, want packaged", s.State)
+		}
+
+		// Still answers the right announcement, and only once
+		makerFunded := relay(t, maker, funded)
+		if _, err := maker.Handle(ctx, funded); !errors.Is(err, ErrUnexpectedMessage) {
+			t.Fatalf("Repeated funded: %v", err)
+		}
+		bad := *makerFunded.(*Funded)
+		bad.ClaimPreSig = bad.ClaimPreSig[:64]
+		if _, err := taker.Handle(ctx, &bad); !errors.Is(err, ErrRejected) {
+			t.Fatalf("Short claim pre-signature: %v", err)
+		}
+		if s := taker.Swap(); s.State != StateFunded {
+			t.Fatalf("Taker state %s, want funded", s.State)
+		}
+	})
+
+	t.Run("routing", func(t *testing.T) {
+		e := newEnv(t, adaptor.SchnorrScheme)
+		maker, _, _ := Propose(e.maker, e.offer)
+		if _, err := maker.Handle(ctx, &Accept{SwapID: "swap-2"}); !errors.Is(err, ErrUnexpectedMessage) {
+			t.Errorf("Other swap: %v", err)
+		}
+		if _, err := maker.Handle(ctx, &ClaimSig{SwapID: "swap-1"}); !errors.Is(err, ErrUnexpectedMessage) {
+			t.Errorf("Out of order: %v", err)
+		}
+		if _, err := DecodeMessage([]byte(`{"type":"cancel","body":{"swap_id":"swap-1"}}`)); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("Unknown type: %v", err)
+		}
+		if _, err := DecodeMessage([]byte(`{"type":"offer","body":{}}`)); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("No swap ID: %v", err)
+		}
+	})
+}
+
+func TestSimChainChecksSpends(t *testing.T) {
+	ctx := context.Background()
+	chain := NewSimChain("btc")
+	keys := make([]*btcec.PrivateKey, 2)
+	for i := range keys {
+		seed := sha256.Sum256([]byte{byte(i)})
+		keys[i], _ = btcec.PrivKeyFromBytes(seed[:])
+	}
+	lock := &Lock{
+		ID:        "l",
+		Chain:     "btc",
+		Amount:    1,
+		Scheme:    adaptor.SchnorrScheme,
+		ClaimKey:  keys[0].PubKey().SerializeCompressed(),
+		RefundKey: keys[1].PubKey().SerializeCompressed(),
+	}
+	if err := chain.Fund(ctx, lock); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Fund(ctx, lock); !errors.Is(err, ErrInvalidSpend) {
+		t.Errorf("Duplicate lock: %v", err)
+	}
+
+	// Sign with a throwaway adaptor: pre-sign and complete at once
+	sign := func(key *btcec.PrivateKey, path SpendPath) []byte {
+		secret := sha256.Sum256([]byte(path))
+		point, _ := vte.ComputeR2Point(secret[:])
+		preSig, _ := adaptor.Schnorr{}.PreSign(key, SpendMessage(lock, path), point)
+		sig, _ := adaptor.Schnorr{}.Complete(preSig, secret[:])
+		return sig
+	}
+	if err := chain.Spend(ctx, &Spend{LockID: "l", Path: PathRefund, Sig: sign(keys[0], PathRefund)}); !errors.Is(err, ErrInvalidSpend) {
+		t.Errorf("Refund signed by the claim key: %v", err)
+	}
+	if err := chain.Spend(ctx, &Spend{LockID: "l", Path: PathClaim, Sig: sign(keys[0], PathRefund)}); !errors.Is(err, ErrInvalidSpend) {
+		t.Errorf("Claim with the refund signature: %v", err)
+	}
+	if err := chain.Spend(ctx, &Spend{LockID: "l", Path: PathRefund, Sig: sign(keys[1], PathRefund)}); err != nil {
+		t.Fatalf("Refund failed: %v", err)
+	}
+	if err := chain.Spend(ctx, &Spend{LockID: "l", Path: PathClaim, Sig: sign(keys[0], PathClaim)}); !errors.Is(err, ErrLockSpent) {
+		t.Errorf("Double spend: %v", err)
+	}
+	if _, err := chain.Lock(ctx, "m"); !errors.Is(err, ErrLockNotFound) {
+		t.Errorf("Unknown lock: %v", err)
+	}
+}
@@ -0,0 +1,453 @@
+package vte
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/protobuf/drand"
+)
+
+// ErrBeaconNotCached is returned by BeaconStore backends for missing entries
+var ErrBeaconNotCached = errors.New("beacon not cached")
+
+// BeaconStore is a storage backend for drand chain info and beacon
+// signatures, keyed by chain hash and round. Backends store bytes as given;
+// BeaconCache does all verification.
+type BeaconStore interface {
+	GetChainInfo(chainHash []byte) ([]byte, error)
+	PutChainInfo(chainHash []byte, chainInfoJSON []byte) error
+	GetSignature(chainHash []byte, round uint64) ([]byte, error)
+	PutSignature(chainHash []byte, round uint64, signature []byte) error
+	Rounds(chainHash []byte) ([]uint64, error)
+	Close() error
+}
+
+// BeaconCache holds verified beacons. A signature is only inserted after it
+// verifies under the chain key (pinned in the registry, or stored chain info
+// that hashes to the chain hash) and is verified again when read, so a
+// tampered store can make a lookup miss but never return a bad beacon.
+type BeaconCache struct {
+	store BeaconStore
+}
+
+// Beacons is the process-wide cache checked by Decrypt and the prefetch path
+// before any endpoint is contacted. It starts in memory, bounded to
+// DefaultMemoryBeacons signatures. Callers that want another store pass their
+// own BeaconCache (see BeaconCache.DecryptVTE) rather than replacing it. Nil
+// disables caching.
+var Beacons = NewBeaconCache(NewMemoryBeaconStore())
+
+// NewBeaconCache returns a verifying cache over a storage backend
+func NewBeaconCache(store BeaconStore) *BeaconCache {
+	return &BeaconCache{store: store}
+}
+
+// Close closes the storage backend
+func (c *BeaconCache) Close() error {
+	return c.store.Close()
+}
+
+// AddChainInfo stores a drand /info response after checking it hashes to
+// chainHash and uses an unchained scheme
+func (c *BeaconCache) AddChainInfo(chainInfoJSON []byte, chainHash []byte) error {
+	trusted, err := TrustedChainInfoFromJSON(chainInfoJSON, chainHash)
+	if err != nil {
+		return err
+	}
+	if !UnchainedScheme(trusted.SchemeID) {
+		return fmt.Errorf("%w: chain %x uses chained scheme %s, only unchained chains can be cached", ErrInvalidInput, chainHash, trusted.SchemeID)
+	}
+	return c.store.PutChainInfo(chainHash, chainInfoJSON)
+}
+
+// AddBeacon verifies a beacon signature and stores it. The chain must be
+// pinned in the registry or have its chain info in the cache.
+func (c *BeaconCache) AddBeacon(chainHash []byte, round uint64, signature []byte) error {
+	info := c.chainInfo(chainHash)
+	if info == nil {
+		return fmt.Errorf("%w: no chain info for chain %x: add it or pin the network first", ErrInvalidInput, chainHash)
+	}
+	if err := verifyBeacon(info, round, signature); err != nil {
+		return err
+	}
+	return c.store.PutSignature(chainHash, round, signature)
+}
+
+// ChainInfo returns the chain info for a pinned or cached chain, or
+// ErrBeaconNotCached
+func (c *BeaconCache) ChainInfo(chainHash []byte) (*TrustedChainInfo, error) {
+	info := c.chainInfo(chainHash)
+	if info == nil {
+		return nil, ErrBeaconNotCached
+	}
+	return trustedFromInfo(info)
+}
+
+// Signature returns a cached beacon signature that verifies under the chain
+// key, or ErrBeaconNotCached
+func (c *BeaconCache) Signature(chainHash []byte, round uint64) ([]byte, error) {
+	info := c.chainInfo(chainHash)
+	if info == nil {
+		return nil, ErrBeaconNotCached
+	}
+	if sig := c.verifiedSignature(chainHash, round, func(sig []byte) error { return verifyBeacon(info, round, sig) }); sig != nil {
+		return sig, nil
+	}
+	return nil, ErrBeaconNotCached
+}
+
+// chainInfo returns the pinned chain info, else stored chain info that still
+// hashes to chainHash, else nil
+func (c *BeaconCache) chainInfo(chainHash []byte) *chain.Info {
+	if c == nil {
+		return nil
+	}
+	trusted := pinnedChain(chainHash)
+	if trusted == nil {
+		stored, err := c.store.GetChainInfo(chainHash)
+		if err != nil {
+			return nil
+		}
+		if trusted, err = TrustedChainInfoFromJSON(stored, chainHash); err != nil {
+			return nil
+		}
+	}
+	info, err := trusted.chainInfo()
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+// verifiedSignature returns the cached signature if verify accepts it
+func (c *BeaconCache) verifiedSignature(chainHash []byte, round uint64, verify func([]byte) error) []byte {
+	if c == nil {
+		return nil
+	}
+	sig, err := c.store.GetSignature(chainHash, round)
+	if err != nil || verify(sig) != nil {
+		return nil
+	}
+	return sig
+}
+
+// remember stores chain info and a signature that were already verified.
+// Caching is best effort: a failing store never fails a decryption.
+func (c *BeaconCache) remember(info *chain.Info, round uint64, signature []byte) {
+	if c == nil {
+		return
+	}
+	if _, err := c.store.GetChainInfo(info.Hash()); err != nil {
+		if data, err := chainInfoJSON(info); err == nil {
+			_ = c.store.PutChainInfo(info.Hash(), data)
+		}
+	}
+	if signature != nil {
+		_ = c.store.PutSignature(info.Hash(), round, signature)
+	}
+}
+
+// chainInfoJSON encodes chain info as a drand /info response
+func chainInfoJSON(info *chain.Info) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := info.ToJSON(&buf, &drand.Metadata{BeaconID: info.ID}); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(buf.Bytes()), nil
+}
+
+// BeaconBundleVersion identifies the beacon bundle format
+const BeaconBundleVersion = "vte-beacons/1"
+
+// BeaconBundle carries chain info and beacons between machines, e.g. to an
+// air-gapped one. Nothing in it is trusted: the chain info must hash to
+// ChainHash and every signature must verify before it is imported.
+type BeaconBundle struct {
+	Version   string          `json:"version"`
+	ChainHash string          `json:"chain_hash"`
+	ChainInfo json.RawMessage `json:"chain_info,omitempty"` // drand /info response
+	Beacons   []BundledBeacon `json:"beacons"`
+}
+
+// BundledBeacon is one beacon in a bundle, as served by drand /public/{round}
+type BundledBeacon struct {
+	Round     uint64 `json:"round"`
+	Signature string `json:"signature"` // Hex
+}
+
+// Export writes a bundle of the cached beacons for a chain. Nil rounds
+// exports every cached round; requested rounds that are not cached fail.
+func (c *BeaconCache) Export(w io.Writer, chainHash []byte, rounds []uint64) error {
+	info := c.chainInfo(chainHash)
+	if info == nil {
+		return fmt.Errorf("%w: no chain info for chain %x", ErrInvalidInput, chainHash)
+	}
+	infoJSON, err := chainInfoJSON(info)
+	if err != nil {
+		return fmt.Errorf("failed to encode chain info: %w", err)
+	}
+
+	if rounds == nil {
+		if rounds, err = c.store.Rounds(chainHash); err != nil {
+			return fmt.Errorf("failed to list cached rounds: %w", err)
+		}
+	}
+	bundle := BeaconBundle{
+		Version:   BeaconBundleVersion,
+		ChainHash: hex.EncodeToString(chainHash),
+		ChainInfo: infoJSON,
+		Beacons:   make([]BundledBeacon, 0, len(rounds)),
+	}
+	for _, round := range rounds {
+		sig, err := c.Signature(chainHash, round)
+		if err != nil {
+			return fmt.Errorf("round %d: %w", round, err)
+		}
+		bundle.Beacons = append(bundle.Beacons, BundledBeacon{Round: round, Signature: hex.EncodeToString(sig)})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(bundle)
+}
+
+// Import verifies a bundle and stores its chain info and beacons. The bundle
+// is rejected as a whole if any beacon fails to verify. A chain pinned in the
+// registry is verified against the pinned key, whatever the bundle says.
+func (c *BeaconCache) Import(r io.Reader) (int, error) {
+	var bundle BeaconBundle
+	if err := json.NewDecoder(r).Decode(&bundle); err != nil {
+		return 0, fmt.Errorf("%w: invalid beacon bundle: %v", ErrInvalidInput, err)
+	}
+	if bundle.Version != BeaconBundleVersion {
+		return 0, fmt.Errorf("%w: have %s, want %s", ErrVersionMismatch, bundle.Version, BeaconBundleVersion)
+	}
+	chainHash, err := hex.DecodeString(bundle.ChainHash)
+	if err != nil || len(chainHash) != 32 {
+		return 0, fmt.Errorf("%w: invalid bundle chain hash", ErrInvalidInput)
+	}
+
+	if len(bundle.ChainInfo) > 0 {
+		if err := c.AddChainInfo(bundle.ChainInfo, chainHash); err != nil {
+			return 0, err
+		}
+	}
+	info := c.chainInfo(chainHash)
+	if info == nil {
+		return 0, fmt.Errorf("%w: bundle has no chain info and chain %x is not pinned", ErrInvalidInput, chainHash)
+	}
+
+	sigs := make([][]byte, len(bundle.Beacons))
+	for i, b := range bundle.Beacons {
+		sig, err := hex.DecodeString(b.Signature)
+		if err != nil {
+			return 0, fmt.Errorf("%w: round %d: invalid signature hex", ErrInvalidInput, b.Round)
+		}
+		if err := verifyBeacon(info, b.Round, sig); err != nil {
+			return 0, err
+		}
+		sigs[i] = sig
+	}
+	for i, b := range bundle.Beacons {
+		if err := c.store.PutSignature(chainHash, b.Round, sigs[i]); err != nil {
+			return i, fmt.Errorf("failed to store round %d: %w", b.Round, err)
+		}
+	}
+	return len(bundle.Beacons), nil
+}
+
+// DefaultMemoryBeacons is how many signatures NewMemoryBeaconStore keeps
+const DefaultMemoryBeacons = 4096
+
+// MemoryBeaconStore keeps beacons in memory; it is the default and the only
+// backend in WASM. Past its limit it evicts the oldest stored signature.
+type MemoryBeaconStore struct {
+	mu     sync.RWMutex
+	limit  int
+	infos  map[string][]byte
+	rounds map[string]map[uint64][]byte
+	order  []beaconKey // Insertion order, for eviction
+}
+
+type beaconKey struct {
+	chain string
+	round uint64
+}
+
+// NewMemoryBeaconStore returns an empty in-memory store holding up to
+// DefaultMemoryBeacons signatures
+func NewMemoryBeaconStore() *MemoryBeaconStore {
+	return NewMemoryBeaconStoreSize(DefaultMemoryBeacons)
+}
+
+// NewMemoryBeaconStoreSize returns an empty in-memory store holding up to
+// limit signatures; a limit below 1 uses DefaultMemoryBeacons
+func NewMemoryBeaconStoreSize(limit int) *MemoryBeaconStore {
+	if limit < 1 {
+		limit = DefaultMemoryBeacons
+	}
+	return &MemoryBeaconStore{
+		limit:  limit,
+		infos:  make(map[string][]byte),
+		rounds: make(map[string]map[uint64][]byte),
+	}
+}
+
+func (m *MemoryBeaconStore) GetChainInfo(chainHash []byte) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if info, ok := m.infos[string(chainHash)]; ok {
+		return info, nil
+	}
+	return nil, ErrBeaconNotCached
+}
+
+func (m *MemoryBeaconStore) PutChainInfo(chainHash []byte, chainInfoJSON []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.infos[string(chainHash)] = bytes.Clone(chainInfoJSON)
+	return nil
+}
+
+func (m *MemoryBeaconStore) GetSignature(chainHash []byte, round uint64) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if sig, ok := m.rounds[string(chainHash)][round]; ok {
+		return sig, nil
+	}
+	return nil, ErrBeaconNotCached
+}
+
+func (m *MemoryBeaconStore) PutSignature(chainHash []byte, round uint64, signature []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	chain := string(chainHash)
+	if m.rounds[chain] == nil {
+		m.rounds[chain] = make(map[uint64][]byte)
+	}
+	if _, ok := m.rounds[chain][round]; !ok {
+		m.order = append(m.order, beaconKey{chain, round})
+	}
+	m.rounds[chain][round] = bytes.Clone(signature)
+	for len(m.order) > m.limit {
+		oldest := m.order[0]
+		m.order = m.order[1:]
+		delete(m.rounds[oldest.chain], oldest.round)
+	}
+	return nil
+}
+
+func (m *MemoryBeaconStore) Rounds(chainHash []byte) ([]uint64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	rounds := make([]uint64, 0, len(m.rounds[string(chainHash)]))
+	for round := range m.rounds[string(chainHash)] {
+		rounds = append(rounds, round)
+	}
+	sort.Slice(rounds, func(i, j int) bool { return rounds[i] < rounds[j] })
+	return rounds, nil
+}
+
+func (m *MemoryBeaconStore) Close() error { return nil }
+
+// FileBeaconStore keeps one directory per chain under Dir, holding info.json
+// and one <round>.sig file of hex per beacon. Files are written atomically, so
+// it is safe to copy the directory while a decryption is running.
+type FileBeaconStore struct {
+	Dir string
+}
+
+// NewFileBeaconStore creates the directory if needed
+func NewFileBeaconStore(dir string) (*FileBeaconStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create beacon store: %w", err)
+	}
+	return &FileBeaconStore{Dir: dir}, nil
+}
+
+func (f *FileBeaconStore) chainDir(chainHash []byte) string {
+	return filepath.Join(f.Dir, hex.EncodeToString(chainHash))
+}
+
+func (f *FileBeaconStore) read(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrBeaconNotCached
+	}
+	return data, err
+}
+
+func (f *FileBeaconStore) write(chainHash []byte, name string, data []byte) error {
+	dir := f.chainDir(chainHash)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, name+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, name))
+}
+
+func (f *FileBeaconStore) GetChainInfo(chainHash []byte) ([]byte, error) {
+	return f.read(filepath.Join(f.chainDir(chainHash), "info.json"))
+}
+
+func (f *FileBeaconStore) PutChainInfo(chainHash []byte, chainInfoJSON []byte) error {
+	return f.write(chainHash, "info.json", chainInfoJSON)
+}
+
+func (f *FileBeaconStore) GetSignature(chainHash []byte, round uint64) ([]byte, error) {
+	data, err := f.read(filepath.Join(f.chainDir(chainHash), strconv.FormatUint(round, 10)+".sig"))
+	if err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(strings.TrimSpace(string(data)))
+}
+
+func (f *FileBeaconStore) PutSignature(chainHash []byte, round uint64, signature []byte) error {
+	return f.write(chainHash, strconv.FormatUint(round, 10)+".sig", []byte(hex.EncodeToString(signature)+"\n"))
+}
+
+func (f *FileBeaconStore) Rounds(chainHash []byte) ([]uint64, error) {
+	entries, err := os.ReadDir(f.chainDir(chainHash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rounds []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".sig")
+		if !ok {
+			continue
+		}
+		if round, err := strconv.ParseUint(name, 10, 64); err == nil {
+			rounds = append(rounds, round)
+		}
+	}
+	sort.Slice(rounds, func(i, j int) bool { return rounds[i] < rounds[j] })
+	return rounds, nil
+}
+
+func (f *FileBeaconStore) Close() error { return nil }
@@ -0,0 +1,108 @@
+//go:build !js || !wasm
+
+package vte
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltInfoKey      = []byte("info")
+	boltRoundsBucket = []byte("rounds")
+)
+
+// BoltBeaconStore keeps beacons in a single bbolt file: one bucket per chain
+// hash holding the chain info and a nested bucket of rounds. Not available
+// in WASM.
+type BoltBeaconStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltBeaconStore opens or creates the database at path. bbolt locks the
+// file, so only one process can hold it open.
+func OpenBoltBeaconStore(path string) (*BoltBeaconStore, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open beacon store: %w", err)
+	}
+	return &BoltBeaconStore{db: db}, nil
+}
+
+func (b *BoltBeaconStore) get(chainHash []byte, key []byte, inRounds bool) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(chainHash)
+		if bucket != nil && inRounds {
+			bucket = bucket.Bucket(boltRoundsBucket)
+		}
+		if bucket == nil {
+			return ErrBeaconNotCached
+		}
+		if v := bucket.Get(key); v != nil {
+			value = bytes.Clone(v)
+			return nil
+		}
+		return ErrBeaconNotCached
+	})
+	return value, err
+}
+
+func (b *BoltBeaconStore) put(chainHash []byte, key, value []byte, inRounds bool) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists(chainHash)
+		if err != nil {
+			return err
+		}
+		if inRounds {
+			if bucket, err = bucket.CreateBucketIfNotExists(boltRoundsBucket); err != nil {
+				return err
+			}
+		}
+		return bucket.Put(key, value)
+	})
+}
+
+func (b *BoltBeaconStore) GetChainInfo(chainHash []byte) ([]byte, error) {
+	return b.get(chainHash, boltInfoKey, false)
+}
+
+func (b *BoltBeaconStore) PutChainInfo(chainHash []byte, chainInfoJSON []byte) error {
+	return b.put(chainHash, boltInfoKey, chainInfoJSON, false)
+}
+
+func (b *BoltBeaconStore) GetSignature(chainHash []byte, round uint64) ([]byte, error) {
+	return b.get(chainHash, roundKey(round), true)
+}
+
+func (b *BoltBeaconStore) PutSignature(chainHash []byte, round uint64, signature []byte) error {
+	return b.put(chainHash, roundKey(round), signature, true)
+}
+
+func (b *BoltBeaconStore) Rounds(chainHash []byte) ([]uint64, error) {
+	var rounds []uint64
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(chainHash)
+		if bucket == nil || bucket.Bucket(boltRoundsBucket) == nil {
+			return nil
+		}
+		return bucket.Bucket(boltRoundsBucket).ForEach(func(k, _ []byte) error {
+			rounds = append(rounds, binary.BigEndian.Uint64(k))
+			return nil
+		})
+	})
+	return rounds, err
+}
+
+func (b *BoltBeaconStore) Close() error {
+	return b.db.Close()
+}
+
+// roundKey encodes a round as a big-endian key, so key order is round order
+func roundKey(round uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, round)
+}
@@ -0,0 +1,80 @@
+//go:build !js || !wasm
+
+package vte
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/drand/drand/v2/crypto"
+)
+
+func TestBoltBeaconStore(t *testing.T) {
+	store, err := OpenBoltBeaconStore(filepath.Join(t.TempDir(), "beacons.db"))
+	if err != nil {
+		t.Fatalf("OpenBoltBeaconStore failed: %v", err)
+	}
+	checkBeaconStore(t, store)
+}
+
+// TestBeaconBundleAirGapped carries beacons from an online machine to an
+// offline one and decrypts there with no endpoint at all
+func TestBeaconBundleAirGapped(t *testing.T) {
+	network, clock, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	round, r2, capsule := encryptForTest(t, network, clock)
+	ctx := context.Background()
+
+	useBeaconCache(t, NewBeaconCache(NewMemoryBeaconStore()))
+	if _, err := Decrypt(ctx, chainHash, round, capsule, []string{endpoint}); err != nil {
+		t.Fatalf("Online decrypt failed: %v", err)
+	}
+	var bundle bytes.Buffer
+	if err := Beacons.Export(&bundle, chainHash, nil); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	if err := Beacons.Export(&bytes.Buffer{}, chainHash, []uint64{round + 1}); !errors.Is(err, ErrBeaconNotCached) {
+		t.Fatalf("Expected ErrBeaconNotCached exporting an uncached round, got %v", err)
+	}
+
+	offline, err := OpenBoltBeaconStore(filepath.Join(t.TempDir(), "offline.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := NewBeaconCache(offline)
+	defer cache.Close()
+	useBeaconCache(t, cache)
+
+	// A bundle with one forged beacon is rejected as a whole
+	var forged BeaconBundle
+	_ = json.Unmarshal(bundle.Bytes(), &forged)
+	forged.Beacons = append(forged.Beacons, BundledBeacon{Round: round + 1, Signature: forged.Beacons[0].Signature})
+	data, _ := json.Marshal(forged)
+	if _, err := cache.Import(bytes.NewReader(data)); !errors.Is(err, ErrBeaconInvalid) {
+		t.Fatalf("Expected ErrBeaconInvalid for a forged bundle, got %v", err)
+	}
+	if rounds, _ := offline.Rounds(chainHash); len(rounds) != 0 {
+		t.Fatalf("Forged bundle left rounds behind: %v", rounds)
+	}
+
+	n, err := cache.Import(bytes.NewReader(bundle.Bytes()))
+	if err != nil || n != 1 {
+		t.Fatalf("Import = %d, %v", n, err)
+	}
+	got, err := Decrypt(ctx, chainHash, round, capsule, nil)
+	if err != nil {
+		t.Fatalf("Offline decrypt failed: %v", err)
+	}
+	if !bytes.Equal(got, r2) {
+		t.Fatalf("Decrypted %x, want %x", got, r2)
+	}
+
+	if _, err := cache.Import(bytes.NewReader([]byte(`{"version":"vte-beacons/0"}`))); !errors.Is(err, ErrVersionMismatch) {
+		t.Fatalf("Expected ErrVersionMismatch, got %v", err)
+	}
+}
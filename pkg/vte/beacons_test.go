@@ -0,0 +1,137 @@
+package vte
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/drand/drand/v2/crypto"
+)
+
+// useBeaconCache swaps the process-wide cache for the duration of a test
+func useBeaconCache(t *testing.T, cache *BeaconCache) {
+	t.Helper()
+	saved := Beacons
+	Beacons = cache
+	t.Cleanup(func() { Beacons = saved })
+}
+
+func TestBeaconStores(t *testing.T) {
+	files, err := NewFileBeaconStore(filepath.Join(t.TempDir(), "beacons"))
+	if err != nil {
+		t.Fatalf("NewFileBeaconStore failed: %v", err)
+	}
+	t.Run("memory", func(t *testing.T) { checkBeaconStore(t, NewMemoryBeaconStore()) })
+	t.Run("file", func(t *testing.T) { checkBeaconStore(t, files) })
+}
+
+// checkBeaconStore runs a BeaconCache over store through verified adds,
+// lookups and an entry written behind the cache's back
+func checkBeaconStore(t *testing.T, store BeaconStore) {
+	network, clock, _ := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	clock.Advance(10 * network.Info().Period)
+	round := network.LatestRound()
+	sig, _ := network.Signature(round)
+
+	cache := NewBeaconCache(store)
+	defer cache.Close()
+
+	if err := cache.AddBeacon(chainHash, round, sig); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Expected ErrInvalidInput without chain info, got %v", err)
+	}
+	if err := cache.AddChainInfo([]byte(network.ChainInfoJSON()), chainHash); err != nil {
+		t.Fatalf("AddChainInfo failed: %v", err)
+	}
+	if err := cache.AddBeacon(chainHash, round, sig); err != nil {
+		t.Fatalf("AddBeacon failed: %v", err)
+	}
+	if err := cache.AddBeacon(chainHash, round-1, sig); !errors.Is(err, ErrBeaconInvalid) {
+		t.Fatalf("Expected ErrBeaconInvalid for the wrong round, got %v", err)
+	}
+
+	got, err := cache.Signature(chainHash, round)
+	if err != nil || !bytes.Equal(got, sig) {
+		t.Fatalf("Signature = %x, %v", got, err)
+	}
+	if _, err := cache.Signature(chainHash, round-1); !errors.Is(err, ErrBeaconNotCached) {
+		t.Fatalf("Expected ErrBeaconNotCached, got %v", err)
+	}
+	rounds, err := store.Rounds(chainHash)
+	if err != nil || len(rounds) != 1 || rounds[0] != round {
+		t.Fatalf("Rounds = %v, %v", rounds, err)
+	}
+
+	// A beacon written behind the cache's back is never returned
+	if err := store.PutSignature(chainHash, round-1, sig); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.Signature(chainHash, round-1); !errors.Is(err, ErrBeaconNotCached) {
+		t.Fatalf("Tampered store entry was returned: %v", err)
+	}
+}
+
+func TestDecryptUsesBeaconCache(t *testing.T) {
+	store, err := NewFileBeaconStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	useBeaconCache(t, NewBeaconCache(store))
+
+	network, clock, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	round, r2, capsule := encryptForTest(t, network, clock)
+	ctx := context.Background()
+
+	if _, err := Decrypt(ctx, chainHash, round, capsule, []string{endpoint}); err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+
+	// A fresh cache over the same directory decrypts with every endpoint down
+	useBeaconCache(t, NewBeaconCache(store))
+	got, err := Decrypt(ctx, chainHash, round, capsule, []string{deadEndpoint()})
+	if err != nil {
+		t.Fatalf("Decrypt from cache failed: %v", err)
+	}
+	if !bytes.Equal(got, r2) {
+		t.Fatalf("Decrypted %x, want %x", got, r2)
+	}
+
+	// So does the prefetch network, with no beacon set
+	prefetched, err := NewNetworkFromChainInfo(network.ChainInfoJSON(), network.ChainHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := DecryptWithNetwork(prefetched, capsule); err != nil || !bytes.Equal(got, r2) {
+		t.Fatalf("Prefetch network did not use the cache: %v", err)
+	}
+
+	// A cache passed explicitly needs no process-wide one
+	useBeaconCache(t, nil)
+	if got, err := NewBeaconCache(store).Decrypt(ctx, chainHash, round, capsule, []string{deadEndpoint()}); err != nil || !bytes.Equal(got, r2) {
+		t.Fatalf("Explicit cache: %x, %v", got, err)
+	}
+}
+
+func TestMemoryBeaconStoreEvicts(t *testing.T) {
+	store := NewMemoryBeaconStoreSize(2)
+	chainHash := bytes.Repeat([]byte{1}, 32)
+	for round := uint64(1); round <= 3; round++ {
+		if err := store.PutSignature(chainHash, round, []byte{byte(round)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Storing a round again does not make it newer or count twice
+	if err := store.PutSignature(chainHash, 2, []byte{2}); err != nil {
+		t.Fatal(err)
+	}
+	if rounds, _ := store.Rounds(chainHash); len(rounds) != 2 || rounds[0] != 2 || rounds[1] != 3 {
+		t.Fatalf("Rounds = %v, want [2 3]", rounds)
+	}
+	if _, err := store.GetSignature(chainHash, 1); !errors.Is(err, ErrBeaconNotCached) {
+		t.Fatalf("Oldest round still stored: %v", err)
+	}
+}
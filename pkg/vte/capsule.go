@@ -11,7 +11,10 @@ import (
 	"filippo.io/age/armor"
 )
 
-var ErrFormatMismatch = fmt.Errorf("ciphertext format ID mismatch")
+var (
+	ErrFormatMismatch   = fmt.Errorf("ciphertext format ID mismatch")
+	ErrMalformedCapsule = fmt.Errorf("malformed capsule")
+)
 
 // CipherFields represents the parsed components of the ciphertext.
 type CipherFields struct {
@@ -48,7 +51,7 @@ func parseTlockV1(capsule []byte) (CipherFields, error) {
 	// 2. Read all data (after armor decoding)
 	data, err := io.ReadAll(reader)
 	if err != nil {
-		return CipherFields{}, err
+		return CipherFields{}, fmt.Errorf("%w: %v", ErrMalformedCapsule, err)
 	}
 
 	// 3. Parse Age Header manually to find tlock stanza
@@ -68,7 +71,7 @@ func parseTlockV1(capsule []byte) (CipherFields, error) {
 		if bytes.HasPrefix(data, []byte("---")) {
 			headerEndIndex = 0 // The start is the end marker? Invalid age file usually starts with version.
 		} else {
-			return CipherFields{}, fmt.Errorf("invalid age format: no header end marker")
+			return CipherFields{}, fmt.Errorf("%w: invalid age format: no header end marker", ErrMalformedCapsule)
 		}
 	}
 
@@ -94,7 +97,7 @@ func parseTlockV1(capsule []byte) (CipherFields, error) {
 	}
 
 	if payloadStartIndex == -1 || payloadStartIndex > len(data) {
-		return CipherFields{}, fmt.Errorf("could not find payload start")
+		return CipherFields{}, fmt.Errorf("%w: could not find payload start", ErrMalformedCapsule)
 	}
 
 	payload := data[payloadStartIndex:]
@@ -115,13 +118,13 @@ func parseTlockV1(capsule []byte) (CipherFields, error) {
 
 			// Body is next line(s).
 			if i+1 >= len(lines) {
-				return CipherFields{}, fmt.Errorf("truncated stanza body")
+				return CipherFields{}, fmt.Errorf("%w: truncated stanza body", ErrMalformedCapsule)
 			}
 
 			bodyB64 := strings.TrimSpace(lines[i+1])
 			decoded, err := base64.RawStdEncoding.DecodeString(bodyB64)
 			if err != nil {
-				return CipherFields{}, fmt.Errorf("invalid base64 in stanza: %w", err)
+				return CipherFields{}, fmt.Errorf("%w: invalid base64 in stanza: %v", ErrMalformedCapsule, err)
 			}
 			stanzaBody = decoded
 			foundStanza = true
@@ -130,14 +133,14 @@ func parseTlockV1(capsule []byte) (CipherFields, error) {
 	}
 
 	if !foundStanza {
-		return CipherFields{}, fmt.Errorf("no tlock stanza found in header")
+		return CipherFields{}, fmt.Errorf("%w: no tlock stanza found in header", ErrMalformedCapsule)
 	}
 
 	// 5. Split Stanza Body (U || V || W)
 	// U is variable length?
 	// V and W are 16 bytes.
 	if len(stanzaBody) < 32 {
-		return CipherFields{}, fmt.Errorf("stanza body too short for V+W")
+		return CipherFields{}, fmt.Errorf("%w: stanza body too short for V+W", ErrMalformedCapsule)
 	}
 
 	uLen := len(stanzaBody) - 32
@@ -12,7 +12,7 @@ import (
 // Returns the compressed form (33 bytes).
 func ComputeR2Point(r2 []byte) ([]byte, error) {
 	if len(r2) != 32 {
-		return nil, fmt.Errorf("r2 must be 32 bytes")
+		return nil, fmt.Errorf("%w: r2 must be 32 bytes", ErrInvalidInput)
 	}
 
 	// Compute R2 = r2 * G on secp256k1
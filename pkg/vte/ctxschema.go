@@ -0,0 +1,220 @@
+package vte
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Context schemas of single-network packages. ctx_v2 concatenates its
+// fields, so bytes can move between the session ID and the refund tx without
+// changing the hash; ctx_v3 length-prefixes and types every field and binds
+// application fields too. Multi-network packages use CtxSchemaMulti, which
+// is length-prefixed already.
+const (
+	CtxSchemaV2 = "ctx_v2"
+	CtxSchemaV3 = "ctx_v3"
+)
+
+var ctxFieldsV2 = []string{"drand_chain_hash", "round", "capsule_hash", "session_id", "refund_tx_hex"}
+
+// CtxFieldType is the type of a ctx_v3 field. It fixes the text form of the
+// value in JSON and the bytes that are hashed.
+type CtxFieldType string
+
+const (
+	CtxBytes    CtxFieldType = "bytes"    // hex; hashed as is
+	CtxString   CtxFieldType = "string"   // UTF-8; hashed as is
+	CtxUint64   CtxFieldType = "u64"      // decimal; 8 bytes big-endian
+	CtxPubkey   CtxFieldType = "pubkey"   // SEC1 compressed secp256k1 point, hex; 33 bytes
+	CtxOutpoint CtxFieldType = "outpoint" // "txid:vout", txid as displayed; Bitcoin serialization, 36 bytes
+	CtxAmount   CtxFieldType = "amount"   // decimal base units (e.g. satoshis); 8 bytes big-endian
+	CtxExpiry   CtxFieldType = "expiry"   // decimal Unix seconds; 8 bytes big-endian
+)
+
+// ctxFieldTags are the type bytes hashed before each value. Never reuse one.
+var ctxFieldTags = map[CtxFieldType]byte{
+	CtxBytes:    1,
+	CtxString:   2,
+	CtxUint64:   3,
+	CtxPubkey:   4,
+	CtxOutpoint: 5,
+	CtxAmount:   6,
+	CtxExpiry:   7,
+}
+
+// CtxField is a typed ctx_v3 field. The core fields of ctx_v2 come first and
+// are not listed in ContextInfo.Values; every other field is, in hash order.
+// Names are the application's choice, but must be unique.
+type CtxField struct {
+	Name  string       `json:"name"`
+	Type  CtxFieldType `json:"type"`
+	Value string       `json:"value"` // text form, see CtxFieldType
+}
+
+// Field constructors
+
+func BytesField(name string, b []byte) CtxField {
+	return CtxField{Name: name, Type: CtxBytes, Value: hex.EncodeToString(b)}
+}
+
+func StringField(name, s string) CtxField {
+	return CtxField{Name: name, Type: CtxString, Value: s}
+}
+
+func Uint64Field(name string, v uint64) CtxField {
+	return CtxField{Name: name, Type: CtxUint64, Value: strconv.FormatUint(v, 10)}
+}
+
+// PubkeyField takes a compressed point, e.g. a counterparty's key
+func PubkeyField(name string, pubkey []byte) CtxField {
+	return CtxField{Name: name, Type: CtxPubkey, Value: hex.EncodeToString(pubkey)}
+}
+
+// OutpointField takes a txid in display (RPC) order
+func OutpointField(name, txid string, vout uint32) CtxField {
+	return CtxField{Name: name, Type: CtxOutpoint, Value: fmt.Sprintf("%s:%d", txid, vout)}
+}
+
+func AmountField(name string, amount uint64) CtxField {
+	return CtxField{Name: name, Type: CtxAmount, Value: strconv.FormatUint(amount, 10)}
+}
+
+func ExpiryField(name string, t time.Time) CtxField {
+	return CtxField{Name: name, Type: CtxExpiry, Value: strconv.FormatInt(t.Unix(), 10)}
+}
+
+// Encode returns the bytes of the value that are hashed, checking it
+// against its type
+func (f CtxField) Encode() ([]byte, error) {
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%w: ctx field %q (%s): %s", ErrInvalidInput, f.Name, f.Type, fmt.Sprintf(format, args...))
+	}
+	switch f.Type {
+	case CtxBytes:
+		b, err := hex.DecodeString(f.Value)
+		if err != nil {
+			return nil, fail("invalid hex: %v", err)
+		}
+		return b, nil
+	case CtxString:
+		return []byte(f.Value), nil
+	case CtxUint64, CtxAmount, CtxExpiry:
+		v, err := strconv.ParseUint(f.Value, 10, 64)
+		if err != nil {
+			return nil, fail("not a decimal uint64: %v", err)
+		}
+		return binary.BigEndian.AppendUint64(nil, v), nil
+	case CtxPubkey:
+		b, err := hex.DecodeString(f.Value)
+		if err != nil || len(b) != 33 {
+			return nil, fail("want 33 bytes of hex")
+		}
+		if _, err := btcec.ParsePubKey(b); err != nil {
+			return nil, fail("not a secp256k1 point: %v", err)
+		}
+		return b, nil
+	case CtxOutpoint:
+		txid, vout, ok := strings.Cut(f.Value, ":")
+		hash, err := chainhash.NewHashFromStr(txid)
+		if !ok || err != nil || len(txid) != 2*chainhash.HashSize {
+			return nil, fail("want txid:vout with a 64-character txid")
+		}
+		index, err := strconv.ParseUint(vout, 10, 32)
+		if err != nil {
+			return nil, fail("invalid vout: %v", err)
+		}
+		return binary.LittleEndian.AppendUint32(hash[:], uint32(index)), nil
+	default:
+		return nil, fail("unknown type")
+	}
+}
+
+// ctxV3Core returns the core fields of a ctx_v3 hash, named as in ctx_v2
+func ctxV3Core(params *CtxHashParams) []CtxField {
+	return []CtxField{
+		BytesField("drand_chain_hash", params.ChainHash),
+		Uint64Field("round", params.Round),
+		BytesField("capsule_hash", params.CapsuleHash),
+		StringField("session_id", params.SessionID),
+		BytesField("refund_tx_hex", params.RefundTx),
+	}
+}
+
+// CtxFieldsV3 returns ContextInfo.Fields of a ctx_v3 package: the core
+// field names, then the names of the extra fields
+func CtxFieldsV3(values []CtxField) []string {
+	names := slices.Clone(ctxFieldsV2)
+	for _, f := range values {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// ComputeCtxHashV3 computes a ctx_v3 context hash over the core fields of
+// params and then params.Fields.
+// Layout: "VTE_CTX_V3" || Count || per field (Name || Type || Value), where
+// Count is 4 bytes big-endian, Type is one tag byte, and Name and the encoded
+// Value are prefixed with their 4-byte big-endian length.
+func ComputeCtxHashV3(params *CtxHashParams) ([]byte, error) {
+	if params == nil {
+		return nil, fmt.Errorf("%w: params cannot be nil", ErrInvalidInput)
+	}
+	if len(params.ChainHash) != 32 {
+		return nil, fmt.Errorf("%w: chain_hash must be 32 bytes", ErrInvalidInput)
+	}
+	if len(params.CapsuleHash) != 32 {
+		return nil, fmt.Errorf("%w: capsule_hash must be 32 bytes SHA256", ErrInvalidInput)
+	}
+
+	fields := append(ctxV3Core(params), params.Fields...)
+	seen := make(map[string]bool, len(fields))
+	h := sha256.New()
+	h.Write([]byte("VTE_CTX_V3"))
+	_ = binary.Write(h, binary.BigEndian, uint32(len(fields)))
+	for _, f := range fields {
+		if f.Name == "" || seen[f.Name] {
+			return nil, fmt.Errorf("%w: ctx field names must be unique and non-empty, got %q", ErrInvalidInput, f.Name)
+		}
+		seen[f.Name] = true
+		value, err := f.Encode()
+		if err != nil {
+			return nil, err
+		}
+		writeLengthPrefixed(h, []byte(f.Name))
+		h.Write([]byte{ctxFieldTags[f.Type]})
+		writeLengthPrefixed(h, value)
+	}
+	return h.Sum(nil), nil
+}
+
+// ComputeCtxHash computes the context hash of a single-network package under
+// a schema; "" is ctx_v2
+func ComputeCtxHash(schema string, params *CtxHashParams) ([]byte, error) {
+	switch schema {
+	case "", CtxSchemaV2:
+		return ComputeFullCtxHash(params)
+	case CtxSchemaV3:
+		return ComputeCtxHashV3(params)
+	default:
+		return nil, fmt.Errorf("%w: unknown context schema %q", ErrInvalidInput, schema)
+	}
+}
+
+// Field returns the ctx_v3 field of a package context by name, or nil
+func (c *ContextInfo) Field(name string) *CtxField {
+	for i := range c.Values {
+		if c.Values[i].Name == name {
+			return &c.Values[i]
+		}
+	}
+	return nil
+}
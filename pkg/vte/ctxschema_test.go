@@ -0,0 +1,147 @@
+package vte
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/crypto"
+)
+
+func TestCtxHashV3(t *testing.T) {
+	base := CtxHashParams{ChainHash: make([]byte, 32), Round: 7, CapsuleHash: make([]byte, 32)}
+
+	// Moving a byte from the session ID into the refund tx keeps the ctx_v2
+	// hash but not the ctx_v3 one
+	a, b := base, base
+	a.SessionID, a.RefundTx = "ab", nil
+	b.SessionID, b.RefundTx = "a", []byte("b")
+	v2a, _ := ComputeFullCtxHash(&a)
+	v2b, _ := ComputeFullCtxHash(&b)
+	if !bytes.Equal(v2a, v2b) {
+		t.Fatal("Expected the ctx_v2 collision")
+	}
+	v3a, err := ComputeCtxHashV3(&a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v3b, _ := ComputeCtxHashV3(&b)
+	if bytes.Equal(v3a, v3b) {
+		t.Fatal("ctx_v3 hashes collide")
+	}
+
+	// Same bytes under another type hash differently
+	a, b = base, base
+	a.Fields = []CtxField{Uint64Field("n", 5)}
+	b.Fields = []CtxField{AmountField("n", 5)}
+	if ha, _ := ComputeCtxHashV3(&a); bytes.Equal(ha, mustCtxHashV3(t, &b)) {
+		t.Fatal("Field type is not bound")
+	}
+
+	// Outpoints hash in Bitcoin serialization: txid reversed, vout little-endian
+	txid := "0102030405060708091011121314151617181920212223242526272829303132"
+	encoded, err := OutpointField("funding", txid, 1).Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encoded[0] != 0x32 || encoded[31] != 0x01 || !bytes.Equal(encoded[32:], []byte{1, 0, 0, 0}) {
+		t.Fatalf("Outpoint encoded as %x", encoded)
+	}
+
+	pubkey, _ := ComputeR2Point(PlaintextToR2("counterparty"))
+	for name, fields := range map[string][]CtxField{
+		"short pubkey":     {PubkeyField("counterparty", pubkey[:32])},
+		"off-curve pubkey": {PubkeyField("counterparty", append([]byte{2}, bytes.Repeat([]byte{0xff}, 32)...))},
+		"bad outpoint":     {{Name: "funding", Type: CtxOutpoint, Value: txid}},
+		"bad amount":       {{Name: "amount", Type: CtxAmount, Value: "-1"}},
+		"bad hex":          {{Name: "memo", Type: CtxBytes, Value: "zz"}},
+		"unknown type":     {{Name: "memo", Type: "float", Value: "1"}},
+		"duplicate":        {StringField("memo", "a"), StringField("memo", "b")},
+		"core name":        {Uint64Field("round", 8)},
+		"empty name":       {StringField("", "a")},
+	} {
+		p := base
+		p.Fields = fields
+		if _, err := ComputeCtxHashV3(&p); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+	p := base
+	p.Fields = []CtxField{PubkeyField("counterparty", pubkey), ExpiryField("expiry", time.Unix(1700000000, 0))}
+	if _, err := ComputeFullCtxHash(&p); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("ctx_v2 accepted extra fields: %v", err)
+	}
+	if _, err := ComputeCtxHash("ctx_v9", &p); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Unknown schema accepted: %v", err)
+	}
+}
+
+func mustCtxHashV3(t *testing.T, p *CtxHashParams) []byte {
+	t.Helper()
+	h, err := ComputeCtxHashV3(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func TestCtxV3Package(t *testing.T) {
+	network, _, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	pubkey, _ := ComputeR2Point(PlaintextToR2("counterparty"))
+	fields := []CtxField{
+		PubkeyField("counterparty_pubkey", pubkey),
+		OutpointField("funding", "0102030405060708091011121314151617181920212223242526272829303132", 0),
+		AmountField("amount", 50000),
+		ExpiryField("expiry", time.Unix(1700000000, 0)),
+		StringField("app.order_id", "order-17"),
+	}
+	pkg, err := GenerateVTE(&GenerateVTEParams{
+		Round:          network.LatestRound() + 5,
+		ChainHash:      chainHash,
+		FormatID:       "tlock_v1_age_pairing",
+		SessionID:      "ctx-v3",
+		R2:             PlaintextToR2("ctx v3"),
+		RefundTx:       []byte{1, 2},
+		CtxFields:      fields,
+		DrandEndpoints: []string{endpoint},
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE failed: %v", err)
+	}
+	if pkg.Context.Schema != CtxSchemaV3 || len(pkg.Context.Fields) != len(ctxFieldsV2)+len(fields) {
+		t.Fatalf("Unexpected context %+v", pkg.Context)
+	}
+	if err := VerifyCtxHashBinding(pkg); err != nil {
+		t.Fatalf("VerifyCtxHashBinding failed: %v", err)
+	}
+	if f := pkg.Context.Field("amount"); f == nil || f.Value != "50000" {
+		t.Fatalf("Field(amount) = %+v", f)
+	}
+
+	for name, tamper := range map[string]func(c *ContextInfo){
+		"value":         func(c *ContextInfo) { c.Values[2].Value = "50001" },
+		"type":          func(c *ContextInfo) { c.Values[2].Type = CtxUint64 },
+		"dropped value": func(c *ContextInfo) { c.Values = c.Values[:4] },
+		"fields":        func(c *ContextInfo) { c.Fields = c.Fields[:len(c.Fields)-1] },
+		"schema":        func(c *ContextInfo) { c.Schema = CtxSchemaV2 },
+	} {
+		tampered := *pkg
+		tampered.Context.Values = append([]CtxField(nil), pkg.Context.Values...)
+		tampered.Context.Fields = append([]string(nil), pkg.Context.Fields...)
+		tamper(&tampered.Context)
+		if err := VerifyCtxHashBinding(&tampered); !errors.Is(err, ErrCtxHashMismatch) {
+			t.Errorf("%s: expected ErrCtxHashMismatch, got %v", name, err)
+		}
+	}
+
+	if _, err := GenerateVTE(&GenerateVTEParams{
+		Lock:      LockAnyOf,
+		R2:        PlaintextToR2("ctx v3"),
+		CtxFields: fields,
+	}); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Lock with ctx_v3 fields: %v", err)
+	}
+}
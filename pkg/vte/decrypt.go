@@ -1,39 +1,109 @@
 package vte
 
 import (
-	"bytes"
 	"context"
+	"encoding/hex"
 	"fmt"
 
-	"github.com/drand/tlock"
-	tlockHttp "github.com/drand/tlock/networks/http"
+	"github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/common/chain"
 )
 
 // Decrypt decrypts a tlock-encrypted capsule using the drand beacon for the specified round.
-// It fetches the beacon from the drand network and uses it to decrypt the payload.
+// Chain info is cross-checked across all endpoints, then the beacon is fetched
+// from the endpoints in order until one serves a signature that verifies.
+// Chains pinned in the network registry skip the chain info fetch and verify
+// beacons against the pinned key. The Beacons cache is checked first for both
+// chain info and the beacon, so a warm cache decrypts with no endpoint at all.
 func Decrypt(ctx context.Context, chainHash []byte, round uint64, capsule []byte, endpoints []string) ([]byte, error) {
-	if len(endpoints) == 0 {
-		return nil, fmt.Errorf("no drand endpoints provided")
+	return Beacons.Decrypt(ctx, chainHash, round, capsule, endpoints)
+}
+
+// Decrypt is the package-level Decrypt with c in place of the Beacons cache
+func (c *BeaconCache) Decrypt(ctx context.Context, chainHash []byte, round uint64, capsule []byte, endpoints []string) ([]byte, error) {
+	if pinned := pinnedChain(chainHash); pinned != nil {
+		info, err := pinned.chainInfo()
+		if err != nil {
+			return nil, err
+		}
+		return c.decryptWithInfo(ctx, info, round, capsule, endpoints)
 	}
 
-	chainHashHex := fmt.Sprintf("%x", chainHash)
+	info := c.chainInfo(chainHash)
+	if info == nil {
+		var err error
+		if info, err = resolveChainInfo(ctx, chainHash, endpoints); err != nil {
+			return nil, err
+		}
+	}
 
-	// Create network client using the first endpoint
-	network, err := tlockHttp.NewNetwork(endpoints[0], chainHashHex)
+	return c.decryptWithInfo(ctx, info, round, capsule, endpoints)
+}
+
+// decryptWithInfo gets a verified beacon for round, from the cache or the
+// endpoints, and opens the capsule with it
+func (c *BeaconCache) decryptWithInfo(ctx context.Context, info *chain.Info, round uint64, capsule []byte, endpoints []string) ([]byte, error) {
+	sig := c.verifiedSignature(info.Hash(), round, func(sig []byte) error { return verifyBeacon(info, round, sig) })
+	if sig == nil {
+		var err error
+		if sig, err = fetchVerifiedSignature(ctx, info, endpoints, round); err != nil {
+			return nil, err
+		}
+	}
+	return c.decryptWithSignature(info, round, sig, capsule)
+}
+
+// DecryptWithBeacon decrypts a capsule with a beacon signature the caller
+// already has, without any network access (WASM, air-gapped machines).
+// Chain info comes from the registry for pinned chains, else from
+// chainInfoJSON, which must hash to chainHash, else from the Beacons cache.
+// The signature must verify under the chain key; an empty one is looked up
+// in the Beacons cache.
+func DecryptWithBeacon(chainHash []byte, round uint64, capsule []byte, chainInfoJSON string, beaconSignatureHex string) ([]byte, error) {
+	var info *chain.Info
+	var err error
+	switch pinned := pinnedChain(chainHash); {
+	case pinned != nil:
+		info, err = pinned.chainInfo()
+	case chainInfoJSON != "":
+		var trusted *TrustedChainInfo
+		if trusted, err = TrustedChainInfoFromJSON([]byte(chainInfoJSON), chainHash); err == nil {
+			info, err = trusted.chainInfo()
+		}
+	default:
+		if info = Beacons.chainInfo(chainHash); info == nil {
+			err = fmt.Errorf("%w: no chain info supplied and chain %x is neither pinned nor cached", ErrInvalidInput, chainHash)
+		}
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create network client: %w", err)
+		return nil, err
+	}
+
+	var sig []byte
+	if beaconSignatureHex != "" {
+		if sig, err = hex.DecodeString(beaconSignatureHex); err != nil {
+			return nil, fmt.Errorf("%w: invalid beacon signature hex: %v", ErrInvalidInput, err)
+		}
+		if err := verifyBeacon(info, round, sig); err != nil {
+			return nil, err
+		}
+	} else if sig = Beacons.verifiedSignature(chainHash, round, func(sig []byte) error { return verifyBeacon(info, round, sig) }); sig == nil {
+		return nil, fmt.Errorf("%w: no beacon supplied or cached for round %d", ErrInvalidInput, round)
 	}
 
-	// Create tlock client in strict mode
-	client := tlock.New(network).Strict()
+	return Beacons.decryptWithSignature(info, round, sig, capsule)
+}
 
-	// Decrypt using the capsule (capsule contains round info internally)
-	var plaintext bytes.Buffer
-	src := bytes.NewReader(capsule)
+// decryptWithSignature opens the capsule with a beacon signature that was
+// already verified under info, and caches it
+func (c *BeaconCache) decryptWithSignature(info *chain.Info, round uint64, sig []byte, capsule []byte) ([]byte, error) {
+	c.remember(info, round, sig)
 
-	if err := client.Decrypt(&plaintext, src); err != nil {
-		return nil, fmt.Errorf("tlock decryption failed: %w", err)
+	network, err := newNetworkFromInfo(info)
+	if err != nil {
+		return nil, err
 	}
+	network.prefetchedBeacon = &common.Beacon{Round: round, Signature: sig}
 
-	return plaintext.Bytes(), nil
+	return DecryptWithNetwork(network, capsule)
 }
@@ -0,0 +1,234 @@
+package vte
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drand/drand/v2/common/chain"
+	"github.com/drand/tlock"
+)
+
+// EndpointTimeout bounds each request to a single drand endpoint. The context
+// passed to Encrypt/Decrypt still bounds the whole operation.
+var EndpointTimeout = 5 * time.Second
+
+// EndpointError records what a single drand endpoint did
+type EndpointError struct {
+	Endpoint string
+	Err      error
+}
+
+func (e *EndpointError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Endpoint, e.Err)
+}
+
+func (e *EndpointError) Unwrap() error { return e.Err }
+
+// EndpointsError aggregates the per-endpoint failures of one operation.
+// errors.Is/As see through it to every endpoint error.
+type EndpointsError struct {
+	Op     string
+	Errors []*EndpointError
+}
+
+func (e *EndpointsError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%s: all %d drand endpoints failed: %s", e.Op, len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *EndpointsError) Unwrap() []error {
+	errs := make([]error, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = err
+	}
+	return errs
+}
+
+// resolveChainInfo fetches the chain info from every endpoint in parallel and
+// cross-checks the answers. Unreachable endpoints are skipped, but any endpoint
+// serving a different chain than chainHash aborts with ErrChainInfoMismatch:
+// a disagreement means at least one endpoint is misconfigured or lying.
+func resolveChainInfo(ctx context.Context, chainHash []byte, endpoints []string) (*chain.Info, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no drand endpoints provided")
+	}
+
+	infos := make([]*chain.Info, len(endpoints))
+	errs := make([]error, len(endpoints))
+
+	var wg sync.WaitGroup
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint string) {
+			defer wg.Done()
+			infos[i], errs[i] = fetchChainInfo(ctx, endpoint, chainHash)
+		}(i, endpoint)
+	}
+	wg.Wait()
+
+	var agreed *chain.Info
+	var failed []*EndpointError
+	var mismatched []string
+	for i, endpoint := range endpoints {
+		if errs[i] != nil {
+			failed = append(failed, &EndpointError{Endpoint: endpoint, Err: errs[i]})
+			continue
+		}
+		if infos[i].HashString() != hex.EncodeToString(chainHash) {
+			mismatched = append(mismatched, fmt.Sprintf("%s serves chain %s", endpoint, infos[i].HashString()))
+			continue
+		}
+		if agreed == nil {
+			agreed = infos[i]
+		} else if !agreed.Equal(infos[i]) {
+			mismatched = append(mismatched, fmt.Sprintf("%s serves different chain info", endpoint))
+		}
+	}
+
+	if len(mismatched) > 0 {
+		return nil, fmt.Errorf("%w: expected chain %x: %s", ErrChainInfoMismatch, chainHash, strings.Join(mismatched, "; "))
+	}
+	if agreed == nil {
+		return nil, &EndpointsError{Op: "fetch chain info", Errors: failed}
+	}
+
+	return agreed, nil
+}
+
+// fetchVerifiedSignature fetches the beacon for round from the endpoints in
+// order and returns the first signature that verifies under info. Endpoints
+// that fail or serve an invalid beacon are recorded and the next one is tried.
+func fetchVerifiedSignature(ctx context.Context, info *chain.Info, endpoints []string, round uint64) ([]byte, error) {
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("no drand endpoints provided")
+	}
+
+	var failed []*EndpointError
+	for _, endpoint := range endpoints {
+		sig, err := fetchBeaconSignature(ctx, endpoint, info.Hash(), round)
+		if err == nil {
+			err = verifyBeacon(info, round, sig)
+		}
+		if err != nil {
+			failed = append(failed, &EndpointError{Endpoint: endpoint, Err: err})
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		return sig, nil
+	}
+
+	return nil, &EndpointsError{Op: fmt.Sprintf("fetch beacon %d", round), Errors: failed}
+}
+
+// FetchChainInfo returns verified chain info for chainHash: pinned from the
+// network registry, else fetched and cross-checked across the endpoints
+func FetchChainInfo(ctx context.Context, chainHash []byte, endpoints []string) (*TrustedChainInfo, error) {
+	if pinned := pinnedChain(chainHash); pinned != nil {
+		return pinned, nil
+	}
+	info, err := resolveChainInfo(ctx, chainHash, endpoints)
+	if err != nil {
+		return nil, err
+	}
+	return trustedFromInfo(info)
+}
+
+// FetchBeacon fetches the signature for round from the endpoints in order and
+// returns the first one that verifies under the trusted chain key
+func FetchBeacon(ctx context.Context, trusted *TrustedChainInfo, round uint64, endpoints []string) ([]byte, error) {
+	info, err := trusted.chainInfo()
+	if err != nil {
+		return nil, err
+	}
+	return fetchVerifiedSignature(ctx, info, endpoints, round)
+}
+
+// fetchChainInfo gets /{chainHash}/info from one endpoint
+func fetchChainInfo(ctx context.Context, endpoint string, chainHash []byte) (*chain.Info, error) {
+	body, err := endpointGet(ctx, endpoint, fmt.Sprintf("%x/info", chainHash))
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := chain.InfoFromJSON(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid chain info: %w", err)
+	}
+	return info, nil
+}
+
+// fetchBeaconSignature gets the signature of /{chainHash}/public/{round} from one endpoint
+func fetchBeaconSignature(ctx context.Context, endpoint string, chainHash []byte, round uint64) ([]byte, error) {
+	body, err := endpointGet(ctx, endpoint, fmt.Sprintf("%x/public/%d", chainHash, round))
+	if err != nil {
+		return nil, err
+	}
+
+	var beacon struct {
+		Round     uint64 `json:"round"`
+		Signature string `json:"signature"`
+	}
+	if err := json.Unmarshal(body, &beacon); err != nil {
+		return nil, fmt.Errorf("invalid beacon: %w", err)
+	}
+	if beacon.Round != round {
+		return nil, fmt.Errorf("%w: asked for round %d, got %d", ErrBeaconInvalid, round, beacon.Round)
+	}
+	sig, err := hex.DecodeString(beacon.Signature)
+	if err != nil || len(sig) == 0 {
+		return nil, fmt.Errorf("%w: bad signature encoding", ErrBeaconInvalid)
+	}
+	return sig, nil
+}
+
+// endpointGet performs one GET bounded by EndpointTimeout. A 425 Too Early
+// response maps to tlock.ErrTooEarly so callers can tell "not yet" apart.
+func endpointGet(ctx context.Context, endpoint, path string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, EndpointTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpointURL(endpoint, path), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusTooEarly:
+		return nil, tlock.ErrTooEarly
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("reading response: %w", err)
+	}
+	return body, nil
+}
+
+// endpointURL joins an endpoint and a path, defaulting to https like tlock does
+func endpointURL(endpoint, path string) string {
+	if !strings.HasPrefix(endpoint, "http") {
+		endpoint = "https://" + endpoint
+	}
+	return strings.TrimRight(endpoint, "/") + "/" + path
+}
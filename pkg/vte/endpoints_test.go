@@ -0,0 +1,178 @@
+package vte
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/crypto"
+
+	"vte-tlock/pkg/drandsim"
+)
+
+// serve starts an httptest server for handler, closed at test end
+func serve(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// deadEndpoint returns the URL of a server that is no longer listening
+func deadEndpoint() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL
+}
+
+func brokenEndpoint(t *testing.T) string {
+	return serve(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+}
+
+// forgedBeaconEndpoint serves the correct chain info for network but beacons
+// signed with another key
+func forgedBeaconEndpoint(t *testing.T, network *drandsim.Network) string {
+	t.Helper()
+	forger, err := drandsim.New(drandsim.Config{Seed: []byte("forger"), GenesisTime: network.Info().GenesisTime})
+	if err != nil {
+		t.Fatalf("drandsim.New failed: %v", err)
+	}
+
+	return serve(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/info") {
+			network.Handler().ServeHTTP(w, r)
+			return
+		}
+		r.URL.Path = strings.Replace(r.URL.Path, network.ChainHash(), forger.ChainHash(), 1)
+		forger.Handler().ServeHTTP(w, r)
+	})
+}
+
+// encryptForTest encrypts r2 for a round the simulated clock already reached
+func encryptForTest(t *testing.T, network *drandsim.Network, clock *drandsim.ManualClock) (uint64, []byte, []byte) {
+	t.Helper()
+	round := network.LatestRound() + 1
+	r2 := PlaintextToR2("failover")
+	capsule, err := EncryptWithNetwork(network, round, r2, nil)
+	if err != nil {
+		t.Fatalf("EncryptWithNetwork failed: %v", err)
+	}
+	clock.Advance(network.Info().Period)
+	return round, r2, capsule
+}
+
+func TestEndpointFailover(t *testing.T) {
+	network, clock, good := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	round, r2, capsule := encryptForTest(t, network, clock)
+	endpoints := []string{deadEndpoint(), brokenEndpoint(t), good}
+	ctx := context.Background()
+
+	got, err := Decrypt(ctx, chainHash, round, capsule, endpoints)
+	if err != nil {
+		t.Fatalf("Decrypt with one live endpoint failed: %v", err)
+	}
+	if string(got) != string(r2) {
+		t.Fatalf("Decrypted %x, want %x", got, r2)
+	}
+
+	if _, err := Encrypt(ctx, chainHash, round+10, r2, endpoints); err != nil {
+		t.Fatalf("Encrypt with one live endpoint failed: %v", err)
+	}
+}
+
+func TestEndpointsAllFail(t *testing.T) {
+	dead, broken := deadEndpoint(), brokenEndpoint(t)
+	chainHash := make([]byte, 32)
+
+	_, err := Decrypt(context.Background(), chainHash, 1, nil, []string{dead, broken})
+
+	var agg *EndpointsError
+	if !errors.As(err, &agg) {
+		t.Fatalf("Expected *EndpointsError, got %T: %v", err, err)
+	}
+	if len(agg.Errors) != 2 || agg.Errors[0].Endpoint != dead || agg.Errors[1].Endpoint != broken {
+		t.Fatalf("Unexpected per-endpoint errors: %v", agg.Errors)
+	}
+	if !strings.Contains(err.Error(), "500") {
+		t.Fatalf("Aggregated error does not say what each endpoint did: %v", err)
+	}
+}
+
+func TestEndpointsDisagree(t *testing.T) {
+	network, _, good := simulatedDrand(t, crypto.SigsOnG1ID)
+	other, err := drandsim.New(drandsim.Config{Seed: []byte("impostor")})
+	if err != nil {
+		t.Fatalf("drandsim.New failed: %v", err)
+	}
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+
+	// Answers any chain hash with its own chain info
+	impostor := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(other.ChainInfoJSON()))
+	})
+
+	_, err = Encrypt(context.Background(), chainHash, 100, PlaintextToR2("x"), []string{good, impostor})
+	if !errors.Is(err, ErrChainInfoMismatch) {
+		t.Fatalf("Expected ErrChainInfoMismatch, got %v", err)
+	}
+	if ErrorClass(err) != "error_chain_info_mismatch" {
+		t.Fatalf("ErrorClass = %s", ErrorClass(err))
+	}
+}
+
+func TestEndpointInvalidBeacon(t *testing.T) {
+	network, clock, good := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	round, r2, capsule := encryptForTest(t, network, clock)
+
+	forged := forgedBeaconEndpoint(t, network)
+
+	ctx := context.Background()
+	if _, err := Decrypt(ctx, chainHash, round, capsule, []string{forged}); !errors.Is(err, ErrBeaconInvalid) {
+		t.Fatalf("Expected ErrBeaconInvalid, got %v", err)
+	}
+
+	got, err := Decrypt(ctx, chainHash, round, capsule, []string{forged, good})
+	if err != nil {
+		t.Fatalf("Decrypt did not fail over past the forged beacon: %v", err)
+	}
+	if string(got) != string(r2) {
+		t.Fatalf("Decrypted %x, want %x", got, r2)
+	}
+}
+
+func TestEndpointTimeout(t *testing.T) {
+	defer func(d time.Duration) { EndpointTimeout = d }(EndpointTimeout)
+	EndpointTimeout = 200 * time.Millisecond
+
+	network, _, good := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+
+	hanging := serve(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	start := time.Now()
+	if _, err := Encrypt(context.Background(), chainHash, 100, PlaintextToR2("x"), []string{hanging, good}); err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Hanging endpoint was not cut off (took %s)", elapsed)
+	}
+
+	// The caller's context still bounds the whole operation
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := Encrypt(ctx, chainHash, 100, PlaintextToR2("x"), []string{hanging})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context deadline, got %v", err)
+	}
+}
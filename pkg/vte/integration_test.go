@@ -1,85 +1,226 @@
 package vte
 
 import (
+	"bytes"
 	"context"
+	"encoding/hex"
+	"errors"
 	"testing"
-	"time"
+
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock"
+
+	"vte-tlock/internal/drandtest"
+	"vte-tlock/pkg/drandsim"
 )
 
-// TestRealEncryptDecryptFlow tests the complete flow with real tlock
-// NOTE: This test requires internet connection (drand API) and takes time (beacon waiting)
-// Skip this test for fast CI builds
+// simulatedDrand starts an in-process drand network and its HTTP API.
+// The clock starts at genesis; advance it to release rounds.
+func simulatedDrand(t *testing.T, scheme string) (*drandsim.Network, *drandsim.ManualClock, string) {
+	t.Helper()
+	network, clock, server := drandtest.Start(t, drandsim.Config{Scheme: scheme})
+	return network, clock, server.URL
+}
+
+// TestRealEncryptDecryptFlow tests the complete flow with real tlock over the
+// drand HTTP API, against a simulated network so it runs offline
 func TestRealEncryptDecryptFlow(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping real drand test in short mode")
+	for _, scheme := range []string{crypto.SigsOnG1ID, crypto.UnchainedSchemeID} {
+		t.Run(scheme, func(t *testing.T) {
+			network, clock, endpoint := simulatedDrand(t, scheme)
+			chainHash, _ := hex.DecodeString(network.ChainHash())
+			ctx := context.Background()
+
+			plaintext := "Hello from real VTE-TLock!"
+			round := network.LatestRound() + 10
+
+			capsule, err := Encrypt(ctx, chainHash, round, PlaintextToR2(plaintext), []string{endpoint})
+			if err != nil {
+				t.Fatalf("Encryption failed: %v", err)
+			}
+
+			// Round not reached yet
+			if _, err := Decrypt(ctx, chainHash, round, capsule, []string{endpoint}); !errors.Is(err, tlock.ErrTooEarly) {
+				t.Fatalf("Expected ErrTooEarly before the round, got %v", err)
+			}
+
+			clock.Advance(10 * network.Info().Period)
+
+			r2, err := Decrypt(ctx, chainHash, round, capsule, []string{endpoint})
+			if err != nil {
+				t.Fatalf("Decryption failed: %v", err)
+			}
+
+			// Verify r2 matches our expected hash of plaintext
+			expectedR2 := PlaintextToR2(plaintext)
+			if string(r2) != string(expectedR2) {
+				t.Fatalf("Decrypted r2 doesn't match. Got %x, want %x", r2, expectedR2)
+			}
+		})
 	}
+}
 
-	// Use Quicknet for fast testing (3s rounds)
-	network := DefaultQuicknetInfo()
+// TestGenerateVTERealEncryption tests GenerateVTE, VerifyVTE and DecryptVTE
+// end to end against a simulated network
+func TestGenerateVTERealEncryption(t *testing.T) {
+	network, clock, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	round := network.LatestRound() + 20
 
-	plaintext := "Hello from real VTE-TLock!"
+	params := &GenerateVTEParams{
+		Round:          round,
+		ChainHash:      chainHash,
+		FormatID:       "tlock_v1_age_pairing",
+		SessionID:      "test-session-123",
+		R2:             PlaintextToR2("test secret"),
+		RefundTx:       make([]byte, 32), // Mock refund tx
+		DrandEndpoints: []string{endpoint},
+		GenerateProof:  true,
+	}
 
-	// Encrypt for a round in near future (10 rounds ahead = 30 seconds)
-	targetTime := time.Now().Add(30 * time.Second)
-	capsule, round, err := EncryptPlaintext(plaintext, targetTime, network)
+	pkg, err := GenerateVTE(params)
 	if err != nil {
-		t.Fatalf("Encryption failed: %v", err)
+		t.Fatalf("GenerateVTE failed: %v", err)
 	}
 
-	t.Logf("Encrypted for round %d, waiting for timelock...", round)
+	fields, err := ParseCapsule(pkg.Tlock.Capsule, pkg.Tlock.CiphertextFormatID)
+	if err != nil {
+		t.Fatalf("ParseCapsule failed: %v", err)
+	}
+	if len(fields.EphemeralPubKey) == 0 {
+		t.Fatal("Expected parsed cipher fields, got empty EphemeralPubKey")
+	}
 
-	// Wait for the round to be reached
-	time.Sleep(35 * time.Second) // 30s + 5s buffer
+	if err := VerifyVTE(pkg, round, chainHash, params.FormatID, params.SessionID, params.RefundTx); err != nil {
+		t.Fatalf("VerifyVTE failed: %v", err)
+	}
 
-	// Decrypt
 	ctx := context.Background()
-	r2, err := Decrypt(ctx, network.ChainHash, round, capsule, []string{"https://api.drand.sh"})
-	if err != nil {
-		t.Fatalf("Decryption failed: %v", err)
+	if _, err := DecryptVTE(ctx, pkg, []string{endpoint}); err == nil {
+		t.Fatal("Expected DecryptVTE to fail before the round")
 	}
 
-	// Verify r2 matches our expected hash of plaintext
-	expectedR2 := PlaintextToR2(plaintext)
-	if string(r2) != string(expectedR2) {
-		t.Fatalf("Decrypted r2 doesn't match. Got %x, want %x", r2, expectedR2)
-	}
+	clock.Advance(20 * network.Info().Period)
 
-	t.Log("SUCCESS: Real encrypt/decrypt cycle completed!")
+	result, err := DecryptVTE(ctx, pkg, []string{endpoint})
+	if err != nil {
+		t.Fatalf("DecryptVTE failed: %v", err)
+	}
+	if string(result.R2) != string(params.R2) {
+		t.Fatalf("Decrypted r2 %x, want %x", result.R2, params.R2)
+	}
 }
 
-// TestGenerateVTERealEncryption tests GenerateVTE with real encryption
-func TestGenerateVTERealEncryption(t *testing.T) {
-	if testing.Short() {
-		t.Skip("Skipping real drand test in short mode")
+// TestPrefetchFlow exercises the WASM path: chain info and beacon are fetched
+// ahead of time and no HTTP happens inside encryption or decryption
+func TestPrefetchFlow(t *testing.T) {
+	network, clock, _ := simulatedDrand(t, crypto.UnchainedSchemeID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	round := network.LatestRound() + 5
+	r2 := PlaintextToR2("prefetched secret")
+
+	pkg, err := GenerateVTE(&GenerateVTEParams{
+		Round:         round,
+		ChainHash:     chainHash,
+		FormatID:      "tlock_v1_age_pairing",
+		SessionID:     "prefetch",
+		R2:            r2,
+		RefundTx:      []byte{0x02},
+		ChainInfoJSON: network.ChainInfoJSON(),
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE with prefetched chain info failed: %v", err)
 	}
 
-	network := DefaultQuicknetInfo()
-	targetTime := time.Now().Add(1 * time.Minute)
-	round := network.TimeToRound(targetTime)
+	capsule, err := EncryptWithPrefetch(context.Background(), chainHash, round, r2, network.ChainInfoJSON(), "")
+	if err != nil {
+		t.Fatalf("EncryptWithPrefetch failed: %v", err)
+	}
 
-	params := &GenerateVTEParams{
-		Round:          round,
-		ChainHash:      network.ChainHash,
-		FormatID:       "tlock_v1_age_pairing",
-		SessionID:      "test-session-123",
-		R2:             PlaintextToR2("test secret"),
-		RefundTx:       make([]byte, 32), // Mock refund tx
-		DrandEndpoints: []string{"https://api.drand.sh"},
+	clock.Advance(5 * network.Info().Period)
+	sig, err := network.Signature(round)
+	if err != nil {
+		t.Fatalf("Signature failed: %v", err)
 	}
 
-	pkg, err := GenerateVTE(params)
+	for _, c := range [][]byte{pkg.Tlock.Capsule, capsule} {
+		// An empty cache, so the beacon set below is the only one available
+		useBeaconCache(t, NewBeaconCache(NewMemoryBeaconStore()))
+		prefetched, err := NewNetworkFromChainInfo(network.ChainInfoJSON(), network.ChainHash())
+		if err != nil {
+			t.Fatalf("NewNetworkFromChainInfo failed: %v", err)
+		}
+		if _, err := DecryptWithNetwork(prefetched, c); err == nil {
+			t.Fatal("Expected decryption without a prefetched beacon to fail")
+		}
+
+		if err := prefetched.(*WasmNetwork).SetPrefetchedBeacon(round, hex.EncodeToString(sig)); err != nil {
+			t.Fatalf("SetPrefetchedBeacon failed: %v", err)
+		}
+		got, err := DecryptWithNetwork(prefetched, c)
+		if err != nil {
+			t.Fatalf("DecryptWithNetwork failed: %v", err)
+		}
+		if string(got) != string(r2) {
+			t.Fatalf("Decrypted %x, want %x", got, r2)
+		}
+	}
+}
+
+// TestDecryptVTEWithBeacon decrypts with caller-supplied chain info and beacon
+// and no endpoint at all
+func TestDecryptVTEWithBeacon(t *testing.T) {
+	useBeaconCache(t, NewBeaconCache(NewMemoryBeaconStore()))
+	network, clock, _ := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	round := network.LatestRound() + 2
+	r2 := PlaintextToR2("supplied beacon")
+
+	pkg, err := GenerateVTE(&GenerateVTEParams{
+		Round:         round,
+		ChainHash:     chainHash,
+		FormatID:      "tlock_v1_age_pairing",
+		SessionID:     "beacon",
+		R2:            r2,
+		RefundTx:      []byte{0x02},
+		ChainInfoJSON: network.ChainInfoJSON(),
+	})
 	if err != nil {
 		t.Fatalf("GenerateVTE failed: %v", err)
 	}
-
-	if len(pkg.Capsule) == 0 {
-		t.Fatal("Expected real capsule, got empty")
+	clock.Advance(2 * network.Info().Period)
+	sig, _ := network.Signature(round)
+	prev, _ := network.Signature(round - 1)
+	info := network.ChainInfoJSON()
+	other, _ := drandsim.New(drandsim.Config{Seed: []byte("other")})
+
+	cases := []struct {
+		name string
+		info string
+		sig  []byte
+		err  error
+	}{
+		{"wrong round", info, prev, ErrBeaconInvalid},
+		{"foreign chain info", other.ChainInfoJSON(), sig, ErrChainInfoMismatch},
+		{"no chain info", "", sig, ErrInvalidInput},
+		{"no beacon", info, nil, ErrInvalidInput},
+	}
+	for _, tc := range cases {
+		if _, err := DecryptVTEWithBeacon(pkg, tc.info, hex.EncodeToString(tc.sig)); !errors.Is(err, tc.err) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.err)
+		}
 	}
 
-	if len(pkg.CipherFields.EphemeralPubKey) == 0 {
-		t.Fatal("Expected parsed cipher fields, got empty EphemeralPubKey")
+	result, err := DecryptVTEWithBeacon(pkg, info, hex.EncodeToString(sig))
+	if err != nil {
+		t.Fatalf("DecryptVTEWithBeacon failed: %v", err)
+	}
+	if !bytes.Equal(result.R2, r2) {
+		t.Fatalf("Decrypted %x, want %x", result.R2, r2)
 	}
 
-	t.Logf("Generated VTE package with %d byte capsule", len(pkg.Capsule))
-	t.Log("SUCCESS: Real VTE generation completed!")
+	// The verified beacon and chain info were cached
+	if _, err := DecryptVTEWithBeacon(pkg, "", ""); err != nil {
+		t.Fatalf("DecryptVTEWithBeacon from cache failed: %v", err)
+	}
 }
@@ -0,0 +1,383 @@
+package vte
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/drand/tlock"
+)
+
+// CtxSchemaMulti is the context schema of packages with a LockInfo
+const CtxSchemaMulti = "ctx_v2_multi"
+
+var ctxFieldsMulti = []string{"lock_mode", "capsules[].drand_chain_hash", "capsules[].round", "capsules[].capsule_hash", "session_id", "refund_tx_hex"}
+
+// LockTarget is one (chain, round) pair of a multi-network package
+type LockTarget struct {
+	ChainHash []byte
+	Round     uint64
+
+	// How to reach the chain, as in GenerateVTEParams. Chains pinned in the
+	// network registry need none of them. Empty DrandEndpoints fall back to
+	// GenerateVTEParams.DrandEndpoints, then to the registry endpoints.
+	Network        tlock.Network
+	TrustedChain   *TrustedChainInfo
+	ChainInfoJSON  string
+	DrandEndpoints []string
+}
+
+// generateLocked encrypts r2, or a share of it, to every target and binds
+// all capsules into one ctx_v2_multi context hash
+func generateLocked(params *GenerateVTEParams) (*VTEPackageV2, error) {
+	if len(params.Targets) < 2 {
+		return nil, fmt.Errorf("%w: a %s lock needs at least two targets", ErrInvalidInput, params.Lock)
+	}
+
+	// payloads[i] is what capsule i encrypts
+	var payloads [][]byte
+	var shares []*ShareInfo
+	var coefficients [][]byte
+	switch params.Lock {
+	case LockAnyOf:
+		for range params.Targets {
+			payloads = append(payloads, params.R2)
+		}
+	case LockAllOf:
+		secret, err := parseScalar(params.R2)
+		if err != nil {
+			return nil, fmt.Errorf("%w: r2 of a %s lock must be a secp256k1 scalar", ErrInvalidInput, params.Lock)
+		}
+		split, err := splitAdditive(secret, len(params.Targets), params.Rand)
+		if err != nil {
+			return nil, err
+		}
+		for _, share := range split {
+			payloads = append(payloads, scalarBytes(share))
+			shares = append(shares, &ShareInfo{Point: scalarPoint(share)})
+		}
+	case LockThreshold:
+		if params.Threshold < 1 || params.Threshold > len(params.Targets) {
+			return nil, fmt.Errorf("%w: threshold %d out of range 1..%d", ErrInvalidInput, params.Threshold, len(params.Targets))
+		}
+		secret, err := parseScalar(params.R2)
+		if err != nil {
+			return nil, fmt.Errorf("%w: r2 of a %s lock must be a secp256k1 scalar", ErrInvalidInput, params.Lock)
+		}
+		split, commitments, err := splitShamir(secret, params.Threshold, len(params.Targets), params.Rand)
+		if err != nil {
+			return nil, err
+		}
+		for i, share := range split {
+			payloads = append(payloads, scalarBytes(share))
+			shares = append(shares, &ShareInfo{Index: uint32(i + 1), Point: scalarPoint(share)})
+		}
+		coefficients = commitments
+	default:
+		return nil, fmt.Errorf("%w: unknown lock mode %q", ErrInvalidInput, params.Lock)
+	}
+
+	capsules := make([]CapsuleInfo, len(params.Targets))
+	for i, target := range params.Targets {
+		for _, prev := range params.Targets[:i] {
+			if bytes.Equal(prev.ChainHash, target.ChainHash) && prev.Round == target.Round {
+				return nil, fmt.Errorf("%w: duplicate target %x round %d", ErrInvalidInput, target.ChainHash, target.Round)
+			}
+		}
+		network, err := targetNetwork(params, &target)
+		if err != nil {
+			return nil, fmt.Errorf("tlock encryption failed for target %d: %w", i, err)
+		}
+		capsule, err := EncryptWithNetwork(network, target.Round, payloads[i], params.Rand)
+		if err != nil {
+			return nil, fmt.Errorf("tlock encryption failed for target %d: %w", i, err)
+		}
+		capsuleHash := sha256.Sum256(capsule)
+		capsules[i] = CapsuleInfo{
+			Tlock: TlockInfo{
+				DrandChainHash:     target.ChainHash,
+				Round:              target.Round,
+				CiphertextFormatID: params.FormatID,
+				Capsule:            capsule,
+				CapsuleHash:        capsuleHash[:],
+			},
+			TLE: TLEProofInfo{Status: "not_implemented"},
+		}
+		if shares != nil {
+			capsules[i].Share = shares[i]
+		}
+	}
+
+	lock := &LockInfo{Mode: params.Lock, Capsules: capsules}
+	if params.Lock == LockThreshold {
+		lock.Threshold = params.Threshold
+		lock.Coefficients = coefficients
+	}
+	ctxHash, err := ComputeLockCtxHash(lock, params.SessionID, params.RefundTx)
+	if err != nil {
+		return nil, fmt.Errorf("ctx_hash computation failed: %w", err)
+	}
+	var primary TlockInfo
+	if params.Lock == LockAnyOf {
+		primary = capsules[0].Tlock
+	}
+	return assemblePackage(params, ctxHash, CtxSchemaMulti, ctxFieldsMulti, primary, lock)
+}
+
+func targetNetwork(params *GenerateVTEParams, target *LockTarget) (tlock.Network, error) {
+	if target.Network != nil {
+		return target.Network, nil
+	}
+	endpoints := target.DrandEndpoints
+	if len(endpoints) == 0 {
+		endpoints = chainEndpoints(target.ChainHash, params.DrandEndpoints)
+	}
+	return generateNetwork(&GenerateVTEParams{
+		ChainHash:      target.ChainHash,
+		TrustedChain:   target.TrustedChain,
+		ChainInfoJSON:  target.ChainInfoJSON,
+		DrandEndpoints: endpoints,
+	})
+}
+
+// chainEndpoints is endpoints followed by the registry endpoints of the
+// chain, so one endpoint list serves packages that span several networks.
+// Beacons are verified against the chain key wherever they come from.
+func chainEndpoints(chainHash []byte, endpoints []string) []string {
+	n, err := Networks.LookupHash(chainHash)
+	if err != nil {
+		return endpoints
+	}
+	out := append([]string(nil), endpoints...)
+	for _, e := range n.Endpoints {
+		if !slices.Contains(out, e) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// ComputeLockCtxHash computes the ctx_v2_multi context hash of a LockInfo.
+// Order: Mode || Count || per capsule (ChainHash || Round || CapsuleHash ||
+// ShareIndex || SharePoint) || Threshold || Coefficients || SessionID ||
+// RefundTx. SharePoint is only present in share modes; ShareIndex, Threshold
+// and Coefficients (count, then each point) only in threshold mode. Mode,
+// SharePoint, each coefficient, SessionID and RefundTx are prefixed with
+// their 4-byte big-endian length; Count, ShareIndex, Threshold and the
+// coefficient count are 4 bytes big-endian.
+func ComputeLockCtxHash(lock *LockInfo, sessionID string, refundTx []byte) ([]byte, error) {
+	if lock == nil || len(lock.Capsules) == 0 {
+		return nil, fmt.Errorf("%w: lock has no capsules", ErrInvalidInput)
+	}
+
+	h := sha256.New()
+	h.Write([]byte("VTE_CTX_V2_MULTI"))
+	writeLengthPrefixed(h, []byte(lock.Mode))
+	_ = binary.Write(h, binary.BigEndian, uint32(len(lock.Capsules)))
+
+	for i, c := range lock.Capsules {
+		if len(c.Tlock.DrandChainHash) != 32 {
+			return nil, fmt.Errorf("%w: capsule %d: chain_hash must be 32 bytes", ErrInvalidInput, i)
+		}
+		if len(c.Tlock.CapsuleHash) != 32 {
+			return nil, fmt.Errorf("%w: capsule %d: capsule_hash must be 32 bytes SHA256", ErrInvalidInput, i)
+		}
+		h.Write(c.Tlock.DrandChainHash)
+		_ = binary.Write(h, binary.BigEndian, c.Tlock.Round)
+		h.Write(c.Tlock.CapsuleHash)
+		if lock.Mode != LockAnyOf {
+			if c.Share == nil {
+				return nil, fmt.Errorf("%w: capsule %d has no share", ErrInvalidInput, i)
+			}
+			if lock.Mode == LockThreshold {
+				_ = binary.Write(h, binary.BigEndian, c.Share.Index)
+			}
+			writeLengthPrefixed(h, c.Share.Point)
+		}
+	}
+	if lock.Mode == LockThreshold {
+		_ = binary.Write(h, binary.BigEndian, uint32(lock.Threshold))
+		_ = binary.Write(h, binary.BigEndian, uint32(len(lock.Coefficients)))
+		for _, point := range lock.Coefficients {
+			writeLengthPrefixed(h, point)
+		}
+	}
+
+	writeLengthPrefixed(h, []byte(sessionID))
+	writeLengthPrefixed(h, refundTx)
+	return h.Sum(nil), nil
+}
+
+func writeLengthPrefixed(w io.Writer, b []byte) {
+	_ = binary.Write(w, binary.BigEndian, uint32(len(b)))
+	_, _ = w.Write(b)
+}
+
+// verifyLockBinding is VerifyCtxHashBinding for packages with a LockInfo.
+// Share modes also check the share points against R2: all_of points must
+// add up to it, threshold points must lie on the committed polynomial.
+func verifyLockBinding(pkg *VTEPackageV2, refundTx []byte) error {
+	lock := pkg.Lock
+	if lock.Mode != LockAnyOf && lock.Mode != LockAllOf && lock.Mode != LockThreshold {
+		return fmt.Errorf("%w: unknown lock mode %q", ErrInvalidInput, lock.Mode)
+	}
+	if lock.Mode != LockThreshold && (lock.Threshold != 0 || len(lock.Coefficients) != 0) {
+		return fmt.Errorf("%w: threshold fields in a %s lock", ErrInvalidInput, lock.Mode)
+	}
+	if len(lock.Capsules) < 2 {
+		return fmt.Errorf("%w: a %s lock needs at least two capsules", ErrInvalidInput, lock.Mode)
+	}
+
+	for i, c := range lock.Capsules {
+		if c.Tlock.Round == 0 {
+			return fmt.Errorf("%w: capsule %d has no round", ErrInvalidInput, i)
+		}
+		actual := sha256.Sum256(c.Tlock.Capsule)
+		if !bytes.Equal(actual[:], c.Tlock.CapsuleHash) {
+			return fmt.Errorf("%w: capsule %d: SHA256(capsule) != capsule_hash", ErrCapsuleHashMismatch, i)
+		}
+		if (c.Share != nil) != (lock.Mode != LockAnyOf) {
+			return fmt.Errorf("%w: capsule %d: share does not match lock mode %s", ErrShareInvalid, i, lock.Mode)
+		}
+		if c.Share != nil && (c.Share.Index != 0) != (lock.Mode == LockThreshold) {
+			return fmt.Errorf("%w: capsule %d: share index does not match lock mode %s", ErrShareInvalid, i, lock.Mode)
+		}
+	}
+
+	switch lock.Mode {
+	case LockAnyOf:
+		if !sameTlock(&pkg.Tlock, &lock.Capsules[0].Tlock) {
+			return fmt.Errorf("%w: tlock does not mirror the first capsule", ErrCapsuleHashMismatch)
+		}
+	case LockThreshold:
+		if !sameTlock(&pkg.Tlock, &TlockInfo{}) {
+			return fmt.Errorf("%w: tlock must be empty in a %s lock", ErrMalformedCapsule, lock.Mode)
+		}
+		if err := verifyFeldman(lock, pkg.Public.R2.Value); err != nil {
+			return err
+		}
+	default:
+		if !sameTlock(&pkg.Tlock, &TlockInfo{}) {
+			return fmt.Errorf("%w: tlock must be empty in a %s lock", ErrMalformedCapsule, lock.Mode)
+		}
+		points := make([][]byte, len(lock.Capsules))
+		for i, c := range lock.Capsules {
+			points[i] = c.Share.Point
+		}
+		sum, err := sumPoints(points)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(sum, pkg.Public.R2.Value) {
+			return fmt.Errorf("%w: share points do not add up to R2", ErrShareInvalid)
+		}
+	}
+
+	expected, err := ComputeLockCtxHash(lock, pkg.Context.SessionID, refundTx)
+	if err != nil {
+		return fmt.Errorf("failed to compute expected ctx_hash: %w", err)
+	}
+	if !bytes.Equal(expected, pkg.Context.CtxHash) {
+		return fmt.Errorf("%w: calculated %x, but package claims %x", ErrCtxHashMismatch, expected, pkg.Context.CtxHash)
+	}
+	return nil
+}
+
+// decryptLocked opens a multi-network package. any_of returns the first
+// capsule that opens; every capsule is checked against the shared commitment,
+// so a capsule holding another secret is skipped rather than returned.
+// Share modes open capsules until enough shares are in, check each share
+// against its point and combine them: all_of adds every share up, threshold
+// interpolates the first k.
+func decryptLocked(pkg *VTEPackageV2, open func(c *TlockInfo) ([]byte, error)) (*DecryptResult, error) {
+	var errs []error
+	var shares []*btcec.ModNScalar
+	var indices []uint32
+	need := pkg.Lock.Needed()
+	for i := range pkg.Lock.Capsules {
+		if len(shares) == need {
+			break
+		}
+		c := &pkg.Lock.Capsules[i]
+		plain, err := open(&c.Tlock)
+		if err == nil {
+			switch pkg.Lock.Mode {
+			case LockAnyOf:
+				var result *DecryptResult
+				if result, err = checkDecrypted(pkg, plain); err == nil {
+					return result, nil
+				}
+			default:
+				var share *btcec.ModNScalar
+				if share, err = openShare(c, plain); err == nil {
+					shares = append(shares, share)
+					indices = append(indices, c.Share.Index)
+					continue
+				}
+			}
+		}
+		errs = append(errs, fmt.Errorf("capsule %d (chain %x round %d): %w", i, c.Tlock.DrandChainHash, c.Tlock.Round, err))
+	}
+	if len(shares) < need {
+		return nil, fmt.Errorf("decryption failed: %w", errors.Join(errs...))
+	}
+
+	if pkg.Lock.Mode == LockThreshold {
+		return checkDecrypted(pkg, scalarBytes(interpolateZero(indices, shares)))
+	}
+	var r2 btcec.ModNScalar
+	for _, share := range shares {
+		r2.Add(share)
+	}
+	return checkDecrypted(pkg, scalarBytes(&r2))
+}
+
+// Needed returns how many capsules must open before the package does
+func (l *LockInfo) Needed() int {
+	switch l.Mode {
+	case LockAllOf:
+		return len(l.Capsules)
+	case LockThreshold:
+		return l.Threshold
+	default:
+		return 1
+	}
+}
+
+// openShare checks a decrypted share against the point the package publishes
+func openShare(c *CapsuleInfo, plain []byte) (*btcec.ModNScalar, error) {
+	share, err := parseScalar(plain)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrShareInvalid, err)
+	}
+	if c.Share == nil || !bytes.Equal(scalarPoint(share), c.Share.Point) {
+		return nil, fmt.Errorf("%w: decrypted share does not match its point", ErrShareInvalid)
+	}
+	return share, nil
+}
+
+// Capsules returns every capsule of the package: the lock capsules of a
+// multi-network package, else Tlock
+func (p *VTEPackageV2) Capsules() []TlockInfo {
+	if p.Lock == nil {
+		return []TlockInfo{p.Tlock}
+	}
+	out := make([]TlockInfo, len(p.Lock.Capsules))
+	for i, c := range p.Lock.Capsules {
+		out[i] = c.Tlock
+	}
+	return out
+}
+
+func sameTlock(a, b *TlockInfo) bool {
+	return bytes.Equal(a.DrandChainHash, b.DrandChainHash) &&
+		a.Round == b.Round &&
+		a.CiphertextFormatID == b.CiphertextFormatID &&
+		bytes.Equal(a.Capsule, b.Capsule) &&
+		bytes.Equal(a.CapsuleHash, b.CapsuleHash)
+}
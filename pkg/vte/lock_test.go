@@ -0,0 +1,362 @@
+package vte
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/tlock"
+
+	"vte-tlock/internal/drandtest"
+	"vte-tlock/pkg/drandsim"
+)
+
+// secondDrand starts another simulated network on clock, with a different
+// key and period
+func secondDrand(t *testing.T, clock *drandsim.ManualClock) (*drandsim.Network, string) {
+	return namedDrand(t, clock, "second")
+}
+
+func namedDrand(t *testing.T, clock *drandsim.ManualClock, name string) (*drandsim.Network, string) {
+	t.Helper()
+	network, _, server := drandtest.Start(t, drandsim.Config{Seed: []byte(name), BeaconID: name, Period: 2 * time.Second, GenesisTime: clock.Now().Unix() - 600, Clock: clock})
+	return network, server.URL
+}
+
+func roundTimeOf(network *drandsim.Network, round uint64) time.Time {
+	info := network.Info()
+	return time.Unix(common.TimeOfRound(info.Period, info.GenesisTime, round), 0)
+}
+
+// cacheTiming adds the chain info of networks to the Beacons cache, so
+// capsules on different chains can be ordered by round time
+func cacheTiming(t *testing.T, networks ...*drandsim.Network) {
+	t.Helper()
+	for _, network := range networks {
+		chainHash, _ := hex.DecodeString(network.ChainHash())
+		if err := Beacons.AddChainInfo([]byte(network.ChainInfoJSON()), chainHash); err != nil {
+			t.Fatalf("AddChainInfo failed: %v", err)
+		}
+	}
+}
+
+// lockPolicy is DefaultPolicy pinning every chain of a lock package
+func lockPolicy(round uint64, sessionID string, chains ...[]byte) *VerificationPolicy {
+	p := DefaultPolicy()
+	p.Round = round
+	p.SessionID = sessionID
+	for _, chainHash := range chains {
+		p.PinnedChains = append(p.PinnedChains, hex.EncodeToString(chainHash))
+	}
+	return p
+}
+
+func TestAnyOfLock(t *testing.T) {
+	a, clock, endpointA := simulatedDrand(t, crypto.SigsOnG1ID)
+	clock.Advance(time.Hour)
+	b, endpointB := secondDrand(t, clock)
+	chainA, _ := hex.DecodeString(a.ChainHash())
+	chainB, _ := hex.DecodeString(b.ChainHash())
+	useBeaconCache(t, NewBeaconCache(NewMemoryBeaconStore()))
+
+	// B unlocks a minute after A
+	roundA := a.LatestRound() + 10
+	roundB := b.Current(roundTimeOf(a, roundA).Add(time.Minute))
+	r2 := PlaintextToR2("either network")
+	pkg, err := GenerateVTE(&GenerateVTEParams{
+		Lock: LockAnyOf,
+		Targets: []LockTarget{
+			{ChainHash: chainA, Round: roundA, DrandEndpoints: []string{endpointA}},
+			{ChainHash: chainB, Round: roundB, DrandEndpoints: []string{endpointB}},
+		},
+		FormatID:      "tlock_v1_age_pairing",
+		SessionID:     "any-of",
+		R2:            r2,
+		GenerateProof: true,
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE failed: %v", err)
+	}
+	if pkg.Context.Schema != CtxSchemaMulti || len(pkg.Lock.Capsules) != 2 || !sameTlock(&pkg.Tlock, &pkg.Lock.Capsules[0].Tlock) {
+		t.Fatalf("Unexpected lock layout: schema %s, %d capsules", pkg.Context.Schema, len(pkg.Lock.Capsules))
+	}
+
+	t.Run("verify", func(t *testing.T) {
+		// Capsules on two chains cannot be ordered without their timing
+		if err := lockPolicy(roundA, "any-of", chainA, chainB).Verify(pkg); !errors.Is(err, ErrRoundOutOfRange) {
+			t.Fatalf("Expected ErrRoundOutOfRange without chain timing, got %v", err)
+		}
+		cacheTiming(t, a, b)
+		if err := lockPolicy(roundA, "any-of", chainA, chainB).Verify(pkg); err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		// Capsule A opens the package before round B
+		if err := lockPolicy(roundB, "any-of", chainA, chainB).Verify(pkg); !errors.Is(err, ErrRoundMismatch) {
+			t.Fatalf("Expected ErrRoundMismatch for an early capsule, got %v", err)
+		}
+		// So does chain A, which the verifier does not trust
+		if err := VerifyVTE(pkg, roundB, chainB, "", "any-of", nil); !errors.Is(err, ErrNetworkMismatch) {
+			t.Fatalf("Expected ErrNetworkMismatch for an unpinned capsule, got %v", err)
+		}
+		if err := VerifyVTE(pkg, 0, bytes.Repeat([]byte{1}, 32), "", "", nil); !errors.Is(err, ErrNetworkMismatch) {
+			t.Fatalf("Expected ErrNetworkMismatch, got %v", err)
+		}
+
+		// Every capsule is bound, not just the mirrored one
+		tampered := *pkg
+		lock := *pkg.Lock
+		lock.Capsules = append([]CapsuleInfo(nil), pkg.Lock.Capsules...)
+		lock.Capsules[1].Tlock.Round++
+		tampered.Lock = &lock
+		if err := VerifyVTE(&tampered, 0, nil, "", "", nil); !errors.Is(err, ErrCtxHashMismatch) {
+			t.Fatalf("Expected ErrCtxHashMismatch for a moved capsule, got %v", err)
+		}
+		lock.Capsules[1] = pkg.Lock.Capsules[1]
+		lock.Capsules[1].Tlock.Capsule = append([]byte(nil), lock.Capsules[1].Tlock.Capsule...)
+		lock.Capsules[1].Tlock.Capsule[0] ^= 1
+		if err := VerifyVTE(&tampered, 0, nil, "", "", nil); !errors.Is(err, ErrCapsuleHashMismatch) {
+			t.Fatalf("Expected ErrCapsuleHashMismatch for a swapped capsule, got %v", err)
+		}
+		single := *pkg
+		single.Lock = nil
+		if err := VerifyCtxHashBinding(&single); !errors.Is(err, ErrCtxHashMismatch) {
+			t.Fatalf("Expected ErrCtxHashMismatch without the lock, got %v", err)
+		}
+	})
+
+	ctx := context.Background()
+	if _, err := DecryptVTE(ctx, pkg, []string{endpointA, endpointB}); !errors.Is(err, tlock.ErrTooEarly) {
+		t.Fatalf("Expected ErrTooEarly before either round, got %v", err)
+	}
+
+	// Network A halts before its round; B still opens the package
+	clock.Set(roundTimeOf(b, roundB))
+	result, err := DecryptVTE(ctx, pkg, []string{deadEndpoint(), endpointB})
+	if err != nil {
+		t.Fatalf("DecryptVTE with only B failed: %v", err)
+	}
+	if !bytes.Equal(result.R2, r2) {
+		t.Fatalf("Decrypted %x, want %x", result.R2, r2)
+	}
+
+	trustedB, err := TrustedChainInfoFromJSON([]byte(b.ChainInfoJSON()), chainB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptVTEWithTrustedChain(ctx, pkg, trustedB, []string{endpointB}); err != nil {
+		t.Fatalf("DecryptVTEWithTrustedChain on B failed: %v", err)
+	}
+	sigA, _ := a.Signature(roundA)
+	if _, err := DecryptVTEWithBeacon(pkg, a.ChainInfoJSON(), hex.EncodeToString(sigA)); err != nil {
+		t.Fatalf("DecryptVTEWithBeacon with A's beacon failed: %v", err)
+	}
+}
+
+func TestAnyOfLockRejectsBadTargets(t *testing.T) {
+	network, _, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	target := LockTarget{ChainHash: chainHash, Round: network.LatestRound() + 5, DrandEndpoints: []string{endpoint}}
+
+	for name, params := range map[string]*GenerateVTEParams{
+		"one target": {Lock: LockAnyOf, Targets: []LockTarget{target}},
+		"duplicate":  {Lock: LockAnyOf, Targets: []LockTarget{target, target}},
+		"bad mode":   {Lock: "some_of", Targets: []LockTarget{target}},
+		"zero k":     {Lock: LockThreshold, Targets: []LockTarget{target, {ChainHash: chainHash, Round: target.Round + 1}}},
+		"k above n":  {Lock: LockThreshold, Threshold: 3, Targets: []LockTarget{target, {ChainHash: chainHash, Round: target.Round + 1}}},
+	} {
+		params.R2 = PlaintextToR2(name)
+		if _, err := GenerateVTE(params); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+}
+
+func TestAllOfLock(t *testing.T) {
+	a, clock, endpointA := simulatedDrand(t, crypto.SigsOnG1ID)
+	clock.Advance(time.Hour)
+	b, endpointB := secondDrand(t, clock)
+	chainA, _ := hex.DecodeString(a.ChainHash())
+	chainB, _ := hex.DecodeString(b.ChainHash())
+	useBeaconCache(t, NewBeaconCache(NewMemoryBeaconStore()))
+
+	roundA := a.LatestRound() + 10
+	roundB := b.Current(roundTimeOf(a, roundA).Add(time.Minute))
+	r2 := PlaintextToR2("both networks")
+	pkg, err := GenerateVTE(&GenerateVTEParams{
+		Lock: LockAllOf,
+		Targets: []LockTarget{
+			{ChainHash: chainA, Round: roundA, DrandEndpoints: []string{endpointA}},
+			{ChainHash: chainB, Round: roundB, DrandEndpoints: []string{endpointB}},
+		},
+		FormatID:      "tlock_v1_age_pairing",
+		SessionID:     "all-of",
+		R2:            r2,
+		GenerateProof: true,
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE failed: %v", err)
+	}
+	if len(pkg.Tlock.Capsule) != 0 || pkg.Lock.Capsules[0].Share == nil || pkg.Lock.Capsules[1].Share == nil {
+		t.Fatal("Expected an empty tlock and a share point per capsule")
+	}
+
+	t.Run("verify", func(t *testing.T) {
+		// Capsule A opening first does not open the package
+		if err := lockPolicy(roundB, "all-of", chainA, chainB).Verify(pkg); err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		if err := VerifyVTE(pkg, roundB, chainB, "", "all-of", nil); !errors.Is(err, ErrNetworkMismatch) {
+			t.Fatalf("Expected ErrNetworkMismatch for an unpinned capsule, got %v", err)
+		}
+
+		// Share points must add up to R2
+		tampered := *pkg
+		lock := *pkg.Lock
+		lock.Capsules = append([]CapsuleInfo(nil), pkg.Lock.Capsules...)
+		lock.Capsules[1].Share = &ShareInfo{Point: lock.Capsules[0].Share.Point}
+		tampered.Lock = &lock
+		if err := VerifyVTE(&tampered, 0, nil, "", "", nil); !errors.Is(err, ErrShareInvalid) {
+			t.Fatalf("Expected ErrShareInvalid, got %v", err)
+		}
+		lock.Capsules[1].Share = nil
+		if err := VerifyVTE(&tampered, 0, nil, "", "", nil); !errors.Is(err, ErrShareInvalid) {
+			t.Fatalf("Expected ErrShareInvalid without a share, got %v", err)
+		}
+	})
+
+	ctx := context.Background()
+	endpoints := []string{endpointA, endpointB}
+
+	// A alone is not enough
+	clock.Set(roundTimeOf(a, roundA))
+	if _, err := DecryptVTE(ctx, pkg, endpoints); !errors.Is(err, tlock.ErrTooEarly) {
+		t.Fatalf("Expected ErrTooEarly with only A's round, got %v", err)
+	}
+
+	clock.Set(roundTimeOf(b, roundB))
+	result, err := DecryptVTE(ctx, pkg, endpoints)
+	if err != nil {
+		t.Fatalf("DecryptVTE failed: %v", err)
+	}
+	if !bytes.Equal(result.R2, r2) {
+		t.Fatalf("Decrypted %x, want %x", result.R2, r2)
+	}
+
+	// Beacons fetched above are cached, so only A's beacon is supplied
+	sigA, _ := a.Signature(roundA)
+	if _, err := DecryptVTEWithBeacon(pkg, a.ChainInfoJSON(), hex.EncodeToString(sigA)); err != nil {
+		t.Fatalf("DecryptVTEWithBeacon failed: %v", err)
+	}
+
+	// Without the cache, network B halting keeps the package shut
+	useBeaconCache(t, NewBeaconCache(NewMemoryBeaconStore()))
+	if _, err := DecryptVTE(ctx, pkg, []string{endpointA, deadEndpoint()}); err == nil {
+		t.Fatal("Expected decryption to fail without network B")
+	}
+}
+
+func TestThresholdLock(t *testing.T) {
+	a, clock, endpointA := simulatedDrand(t, crypto.SigsOnG1ID)
+	clock.Advance(time.Hour)
+	b, endpointB := secondDrand(t, clock)
+	c, endpointC := namedDrand(t, clock, "third")
+	useBeaconCache(t, NewBeaconCache(NewMemoryBeaconStore()))
+
+	// Staged: A, then B a minute later, then C a minute after that
+	roundA := a.LatestRound() + 10
+	roundB := b.Current(roundTimeOf(a, roundA).Add(time.Minute))
+	roundC := c.Current(roundTimeOf(b, roundB).Add(time.Minute))
+	var targets []LockTarget
+	for _, target := range []struct {
+		network  *drandsim.Network
+		round    uint64
+		endpoint string
+	}{{a, roundA, endpointA}, {b, roundB, endpointB}, {c, roundC, endpointC}} {
+		chainHash, _ := hex.DecodeString(target.network.ChainHash())
+		targets = append(targets, LockTarget{ChainHash: chainHash, Round: target.round, DrandEndpoints: []string{target.endpoint}})
+	}
+
+	r2 := PlaintextToR2("two of three")
+	pkg, err := GenerateVTE(&GenerateVTEParams{
+		Lock:          LockThreshold,
+		Threshold:     2,
+		Targets:       targets,
+		FormatID:      "tlock_v1_age_pairing",
+		SessionID:     "2-of-3",
+		R2:            r2,
+		GenerateProof: true,
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE failed: %v", err)
+	}
+	if len(pkg.Lock.Coefficients) != 2 || !bytes.Equal(pkg.Lock.Coefficients[0], pkg.Public.R2.Value) {
+		t.Fatal("Expected two coefficient commitments starting with R2")
+	}
+
+	t.Run("verify", func(t *testing.T) {
+		cacheTiming(t, a, b, c)
+		chains := [][]byte{targets[0].ChainHash, targets[1].ChainHash, targets[2].ChainHash}
+		if err := lockPolicy(roundA, "2-of-3", chains...).Verify(pkg); err != nil {
+			t.Fatalf("Verify failed: %v", err)
+		}
+		if err := lockPolicy(roundC, "2-of-3", chains...).Verify(pkg); !errors.Is(err, ErrRoundMismatch) {
+			t.Fatalf("Expected ErrRoundMismatch for early capsules, got %v", err)
+		}
+
+		// No capsule's encryption is verified
+		report := lockPolicy(roundA, "2-of-3", chains...).Report(pkg)
+		if c := report.Check(CheckTLE); c.Status != CheckSkipped || !slices.Equal(c.UnverifiedCapsules, []int{0, 1, 2}) {
+			t.Fatalf("TLE check: %+v, want every capsule unverified", c)
+		}
+		strict := lockPolicy(roundA, "2-of-3", chains...)
+		strict.Require.TLE = true
+		if err := strict.Verify(pkg); !errors.Is(err, ErrMissingProof) {
+			t.Fatalf("Expected ErrMissingProof requiring TLE, got %v", err)
+		}
+
+		tamper := func(change func(lock *LockInfo)) *VTEPackageV2 {
+			tampered := *pkg
+			lock := *pkg.Lock
+			lock.Capsules = append([]CapsuleInfo(nil), pkg.Lock.Capsules...)
+			lock.Coefficients = append([][]byte(nil), pkg.Lock.Coefficients...)
+			change(&lock)
+			tampered.Lock = &lock
+			return &tampered
+		}
+		for name, change := range map[string]func(lock *LockInfo){
+			"moved point": func(lock *LockInfo) {
+				lock.Capsules[0].Share = &ShareInfo{Index: 1, Point: lock.Capsules[1].Share.Point}
+			},
+			"repeated index": func(lock *LockInfo) { lock.Capsules[1].Share = lock.Capsules[0].Share },
+			"not R2":         func(lock *LockInfo) { lock.Coefficients[0] = lock.Coefficients[1] },
+			"lower k":        func(lock *LockInfo) { lock.Threshold, lock.Coefficients = 1, lock.Coefficients[:1] },
+		} {
+			if err := VerifyCtxHashBinding(tamper(change)); !errors.Is(err, ErrShareInvalid) {
+				t.Errorf("%s: expected ErrShareInvalid, got %v", name, err)
+			}
+		}
+	})
+
+	ctx := context.Background()
+	endpoints := []string{endpointA, endpointB, endpointC}
+	clock.Set(roundTimeOf(a, roundA))
+	if _, err := DecryptVTE(ctx, pkg, endpoints); !errors.Is(err, tlock.ErrTooEarly) {
+		t.Fatalf("Expected ErrTooEarly with one share out, got %v", err)
+	}
+
+	// Network A halts; B and C are two shares
+	clock.Set(roundTimeOf(c, roundC))
+	result, err := DecryptVTE(ctx, pkg, []string{deadEndpoint(), endpointB, endpointC})
+	if err != nil {
+		t.Fatalf("DecryptVTE with B and C failed: %v", err)
+	}
+	if !bytes.Equal(result.R2, r2) {
+		t.Fatalf("Decrypted %x, want %x", result.R2, r2)
+	}
+}
@@ -0,0 +1,140 @@
+package vte
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber"
+	"github.com/drand/tlock"
+)
+
+var _ tlock.Network = (*WasmNetwork)(nil)
+
+// WasmNetwork is a tlock.Network built from pre-fetched chain info and an
+// optional pre-fetched beacon, so it never performs HTTP itself. WASM builds
+// rely on it; it is not build-tagged so the prefetch path runs in native tests.
+type WasmNetwork struct {
+	chainHash   string
+	scheme      *crypto.Scheme
+	pubKey      kyber.Point
+	genesisTime int64
+	period      time.Duration
+
+	// Pre-fetched beacon (optional, for sync operation)
+	prefetchedBeacon *common.Beacon
+}
+
+// NewNetworkFromChainInfo creates a network from pre-fetched chain info.
+// The info must hash to chainHash, so a tampered response cannot swap the key.
+func NewNetworkFromChainInfo(chainInfoJSON string, chainHash string) (tlock.Network, error) {
+	hash, err := hex.DecodeString(chainHash)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid chain hash hex: %v", ErrInvalidInput, err)
+	}
+
+	trusted, err := TrustedChainInfoFromJSON([]byte(chainInfoJSON), hash)
+	if err != nil {
+		return nil, err
+	}
+	return trusted.network()
+}
+
+// newNetworkFromInfo creates a network from chain info that was already
+// fetched and checked (see resolveChainInfo)
+func newNetworkFromInfo(info *chain.Info) (*WasmNetwork, error) {
+	scheme, err := crypto.SchemeFromName(info.Scheme)
+	if err != nil {
+		return nil, fmt.Errorf("unknown scheme: %s: %w", info.Scheme, err)
+	}
+
+	return &WasmNetwork{
+		chainHash:   info.HashString(),
+		scheme:      scheme,
+		pubKey:      info.PublicKey,
+		genesisTime: info.GenesisTime,
+		period:      info.Period,
+	}, nil
+}
+
+// SetPrefetchedBeacon allows setting a pre-fetched beacon to avoid Request() HTTP.
+// The signature must verify under the network's public key; it is then added
+// to the Beacons cache.
+func (w *WasmNetwork) SetPrefetchedBeacon(round uint64, signatureHex string) error {
+	sigBytes, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return fmt.Errorf("invalid signature hex: %w", err)
+	}
+	beacon := &common.Beacon{
+		Round:     round,
+		Signature: sigBytes,
+	}
+	if err := w.scheme.VerifyBeacon(beacon, w.pubKey); err != nil {
+		return fmt.Errorf("%w: round %d: %v", ErrBeaconInvalid, round, err)
+	}
+	w.prefetchedBeacon = beacon
+	if hash, err := hex.DecodeString(w.chainHash); err == nil && Beacons != nil {
+		_ = Beacons.store.PutSignature(hash, round, sigBytes)
+	}
+	return nil
+}
+
+// cachedBeacon returns a verified beacon for round from the Beacons cache
+func (w *WasmNetwork) cachedBeacon(round uint64) *common.Beacon {
+	hash, err := hex.DecodeString(w.chainHash)
+	if err != nil {
+		return nil
+	}
+	sig := Beacons.verifiedSignature(hash, round, func(sig []byte) error {
+		return w.scheme.VerifyBeacon(&common.Beacon{Round: round, Signature: sig}, w.pubKey)
+	})
+	if sig == nil {
+		return nil
+	}
+	return &common.Beacon{Round: round, Signature: sig}
+}
+
+func (w *WasmNetwork) ChainHash() string { return w.chainHash }
+
+// Current is drand's CurrentRound, like DrandNetworkInfo.TimeToRound
+func (w *WasmNetwork) Current(t time.Time) uint64 {
+	if w.period == 0 {
+		return 0
+	}
+	return common.CurrentRound(t.Unix(), w.period, w.genesisTime)
+}
+
+func (w *WasmNetwork) PublicKey() kyber.Point { return w.pubKey }
+
+func (w *WasmNetwork) Scheme() crypto.Scheme { return *w.scheme }
+
+func (w *WasmNetwork) Signature(round uint64) ([]byte, error) {
+	if w.prefetchedBeacon != nil && w.prefetchedBeacon.Round == round {
+		return w.prefetchedBeacon.Signature, nil
+	}
+	if cached := w.cachedBeacon(round); cached != nil {
+		return cached.Signature, nil
+	}
+	return nil, fmt.Errorf("beacon not prefetched for round %d", round)
+}
+
+func (w *WasmNetwork) SwitchChainHash(h string) error {
+	w.chainHash = h
+	return nil
+}
+
+func (w *WasmNetwork) Request(ctx context.Context, round uint64) (common.Beacon, error) {
+	// Use prefetched beacon if available
+	if w.prefetchedBeacon != nil && w.prefetchedBeacon.Round == round {
+		return *w.prefetchedBeacon, nil
+	}
+	if cached := w.cachedBeacon(round); cached != nil {
+		return *cached, nil
+	}
+	// Cannot make HTTP requests from WASM - beacon must be pre-fetched
+	return common.Beacon{}, fmt.Errorf("beacon not prefetched for round %d - WASM cannot make HTTP requests", round)
+}
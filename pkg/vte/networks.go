@@ -0,0 +1,366 @@
+package vte
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+)
+
+// KnownNetwork is a drand network in the registry
+type KnownNetwork struct {
+	Name      string
+	ChainHash []byte
+	SchemeID  string
+	Endpoints []string
+
+	// Info is the pinned chain info. Built-in testnets leave it nil: their
+	// chain info is fetched on first use and must hash to ChainHash.
+	Info *TrustedChainInfo
+}
+
+// Pinned reports whether the full chain info is known without any fetch
+func (n *KnownNetwork) Pinned() bool { return n.Info != nil }
+
+// NetworkInfo returns the timing parameters of a pinned network
+func (n *KnownNetwork) NetworkInfo() (DrandNetworkInfo, error) {
+	if n.Info == nil {
+		return DrandNetworkInfo{}, fmt.Errorf("network %s is not pinned: resolve it first", n.Name)
+	}
+	return DrandNetworkInfo{
+		ChainHash:   n.Info.ChainHash,
+		GenesisTime: n.Info.GenesisTime,
+		Period:      n.Info.Period,
+		SchemeID:    n.Info.SchemeID,
+	}, nil
+}
+
+// Tlock reports whether capsules can be encrypted to the network.
+// tlock needs an unchained scheme; the default mainnet is chained.
+func (n *KnownNetwork) Tlock() bool {
+	return UnchainedScheme(n.SchemeID)
+}
+
+// UnchainedScheme reports whether beacons of the scheme sign the round alone.
+// Chained beacons also sign the previous signature, which is never fetched or
+// cached here, so only unchained chains can be verified, cached or relayed.
+func UnchainedScheme(schemeID string) bool {
+	switch schemeID {
+	case crypto.SigsOnG1ID, crypto.UnchainedSchemeID, crypto.ShortSigSchemeID:
+		return true
+	default:
+		return false
+	}
+}
+
+// NetworkRegistry maps network names and chain hashes to known networks
+type NetworkRegistry struct {
+	mu     sync.RWMutex
+	byName map[string]*KnownNetwork
+	byHash map[string]*KnownNetwork
+}
+
+// Networks is the process-wide registry used by Encrypt, Decrypt,
+// EncryptPlaintext and the name-based lookups. It starts with the built-in
+// networks; custom ones can be added with Register or LoadChainInfoFile.
+var Networks = NewNetworkRegistry()
+
+var mainnetEndpoints = []string{
+	"https://api.drand.sh",
+	"https://api2.drand.sh",
+	"https://api3.drand.sh",
+	"https://drand.cloudflare.com",
+}
+
+var testnetEndpoints = []string{
+	"https://pl-us.testnet.drand.sh",
+	"https://pl-eu.testnet.drand.sh",
+}
+
+// NewNetworkRegistry returns a registry holding the built-in networks
+func NewNetworkRegistry() *NetworkRegistry {
+	r := &NetworkRegistry{
+		byName: make(map[string]*KnownNetwork),
+		byHash: make(map[string]*KnownNetwork),
+	}
+	// The chained built-ins are known by name only, so using them for tlock
+	// fails with a clear error; Register refuses new chained networks.
+	for _, n := range builtinNetworks() {
+		if err := r.add(n); err != nil {
+			panic(fmt.Sprintf("built-in network %s: %v", n.Name, err))
+		}
+	}
+	return r
+}
+
+func builtinNetworks() []*KnownNetwork {
+	return []*KnownNetwork{
+		{
+			Name:      "quicknet",
+			SchemeID:  crypto.SigsOnG1ID,
+			Endpoints: mainnetEndpoints,
+			Info: &TrustedChainInfo{
+				ChainHash:   mustDecodeHex("52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"),
+				PublicKey:   mustDecodeHex("83cf0f2896adee7eb8b5f01fcad3912212c437e0073e911fb90022d3e760183c8c4b450b6a0a6c3ac6a5776a2d1064510d1fec758c921cc22b0e17e63aaf4bcb5ed66304de9cf809bd274ca73bab4af5a6e9c76a4bc09e76eae8991ef5ece45a"),
+				SchemeID:    crypto.SigsOnG1ID,
+				GenesisTime: 1692803367,
+				Period:      3,
+				GenesisSeed: mustDecodeHex("f477d5c89f21a17c863a7f937c6a6d15859414d2be09cd448d4279af331c5d3e"),
+				BeaconID:    "quicknet",
+			},
+		},
+		{
+			Name:      "mainnet",
+			SchemeID:  crypto.DefaultSchemeID,
+			Endpoints: mainnetEndpoints,
+			Info: &TrustedChainInfo{
+				ChainHash:   mustDecodeHex("8990e7a9aaed2ffed73dbd7092123d6f289930540d7651336225dc172e51b2ce"),
+				PublicKey:   mustDecodeHex("868f005eb8e6e4ca0a47c8a77ceaa5309a47978a7c71bc5cce96366b5d7a569937c529eeda66c7293784a9402801af31"),
+				SchemeID:    crypto.DefaultSchemeID,
+				GenesisTime: 1595431050,
+				Period:      30,
+				GenesisSeed: mustDecodeHex("176f93498eac9ca337150b46d21dd58673ea4e3581185f869672e59fa4cb390a"),
+			},
+		},
+		{
+			Name:      "quicknet-t",
+			ChainHash: mustDecodeHex("cc9c398442737cbd141526600919edd69f1d6f9b4adb67e4d912fbc64341a9a5"),
+			SchemeID:  crypto.SigsOnG1ID,
+			Endpoints: testnetEndpoints,
+		},
+		{
+			Name:      "testnet",
+			ChainHash: mustDecodeHex("7672797f548f3f4748ac4bf3352fc6c6b6468c9ad40ad456a397545c6e2df5bf"),
+			SchemeID:  crypto.DefaultSchemeID,
+			Endpoints: testnetEndpoints,
+		},
+	}
+}
+
+// Register adds a network. Pinned chain info must hash to the chain hash,
+// names and chain hashes must be unique and the scheme must be unchained.
+func (r *NetworkRegistry) Register(n *KnownNetwork) error {
+	scheme := n.SchemeID
+	if scheme == "" && n.Info != nil {
+		scheme = n.Info.SchemeID
+	}
+	if scheme != "" && !UnchainedScheme(scheme) {
+		return fmt.Errorf("%w: network %s uses chained scheme %q, only unchained chains can be registered", ErrInvalidInput, n.Name, scheme)
+	}
+	return r.add(n)
+}
+
+func (r *NetworkRegistry) add(n *KnownNetwork) error {
+	if n.Name == "" {
+		return fmt.Errorf("%w: network name is required", ErrInvalidInput)
+	}
+	if n.Info != nil {
+		if err := n.Info.Validate(); err != nil {
+			return fmt.Errorf("network %s: %w", n.Name, err)
+		}
+		if n.ChainHash == nil {
+			n.ChainHash = n.Info.ChainHash
+		}
+		if n.SchemeID == "" {
+			n.SchemeID = n.Info.SchemeID
+		}
+		if !bytes.Equal(n.ChainHash, n.Info.ChainHash) || n.SchemeID != n.Info.SchemeID {
+			return fmt.Errorf("%w: network %s disagrees with its pinned chain info", ErrChainInfoMismatch, n.Name)
+		}
+	}
+	if len(n.ChainHash) != 32 {
+		return fmt.Errorf("%w: network %s: chain hash must be 32 bytes", ErrInvalidInput, n.Name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	hash := hex.EncodeToString(n.ChainHash)
+	if _, ok := r.byName[n.Name]; ok {
+		return fmt.Errorf("%w: network %s already registered", ErrInvalidInput, n.Name)
+	}
+	if existing, ok := r.byHash[hash]; ok {
+		return fmt.Errorf("%w: chain %s already registered as %s", ErrInvalidInput, hash, existing.Name)
+	}
+	r.byName[n.Name] = n
+	r.byHash[hash] = n
+	return nil
+}
+
+// RegisterChainInfoJSON adds a custom network from a drand /info response.
+// The chain hash is computed from the info, so the file pins the network.
+// An empty name uses the beacon ID from the info.
+func (r *NetworkRegistry) RegisterChainInfoJSON(name string, chainInfoJSON []byte, endpoints []string) (*KnownNetwork, error) {
+	info, err := chain.InfoFromJSON(bytes.NewReader(chainInfoJSON))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse chain info: %v", ErrInvalidInput, err)
+	}
+	// The advertised hash, when present, must be the one the info hashes to
+	var advertised struct {
+		Hash string `json:"hash"`
+	}
+	if err := json.Unmarshal(chainInfoJSON, &advertised); err == nil && advertised.Hash != "" && advertised.Hash != info.HashString() {
+		return nil, fmt.Errorf("%w: chain info advertises hash %s but hashes to %s", ErrChainInfoMismatch, advertised.Hash, info.HashString())
+	}
+
+	trusted, err := TrustedChainInfoFromJSON(chainInfoJSON, info.Hash())
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		name = info.ID
+	}
+	if name == "" || common.IsDefaultBeaconID(name) {
+		return nil, fmt.Errorf("%w: custom network needs a name", ErrInvalidInput)
+	}
+
+	n := &KnownNetwork{Name: name, Endpoints: endpoints, Info: trusted}
+	if err := r.Register(n); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// LoadChainInfoFile registers a custom network from a chain-info JSON file
+func (r *NetworkRegistry) LoadChainInfoFile(name, path string, endpoints []string) (*KnownNetwork, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read chain info file: %w", err)
+	}
+	return r.RegisterChainInfoJSON(name, data, endpoints)
+}
+
+// Lookup finds a network by name or by hex chain hash
+func (r *NetworkRegistry) Lookup(nameOrHash string) (*KnownNetwork, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if n, ok := r.byName[nameOrHash]; ok {
+		return n, nil
+	}
+	if n, ok := r.byHash[strings.ToLower(nameOrHash)]; ok {
+		return n, nil
+	}
+	return nil, fmt.Errorf("%w: unknown drand network %q", ErrNetworkMismatch, nameOrHash)
+}
+
+// LookupHash finds a network by chain hash
+func (r *NetworkRegistry) LookupHash(chainHash []byte) (*KnownNetwork, error) {
+	return r.Lookup(hex.EncodeToString(chainHash))
+}
+
+// Names returns the registered network names, sorted
+func (r *NetworkRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.byName))
+	for name := range r.byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the pinned chain info of a network, fetching it from the
+// network's endpoints for unpinned entries. Fetched info must hash to the
+// registered chain hash and use the registered scheme; the registry entry is
+// then replaced by a pinned copy, so later lookups need no fetch.
+func (r *NetworkRegistry) Resolve(ctx context.Context, n *KnownNetwork) (*TrustedChainInfo, error) {
+	if n.Info != nil {
+		return n.Info, nil
+	}
+	if current, err := r.Lookup(n.Name); err == nil && current.Info != nil && bytes.Equal(current.ChainHash, n.ChainHash) {
+		return current.Info, nil
+	}
+
+	info, err := resolveChainInfo(ctx, n.ChainHash, n.Endpoints)
+	if err != nil {
+		return nil, fmt.Errorf("network %s: %w", n.Name, err)
+	}
+	if info.Scheme != n.SchemeID {
+		return nil, fmt.Errorf("%w: network %s serves scheme %s, expected %s", ErrChainInfoMismatch, n.Name, info.Scheme, n.SchemeID)
+	}
+	trusted, err := trustedFromInfo(info)
+	if err != nil {
+		return nil, err
+	}
+
+	// Entries are never mutated: swap in a pinned copy
+	pinned := *n
+	pinned.Info = trusted
+	r.mu.Lock()
+	if current, ok := r.byName[n.Name]; ok && bytes.Equal(current.ChainHash, n.ChainHash) {
+		r.byName[n.Name] = &pinned
+		r.byHash[hex.EncodeToString(n.ChainHash)] = &pinned
+	}
+	r.mu.Unlock()
+	return trusted, nil
+}
+
+// LookupNetworkInfo returns the timing parameters of a registered network,
+// e.g. LookupNetworkInfo("quicknet") then TimeToRound
+func LookupNetworkInfo(nameOrHash string) (DrandNetworkInfo, error) {
+	n, err := Networks.Lookup(nameOrHash)
+	if err != nil {
+		return DrandNetworkInfo{}, err
+	}
+	return n.NetworkInfo()
+}
+
+// ResolveChainHash turns a network name or hex chain hash into chain hash
+// bytes. Unknown hex hashes are passed through so custom chains still work.
+func ResolveChainHash(nameOrHash string) ([]byte, error) {
+	if n, err := Networks.Lookup(nameOrHash); err == nil {
+		return n.ChainHash, nil
+	}
+	hash, err := hex.DecodeString(nameOrHash)
+	if err != nil || len(hash) != 32 {
+		return nil, fmt.Errorf("%w: %q is neither a known network nor a chain hash", ErrInvalidInput, nameOrHash)
+	}
+	return hash, nil
+}
+
+// EncryptToNetwork encrypts the payload (r2) for a round on a registered
+// network, by name or hex chain hash, to its pinned public key
+func EncryptToNetwork(ctx context.Context, nameOrHash string, round uint64, payload []byte) ([]byte, error) {
+	n, err := Networks.Lookup(nameOrHash)
+	if err != nil {
+		return nil, err
+	}
+	if !n.Tlock() {
+		return nil, fmt.Errorf("%w: network %s uses chained scheme %s, tlock needs an unchained one", ErrInvalidInput, n.Name, n.SchemeID)
+	}
+	trusted, err := Networks.Resolve(ctx, n)
+	if err != nil {
+		return nil, err
+	}
+	return EncryptWithTrustedChain(trusted, round, payload)
+}
+
+// pinnedChain returns the pinned chain info for a chain hash if it is a
+// registered, pinned network
+func pinnedChain(chainHash []byte) *TrustedChainInfo {
+	n, err := Networks.LookupHash(chainHash)
+	if err != nil {
+		return nil
+	}
+	return n.Info
+}
+
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
@@ -0,0 +1,199 @@
+package vte
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/drand/drand/v2/crypto"
+)
+
+func TestBuiltinNetworks(t *testing.T) {
+	byName, err := Networks.Lookup("quicknet")
+	if err != nil {
+		t.Fatalf("Lookup(quicknet) failed: %v", err)
+	}
+	byHash, err := Networks.Lookup("52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971")
+	if err != nil || byHash != byName {
+		t.Fatalf("Lookup by chain hash did not find quicknet: %v", err)
+	}
+	if !byName.Pinned() || !byName.Tlock() || len(byName.Endpoints) == 0 {
+		t.Fatalf("Unexpected quicknet entry: %+v", byName)
+	}
+
+	info := DefaultQuicknetInfo()
+	if info.Period != 3 || info.GenesisTime != 1692803367 || info.SchemeID != crypto.SigsOnG1ID {
+		t.Fatalf("Unexpected quicknet timing: %+v", info)
+	}
+
+	mainnet, err := Networks.Lookup("mainnet")
+	if err != nil {
+		t.Fatalf("Lookup(mainnet) failed: %v", err)
+	}
+	if mainnet.Tlock() {
+		t.Fatal("Chained mainnet must not be usable for tlock")
+	}
+	if _, err := EncryptToNetwork(context.Background(), "mainnet", 1, PlaintextToR2("x")); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Expected ErrInvalidInput encrypting to mainnet, got %v", err)
+	}
+	if err := mainnet.Info.VerifyBeacon(1, make([]byte, 96)); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Expected ErrInvalidInput verifying a chained beacon, got %v", err)
+	}
+	chained := &KnownNetwork{Name: "chained", Info: mainnet.Info}
+	if err := NewNetworkRegistry().Register(chained); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Expected ErrInvalidInput registering a chained network, got %v", err)
+	}
+
+	for _, name := range []string{"quicknet-t", "testnet"} {
+		n, err := Networks.Lookup(name)
+		if err != nil {
+			t.Fatalf("Lookup(%s) failed: %v", name, err)
+		}
+		if n.Pinned() {
+			t.Fatalf("%s should be resolved on first use", name)
+		}
+	}
+
+	if _, err := Networks.Lookup("nope"); !errors.Is(err, ErrNetworkMismatch) {
+		t.Fatalf("Expected ErrNetworkMismatch for unknown network, got %v", err)
+	}
+}
+
+func TestResolveChainHash(t *testing.T) {
+	quicknet, _ := ResolveChainHash("quicknet")
+	if hex.EncodeToString(quicknet) != "52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971" {
+		t.Fatalf("ResolveChainHash(quicknet) = %x", quicknet)
+	}
+
+	custom := strings.Repeat("ab", 32)
+	hash, err := ResolveChainHash(custom)
+	if err != nil || hex.EncodeToString(hash) != custom {
+		t.Fatalf("Unknown hex hashes should pass through: %x, %v", hash, err)
+	}
+	if got := endpointsFor(hash); len(got) == 0 || got[0] != "https://api.drand.sh" {
+		t.Fatalf("Unknown chains should use the public endpoints, got %v", got)
+	}
+	if got := endpointsFor(quicknet); len(got) == 0 {
+		t.Fatal("No endpoints for quicknet")
+	}
+
+	if _, err := ResolveChainHash("not-a-network"); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestLoadChainInfoFile(t *testing.T) {
+	network, _, _ := simulatedDrand(t, crypto.UnchainedSchemeID)
+	registry := NewNetworkRegistry()
+
+	path := filepath.Join(t.TempDir(), "chain.json")
+	if err := os.WriteFile(path, []byte(network.ChainInfoJSON()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := registry.LoadChainInfoFile("", path, []string{"http://localhost"})
+	if err != nil {
+		t.Fatalf("LoadChainInfoFile failed: %v", err)
+	}
+	if n.Name != "simnet" || hex.EncodeToString(n.ChainHash) != network.ChainHash() || n.SchemeID != crypto.UnchainedSchemeID {
+		t.Fatalf("Unexpected custom network: %+v", n)
+	}
+	if found, err := registry.Lookup(network.ChainHash()); err != nil || found != n {
+		t.Fatalf("Lookup by hash failed: %v", err)
+	}
+
+	if _, err := registry.LoadChainInfoFile("other-name", path, nil); err == nil {
+		t.Fatal("Expected a duplicate chain to be rejected")
+	}
+
+	// A file whose advertised hash does not match its content
+	forged := strings.Replace(network.ChainInfoJSON(), network.ChainHash(), strings.Repeat("00", 32), 1)
+	if _, err := registry.RegisterChainInfoJSON("forged", []byte(forged), nil); !errors.Is(err, ErrChainInfoMismatch) {
+		t.Fatalf("Expected ErrChainInfoMismatch, got %v", err)
+	}
+}
+
+func TestResolveUnpinnedNetwork(t *testing.T) {
+	network, _, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	registry := NewNetworkRegistry()
+
+	wrongScheme := &KnownNetwork{Name: "wrong", ChainHash: chainHash, SchemeID: crypto.UnchainedSchemeID, Endpoints: []string{endpoint}}
+	if _, err := registry.Resolve(context.Background(), wrongScheme); !errors.Is(err, ErrChainInfoMismatch) {
+		t.Fatalf("Expected ErrChainInfoMismatch for a scheme mismatch, got %v", err)
+	}
+
+	n := &KnownNetwork{Name: "sim", ChainHash: chainHash, SchemeID: crypto.SigsOnG1ID, Endpoints: []string{endpoint}}
+	if err := registry.Register(n); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	trusted, err := registry.Resolve(context.Background(), n)
+	if err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if err := trusted.Validate(); err != nil {
+		t.Fatalf("Resolved info does not validate: %v", err)
+	}
+
+	pinned, _ := registry.Lookup("sim")
+	if !pinned.Pinned() || n.Pinned() {
+		t.Fatal("Resolve should swap in a pinned copy and leave the original entry untouched")
+	}
+	if _, err := pinned.NetworkInfo(); err != nil {
+		t.Fatalf("NetworkInfo failed after resolve: %v", err)
+	}
+}
+
+func TestRegisteredNetworkFlow(t *testing.T) {
+	network, clock, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	name := "registered-" + network.ChainHash()[:8]
+	if _, err := Networks.RegisterChainInfoJSON(name, []byte(network.ChainInfoJSON()), []string{endpoint}); err != nil {
+		t.Fatalf("RegisterChainInfoJSON failed: %v", err)
+	}
+	chainHash, _ := ResolveChainHash(name)
+	round := network.LatestRound() + 2
+	r2 := PlaintextToR2("registered")
+	ctx := context.Background()
+
+	capsule, err := EncryptToNetwork(ctx, name, round, r2)
+	if err != nil {
+		t.Fatalf("EncryptToNetwork failed: %v", err)
+	}
+
+	// Pinned chains need no endpoint for encryption
+	if _, err := Encrypt(ctx, chainHash, round, r2, nil); err != nil {
+		t.Fatalf("Encrypt on a pinned chain failed: %v", err)
+	}
+
+	pkg, err := GenerateVTE(&GenerateVTEParams{
+		Round:         round,
+		ChainHash:     chainHash,
+		FormatID:      "tlock_v1_age_pairing",
+		SessionID:     "registered",
+		R2:            r2,
+		RefundTx:      []byte{0x02},
+		GenerateProof: true,
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE on a registered chain failed: %v", err)
+	}
+	if err := VerifyVTEOnNetwork(pkg, round, name, "tlock_v1_age_pairing", "registered", []byte{0x02}); err != nil {
+		t.Fatalf("VerifyVTEOnNetwork failed: %v", err)
+	}
+	if err := VerifyVTEOnNetwork(pkg, round, "quicknet", "tlock_v1_age_pairing", "registered", []byte{0x02}); !errors.Is(err, ErrNetworkMismatch) {
+		t.Fatalf("Expected ErrNetworkMismatch against quicknet, got %v", err)
+	}
+
+	clock.Advance(2 * network.Info().Period)
+	got, err := Decrypt(ctx, chainHash, round, capsule, []string{forgedBeaconEndpoint(t, network), endpoint})
+	if err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	if string(got) != string(r2) {
+		t.Fatalf("Decrypted %x, want %x", got, r2)
+	}
+}
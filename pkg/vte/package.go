@@ -2,10 +2,13 @@ package vte
 
 import (
 	"bytes"
-	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io"
+	"slices"
+
+	"github.com/drand/tlock"
 
 	"vte-tlock/circuits/commitment"
 )
@@ -18,12 +21,41 @@ type GenerateVTEParams struct {
 	SessionID string // Added for binding (e.g. UUID)
 	R2        []byte // 32-byte secret scalar
 	RefundTx  []byte // Transaction data for binding
-	// ...
+
+	// CtxSchema is CtxSchemaV3 (the default) or CtxSchemaV2, for verifiers
+	// that predate ctx_v3. ctx_v3 also binds CtxFields, e.g. the
+	// counterparty key or the funding outpoint.
+	CtxSchema string
+	CtxFields []CtxField
+
 	CtxHash         []byte   // Optional: pre-computed context hash (not recommended)
 	DrandEndpoints  []string // Endpoints to use for encryption (e.g. local proxy)
 	StoredEndpoints []string // Endpoints to write to package (e.g. real URL). If empty, uses DrandEndpoints.
 	GenerateProof   bool     // Whether to generate ZK proof (expensive, ~1.5s)
 
+	// Network is an optional pre-built drand network. When set it takes precedence
+	// over DrandEndpoints and ChainInfoJSON (offline tooling, test vectors).
+	Network tlock.Network
+
+	// TrustedChain pins the chain info to encrypt to. When set the capsule is
+	// encrypted to its public key and endpoints are never asked for chain info.
+	TrustedChain *TrustedChainInfo
+
+	// Rand is an optional randomness source for the age file key and nonce,
+	// the IBE sigma and, in detproof builds only, the Groth16 blinding. Nil
+	// uses crypto/rand. Two runs with equal readers (see NewSeededRand) give
+	// byte-identical packages apart from the Groth16 proofs, which match too
+	// under -tags detproof. Never set it outside tests and tooling.
+	Rand io.Reader
+
+	// Lock and Targets lock r2 to several (chain, round) pairs instead of
+	// ChainHash and Round (see LockInfo). Each target resolves its own
+	// network; unset target fields fall back to the ones above. Threshold
+	// is k for LockThreshold.
+	Lock      LockMode
+	Targets   []LockTarget
+	Threshold int
+
 	// WASM-specific: pre-fetched chain info and beacon (avoids HTTP from WASM)
 	ChainInfoJSON      string // JSON response from /{chainHash}/info (required in WASM)
 	BeaconSignatureHex string // Signature hex from /{chainHash}/public/{round} (required in WASM)
@@ -37,18 +69,29 @@ func GenerateVTE(params *GenerateVTEParams) (*VTEPackageV2, error) {
 	if len(params.R2) != 32 {
 		return nil, fmt.Errorf("R2 secret must be 32 bytes")
 	}
+	if params.Lock != "" {
+		if (params.CtxSchema != "" && params.CtxSchema != CtxSchemaMulti) || len(params.CtxFields) > 0 {
+			return nil, fmt.Errorf("%w: multi-network packages use the %s context schema", ErrInvalidInput, CtxSchemaMulti)
+		}
+		return generateLocked(params)
+	}
+	schema := params.CtxSchema
+	if schema == "" {
+		schema = CtxSchemaV3
+	}
 
 	// 1. REAL ENCRYPTION
-	ctx := context.Background()
-	var capsule []byte
-	var err error
-
-	// Use prefetched data if available (required for WASM builds)
-	if params.ChainInfoJSON != "" {
-		capsule, err = EncryptWithPrefetch(ctx, params.ChainHash, params.Round, params.R2, params.ChainInfoJSON, params.BeaconSignatureHex)
-	} else {
-		capsule, err = Encrypt(ctx, params.ChainHash, params.Round, params.R2, params.DrandEndpoints)
+	// Resolve the network: explicit, pinned, prefetched chain info (WASM) or endpoints
+	network := params.Network
+	if network == nil {
+		var err error
+		network, err = generateNetwork(params)
+		if err != nil {
+			return nil, fmt.Errorf("tlock encryption failed: %w", err)
+		}
 	}
+
+	capsule, err := EncryptWithNetwork(network, params.Round, params.R2, params.Rand)
 	if err != nil {
 		return nil, fmt.Errorf("tlock encryption failed: %w", err)
 	}
@@ -63,13 +106,30 @@ func GenerateVTE(params *GenerateVTEParams) (*VTEPackageV2, error) {
 		ChainHash:   params.ChainHash,
 		Round:       params.Round,
 		CapsuleHash: capsuleHash[:],
+		Fields:      params.CtxFields,
 	}
 
-	ctxHash, err := ComputeFullCtxHash(ctxParams)
+	ctxHash, err := ComputeCtxHash(schema, ctxParams)
 	if err != nil {
 		return nil, fmt.Errorf("ctx_hash computation failed: %w", err)
 	}
 
+	fields := slices.Clone(ctxFieldsV2)
+	if schema == CtxSchemaV3 {
+		fields = CtxFieldsV3(params.CtxFields)
+	}
+	return assemblePackage(params, ctxHash, schema, fields, TlockInfo{
+		DrandChainHash:     params.ChainHash,
+		Round:              params.Round,
+		CiphertextFormatID: params.FormatID,
+		Capsule:            capsule,
+		CapsuleHash:        capsuleHash[:],
+	}, nil)
+}
+
+// assemblePackage derives R2, the commitment and the proofs for a context hash
+// that already binds the capsules, and builds the package
+func assemblePackage(params *GenerateVTEParams, ctxHash []byte, schema string, fields []string, tlockInfo TlockInfo, lock *LockInfo) (*VTEPackageV2, error) {
 	// 3. Compute R2 Compressed Point (R2 = r2 * G)
 	compressedR2, err := ComputeR2Point(params.R2)
 	if err != nil {
@@ -85,11 +145,11 @@ func GenerateVTE(params *GenerateVTEParams) (*VTEPackageV2, error) {
 	// 5. Generate ZK Proof (Groth16)
 	var commitmentProof CommitmentProofInfo
 	if params.GenerateProof {
-		proofResult, err := commitment.Prove(nil, &commitment.WitnessInput{
+		proofResult, err := commitment.ProveWithRand(nil, &commitment.WitnessInput{
 			R2:      params.R2,
 			CtxHash: ctxHash,
 			C:       commitmentBytes,
-		})
+		}, params.Rand)
 		if err != nil {
 			return nil, fmt.Errorf("ZK proof generation failed: %w", err)
 		}
@@ -105,11 +165,12 @@ func GenerateVTE(params *GenerateVTEParams) (*VTEPackageV2, error) {
 		}
 	}
 
-	// 6. Generate Schnorr Proof (R2 = r2*G binding to CtxHash)
-	// Note: We bind to specific fields as per V2 spec to be explicit
-	// Actually Schnorr signature signs the message.
-	// We sign the CtxHash.
-	proofSecp, err := GenerateSchnorrProof(params.R2, ctxHash)
+	// 6. Generate Schnorr Proof (knowledge of r2, bound to every public field)
+	proofSecp, err := GenerateSchnorrProofV2(params.R2, &SchnorrBinding{
+		Commitment:  commitmentBytes,
+		CtxHash:     ctxHash,
+		CapsuleHash: SchnorrCapsuleHash(tlockInfo, lock),
+	})
 	if err != nil {
 		return nil, fmt.Errorf("schnorr proof generation failed: %w", err)
 	}
@@ -117,18 +178,14 @@ func GenerateVTE(params *GenerateVTEParams) (*VTEPackageV2, error) {
 	// Construct V2 Package
 	pkg := &VTEPackageV2{
 		Version: "vte-tlock/0.2",
-		Tlock: TlockInfo{
-			DrandChainHash:     params.ChainHash,
-			Round:              params.Round,
-			CiphertextFormatID: params.FormatID,
-			Capsule:            capsule,
-			CapsuleHash:        capsuleHash[:],
-		},
+		Tlock:   tlockInfo,
+		Lock:    lock,
 		Context: ContextInfo{
-			Schema:      "ctx_v2",
-			Fields:      []string{"drand_chain_hash", "round", "capsule_hash", "session_id", "refund_tx_hex"},
+			Schema:      schema,
+			Fields:      fields,
 			SessionID:   params.SessionID,
 			RefundTxHex: hex.EncodeToString(params.RefundTx),
+			Values:      params.CtxFields,
 			CtxHash:     ctxHash,
 		},
 		Public: PublicInfo{
@@ -141,8 +198,8 @@ func GenerateVTE(params *GenerateVTEParams) (*VTEPackageV2, error) {
 		Proofs: ProofsInfo{
 			Commitment: commitmentProof,
 			SecpSchnorr: SecpSchnorrInfo{
-				Scheme:       "schnorr_fs_v1",
-				BindFields:   []string{"R2", "commitment", "ctx_hash", "capsule_hash"}, // Implicitly via CtxHash
+				Scheme:       SchnorrSchemeV2,
+				BindFields:   append([]string(nil), SchnorrBindFields...),
 				SignatureB64: proofSecp.Signature,
 			},
 			TLE: TLEProofInfo{
@@ -163,14 +220,18 @@ type CtxHashParams struct {
 	RefundTx    []byte
 	ChainHash   []byte
 	Round       uint64
-	CapsuleHash []byte // SHA256(capsule) required for V2
+	CapsuleHash []byte     // SHA256(capsule) required for V2
+	Fields      []CtxField // ctx_v3 only
 }
 
 // ComputeFullCtxHash computes context hash according to V2 spec.
 // Order: ChainHash || Round || CapsuleHash || SessionID || RefundTx
 func ComputeFullCtxHash(params *CtxHashParams) ([]byte, error) {
 	if params == nil {
-		return nil, fmt.Errorf("params cannot be nil")
+		return nil, fmt.Errorf("%w: params cannot be nil", ErrInvalidInput)
+	}
+	if len(params.Fields) > 0 {
+		return nil, fmt.Errorf("%w: ctx_v2 cannot bind extra fields, use ctx_v3", ErrInvalidInput)
 	}
 
 	h := sha256.New()
@@ -179,7 +240,7 @@ func ComputeFullCtxHash(params *CtxHashParams) ([]byte, error) {
 
 	// 1. Chain Hash
 	if len(params.ChainHash) != 32 {
-		return nil, fmt.Errorf("chain_hash must be 32 bytes")
+		return nil, fmt.Errorf("%w: chain_hash must be 32 bytes", ErrInvalidInput)
 	}
 	h.Write(params.ChainHash)
 
@@ -197,7 +258,7 @@ func ComputeFullCtxHash(params *CtxHashParams) ([]byte, error) {
 
 	// 3. Capsule Hash
 	if len(params.CapsuleHash) != 32 {
-		return nil, fmt.Errorf("capsule_hash must be 32 bytes SHA256")
+		return nil, fmt.Errorf("%w: capsule_hash must be 32 bytes SHA256", ErrInvalidInput)
 	}
 	h.Write(params.CapsuleHash)
 
@@ -214,16 +275,31 @@ func ComputeFullCtxHash(params *CtxHashParams) ([]byte, error) {
 func VerifyCtxHashBinding(pkg *VTEPackageV2) error {
 	refundTx, err := hex.DecodeString(pkg.Context.RefundTxHex)
 	if err != nil {
-		return fmt.Errorf("invalid refund tx hex: %w", err)
+		return fmt.Errorf("%w: invalid refund tx hex: %v", ErrInvalidInput, err)
+	}
+
+	if (pkg.Lock != nil) != (pkg.Context.Schema == CtxSchemaMulti) {
+		return fmt.Errorf("%w: context schema %q does not match the lock", ErrCtxHashMismatch, pkg.Context.Schema)
+	}
+	if len(pkg.Context.Values) > 0 && pkg.Context.Schema != CtxSchemaV3 {
+		return fmt.Errorf("%w: context schema %q does not bind values", ErrCtxHashMismatch, pkg.Context.Schema)
+	}
+	if pkg.Lock != nil {
+		return verifyLockBinding(pkg, refundTx)
+	}
+	// ctx_v3 declares its fields; they must be the ones hashed
+	if pkg.Context.Schema == CtxSchemaV3 && !slices.Equal(pkg.Context.Fields, CtxFieldsV3(pkg.Context.Values)) {
+		return fmt.Errorf("%w: declared fields %v do not match the values", ErrCtxHashMismatch, pkg.Context.Fields)
 	}
 
 	// Recompute the full context hash
-	expectedCtxHash, err := ComputeFullCtxHash(&CtxHashParams{
+	expectedCtxHash, err := ComputeCtxHash(pkg.Context.Schema, &CtxHashParams{
 		SessionID:   pkg.Context.SessionID,
 		RefundTx:    refundTx,
 		ChainHash:   pkg.Tlock.DrandChainHash,
 		Round:       pkg.Tlock.Round,
 		CapsuleHash: pkg.Tlock.CapsuleHash,
+		Fields:      pkg.Context.Values,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to compute expected ctx_hash: %w", err)
@@ -231,13 +307,13 @@ func VerifyCtxHashBinding(pkg *VTEPackageV2) error {
 
 	// Compare with package's ctx_hash
 	if !bytes.Equal(expectedCtxHash, pkg.Context.CtxHash) {
-		return fmt.Errorf("ctx_hash binding failed: calculated %x, but package claims %x", expectedCtxHash, pkg.Context.CtxHash)
+		return fmt.Errorf("%w: calculated %x, but package claims %x", ErrCtxHashMismatch, expectedCtxHash, pkg.Context.CtxHash)
 	}
 
 	// Also verify Capsule Hash matches actual Capsule
 	actualCapsuleHash := sha256.Sum256(pkg.Tlock.Capsule)
 	if !bytes.Equal(actualCapsuleHash[:], pkg.Tlock.CapsuleHash) {
-		return fmt.Errorf("capsule integrity check failed: SHA256(capsule) != capsule_hash")
+		return fmt.Errorf("%w: SHA256(capsule) != capsule_hash", ErrCapsuleHashMismatch)
 	}
 
 	return nil
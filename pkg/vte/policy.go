@@ -0,0 +1,496 @@
+package vte
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"vte-tlock/circuits/commitment"
+)
+
+// VerificationPolicy declares what a verifier accepts. Integrations keep it
+// in a JSON or YAML file (see ParseVerificationPolicy) so risk rules change
+// without code changes. Empty fields accept anything; Require starts from
+// DefaultPolicy when loaded from a file.
+//
+// Every capsule of a multi-network package must be on a pinned chain, and one
+// must be at Round. Capsules of any_of and threshold locks each open the
+// package, alone or with others, so none of them may open before that one;
+// capsules on other chains are placed by their round time (see
+// PackageUnlockTime).
+type VerificationPolicy struct {
+	Require ProofRequirements `json:"require" yaml:"require"`
+
+	AllowedCircuitIDs []string `json:"allowed_circuit_ids,omitempty" yaml:"allowed_circuit_ids"`
+	AllowedFormats    []string `json:"allowed_formats,omitempty" yaml:"allowed_formats"`
+	PinnedChains      []string `json:"pinned_chains,omitempty" yaml:"pinned_chains"` // network names or hex chain hashes
+
+	// AllowedSchnorrSchemes lists the accepted Schnorr proof schemes; empty
+	// accepts both. Set it to [schnorr_fs_v2] to refuse schnorr_fs_v1 proofs,
+	// which bind neither the commitment nor the capsule and say nothing
+	// about the parity of R2.
+	AllowedSchnorrSchemes []string `json:"allowed_schnorr_schemes,omitempty" yaml:"allowed_schnorr_schemes"`
+
+	// AllowedCtxSchemas lists the accepted context schemas, ctx_v2_multi for
+	// multi-network packages; empty accepts any. Set it to [ctx_v3] to
+	// refuse ctx_v2, whose concatenated fields can shift between the
+	// session ID and the refund tx.
+	AllowedCtxSchemas []string `json:"allowed_ctx_schemas,omitempty" yaml:"allowed_ctx_schemas"`
+
+	// Round is usually set in code, per package
+	Round uint64 `json:"round,omitempty" yaml:"round"`
+
+	// The package must open between MinUnlock and MaxUnlock from now, by the
+	// nominal time of its round (of the capsule that completes it, for
+	// multi-network packages). Only chains with known timing can be placed.
+	MinUnlock Duration `json:"min_unlock,omitempty" yaml:"min_unlock"`
+	MaxUnlock Duration `json:"max_unlock,omitempty" yaml:"max_unlock"`
+
+	SessionID   string `json:"session_id,omitempty" yaml:"session_id"`
+	RefundTxHex string `json:"refund_tx_hex,omitempty" yaml:"refund_tx_hex"`
+
+	// Refund, when set, decodes the refund tx as a Bitcoin transaction and
+	// checks its locktime and outputs
+	Refund *RefundPolicy `json:"refund,omitempty" yaml:"refund"`
+
+	Now func() time.Time `json:"-" yaml:"-"` // Nil uses time.Now
+}
+
+// ProofRequirements says which proofs a package must carry. Proofs that are
+// present are always verified, required or not.
+type ProofRequirements struct {
+	Commitment bool `json:"commitment" yaml:"commitment"`
+	Schnorr    bool `json:"schnorr" yaml:"schnorr"`
+	TLE        bool `json:"tle" yaml:"tle"`
+	SecpZK     bool `json:"secp_zk" yaml:"secp_zk"`
+}
+
+// DefaultPolicy requires the commitment and Schnorr proofs and nothing else,
+// like VerifyVTE without expectations
+func DefaultPolicy() *VerificationPolicy {
+	return &VerificationPolicy{Require: ProofRequirements{Commitment: true, Schnorr: true}}
+}
+
+// ParseVerificationPolicy reads a policy from JSON or YAML, over
+// DefaultPolicy. Unknown fields are rejected, so a misspelt rule is an error
+// rather than silently unenforced.
+func ParseVerificationPolicy(data []byte) (*VerificationPolicy, error) {
+	p := DefaultPolicy()
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(p); err != nil {
+			return nil, fmt.Errorf("%w: policy JSON: %v", ErrInvalidInput, err)
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(p); err != nil && err.Error() != "EOF" {
+			return nil, fmt.Errorf("%w: policy YAML: %v", ErrInvalidInput, err)
+		}
+	}
+	if _, err := p.resolve(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// LoadVerificationPolicy reads a policy file (see ParseVerificationPolicy)
+func LoadVerificationPolicy(path string) (*VerificationPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseVerificationPolicy(data)
+}
+
+// Duration is a time.Duration written as a Go ("36h") or ISO-8601 ("P1DT12H")
+// duration string in policy files
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string: %w", err)
+	}
+	return d.parse(s)
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	return d.parse(node.Value)
+}
+
+func (d *Duration) parse(s string) error {
+	v, err := ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// resolvedPolicy holds the decoded fields of a policy
+type resolvedPolicy struct {
+	chains   [][]byte
+	refundTx []byte
+}
+
+func (p *VerificationPolicy) resolve() (*resolvedPolicy, error) {
+	r := &resolvedPolicy{}
+	for _, chain := range p.PinnedChains {
+		hash, err := ResolveChainHash(chain)
+		if err != nil {
+			return nil, fmt.Errorf("policy pinned_chains: %w", err)
+		}
+		r.chains = append(r.chains, hash)
+	}
+	refundTx, err := hex.DecodeString(p.RefundTxHex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: policy refund_tx_hex: %v", ErrInvalidInput, err)
+	}
+	r.refundTx = refundTx
+	if p.MinUnlock < 0 || p.MaxUnlock < 0 || (p.MaxUnlock > 0 && p.MinUnlock > p.MaxUnlock) {
+		return nil, fmt.Errorf("%w: policy needs 0 <= min_unlock <= max_unlock", ErrInvalidInput)
+	}
+	if p.Refund != nil {
+		if err := p.Refund.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// allowsCtxSchema reads an empty schema as ctx_v2, like ComputeCtxHash
+func (p *VerificationPolicy) allowsCtxSchema(schema string) bool {
+	if schema == "" {
+		schema = CtxSchemaV2
+	}
+	return len(p.AllowedCtxSchemas) == 0 || slices.Contains(p.AllowedCtxSchemas, schema)
+}
+
+func (p *VerificationPolicy) allowsSchnorrScheme(scheme string) bool {
+	return len(p.AllowedSchnorrSchemes) == 0 || slices.Contains(p.AllowedSchnorrSchemes, scheme)
+}
+
+func (p *VerificationPolicy) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+	return time.Now()
+}
+
+// Verify checks pkg against the policy and returns the first failure
+func (p *VerificationPolicy) Verify(pkg *VTEPackageV2) error {
+	return p.evaluate(pkg, true).Err()
+}
+
+// Report checks pkg against the policy and records every check
+func (p *VerificationPolicy) Report(pkg *VTEPackageV2) *VerificationReport {
+	return p.evaluate(pkg, false)
+}
+
+func (p *VerificationPolicy) evaluate(pkg *VTEPackageV2, failFast bool) *VerificationReport {
+	resolved, err := p.resolve()
+	if err != nil {
+		return newReport(pkg, []namedCheck{{CheckPolicy, func(*CheckResult) error { return err }}}, true)
+	}
+	return newReport(pkg, p.checks(pkg, resolved), failFast)
+}
+
+// onPinnedChain reports whether a capsule is on a pinned chain; no pins
+// accept every chain
+func (r *resolvedPolicy) onPinnedChain(c *TlockInfo) bool {
+	return len(r.chains) == 0 || slices.ContainsFunc(r.chains, func(h []byte) bool { return bytes.Equal(h, c.DrandChainHash) })
+}
+
+func (p *VerificationPolicy) checks(pkg *VTEPackageV2, r *resolvedPolicy) []namedCheck {
+	return []namedCheck{
+		{CheckVersion, func(*CheckResult) error {
+			if pkg.Version != "vte-tlock/0.2" {
+				return fmt.Errorf("%w: have %s, want vte-tlock/0.2", ErrVersionMismatch, pkg.Version)
+			}
+			return nil
+		}},
+
+		{CheckChain, func(*CheckResult) error {
+			if len(r.chains) == 0 {
+				return errSkipped("no pinned chains")
+			}
+			// Every capsule must be on a pinned chain: a capsule elsewhere may
+			// open whenever that chain's operator likes
+			for i, c := range pkg.Capsules() {
+				if !r.onPinnedChain(&c) {
+					return fmt.Errorf("%w: capsule %d has %x, want one of %x", ErrNetworkMismatch, i, c.DrandChainHash, r.chains)
+				}
+			}
+			return nil
+		}},
+
+		{CheckRound, func(*CheckResult) error {
+			if p.Round == 0 {
+				return errSkipped("no expected round")
+			}
+			capsules := pkg.Capsules()
+			var have []uint64
+			var at []TlockInfo
+			for _, c := range capsules {
+				have = append(have, c.Round)
+				if c.Round == p.Round {
+					at = append(at, c)
+				}
+			}
+			if len(at) == 0 {
+				return fmt.Errorf("%w: have %v, want %d", ErrRoundMismatch, have, p.Round)
+			}
+			if pkg.Lock == nil || pkg.Lock.Mode == LockAllOf {
+				return nil
+			}
+			// One capsule of an any_of lock opens the package, and so do the
+			// earliest k of a threshold lock; none of them may open first
+			for i := range capsules {
+				early, err := opensBeforeAll(&capsules[i], at)
+				if err != nil {
+					return fmt.Errorf("capsule %d: %w", i, err)
+				}
+				if early {
+					return fmt.Errorf("%w: capsule %d opens at round %d of chain %x, before round %d", ErrRoundMismatch, i, capsules[i].Round, capsules[i].DrandChainHash, p.Round)
+				}
+			}
+			return nil
+		}},
+
+		{CheckCtxBinding, func(*CheckResult) error {
+			if schema := pkg.Context.Schema; !p.allowsCtxSchema(schema) {
+				return fmt.Errorf("%w: context schema %q, want one of %v", ErrFormatMismatch, schema, p.AllowedCtxSchemas)
+			}
+			if err := VerifyCtxHashBinding(pkg); err != nil {
+				return fmt.Errorf("ctx_hash binding validation failed: %w", err)
+			}
+			return nil
+		}},
+
+		{CheckCapsuleHash, func(*CheckResult) error {
+			for i, c := range pkg.Capsules() {
+				actual := sha256.Sum256(c.Capsule)
+				if !bytes.Equal(actual[:], c.CapsuleHash) {
+					return fmt.Errorf("%w: capsule %d: SHA256(capsule) != capsule_hash", ErrCapsuleHashMismatch, i)
+				}
+			}
+			return nil
+		}},
+
+		{CheckPolicy, func(*CheckResult) error {
+			if p.SessionID == "" && len(r.refundTx) == 0 {
+				return errSkipped("no expected session or refund tx")
+			}
+			if p.SessionID != "" && pkg.Context.SessionID != p.SessionID {
+				return fmt.Errorf("%w: have %s, want %s", ErrSessionMismatch, pkg.Context.SessionID, p.SessionID)
+			}
+			if len(r.refundTx) > 0 {
+				haveRefundTx, _ := hex.DecodeString(pkg.Context.RefundTxHex)
+				if !bytes.Equal(haveRefundTx, r.refundTx) {
+					return fmt.Errorf("%w: have %s, want %x", ErrRefundTxMismatch, pkg.Context.RefundTxHex, r.refundTx)
+				}
+			}
+			return nil
+		}},
+
+		{CheckRefundTx, func(*CheckResult) error {
+			if p.Refund == nil {
+				return errSkipped("no refund tx policy")
+			}
+			return p.Refund.check(pkg)
+		}},
+
+		{CheckFormat, func(*CheckResult) error {
+			for i, c := range pkg.Capsules() {
+				if len(p.AllowedFormats) > 0 && !slices.Contains(p.AllowedFormats, c.CiphertextFormatID) {
+					return fmt.Errorf("%w: capsule %d has %s, want one of %v", ErrFormatMismatch, i, c.CiphertextFormatID, p.AllowedFormats)
+				}
+				if _, err := ParseCapsule(c.Capsule, c.CiphertextFormatID); err != nil {
+					return fmt.Errorf("capsule %d: %w", i, err)
+				}
+			}
+			return nil
+		}},
+
+		{CheckUnlockHorizon, func(*CheckResult) error {
+			if p.MinUnlock == 0 && p.MaxUnlock == 0 {
+				return errSkipped("no unlock horizon")
+			}
+			unlockAt, err := PackageUnlockTime(pkg)
+			if err != nil {
+				return err
+			}
+			now := p.now()
+			if earliest := now.Add(time.Duration(p.MinUnlock)); unlockAt.Before(earliest) {
+				return fmt.Errorf("%w: unlocks at %s, policy needs %s or later", ErrRoundOutOfRange, unlockAt.UTC().Format(time.RFC3339), earliest.UTC().Format(time.RFC3339))
+			}
+			if latest := now.Add(time.Duration(p.MaxUnlock)); p.MaxUnlock > 0 && unlockAt.After(latest) {
+				return fmt.Errorf("%w: unlocks at %s, policy needs %s or earlier", ErrRoundOutOfRange, unlockAt.UTC().Format(time.RFC3339), latest.UTC().Format(time.RFC3339))
+			}
+			return nil
+		}},
+
+		{CheckCommitmentProof, func(c *CheckResult) error {
+			proof := pkg.Proofs.Commitment
+			if len(proof.ProofB64) == 0 {
+				if p.Require.Commitment {
+					return fmt.Errorf("%w: commitment", ErrMissingProof)
+				}
+				return errSkipped("no commitment proof, not required")
+			}
+			if len(p.AllowedCircuitIDs) > 0 && !slices.Contains(p.AllowedCircuitIDs, proof.CircuitID) {
+				return fmt.Errorf("%w: circuit %s is not allowed by the policy", ErrCircuitIDMismatch, proof.CircuitID)
+			}
+			c.CircuitID = commitment.GetEmbeddedCircuitID()
+			if err := VerifyCommitmentProof(pkg); err != nil {
+				return fmt.Errorf("ZK proof verification failed: %w", err)
+			}
+			return nil
+		}},
+
+		{CheckSchnorr, func(*CheckResult) error {
+			if pkg.Proofs.SecpSchnorr.SignatureB64 == nil {
+				if p.Require.Schnorr {
+					return fmt.Errorf("%w: schnorr", ErrMissingProof)
+				}
+				return errSkipped("no Schnorr proof, not required")
+			}
+			if scheme := pkg.Proofs.SecpSchnorr.Scheme; !p.allowsSchnorrScheme(scheme) {
+				return fmt.Errorf("%w: schnorr: scheme %q is not allowed by the policy", ErrProofInvalid, scheme)
+			}
+			if err := verifySecpSchnorr(pkg); err != nil {
+				return fmt.Errorf("%w: schnorr: %v", ErrProofInvalid, err)
+			}
+			return nil
+		}},
+
+		{CheckSecpZK, func(*CheckResult) error {
+			if p.Require.SecpZK {
+				return fmt.Errorf("%w: secp ZK proof (packages do not carry one yet)", ErrMissingProof)
+			}
+			return errSkipped("not required")
+		}},
+
+		{CheckTLE, func(c *CheckResult) error {
+			// There is no TLE verifier yet, so no capsule's encryption is
+			// verified, whatever evidence it carries
+			statuses := tleStatuses(pkg)
+			for i, status := range statuses {
+				c.UnverifiedCapsules = append(c.UnverifiedCapsules, i)
+				if !p.Require.TLE {
+					continue
+				}
+				what := "package"
+				if pkg.Lock != nil {
+					what = fmt.Sprintf("capsule %d", i)
+				}
+				if status == "" || status == "not_implemented" {
+					return fmt.Errorf("%w: tle: %s carries no TLE proof", ErrMissingProof, what)
+				}
+				return fmt.Errorf("%w: tle: no verifier for TLE proof status %q of %s", ErrMissingProof, status, what)
+			}
+			if pkg.Lock != nil {
+				return errSkipped(fmt.Sprintf("encryption of all %d capsules unverified: no TLE verifier", len(statuses)))
+			}
+			if status := statuses[0]; status != "" && status != "not_implemented" {
+				return errSkipped(fmt.Sprintf("no verifier for TLE proof status %q", status))
+			}
+			return errSkipped("package carries no TLE proof")
+		}},
+	}
+}
+
+// tleStatuses returns the TLE proof status of each capsule
+func tleStatuses(pkg *VTEPackageV2) []string {
+	if pkg.Lock == nil {
+		return []string{pkg.Proofs.TLE.Status}
+	}
+	statuses := make([]string, len(pkg.Lock.Capsules))
+	for i, c := range pkg.Lock.Capsules {
+		statuses[i] = c.TLE.Status
+	}
+	return statuses
+}
+
+// PackageUnlockTime returns the nominal time a package can first be opened:
+// its round time, or for multi-network packages the time enough capsules are
+// open (see LockInfo.Needed). Chain timing comes from the registry or the
+// Beacons cache.
+func PackageUnlockTime(pkg *VTEPackageV2) (time.Time, error) {
+	var times []time.Time
+	for _, c := range pkg.Capsules() {
+		info, err := chainTiming(c.DrandChainHash)
+		if err != nil {
+			return time.Time{}, err
+		}
+		times = append(times, info.RoundToTime(c.Round))
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	need := 1
+	if pkg.Lock != nil {
+		need = min(max(pkg.Lock.Needed(), 1), len(times))
+	}
+	if len(times) < need {
+		return time.Time{}, fmt.Errorf("%w: package has no capsules", ErrInvalidInput)
+	}
+	return times[need-1], nil
+}
+
+// opensBeforeAll reports whether capsule c opens before every capsule in at:
+// by round on the same chain, else by nominal round time
+func opensBeforeAll(c *TlockInfo, at []TlockInfo) (bool, error) {
+	for _, a := range at {
+		if bytes.Equal(c.DrandChainHash, a.DrandChainHash) {
+			if c.Round >= a.Round {
+				return false, nil
+			}
+			continue
+		}
+		cInfo, err := chainTiming(c.DrandChainHash)
+		if err != nil {
+			return false, err
+		}
+		aInfo, err := chainTiming(a.DrandChainHash)
+		if err != nil {
+			return false, err
+		}
+		if !cInfo.RoundToTime(c.Round).Before(aInfo.RoundToTime(a.Round)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// chainTiming returns the round timing of a chain known without network
+// access
+func chainTiming(chainHash []byte) (DrandNetworkInfo, error) {
+	if n, err := Networks.LookupHash(chainHash); err == nil {
+		if info, err := n.NetworkInfo(); err == nil {
+			return info, nil
+		}
+	}
+	if trusted, err := Beacons.ChainInfo(chainHash); err == nil {
+		return DrandNetworkInfo{
+			ChainHash:   trusted.ChainHash,
+			GenesisTime: trusted.GenesisTime,
+			Period:      trusted.Period,
+			SchemeID:    trusted.SchemeID,
+		}, nil
+	}
+	return DrandNetworkInfo{}, fmt.Errorf("%w: no round timing known for chain %x", ErrRoundOutOfRange, chainHash)
+}
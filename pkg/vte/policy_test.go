@@ -0,0 +1,169 @@
+package vte
+
+import (
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/crypto"
+)
+
+func TestParseVerificationPolicy(t *testing.T) {
+	jsonPolicy := `{
+		"require": {"commitment": true, "schnorr": true, "tle": false, "secp_zk": false},
+		"allowed_formats": ["tlock_v1_age_pairing"],
+		"pinned_chains": ["quicknet"],
+		"allowed_schnorr_schemes": ["schnorr_fs_v2"],
+		"min_unlock": "1h",
+		"max_unlock": "P2D",
+		"session_id": "swap-1",
+		"refund_tx_hex": "010203"
+	}`
+	yamlPolicy := `
+require:
+  commitment: true
+  schnorr: true
+allowed_formats: [tlock_v1_age_pairing]
+pinned_chains: [quicknet]
+allowed_schnorr_schemes: [schnorr_fs_v2]
+min_unlock: 1h
+max_unlock: P2D
+session_id: swap-1
+refund_tx_hex: "010203"
+`
+	for name, data := range map[string]string{"json": jsonPolicy, "yaml": yamlPolicy} {
+		p, err := ParseVerificationPolicy([]byte(data))
+		if err != nil {
+			t.Fatalf("%s: ParseVerificationPolicy failed: %v", name, err)
+		}
+		if !p.Require.Commitment || p.Require.TLE || time.Duration(p.MinUnlock) != time.Hour ||
+			time.Duration(p.MaxUnlock) != 48*time.Hour || p.SessionID != "swap-1" || p.PinnedChains[0] != "quicknet" ||
+			p.allowsSchnorrScheme(SchnorrSchemeV1) {
+			t.Errorf("%s: parsed %+v", name, p)
+		}
+	}
+
+	// Unset requirements keep the default
+	p, err := ParseVerificationPolicy([]byte("session_id: x\n"))
+	if err != nil || !p.Require.Commitment || !p.Require.Schnorr {
+		t.Fatalf("Expected the default requirements, got %+v (%v)", p, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte(yamlPolicy), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadVerificationPolicy(path); err != nil {
+		t.Fatalf("LoadVerificationPolicy failed: %v", err)
+	}
+
+	for name, data := range map[string]string{
+		"unknown json field": `{"sesion_id": "x"}`,
+		"unknown yaml field": "requires:\n  tle: true\n",
+		"bad duration":       `{"min_unlock": "soon"}`,
+		"min above max":      "min_unlock: 2h\nmax_unlock: 1h\n",
+		"unknown chain":      "pinned_chains: [nonet]\n",
+		"bad refund hex":     `{"refund_tx_hex": "zz"}`,
+	} {
+		if _, err := ParseVerificationPolicy([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestVerificationPolicy(t *testing.T) {
+	network, clock, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	useBeaconCache(t, NewBeaconCache(NewMemoryBeaconStore()))
+	round := network.LatestRound() + 100
+	pkg, err := GenerateVTE(&GenerateVTEParams{
+		Round:          round,
+		ChainHash:      chainHash,
+		FormatID:       "tlock_v1_age_pairing",
+		SessionID:      "policy",
+		R2:             PlaintextToR2("policy"),
+		DrandEndpoints: []string{endpoint},
+		GenerateProof:  true,
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE failed: %v", err)
+	}
+	unlockIn := roundTimeOf(network, round).Sub(clock.Now())
+
+	policy := func() *VerificationPolicy {
+		p := DefaultPolicy()
+		p.PinnedChains = []string{network.ChainHash()}
+		p.Now = clock.Now
+		return p
+	}
+	if err := policy().Verify(pkg); err != nil {
+		t.Fatalf("Default policy rejected the package: %v", err)
+	}
+	if pkg.Context.Schema != CtxSchemaV3 {
+		t.Fatalf("New package has schema %s, want %s", pkg.Context.Schema, CtxSchemaV3)
+	}
+
+	// The horizon needs the chain's timing
+	p := policy()
+	p.MinUnlock = Duration(time.Second)
+	if err := p.Verify(pkg); !errors.Is(err, ErrRoundOutOfRange) {
+		t.Fatalf("Expected ErrRoundOutOfRange for an unknown chain, got %v", err)
+	}
+	if err := Beacons.AddChainInfo([]byte(network.ChainInfoJSON()), chainHash); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Verify(pkg); err != nil {
+		t.Fatalf("Horizon check failed: %v", err)
+	}
+	if unlockAt, err := PackageUnlockTime(pkg); err != nil || !unlockAt.Equal(roundTimeOf(network, round)) {
+		t.Fatalf("PackageUnlockTime = %v (%v)", unlockAt, err)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		edit  func(p *VerificationPolicy)
+		check string
+		err   error
+	}{
+		{"too soon", func(p *VerificationPolicy) { p.MinUnlock = Duration(unlockIn + time.Minute) }, CheckUnlockHorizon, ErrRoundOutOfRange},
+		{"too late", func(p *VerificationPolicy) { p.MaxUnlock = Duration(unlockIn - time.Minute) }, CheckUnlockHorizon, ErrRoundOutOfRange},
+		{"other chain", func(p *VerificationPolicy) { p.PinnedChains = []string{"quicknet"} }, CheckChain, ErrNetworkMismatch},
+		{"circuit", func(p *VerificationPolicy) { p.AllowedCircuitIDs = []string{"other"} }, CheckCommitmentProof, ErrCircuitIDMismatch},
+		{"format", func(p *VerificationPolicy) { p.AllowedFormats = []string{"tlock_v2"} }, CheckFormat, ErrFormatMismatch},
+		{"ctx schema", func(p *VerificationPolicy) { p.AllowedCtxSchemas = []string{CtxSchemaV2} }, CheckCtxBinding, ErrFormatMismatch},
+		{"tle required", func(p *VerificationPolicy) { p.Require.TLE = true }, CheckTLE, ErrMissingProof},
+		{"secp zk required", func(p *VerificationPolicy) { p.Require.SecpZK = true }, CheckSecpZK, ErrMissingProof},
+		{"refund", func(p *VerificationPolicy) { p.RefundTxHex = "01" }, CheckPolicy, ErrRefundTxMismatch},
+	} {
+		p := policy()
+		tc.edit(p)
+		if err := p.Verify(pkg); !errors.Is(err, tc.err) {
+			t.Errorf("%s: Verify returned %v, want %v", tc.name, err, tc.err)
+		}
+		if c := p.Report(pkg).Check(tc.check); c == nil || c.Status != CheckFail {
+			t.Errorf("%s: %s check %+v, want a failure", tc.name, tc.check, c)
+		}
+	}
+
+	// Proofs that are not required may be missing
+	stripped := *pkg
+	stripped.Proofs.Commitment.ProofB64 = nil
+	if err := policy().Verify(&stripped); !errors.Is(err, ErrMissingProof) {
+		t.Fatalf("Expected ErrMissingProof, got %v", err)
+	}
+	p = policy()
+	p.Require.Commitment = false
+	if report := p.Report(&stripped); !report.OK || report.Check(CheckCommitmentProof).Status != CheckSkipped {
+		t.Fatalf("Unexpected report %+v", report)
+	}
+
+	// Verify stops at the first failure
+	p = policy()
+	p.SessionID = "other"
+	if report := p.evaluate(pkg, true); report.Checks[len(report.Checks)-1].Name != CheckPolicy {
+		t.Fatalf("Fail-fast report ran past the failure: %+v", report.Checks)
+	}
+}
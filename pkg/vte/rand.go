@@ -0,0 +1,42 @@
+package vte
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+)
+
+// seededRand is a SHA256 counter-mode byte stream: block i = SHA256(seed || i)
+type seededRand struct {
+	seed    []byte
+	counter uint64
+	buf     []byte
+}
+
+// NewSeededRand returns a deterministic randomness source for
+// GenerateVTEParams.Rand. Equal seeds give equal streams, which is what golden
+// files, cross-implementation checks and bug reports need.
+// It is NOT a CSPRNG for real secrets: anyone with the seed can replay it.
+func NewSeededRand(seed []byte) io.Reader {
+	return &seededRand{seed: append([]byte{}, seed...)}
+}
+
+func (r *seededRand) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			var ctr [8]byte
+			binary.BigEndian.PutUint64(ctr[:], r.counter)
+			r.counter++
+
+			h := sha256.New()
+			h.Write(r.seed)
+			h.Write(ctr[:])
+			r.buf = h.Sum(nil)
+		}
+		c := copy(p[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+	return n, nil
+}
@@ -0,0 +1,165 @@
+package vte
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/wire"
+)
+
+// lockTimeThreshold is where nLockTime switches from block heights to Unix
+// times (BIP-65)
+const lockTimeThreshold = 500_000_000
+
+// maxSatoshi is the Bitcoin supply cap in satoshis
+const maxSatoshi = 21_000_000 * 100_000_000
+
+// RefundTx is a decoded Bitcoin refund transaction
+type RefundTx struct {
+	TxID     string           `json:"txid"`
+	Version  int32            `json:"version"`
+	Inputs   []RefundTxInput  `json:"inputs"`
+	Outputs  []RefundTxOutput `json:"outputs"`
+	LockTime uint32           `json:"locktime"`
+}
+
+type RefundTxInput struct {
+	PrevOut  string `json:"prevout"` // "txid:vout", txid as displayed
+	Sequence uint32 `json:"sequence"`
+}
+
+type RefundTxOutput struct {
+	Value    int64  `json:"value"`     // satoshis
+	PkScript string `json:"pk_script"` // hex
+}
+
+// LockTimeEnforced reports whether nLockTime applies: it is set and some
+// input is not final
+func (tx *RefundTx) LockTimeEnforced() bool {
+	if tx.LockTime == 0 {
+		return false
+	}
+	for _, in := range tx.Inputs {
+		if in.Sequence != wire.MaxTxInSequenceNum {
+			return true
+		}
+	}
+	return false
+}
+
+// LockTimeUTC returns nLockTime as a time, or false for a block height
+func (tx *RefundTx) LockTimeUTC() (time.Time, bool) {
+	if tx.LockTime < lockTimeThreshold {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(tx.LockTime), 0).UTC(), true
+}
+
+// DecodeRefundTx parses raw as a Bitcoin transaction, with or without
+// witness data, and checks it is well-formed: no trailing bytes, at least one
+// input and output, no input spent twice and output values within the
+// supply cap
+func DecodeRefundTx(raw []byte) (*RefundTx, error) {
+	var msg wire.MsgTx
+	r := bytes.NewReader(raw)
+	if err := msg.Deserialize(r); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRefundTxInvalid, err)
+	}
+	if r.Len() > 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrRefundTxInvalid, r.Len())
+	}
+	if len(msg.TxIn) == 0 || len(msg.TxOut) == 0 {
+		return nil, fmt.Errorf("%w: needs inputs and outputs", ErrRefundTxInvalid)
+	}
+
+	tx := &RefundTx{TxID: msg.TxHash().String(), Version: msg.Version, LockTime: msg.LockTime}
+	spent := make(map[wire.OutPoint]bool, len(msg.TxIn))
+	for i, in := range msg.TxIn {
+		if spent[in.PreviousOutPoint] {
+			return nil, fmt.Errorf("%w: input %d spends %s twice", ErrRefundTxInvalid, i, in.PreviousOutPoint)
+		}
+		spent[in.PreviousOutPoint] = true
+		tx.Inputs = append(tx.Inputs, RefundTxInput{PrevOut: in.PreviousOutPoint.String(), Sequence: in.Sequence})
+	}
+	var total int64
+	for i, out := range msg.TxOut {
+		if out.Value < 0 || out.Value > maxSatoshi {
+			return nil, fmt.Errorf("%w: output %d value %d out of range", ErrRefundTxInvalid, i, out.Value)
+		}
+		if total += out.Value; total > maxSatoshi {
+			return nil, fmt.Errorf("%w: outputs total more than the supply cap", ErrRefundTxInvalid)
+		}
+		tx.Outputs = append(tx.Outputs, RefundTxOutput{Value: out.Value, PkScript: hex.EncodeToString(out.PkScript)})
+	}
+	return tx, nil
+}
+
+// DecodeRefundTx decodes the refund transaction a package binds
+func (pkg *VTEPackageV2) DecodeRefundTx() (*RefundTx, error) {
+	raw, err := hex.DecodeString(pkg.Context.RefundTxHex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid refund tx hex: %v", ErrRefundTxInvalid, err)
+	}
+	if len(raw) == 0 {
+		return nil, fmt.Errorf("%w: package binds no refund tx", ErrRefundTxInvalid)
+	}
+	return DecodeRefundTx(raw)
+}
+
+// RefundPolicy checks the refund transaction of a package. The transaction
+// must parse; its nLockTime must be a time within LockTimeTolerance of the
+// package unlock time (see PackageUnlockTime) and be enforced by some input;
+// with PayTo set, every output must pay one of those scripts.
+type RefundPolicy struct {
+	LockTimeTolerance Duration `json:"locktime_tolerance,omitempty" yaml:"locktime_tolerance"`
+	PayTo             []string `json:"pay_to,omitempty" yaml:"pay_to"` // hex scriptPubKeys
+}
+
+func (r *RefundPolicy) validate() error {
+	if r.LockTimeTolerance < 0 {
+		return fmt.Errorf("%w: policy refund locktime_tolerance is negative", ErrInvalidInput)
+	}
+	for _, script := range r.PayTo {
+		if _, err := hex.DecodeString(script); err != nil || script == "" {
+			return fmt.Errorf("%w: policy refund pay_to %q is not a hex script", ErrInvalidInput, script)
+		}
+	}
+	return nil
+}
+
+// check runs the policy against pkg
+func (r *RefundPolicy) check(pkg *VTEPackageV2) error {
+	tx, err := pkg.DecodeRefundTx()
+	if err != nil {
+		return err
+	}
+
+	lockTime, isTime := tx.LockTimeUTC()
+	if !isTime {
+		return fmt.Errorf("%w: nLockTime %d is a block height, not a time", ErrRefundTxMismatch, tx.LockTime)
+	}
+	if !tx.LockTimeEnforced() {
+		return fmt.Errorf("%w: every input is final, so nLockTime is not enforced", ErrRefundTxMismatch)
+	}
+	unlockAt, err := PackageUnlockTime(pkg)
+	if err != nil {
+		return err
+	}
+	if diff := lockTime.Sub(unlockAt).Abs(); diff > time.Duration(r.LockTimeTolerance) {
+		return fmt.Errorf("%w: nLockTime %s is %s from the unlock time %s", ErrRefundTxMismatch,
+			lockTime.Format(time.RFC3339), diff, unlockAt.UTC().Format(time.RFC3339))
+	}
+
+	if len(r.PayTo) > 0 {
+		for i, out := range tx.Outputs {
+			if !slices.ContainsFunc(r.PayTo, func(script string) bool { return strings.EqualFold(script, out.PkScript) }) {
+				return fmt.Errorf("%w: output %d pays %s, not an expected script", ErrRefundTxMismatch, i, out.PkScript)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package vte
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/drand/drand/v2/crypto"
+)
+
+// refundTx builds a one-input refund transaction paying script
+func refundTx(t *testing.T, lockTime time.Time, sequence uint32, script []byte) []byte {
+	t.Helper()
+	tx := wire.NewMsgTx(2)
+	in := wire.NewTxIn(&wire.OutPoint{Hash: chainhash.Hash{1, 2, 3}, Index: 1}, nil, nil)
+	in.Sequence = sequence
+	tx.AddTxIn(in)
+	tx.AddTxOut(wire.NewTxOut(49000, script))
+	tx.LockTime = uint32(lockTime.Unix())
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecodeRefundTx(t *testing.T) {
+	script, _ := hex.DecodeString("0014" + "00112233445566778899aabbccddeeff00112233")
+	lockTime := time.Unix(1700000000, 0)
+	raw := refundTx(t, lockTime, wire.MaxTxInSequenceNum-1, script)
+
+	tx, err := DecodeRefundTx(raw)
+	if err != nil {
+		t.Fatalf("DecodeRefundTx failed: %v", err)
+	}
+	var msg wire.MsgTx
+	_ = msg.Deserialize(bytes.NewReader(raw))
+	if tx.TxID != msg.TxHash().String() || tx.Version != 2 || len(tx.Inputs) != 1 || tx.Outputs[0].Value != 49000 {
+		t.Fatalf("Decoded %+v", tx)
+	}
+	if at, ok := tx.LockTimeUTC(); !ok || !at.Equal(lockTime) || !tx.LockTimeEnforced() {
+		t.Fatalf("Locktime %v %v, enforced %v", at, ok, tx.LockTimeEnforced())
+	}
+	if final, _ := DecodeRefundTx(refundTx(t, lockTime, wire.MaxTxInSequenceNum, script)); final.LockTimeEnforced() {
+		t.Fatal("Final inputs should not enforce the locktime")
+	}
+
+	for name, bad := range map[string][]byte{
+		"empty":     nil,
+		"garbage":   []byte("not a transaction"),
+		"truncated": raw[:len(raw)-3],
+		"trailing":  append(append([]byte(nil), raw...), 0),
+	} {
+		if _, err := DecodeRefundTx(bad); !errors.Is(err, ErrRefundTxInvalid) {
+			t.Errorf("%s: expected ErrRefundTxInvalid, got %v", name, err)
+		}
+	}
+	if ErrorClass(ErrRefundTxInvalid) != "error_refund_tx_invalid" {
+		t.Fatal("ErrRefundTxInvalid has no class")
+	}
+}
+
+func TestRefundPolicy(t *testing.T) {
+	network, _, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	useBeaconCache(t, NewBeaconCache(NewMemoryBeaconStore()))
+	if err := Beacons.AddChainInfo([]byte(network.ChainInfoJSON()), chainHash); err != nil {
+		t.Fatal(err)
+	}
+	round := network.LatestRound() + 50
+	unlockAt := roundTimeOf(network, round)
+	script, _ := hex.DecodeString("0014" + "00112233445566778899aabbccddeeff00112233")
+
+	generate := func(refund []byte) *VTEPackageV2 {
+		pkg, err := GenerateVTE(&GenerateVTEParams{
+			Round:          round,
+			ChainHash:      chainHash,
+			FormatID:       "tlock_v1_age_pairing",
+			SessionID:      "refund",
+			R2:             PlaintextToR2("refund"),
+			RefundTx:       refund,
+			DrandEndpoints: []string{endpoint},
+		})
+		if err != nil {
+			t.Fatalf("GenerateVTE failed: %v", err)
+		}
+		return pkg
+	}
+	policy := func() *VerificationPolicy {
+		p := DefaultPolicy()
+		p.Require.Commitment = false
+		p.Refund = &RefundPolicy{LockTimeTolerance: Duration(time.Hour), PayTo: []string{hex.EncodeToString(script)}}
+		return p
+	}
+
+	good := generate(refundTx(t, unlockAt.Add(30*time.Minute), 0, script))
+	if err := policy().Verify(good); err != nil {
+		t.Fatalf("Refund policy rejected a good package: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name   string
+		refund []byte
+		err    error
+	}{
+		{"unparseable", []byte("refund"), ErrRefundTxInvalid},
+		{"missing", nil, ErrRefundTxInvalid},
+		{"locktime far off", refundTx(t, unlockAt.Add(2*time.Hour), 0, script), ErrRefundTxMismatch},
+		{"final inputs", refundTx(t, unlockAt, wire.MaxTxInSequenceNum, script), ErrRefundTxMismatch},
+		{"block height", refundTx(t, time.Unix(800000, 0), 0, script), ErrRefundTxMismatch},
+		{"other script", refundTx(t, unlockAt, 0, []byte{0x51}), ErrRefundTxMismatch},
+	} {
+		pkg := generate(tc.refund)
+		if err := policy().Verify(pkg); !errors.Is(err, tc.err) {
+			t.Errorf("%s: Verify returned %v, want %v", tc.name, err, tc.err)
+		}
+		if c := policy().Report(pkg).Check(CheckRefundTx); c.Status != CheckFail {
+			t.Errorf("%s: refund_tx check %+v", tc.name, c)
+		}
+	}
+
+	if _, err := ParseVerificationPolicy([]byte("refund:\n  pay_to: [xyz]\n")); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Bad pay_to accepted: %v", err)
+	}
+	p, err := ParseVerificationPolicy([]byte(`{"refund": {"locktime_tolerance": "10m", "pay_to": ["0014aa"]}}`))
+	if err != nil || time.Duration(p.Refund.LockTimeTolerance) != 10*time.Minute {
+		t.Fatalf("Parsed refund policy %+v (%v)", p, err)
+	}
+}
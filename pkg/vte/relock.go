@@ -0,0 +1,147 @@
+package vte
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"vte-tlock/circuits/equality"
+)
+
+// RelockVersion is the version tag of RelockProof
+const RelockVersion = "vte-relock/1"
+
+// RelockProof links a relocked package to the package it renews: both expose
+// the same R2 and a Groth16 proof shows both commitments hide the same r2
+// under their own ctx hashes
+type RelockProof struct {
+	Version    string `json:"version"`    // "vte-relock/1"
+	System     string `json:"system"`     // "groth16_bn254"
+	CircuitID  string `json:"circuit_id"` // equality circuit VK hash
+	OldCtxHash []byte `json:"old_ctx_hash"`
+	NewCtxHash []byte `json:"new_ctx_hash"`
+	ProofB64   []byte `json:"proof_b64"`
+}
+
+// RelockResult is the renewed package and its link to the old one
+type RelockResult struct {
+	Package *VTEPackageV2 `json:"package"`
+	Proof   *RelockProof  `json:"relock_proof"`
+}
+
+// Relock re-encrypts the secret of oldPkg to the later newRound. Only the
+// creator can do this: r2 must open the old commitment and match its R2.
+//
+// The new package keeps the chain, format, context schema and fields, session
+// ID and refund tx of oldPkg and always carries a commitment proof. params
+// only says how to encrypt (DrandEndpoints, ChainInfoJSON, Network,
+// TrustedChain, Rand) and may be nil for chains pinned in the network
+// registry; its other fields are ignored.
+// Multi-network packages cannot be relocked.
+func Relock(oldPkg *VTEPackageV2, r2 []byte, newRound uint64, params *GenerateVTEParams) (*RelockResult, error) {
+	if oldPkg.Lock != nil {
+		return nil, fmt.Errorf("%w: relock supports single-network packages only, this one has a %s lock", ErrInvalidInput, oldPkg.Lock.Mode)
+	}
+	if newRound <= oldPkg.Tlock.Round {
+		return nil, fmt.Errorf("%w: relock round %d is not after round %d", ErrRoundOutOfRange, newRound, oldPkg.Tlock.Round)
+	}
+	if _, err := checkDecrypted(oldPkg, r2); err != nil {
+		return nil, err
+	}
+	compressedR2, err := ComputeR2Point(r2)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(compressedR2, oldPkg.Public.R2.Value) {
+		return nil, fmt.Errorf("%w: r2 does not match the package R2", ErrRelockMismatch)
+	}
+	refundTx, err := hex.DecodeString(oldPkg.Context.RefundTxHex)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid refund tx hex: %v", ErrInvalidInput, err)
+	}
+
+	next := GenerateVTEParams{}
+	if params != nil {
+		next = *params
+	}
+	next.Round = newRound
+	next.ChainHash = oldPkg.Tlock.DrandChainHash
+	next.FormatID = oldPkg.Tlock.CiphertextFormatID
+	next.SessionID = oldPkg.Context.SessionID
+	next.RefundTx = refundTx
+	next.CtxSchema = oldPkg.Context.Schema
+	next.CtxFields = oldPkg.Context.Values
+	next.R2 = r2
+	next.CtxHash = nil
+	next.GenerateProof = true
+
+	pkg, err := GenerateVTE(&next)
+	if err != nil {
+		return nil, fmt.Errorf("relocked package generation failed: %w", err)
+	}
+
+	proof, err := equality.ProveWithRand(nil, &equality.WitnessInput{
+		R2:         r2,
+		CtxHashOld: oldPkg.Context.CtxHash,
+		COld:       oldPkg.Public.Commitment,
+		CtxHashNew: pkg.Context.CtxHash,
+		CNew:       pkg.Public.Commitment,
+	}, next.Rand)
+	if err != nil {
+		return nil, fmt.Errorf("equality proof generation failed: %w", err)
+	}
+
+	return &RelockResult{
+		Package: pkg,
+		Proof: &RelockProof{
+			Version:    RelockVersion,
+			System:     "groth16_bn254",
+			CircuitID:  equality.CircuitID,
+			OldCtxHash: oldPkg.Context.CtxHash,
+			NewCtxHash: pkg.Context.CtxHash,
+			ProofB64:   proof,
+		},
+	}, nil
+}
+
+// VerifyRelock checks that newPkg renews oldPkg: same chain, a later round,
+// the same R2, and a valid equality proof between the two commitments. It
+// only checks the link; verify each package on its own with VerifyVTE.
+// Multi-network packages are rejected, as Relock never makes them.
+func VerifyRelock(oldPkg, newPkg *VTEPackageV2, proof *RelockProof) error {
+	if oldPkg.Lock != nil || newPkg.Lock != nil {
+		return fmt.Errorf("%w: relock supports single-network packages only", ErrInvalidInput)
+	}
+	if proof == nil || len(proof.ProofB64) == 0 {
+		return fmt.Errorf("%w: relock", ErrMissingProof)
+	}
+	if proof.Version != RelockVersion {
+		return fmt.Errorf("%w: have %s, want %s", ErrVersionMismatch, proof.Version, RelockVersion)
+	}
+	if proof.CircuitID != equality.CircuitID {
+		return fmt.Errorf("%w: relock proof claims %s, verifiable only with %s", ErrCircuitIDMismatch, proof.CircuitID, equality.CircuitID)
+	}
+
+	for _, pkg := range []*VTEPackageV2{oldPkg, newPkg} {
+		if err := VerifyCtxHashBinding(pkg); err != nil {
+			return fmt.Errorf("ctx_hash binding validation failed: %w", err)
+		}
+	}
+	if !bytes.Equal(oldPkg.Tlock.DrandChainHash, newPkg.Tlock.DrandChainHash) {
+		return fmt.Errorf("%w: relocked to chain %x from %x", ErrNetworkMismatch, newPkg.Tlock.DrandChainHash, oldPkg.Tlock.DrandChainHash)
+	}
+	if newPkg.Tlock.Round <= oldPkg.Tlock.Round {
+		return fmt.Errorf("%w: relocked round %d is not after round %d", ErrRoundMismatch, newPkg.Tlock.Round, oldPkg.Tlock.Round)
+	}
+	if !bytes.Equal(proof.OldCtxHash, oldPkg.Context.CtxHash) || !bytes.Equal(proof.NewCtxHash, newPkg.Context.CtxHash) {
+		return fmt.Errorf("%w: relock proof is for other packages", ErrCtxHashMismatch)
+	}
+	if len(oldPkg.Public.R2.Value) == 0 || !bytes.Equal(oldPkg.Public.R2.Value, newPkg.Public.R2.Value) {
+		return fmt.Errorf("%w: packages expose different R2", ErrRelockMismatch)
+	}
+
+	if err := equality.VerifyWithEmbeddedVK(proof.ProofB64, oldPkg.Context.CtxHash, oldPkg.Public.Commitment, newPkg.Context.CtxHash, newPkg.Public.Commitment); err != nil {
+		return fmt.Errorf("%w: relock proof: %v", ErrProofInvalid, err)
+	}
+	return nil
+}
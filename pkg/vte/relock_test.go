@@ -0,0 +1,127 @@
+package vte
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+)
+
+func TestRelock(t *testing.T) {
+	network, clock, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	r2 := PlaintextToR2("renewable")
+	params := &GenerateVTEParams{DrandEndpoints: []string{endpoint}}
+
+	old, err := GenerateVTE(&GenerateVTEParams{
+		Round:          network.LatestRound() + 5,
+		ChainHash:      chainHash,
+		FormatID:       "tlock_v1_age_pairing",
+		SessionID:      "dead-mans-switch",
+		R2:             r2,
+		RefundTx:       []byte{0x02, 0x00},
+		CtxSchema:      CtxSchemaV2,
+		DrandEndpoints: []string{endpoint},
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE failed: %v", err)
+	}
+
+	newRound := old.Tlock.Round + 20
+	relocked, err := Relock(old, r2, newRound, params)
+	if err != nil {
+		t.Fatalf("Relock failed: %v", err)
+	}
+	pkg := relocked.Package
+	if pkg.Tlock.Round != newRound || pkg.Context.SessionID != old.Context.SessionID || pkg.Context.RefundTxHex != old.Context.RefundTxHex ||
+		pkg.Context.Schema != CtxSchemaV2 {
+		t.Fatalf("Relocked package did not keep the old bindings: %+v", pkg.Context)
+	}
+	if err := VerifyRelock(old, pkg, relocked.Proof); err != nil {
+		t.Fatalf("VerifyRelock failed: %v", err)
+	}
+	if err := VerifyVTE(pkg, newRound, chainHash, "", old.Context.SessionID, nil); err != nil {
+		t.Fatalf("Relocked package does not verify: %v", err)
+	}
+
+	// The old round no longer opens the new package; the new round does
+	info := network.Info()
+	roundTime := func(round uint64) time.Time {
+		return time.Unix(common.TimeOfRound(info.Period, info.GenesisTime, round), 0)
+	}
+	clock.Set(roundTime(old.Tlock.Round))
+	ctx := context.Background()
+	if _, err := DecryptVTE(ctx, pkg, []string{endpoint}); err == nil {
+		t.Fatal("Relocked package opened at the old round")
+	}
+	clock.Set(roundTime(newRound))
+	result, err := DecryptVTE(ctx, pkg, []string{endpoint})
+	if err != nil {
+		t.Fatalf("DecryptVTE failed: %v", err)
+	}
+	if !bytes.Equal(result.R2, r2) {
+		t.Fatalf("Relocked r2 %x, want %x", result.R2, r2)
+	}
+
+	t.Run("creator checks", func(t *testing.T) {
+		if _, err := Relock(old, PlaintextToR2("other"), newRound, params); !errors.Is(err, ErrCommitmentMismatch) {
+			t.Fatalf("Expected ErrCommitmentMismatch for the wrong r2, got %v", err)
+		}
+		if _, err := Relock(old, r2, old.Tlock.Round, params); !errors.Is(err, ErrRoundOutOfRange) {
+			t.Fatalf("Expected ErrRoundOutOfRange for the same round, got %v", err)
+		}
+		locked := *old
+		locked.Lock = &LockInfo{Mode: LockAnyOf}
+		if _, err := Relock(&locked, r2, newRound, params); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("Expected ErrInvalidInput for a multi-network package, got %v", err)
+		}
+	})
+
+	t.Run("multi-network packages", func(t *testing.T) {
+		locked := *pkg
+		locked.Lock = &LockInfo{Mode: LockAnyOf}
+		if err := VerifyRelock(old, &locked, relocked.Proof); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("Expected ErrInvalidInput for a multi-network new package, got %v", err)
+		}
+		if err := VerifyRelock(&locked, pkg, relocked.Proof); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("Expected ErrInvalidInput for a multi-network old package, got %v", err)
+		}
+	})
+
+	t.Run("forged links", func(t *testing.T) {
+		// Same R2 and round, but not the package the proof was made for
+		twin, err := GenerateVTE(&GenerateVTEParams{
+			Round: newRound, ChainHash: chainHash, SessionID: "dead-mans-switch", R2: r2,
+			RefundTx: []byte{0x02, 0x00}, DrandEndpoints: []string{endpoint},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := VerifyRelock(old, twin, relocked.Proof); !errors.Is(err, ErrCtxHashMismatch) {
+			t.Fatalf("Expected ErrCtxHashMismatch, got %v", err)
+		}
+		retargeted := *relocked.Proof
+		retargeted.NewCtxHash = twin.Context.CtxHash
+		if err := VerifyRelock(old, twin, &retargeted); !errors.Is(err, ErrProofInvalid) {
+			t.Fatalf("Expected ErrProofInvalid for a retargeted proof, got %v", err)
+		}
+
+		// -R2 differs from R2 only in the SEC1 prefix
+		swapped := *pkg
+		swapped.Public.R2.Value = append([]byte{pkg.Public.R2.Value[0] ^ 0x01}, pkg.Public.R2.Value[1:]...)
+		if err := VerifyRelock(old, &swapped, relocked.Proof); !errors.Is(err, ErrRelockMismatch) {
+			t.Fatalf("Expected ErrRelockMismatch for another R2, got %v", err)
+		}
+		if err := VerifyRelock(pkg, old, relocked.Proof); err == nil {
+			t.Fatal("A relock verified backwards")
+		}
+		if err := VerifyRelock(old, pkg, nil); !errors.Is(err, ErrMissingProof) {
+			t.Fatalf("Expected ErrMissingProof, got %v", err)
+		}
+	})
+}
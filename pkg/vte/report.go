@@ -0,0 +1,142 @@
+package vte
+
+import (
+	"encoding/hex"
+	"time"
+)
+
+// ReportVersion identifies the VerificationReport JSON layout
+const ReportVersion = "vte-verify-report/1"
+
+// CheckStatus is the outcome of one check in a VerificationReport
+type CheckStatus string
+
+const (
+	CheckPass    CheckStatus = "pass"
+	CheckFail    CheckStatus = "fail"
+	CheckSkipped CheckStatus = "skipped" // nothing to check against, or no verifier
+)
+
+// Check names, in the order a VerificationPolicy runs them
+const (
+	CheckVersion         = "version"
+	CheckChain           = "chain"
+	CheckRound           = "round"
+	CheckCtxBinding      = "ctx_binding"
+	CheckCapsuleHash     = "capsule_hash"
+	CheckPolicy          = "policy" // session and refund tx
+	CheckRefundTx        = "refund_tx"
+	CheckFormat          = "format"
+	CheckUnlockHorizon   = "unlock_horizon"
+	CheckCommitmentProof = "commitment_proof"
+	CheckSchnorr         = "schnorr"
+	CheckSecpZK          = "secp_zk"
+	CheckTLE             = "tle"
+)
+
+// CheckResult is one check of a VerificationReport. ErrorClass is the
+// ErrorClass of a failure; CircuitID is the circuit whose embedded key
+// verified the proof. UnverifiedCapsules lists the capsules (by index, 0 for
+// a single-capsule package) whose encryption of r2 the check did not verify.
+type CheckResult struct {
+	Name               string      `json:"name"`
+	Status             CheckStatus `json:"status"`
+	Reason             string      `json:"reason,omitempty"`
+	ErrorClass         string      `json:"error_class,omitempty"`
+	DurationUs         int64       `json:"duration_us"`
+	CircuitID          string      `json:"circuit_id,omitempty"`
+	UnverifiedCapsules []int       `json:"unverified_capsules,omitempty"`
+
+	err error
+}
+
+// VerificationReport records the checks a verification ran. OK is true when
+// no check failed; ErrorClass is the class of the first failure.
+type VerificationReport struct {
+	Version    string        `json:"version"`
+	OK         bool          `json:"ok"`
+	ErrorClass string        `json:"error_class"`
+	CtxHash    string        `json:"ctx_hash"`
+	DurationUs int64         `json:"duration_us"`
+	Checks     []CheckResult `json:"checks"`
+}
+
+// Err returns the error of the first failed check, or nil
+func (r *VerificationReport) Err() error {
+	for _, c := range r.Checks {
+		if c.Status == CheckFail {
+			return c.err
+		}
+	}
+	return nil
+}
+
+// Check returns the named check, or nil
+func (r *VerificationReport) Check(name string) *CheckResult {
+	for i := range r.Checks {
+		if r.Checks[i].Name == name {
+			return &r.Checks[i]
+		}
+	}
+	return nil
+}
+
+// errSkipped makes a check report itself as skipped, with the message as reason
+type errSkipped string
+
+func (e errSkipped) Error() string { return string(e) }
+
+// VerifyVTEReport runs the checks of VerifyVTE without stopping at the
+// first failure. The expectations have the same meaning as for VerifyVTE;
+// empty ones skip their check. report.Err() is nil exactly when every check
+// passed or was skipped.
+//
+// A passing report does not cover the encryption: the TLE check is skipped
+// and lists every capsule, each capsule of any_of and threshold locks too,
+// in UnverifiedCapsules (see LockInfo).
+func VerifyVTEReport(
+	pkg *VTEPackageV2,
+	expectedRound uint64,
+	expectedChainHash []byte,
+	expectedFormatID string,
+	expectedSessionID string,
+	expectedRefundTx []byte,
+) *VerificationReport {
+	return expectationPolicy(expectedRound, expectedChainHash, expectedFormatID, expectedSessionID, expectedRefundTx).Report(pkg)
+}
+
+// namedCheck is one step of a verification; returning errSkipped skips it
+type namedCheck struct {
+	name  string
+	check func(c *CheckResult) error
+}
+
+// newReport runs checks in order. With failFast it stops at the first
+// failure, leaving the remaining checks out of the report.
+func newReport(pkg *VTEPackageV2, checks []namedCheck, failFast bool) *VerificationReport {
+	start := time.Now()
+	report := &VerificationReport{Version: ReportVersion, CtxHash: hex.EncodeToString(pkg.Context.CtxHash)}
+	for _, nc := range checks {
+		c := CheckResult{Name: nc.name}
+		checkStart := time.Now()
+		err := nc.check(&c)
+		c.DurationUs = time.Since(checkStart).Microseconds()
+		switch skip, ok := err.(errSkipped); {
+		case ok:
+			c.Status, c.Reason = CheckSkipped, string(skip)
+		case err != nil:
+			c.Status, c.Reason, c.ErrorClass, c.err = CheckFail, err.Error(), ErrorClass(err), err
+		default:
+			c.Status = CheckPass
+		}
+		report.Checks = append(report.Checks, c)
+		if failFast && c.Status == CheckFail {
+			break
+		}
+	}
+
+	report.ErrorClass = ErrorClass(report.Err())
+	report.OK = report.ErrorClass == "success"
+	report.DurationUs = time.Since(start).Microseconds()
+	return report
+}
@@ -0,0 +1,106 @@
+package vte
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/drand/drand/v2/crypto"
+
+	"vte-tlock/circuits/commitment"
+)
+
+func TestVerifyVTEReport(t *testing.T) {
+	network, _, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	round := network.LatestRound() + 20
+	refundTx := []byte{1, 2, 3}
+	pkg, err := GenerateVTE(&GenerateVTEParams{
+		Round:          round,
+		ChainHash:      chainHash,
+		FormatID:       "tlock_v1_age_pairing",
+		SessionID:      "report",
+		R2:             PlaintextToR2("report"),
+		RefundTx:       refundTx,
+		DrandEndpoints: []string{endpoint},
+		GenerateProof:  true,
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE failed: %v", err)
+	}
+
+	report := VerifyVTEReport(pkg, round, chainHash, "tlock_v1_age_pairing", "report", refundTx)
+	if !report.OK || report.Err() != nil || report.ErrorClass != "success" {
+		t.Fatalf("Expected a passing report, got %+v", report)
+	}
+	want := []string{CheckVersion, CheckChain, CheckRound, CheckCtxBinding, CheckCapsuleHash, CheckPolicy, CheckRefundTx, CheckFormat, CheckUnlockHorizon, CheckCommitmentProof, CheckSchnorr, CheckSecpZK, CheckTLE}
+	if len(report.Checks) != len(want) {
+		t.Fatalf("Got %d checks, want %d", len(report.Checks), len(want))
+	}
+	for i, c := range report.Checks {
+		status := CheckPass
+		if c.Name == CheckTLE || c.Name == CheckSecpZK || c.Name == CheckUnlockHorizon || c.Name == CheckRefundTx {
+			status = CheckSkipped
+		}
+		if c.Name != want[i] || c.Status != status {
+			t.Errorf("Check %d: %s %s, want %s %s", i, c.Name, c.Status, want[i], status)
+		}
+	}
+	if c := report.Check(CheckCommitmentProof); c.CircuitID != commitment.GetEmbeddedCircuitID() {
+		t.Errorf("Commitment check used circuit %q", c.CircuitID)
+	}
+	if c := report.Check(CheckTLE); len(c.UnverifiedCapsules) != 1 || c.UnverifiedCapsules[0] != 0 {
+		t.Errorf("TLE check: %+v, want the capsule unverified", c)
+	}
+
+	// Nothing expected: the policy checks are skipped
+	loose := VerifyVTEReport(pkg, 0, nil, "", "", nil)
+	for _, name := range []string{CheckChain, CheckRound, CheckPolicy} {
+		if c := loose.Check(name); c.Status != CheckSkipped || c.Reason == "" {
+			t.Errorf("%s: %+v, want skipped with a reason", name, c)
+		}
+	}
+
+	// Every failure is recorded, not just the first
+	tampered := *pkg
+	tampered.Version = "vte-tlock/0.1"
+	tampered.Proofs.SecpSchnorr.SignatureB64 = make([]byte, 64)
+	report = VerifyVTEReport(&tampered, round+1, chainHash, "", "other", nil)
+	failed := map[string]string{}
+	for _, c := range report.Checks {
+		if c.Status == CheckFail {
+			failed[c.Name] = c.ErrorClass
+		}
+	}
+	wantFailed := map[string]string{
+		CheckVersion: "error_version_mismatch",
+		CheckRound:   "error_round_mismatch",
+		CheckSchnorr: "error_proof_invalid",
+		CheckPolicy:  "error_session_mismatch",
+	}
+	if len(failed) != len(wantFailed) {
+		t.Fatalf("Failed checks %v, want %v", failed, wantFailed)
+	}
+	for name, class := range wantFailed {
+		if failed[name] != class {
+			t.Errorf("%s: class %q, want %q", name, failed[name], class)
+		}
+	}
+	if report.OK || report.ErrorClass != "error_version_mismatch" || !errors.Is(report.Err(), ErrVersionMismatch) {
+		t.Fatalf("Report should fail with the first error: %+v", report)
+	}
+
+	// The report is plain JSON
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded VerificationReport
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Version != ReportVersion || len(decoded.Checks) != len(want) || decoded.Checks[0].Status != CheckFail {
+		t.Fatalf("JSON round trip lost data: %s", data)
+	}
+}
@@ -0,0 +1,204 @@
+package vte
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/drand/drand/v2/common"
+)
+
+// DefaultMaxHorizon bounds how far out a Scheduler accepts rounds. Anything
+// beyond it is almost certainly a unit mistake (ms vs s, round vs time).
+const DefaultMaxHorizon = 5 * 365 * 24 * time.Hour
+
+// Scheduler maps unlock times to drand rounds with the same arithmetic as
+// drand itself: round r is published at genesis + (r-1)*period, and never
+// earlier. SafetyMargin covers clock skew and beacon publication delay: a
+// beacon is only counted on SafetyMargin after its nominal round time.
+type Scheduler struct {
+	Network      DrandNetworkInfo
+	SafetyMargin time.Duration
+	MaxHorizon   time.Duration    // Zero uses DefaultMaxHorizon
+	Now          func() time.Time // Nil uses time.Now
+}
+
+// NewScheduler returns a scheduler for a network with the given safety margin
+func NewScheduler(network DrandNetworkInfo, safetyMargin time.Duration) (*Scheduler, error) {
+	s := &Scheduler{Network: network, SafetyMargin: safetyMargin}
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Scheduler) validate() error {
+	if s.Network.Period <= 0 {
+		return fmt.Errorf("%w: network period must be positive", ErrInvalidInput)
+	}
+	if s.SafetyMargin < 0 || s.MaxHorizon < 0 {
+		return fmt.Errorf("%w: safety margin and horizon must not be negative", ErrInvalidInput)
+	}
+	return nil
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func (s *Scheduler) period() time.Duration {
+	return time.Duration(s.Network.Period) * time.Second
+}
+
+func (s *Scheduler) horizon() time.Duration {
+	if s.MaxHorizon == 0 {
+		return DefaultMaxHorizon
+	}
+	return s.MaxHorizon
+}
+
+// roundTime is the nominal publication time of round, as drand computes it
+func (s *Scheduler) roundTime(round uint64) time.Time {
+	return time.Unix(common.TimeOfRound(s.period(), s.Network.GenesisTime, round), 0).UTC()
+}
+
+// CurrentRound is the latest round drand has published at the scheduler's now
+func (s *Scheduler) CurrentRound() uint64 {
+	return common.CurrentRound(s.now().Unix(), s.period(), s.Network.GenesisTime)
+}
+
+// ValidateRound rejects round 0, rounds that are already published and rounds
+// further out than the horizon
+func (s *Scheduler) ValidateRound(round uint64) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	if round == 0 {
+		return fmt.Errorf("%w: round 0 is never published", ErrRoundOutOfRange)
+	}
+	now := s.now()
+	at := s.roundTime(round)
+	if !at.After(now) {
+		return fmt.Errorf("%w: round %d was published at %s", ErrRoundOutOfRange, round, at.Format(time.RFC3339))
+	}
+	// TimeOfRound saturates instead of overflowing, so huge rounds land here
+	if at.Sub(now) > s.horizon() {
+		return fmt.Errorf("%w: round %d is more than %s out", ErrRoundOutOfRange, round, s.horizon())
+	}
+	return nil
+}
+
+// EarliestUnlock returns when the beacon for round can be relied on: its
+// nominal round time plus the safety margin. Nobody can decrypt before the
+// nominal time, so a refund locktime at or after the returned time never opens
+// before the secret is out.
+func (s *Scheduler) EarliestUnlock(round uint64) (time.Time, error) {
+	if err := s.ValidateRound(round); err != nil {
+		return time.Time{}, err
+	}
+	return s.roundTime(round).Add(s.SafetyMargin), nil
+}
+
+// LatestSafeRound returns the last round whose beacon is out, safety margin
+// included, by deadline. Encrypting to it guarantees the secret is available
+// before a refund locktime at deadline.
+func (s *Scheduler) LatestSafeRound(deadline time.Time) (uint64, error) {
+	if err := s.validate(); err != nil {
+		return 0, err
+	}
+	latest := deadline.Add(-s.SafetyMargin)
+	if latest.Unix() < s.Network.GenesisTime {
+		return 0, fmt.Errorf("%w: deadline %s minus margin is before genesis", ErrRoundOutOfRange, deadline.UTC().Format(time.RFC3339))
+	}
+	round := common.CurrentRound(latest.Unix(), s.period(), s.Network.GenesisTime)
+	if err := s.ValidateRound(round); err != nil {
+		return 0, fmt.Errorf("no safe round before %s: %w", deadline.UTC().Format(time.RFC3339), err)
+	}
+	return round, nil
+}
+
+// FirstRoundAt returns the first round whose nominal time is at or after t.
+// A package locked to it never opens before t; LatestSafeRound is the other
+// bound, for a round that must be out by a deadline. It does not validate
+// the round, so it also places past times.
+func (s *Scheduler) FirstRoundAt(t time.Time) (uint64, error) {
+	if err := s.validate(); err != nil {
+		return 0, err
+	}
+	if t.Unix() < s.Network.GenesisTime {
+		return 1, nil
+	}
+	round := common.CurrentRound(t.Unix(), s.period(), s.Network.GenesisTime)
+	if s.roundTime(round).Before(t) {
+		round++
+	}
+	return round, nil
+}
+
+// ParseTime reads an unlock time as an ISO-8601 / RFC 3339 timestamp
+// ("2026-01-02T15:04:05Z"), an ISO-8601 duration from now ("PT90M",
+// "P1DT12H") or a Go duration from now ("90m")
+func (s *Scheduler) ParseTime(input string) (time.Time, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return time.Time{}, fmt.Errorf("%w: empty time", ErrInvalidInput)
+	}
+	if t, err := time.Parse(time.RFC3339Nano, input); err == nil {
+		return t.UTC(), nil
+	}
+	if d, err := ParseDuration(input); err == nil {
+		return s.now().Add(d).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %q is neither an ISO-8601 time nor a duration", ErrInvalidInput, input)
+}
+
+// ParseDuration reads an ISO-8601 duration (weeks, days and time parts; no
+// years or months, which have no fixed length) or a Go duration string
+func ParseDuration(input string) (time.Duration, error) {
+	if !strings.HasPrefix(strings.ToUpper(input), "P") {
+		d, err := time.ParseDuration(input)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		if d < 0 {
+			return 0, fmt.Errorf("%w: negative duration %s", ErrInvalidInput, input)
+		}
+		return d, nil
+	}
+
+	m := isoDuration.FindStringSubmatch(strings.ToUpper(input))
+	if m == nil || input == "P" || strings.HasSuffix(strings.ToUpper(input), "T") {
+		return 0, fmt.Errorf("%w: invalid ISO-8601 duration %q", ErrInvalidInput, input)
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var total time.Duration
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		v, err := strconv.ParseFloat(strings.Replace(m[i+1], ",", ".", 1), 64)
+		if err != nil || v > float64(DefaultMaxHorizon/unit)*10 {
+			return 0, fmt.Errorf("%w: invalid ISO-8601 duration %q", ErrInvalidInput, input)
+		}
+		total += time.Duration(v * float64(unit))
+	}
+	return total, nil
+}
+
+var isoDuration = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+(?:[.,]\d+)?)S)?)?$`)
+
+// Schedule returns the scheduler for a registered network, by name or hex
+// chain hash
+func Schedule(nameOrHash string, safetyMargin time.Duration) (*Scheduler, error) {
+	info, err := LookupNetworkInfo(nameOrHash)
+	if err != nil {
+		return nil, err
+	}
+	return NewScheduler(info, safetyMargin)
+}
@@ -0,0 +1,183 @@
+package vte
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+
+	"vte-tlock/internal/drandtest"
+	"vte-tlock/pkg/drandsim"
+)
+
+// TestScheduleMatchesDrand checks our round arithmetic against drand's own
+// round calculator, on both sides of every round boundary
+func TestScheduleMatchesDrand(t *testing.T) {
+	for _, period := range []int64{3, 30} {
+		network := DrandNetworkInfo{GenesisTime: 1692803367, Period: period}
+		p := time.Duration(period) * time.Second
+		s := &Scheduler{Network: network, Now: func() time.Time { return time.Unix(network.GenesisTime, 0) }}
+		wasm := &WasmNetwork{genesisTime: network.GenesisTime, period: p}
+
+		// Before genesis both paths agree with drand too
+		if got, want := network.TimeToRound(time.Unix(network.GenesisTime-100, 0)), wasm.Current(time.Unix(network.GenesisTime-100, 0)); got != want {
+			t.Fatalf("period %d: before genesis TimeToRound = %d, WasmNetwork.Current = %d", period, got, want)
+		}
+
+		for round := uint64(1); round < 50; round++ {
+			at := common.TimeOfRound(p, network.GenesisTime, round)
+			if got := network.RoundToTime(round).Unix(); got != at {
+				t.Fatalf("period %d: RoundToTime(%d) = %d, drand says %d", period, round, got, at)
+			}
+			if got, _ := s.FirstRoundAt(time.Unix(at, 0)); got != round {
+				t.Fatalf("period %d: FirstRoundAt(round %d time) = %d", period, round, got)
+			}
+			if got, _ := s.FirstRoundAt(time.Unix(at, 0).Add(time.Millisecond)); got != round+1 {
+				t.Fatalf("period %d: FirstRoundAt just after round %d = %d, want %d", period, round, got, round+1)
+			}
+			for _, now := range []int64{at - 1, at, at + 1} {
+				want := common.CurrentRound(now, p, network.GenesisTime)
+				if got := network.TimeToRound(time.Unix(now, 0)); got != want {
+					t.Fatalf("period %d: TimeToRound(%d) = %d, drand says %d", period, now, got, want)
+				}
+				if got := wasm.Current(time.Unix(now, 0)); got != want {
+					t.Fatalf("period %d: WasmNetwork.Current(%d) = %d, drand says %d", period, now, got, want)
+				}
+			}
+
+			// A deadline exactly at a round time makes that round the latest
+			// safe one; rounds 1 and 2 are too close to now to schedule
+			if round < 3 {
+				continue
+			}
+			if got, err := s.LatestSafeRound(time.Unix(at, 0)); err != nil || got != round {
+				t.Fatalf("period %d: LatestSafeRound(round %d time) = %d, %v", period, round, got, err)
+			}
+			if got, _ := s.LatestSafeRound(time.Unix(at-1, 0)); got != round-1 {
+				t.Fatalf("period %d: LatestSafeRound one second early = %d, want %d", period, got, round-1)
+			}
+		}
+	}
+}
+
+// TestScheduleAgainstBeacons checks the guarantees against a simulated network:
+// no beacon before EarliestUnlock minus the margin, and the LatestSafeRound
+// beacon is out by the deadline minus the margin
+func TestScheduleAgainstBeacons(t *testing.T) {
+	network, clock := drandtest.Network(t, drandsim.Config{Scheme: crypto.SigsOnG1ID})
+	margin := 10 * time.Second
+	s := &Scheduler{
+		Network: DrandNetworkInfo{
+			GenesisTime: network.Info().GenesisTime,
+			Period:      int64(network.Info().Period / time.Second),
+		},
+		SafetyMargin: margin,
+		Now:          clock.Now,
+	}
+	start := clock.Now()
+
+	round := network.LatestRound() + 7
+	unlock, err := s.EarliestUnlock(round)
+	if err != nil {
+		t.Fatalf("EarliestUnlock failed: %v", err)
+	}
+	clock.Set(unlock.Add(-margin - time.Second))
+	if _, err := network.Signature(round); !errors.Is(err, drandsim.ErrRoundNotReached) {
+		t.Fatalf("Beacon for round %d out before its round time: %v", round, err)
+	}
+	clock.Set(unlock.Add(-margin))
+	if _, err := network.Signature(round); err != nil {
+		t.Fatalf("Beacon for round %d not out at its round time: %v", round, err)
+	}
+
+	clock.Set(start)
+	deadline := start.Add(95 * time.Second)
+	safe, err := s.LatestSafeRound(deadline)
+	if err != nil {
+		t.Fatalf("LatestSafeRound failed: %v", err)
+	}
+	if unlock, _ := s.EarliestUnlock(safe); unlock.After(deadline) {
+		t.Fatalf("Round %d unlocks at %s, after deadline %s", safe, unlock, deadline)
+	}
+	if unlock, _ := s.EarliestUnlock(safe + 1); !unlock.After(deadline) {
+		t.Fatalf("Round %d is safe too, LatestSafeRound returned %d", safe+1, safe)
+	}
+	clock.Set(deadline.Add(-margin))
+	if _, err := network.Signature(safe); err != nil {
+		t.Fatalf("Safe round %d not out by deadline minus margin: %v", safe, err)
+	}
+}
+
+func TestScheduleValidation(t *testing.T) {
+	now := time.Unix(1692803367+3000, 0)
+	s := &Scheduler{Network: DefaultQuicknetInfo(), Now: func() time.Time { return now }}
+	current := s.CurrentRound()
+
+	cases := []struct {
+		name  string
+		round uint64
+		err   error
+	}{
+		{"zero", 0, ErrRoundOutOfRange},
+		{"published", current, ErrRoundOutOfRange},
+		{"next", current + 1, nil},
+		{"within horizon", current + uint64(DefaultMaxHorizon/(3*time.Second)), nil},
+		{"beyond horizon", current + uint64(DefaultMaxHorizon/(3*time.Second)) + 2, ErrRoundOutOfRange},
+		{"absurd", 1 << 62, ErrRoundOutOfRange},
+	}
+	for _, tc := range cases {
+		if err := s.ValidateRound(tc.round); !errors.Is(err, tc.err) {
+			t.Errorf("%s: ValidateRound(%d) = %v, want %v", tc.name, tc.round, err, tc.err)
+		}
+	}
+
+	if _, err := s.LatestSafeRound(now.Add(time.Second)); !errors.Is(err, ErrRoundOutOfRange) {
+		t.Fatalf("Expected ErrRoundOutOfRange for a deadline with no future round, got %v", err)
+	}
+	if _, err := s.LatestSafeRound(time.Unix(0, 0)); !errors.Is(err, ErrRoundOutOfRange) {
+		t.Fatalf("Expected ErrRoundOutOfRange for a pre-genesis deadline, got %v", err)
+	}
+	if ErrorClass(s.ValidateRound(0)) != "error_round_out_of_range" {
+		t.Fatalf("ErrorClass = %s", ErrorClass(s.ValidateRound(0)))
+	}
+	if _, err := NewScheduler(DrandNetworkInfo{}, 0); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Expected ErrInvalidInput for a zero period, got %v", err)
+	}
+	if _, err := Schedule("quicknet", -time.Second); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Expected ErrInvalidInput for a negative margin, got %v", err)
+	}
+}
+
+func TestScheduleParseTime(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	s := &Scheduler{Network: DefaultQuicknetInfo(), Now: func() time.Time { return now }}
+
+	cases := map[string]time.Time{
+		"2026-03-01T12:00:00Z":      time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		"2026-03-01T12:00:00+02:00": time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC),
+		"PT90M":                     now.Add(90 * time.Minute),
+		"P1DT12H":                   now.Add(36 * time.Hour),
+		"P2W":                       now.Add(14 * 24 * time.Hour),
+		"PT1.5S":                    now.Add(1500 * time.Millisecond),
+		"pt30s":                     now.Add(30 * time.Second),
+		"90m":                       now.Add(90 * time.Minute),
+	}
+	for input, want := range cases {
+		got, err := s.ParseTime(input)
+		if err != nil {
+			t.Errorf("ParseTime(%q) failed: %v", input, err)
+			continue
+		}
+		if !got.Equal(want) {
+			t.Errorf("ParseTime(%q) = %s, want %s", input, got, want)
+		}
+	}
+
+	for _, input := range []string{"", "P", "PT", "P1Y", "P1M", "-5m", "tomorrow", "2026-03-01"} {
+		if _, err := s.ParseTime(input); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ParseTime(%q) = %v, want ErrInvalidInput", input, err)
+		}
+	}
+}
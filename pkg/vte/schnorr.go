@@ -5,22 +5,56 @@ import (
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+// Schnorr proof schemes. v1 is a BIP-340 signature over ctx_hash with R2 as
+// an x-only key, so it says nothing about the parity of R2. v2 is a
+// Fiat-Shamir proof of knowledge of r2 whose challenge hashes the full
+// points and every field in SchnorrBindFields.
+const (
+	SchnorrSchemeV1 = "schnorr_fs_v1"
+	SchnorrSchemeV2 = "schnorr_fs_v2"
+)
+
+// SchnorrBindFields are the package fields a schnorr_fs_v2 proof binds
+var SchnorrBindFields = []string{"R2", "commitment", "ctx_hash", "capsule_hash"}
+
+var (
+	tagSchnorrV2Nonce     = []byte("VTE/schnorr_fs_v2/nonce")
+	tagSchnorrV2Challenge = []byte("VTE/schnorr_fs_v2/challenge")
+	tagSchnorrV2Capsules  = []byte("VTE/schnorr_fs_v2/capsules")
 )
 
 // ProofSecp represents a Schnorr proof that R2 = r2 * G.
-// Using standard BIP-340 Schnorr signature.
-// It effectively binds R2 to the context.
+// v1 holds a BIP-340 signature (R || s), v2 a challenge and response (e || s).
 type ProofSecp struct {
-	Signature []byte `json:"signature"` // 64 bytes (R || s)
+	Signature []byte `json:"signature"` // 64 bytes
+}
+
+// SchnorrBinding holds the public fields a schnorr_fs_v2 proof binds, each
+// 32 bytes. For a lock package CapsuleHash covers every capsule (see
+// SchnorrCapsuleHash).
+type SchnorrBinding struct {
+	Commitment  []byte
+	CtxHash     []byte
+	CapsuleHash []byte
+}
+
+func (b *SchnorrBinding) validate() error {
+	if len(b.Commitment) != 32 || len(b.CtxHash) != 32 || len(b.CapsuleHash) != 32 {
+		return fmt.Errorf("%w: commitment, ctx_hash and capsule_hash must be 32 bytes", ErrInvalidInput)
+	}
+	return nil
 }
 
 // GenerateSchnorrProof generates a BIP-340 Schnorr signature for secret r2Bytes and message msg.
+// This is the schnorr_fs_v1 proof; new packages use GenerateSchnorrProofV2.
 func GenerateSchnorrProof(r2Bytes []byte, msg []byte) (*ProofSecp, error) {
 	// 1. Parse Private Key
 	privKey, _ := btcec.PrivKeyFromBytes(r2Bytes)
 
 	// 2. Sign Message (CtxHash)
-	// Note: msg should be 32 bytes hash. CtxHash is 32 bytes.
 	// schnorr.Sign expects a 32-byte hash.
 	var msgHash [32]byte
 	if len(msg) != 32 {
@@ -38,28 +72,17 @@ func GenerateSchnorrProof(r2Bytes []byte, msg []byte) (*ProofSecp, error) {
 	}, nil
 }
 
-// VerifySchnorrProof verifies the BIP-340 Schnorr signature.
+// VerifySchnorrProof verifies a schnorr_fs_v1 proof: a BIP-340 signature
+// over msg. BIP-340 keys are x-only, so a 33-byte R2 is checked without its
+// parity.
 func VerifySchnorrProof(r2Compressed []byte, msg []byte, proof *ProofSecp) error {
 	if len(proof.Signature) != 64 {
 		return fmt.Errorf("invalid signature size: %d", len(proof.Signature))
 	}
 
-	// 1. Parse Public Key
+	// 1. Parse Public Key (x-only, or SEC1 with the parity dropped)
 	pubKey, err := schnorr.ParsePubKey(r2Compressed)
 	if err != nil {
-		// btcec schnorr expects 32-byte x-only public key usually for BIP-340.
-		// But ParsePubKey might accept compressed point (33 bytes)?
-		// Check btcec docs logic.
-		// If r2Compressed is 33 bytes (0x02/0x03), ParsePubKey handles it?
-		// schnorr.ParsePubKey parses 32-byte x-coord.
-		// But btcec.ParsePubKey handles compressed.
-		// Standard Schnorr (BIP-340) uses x-only.
-		// VTE uses r2Compressed (33 bytes).
-		// We can convert 33 bytes to 32 bytes x-coord if we assume BIP-340.
-		// Or using btcec legacy Schnorr?
-		// btcec/v2/schnorr implements BIP-340.
-		// It requires PubKey to be converted?
-		// Let's try parsing as standard pubkey first.
 		pk, err2 := btcec.ParsePubKey(r2Compressed)
 		if err2 != nil {
 			return fmt.Errorf("invalid public key: %w", err2)
@@ -67,7 +90,7 @@ func VerifySchnorrProof(r2Compressed []byte, msg []byte, proof *ProofSecp) error
 		pubKey = pk
 	}
 
-	// 2. ParsSig
+	// 2. Parse Signature
 	sig, err := schnorr.ParseSignature(proof.Signature)
 	if err != nil {
 		return fmt.Errorf("invalid signature format: %w", err)
@@ -86,3 +109,122 @@ func VerifySchnorrProof(r2Compressed []byte, msg []byte, proof *ProofSecp) error
 
 	return nil
 }
+
+// GenerateSchnorrProofV2 proves knowledge of r2 bound to b (schnorr_fs_v2):
+// K = k·G, e = H(R2 || K || commitment || ctx_hash || capsule_hash),
+// s = k + e·r2, with R2 and K as SEC1 compressed points. The nonce is
+// derived from r2 and the binding, so the proof is deterministic.
+func GenerateSchnorrProofV2(r2Bytes []byte, b *SchnorrBinding) (*ProofSecp, error) {
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+	var r2 btcec.ModNScalar
+	if len(r2Bytes) != 32 || r2.SetByteSlice(r2Bytes) || r2.IsZero() {
+		return nil, fmt.Errorf("%w: r2 must be a nonzero 32-byte scalar below the group order", ErrInvalidInput)
+	}
+	defer r2.Zero()
+	R2 := compressPoint(basePointMul(&r2))
+
+	var k btcec.ModNScalar
+	k.SetByteSlice(chainhash.TaggedHash(tagSchnorrV2Nonce, r2Bytes, R2, b.Commitment, b.CtxHash, b.CapsuleHash)[:])
+	if k.IsZero() {
+		return nil, fmt.Errorf("schnorr_fs_v2: zero nonce")
+	}
+	defer k.Zero()
+	K := compressPoint(basePointMul(&k))
+
+	e := schnorrV2Challenge(R2, K, b)
+	s := new(btcec.ModNScalar).Mul2(e, &r2).Add(&k)
+
+	eBytes, sBytes := e.Bytes(), s.Bytes()
+	return &ProofSecp{Signature: append(eBytes[:], sBytes[:]...)}, nil
+}
+
+// VerifySchnorrProofV2 verifies a schnorr_fs_v2 proof for the 33-byte R2:
+// K = s·G - e·R2 must hash back to e
+func VerifySchnorrProofV2(r2Compressed []byte, b *SchnorrBinding, proof *ProofSecp) error {
+	if err := b.validate(); err != nil {
+		return err
+	}
+	if len(proof.Signature) != 64 {
+		return fmt.Errorf("invalid proof size: %d", len(proof.Signature))
+	}
+	if len(r2Compressed) != 33 {
+		return fmt.Errorf("R2 must be a 33-byte compressed point")
+	}
+	pub, err := btcec.ParsePubKey(r2Compressed)
+	if err != nil {
+		return fmt.Errorf("invalid public key: %w", err)
+	}
+
+	var e, s btcec.ModNScalar
+	if e.SetByteSlice(proof.Signature[:32]) || s.SetByteSlice(proof.Signature[32:]) {
+		return fmt.Errorf("proof scalar not below the group order")
+	}
+
+	var R2, eR2, K btcec.JacobianPoint
+	pub.AsJacobian(&R2)
+	btcec.ScalarMultNonConst(new(btcec.ModNScalar).Set(&e).Negate(), &R2, &eR2)
+	btcec.AddNonConst(basePointMul(&s), &eR2, &K)
+	if (K.X.IsZero() && K.Y.IsZero()) || K.Z.IsZero() {
+		return fmt.Errorf("proof verification failed")
+	}
+	K.ToAffine()
+
+	want := schnorrV2Challenge(r2Compressed, compressPoint(&K), b)
+	if !want.Equals(&e) {
+		return fmt.Errorf("proof verification failed")
+	}
+	return nil
+}
+
+// verifySecpSchnorr verifies a package's Schnorr proof under its scheme
+func verifySecpSchnorr(pkg *VTEPackageV2) error {
+	proof := &ProofSecp{Signature: pkg.Proofs.SecpSchnorr.SignatureB64}
+	switch pkg.Proofs.SecpSchnorr.Scheme {
+	case SchnorrSchemeV1:
+		return VerifySchnorrProof(pkg.Public.R2.Value, pkg.Context.CtxHash, proof)
+	case SchnorrSchemeV2:
+		return VerifySchnorrProofV2(pkg.Public.R2.Value, &SchnorrBinding{
+			Commitment:  pkg.Public.Commitment,
+			CtxHash:     pkg.Context.CtxHash,
+			CapsuleHash: SchnorrCapsuleHash(pkg.Tlock, pkg.Lock),
+		}, proof)
+	default:
+		return fmt.Errorf("unknown scheme %q", pkg.Proofs.SecpSchnorr.Scheme)
+	}
+}
+
+// SchnorrCapsuleHash is the capsule_hash a schnorr_fs_v2 proof binds: the
+// tlock capsule hash, or for a lock package H(capsule_hash_0 || ... ||
+// capsule_hash_n-1)
+func SchnorrCapsuleHash(tlock TlockInfo, lock *LockInfo) []byte {
+	if lock == nil {
+		return tlock.CapsuleHash
+	}
+	hashes := make([][]byte, len(lock.Capsules))
+	for i, c := range lock.Capsules {
+		hashes[i] = c.Tlock.CapsuleHash
+	}
+	h := chainhash.TaggedHash(tagSchnorrV2Capsules, hashes...)
+	return h[:]
+}
+
+func schnorrV2Challenge(R2, K []byte, b *SchnorrBinding) *btcec.ModNScalar {
+	var e btcec.ModNScalar
+	e.SetByteSlice(chainhash.TaggedHash(tagSchnorrV2Challenge, R2, K, b.Commitment, b.CtxHash, b.CapsuleHash)[:])
+	return &e
+}
+
+// basePointMul returns k·G in affine coordinates
+func basePointMul(k *btcec.ModNScalar) *btcec.JacobianPoint {
+	var p btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(k, &p)
+	p.ToAffine()
+	return &p
+}
+
+// compressPoint SEC1-encodes an affine point
+func compressPoint(p *btcec.JacobianPoint) []byte {
+	return btcec.NewPublicKey(&p.X, &p.Y).SerializeCompressed()
+}
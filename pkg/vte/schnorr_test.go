@@ -0,0 +1,121 @@
+package vte
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/drand/drand/v2/crypto"
+)
+
+func TestSchnorrProofV2(t *testing.T) {
+	r2 := PlaintextToR2("schnorr v2")
+	R2, _ := ComputeR2Point(r2)
+	b := &SchnorrBinding{
+		Commitment:  bytes.Repeat([]byte{1}, 32),
+		CtxHash:     bytes.Repeat([]byte{2}, 32),
+		CapsuleHash: bytes.Repeat([]byte{3}, 32),
+	}
+	proof, err := GenerateSchnorrProofV2(r2, b)
+	if err != nil {
+		t.Fatalf("GenerateSchnorrProofV2 failed: %v", err)
+	}
+	if err := VerifySchnorrProofV2(R2, b, proof); err != nil {
+		t.Fatalf("VerifySchnorrProofV2 failed: %v", err)
+	}
+	again, _ := GenerateSchnorrProofV2(r2, b)
+	if !bytes.Equal(again.Signature, proof.Signature) {
+		t.Error("Proof is not deterministic")
+	}
+
+	// Every bound field is in the challenge
+	for name, edit := range map[string]func(*SchnorrBinding){
+		"commitment":   func(b *SchnorrBinding) { b.Commitment = bytes.Repeat([]byte{9}, 32) },
+		"ctx_hash":     func(b *SchnorrBinding) { b.CtxHash = bytes.Repeat([]byte{9}, 32) },
+		"capsule_hash": func(b *SchnorrBinding) { b.CapsuleHash = bytes.Repeat([]byte{9}, 32) },
+	} {
+		other := *b
+		edit(&other)
+		if err := VerifySchnorrProofV2(R2, &other, proof); err == nil {
+			t.Errorf("%s: proof verified for another value", name)
+		}
+	}
+
+	// The parity of R2 counts: -R2 has the same x-only key
+	negR2 := append([]byte{R2[0] ^ 1}, R2[1:]...)
+	if err := VerifySchnorrProofV2(negR2, b, proof); err == nil {
+		t.Error("Proof verified for -R2")
+	}
+	if err := VerifySchnorrProofV2(R2[1:], b, proof); err == nil {
+		t.Error("Proof verified for an x-only R2")
+	}
+	v1, _ := GenerateSchnorrProof(r2, b.CtxHash)
+	if err := VerifySchnorrProof(negR2, b.CtxHash, v1); err != nil {
+		t.Errorf("v1 is x-only and should accept -R2: %v", err)
+	}
+
+	tampered := &ProofSecp{Signature: append([]byte{}, proof.Signature...)}
+	tampered.Signature[63] ^= 1
+	if err := VerifySchnorrProofV2(R2, b, tampered); err == nil {
+		t.Error("Tampered proof verified")
+	}
+	if _, err := GenerateSchnorrProofV2(r2, &SchnorrBinding{CtxHash: b.CtxHash}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Missing fields: %v", err)
+	}
+}
+
+func TestPolicyVerifiesSchnorrSchemes(t *testing.T) {
+	network, _, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	r2 := PlaintextToR2("schemes")
+	pkg, err := GenerateVTE(&GenerateVTEParams{
+		Round:          network.LatestRound() + 20,
+		ChainHash:      chainHash,
+		FormatID:       "tlock_v1_age_pairing",
+		SessionID:      "schemes",
+		R2:             r2,
+		DrandEndpoints: []string{endpoint},
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE failed: %v", err)
+	}
+	policy := &VerificationPolicy{Require: ProofRequirements{Schnorr: true}}
+	if pkg.Proofs.SecpSchnorr.Scheme != SchnorrSchemeV2 {
+		t.Fatalf("New packages use %q", pkg.Proofs.SecpSchnorr.Scheme)
+	}
+	if err := policy.Verify(pkg); err != nil {
+		t.Fatalf("v2 package failed: %v", err)
+	}
+
+	// A v2 proof does not verify once the commitment is swapped
+	swapped := *pkg
+	swapped.Public.Commitment = bytes.Repeat([]byte{7}, 32)
+	if err := policy.Verify(&swapped); !errors.Is(err, ErrProofInvalid) {
+		t.Errorf("Swapped commitment: %v", err)
+	}
+
+	// Packages with a v1 proof still verify, unless the policy opts out
+	v1, _ := GenerateSchnorrProof(r2, pkg.Context.CtxHash)
+	legacy := *pkg
+	legacy.Proofs.SecpSchnorr = SecpSchnorrInfo{Scheme: SchnorrSchemeV1, BindFields: SchnorrBindFields, SignatureB64: v1.Signature}
+	if err := policy.Verify(&legacy); err != nil {
+		t.Errorf("v1 package failed: %v", err)
+	}
+	if c := DefaultPolicy().Report(&legacy).Check(CheckSchnorr); c.Status != CheckPass {
+		t.Errorf("v1 package under DefaultPolicy: %+v", c)
+	}
+	v2Only := &VerificationPolicy{Require: policy.Require, AllowedSchnorrSchemes: []string{SchnorrSchemeV2}}
+	if err := v2Only.Verify(&legacy); !errors.Is(err, ErrProofInvalid) {
+		t.Errorf("v1 package passed a v2-only policy: %v", err)
+	}
+	if err := v2Only.Verify(pkg); err != nil {
+		t.Errorf("v2 package failed a v2-only policy: %v", err)
+	}
+
+	unknown := *pkg
+	unknown.Proofs.SecpSchnorr.Scheme = "schnorr_fs_v9"
+	if err := policy.Verify(&unknown); !errors.Is(err, ErrProofInvalid) {
+		t.Errorf("Unknown scheme: %v", err)
+	}
+}
@@ -0,0 +1,212 @@
+package vte
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+// Secret shares are secp256k1 scalars, so every share s_i has a public point
+// S_i = s_i·G that can be checked against R2 = r2·G without decrypting.
+
+// parseScalar parses a 32-byte big-endian scalar in [1, n)
+func parseScalar(b []byte) (*btcec.ModNScalar, error) {
+	if len(b) != 32 {
+		return nil, fmt.Errorf("%w: scalar must be 32 bytes", ErrInvalidInput)
+	}
+	var s btcec.ModNScalar
+	if overflow := s.SetByteSlice(b); overflow || s.IsZero() {
+		return nil, fmt.Errorf("%w: scalar is not in [1, n) of secp256k1", ErrInvalidInput)
+	}
+	return &s, nil
+}
+
+// randomScalar draws a uniform non-zero scalar from rng (crypto/rand if nil)
+func randomScalar(rng io.Reader) (*btcec.ModNScalar, error) {
+	if rng == nil {
+		rng = rand.Reader
+	}
+	var buf [32]byte
+	for {
+		if _, err := io.ReadFull(rng, buf[:]); err != nil {
+			return nil, fmt.Errorf("failed to read randomness: %w", err)
+		}
+		if s, err := parseScalar(buf[:]); err == nil {
+			return s, nil
+		}
+	}
+}
+
+func scalarBytes(s *btcec.ModNScalar) []byte {
+	b := s.Bytes()
+	return b[:]
+}
+
+// scalarPoint returns s·G, SEC1 compressed
+func scalarPoint(s *btcec.ModNScalar) []byte {
+	var p btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(s, &p)
+	p.ToAffine()
+	return btcec.NewPublicKey(&p.X, &p.Y).SerializeCompressed()
+}
+
+// splitAdditive splits r2 into n random shares that sum to r2 mod n
+func splitAdditive(r2 *btcec.ModNScalar, n int, rng io.Reader) ([]*btcec.ModNScalar, error) {
+	shares := make([]*btcec.ModNScalar, n)
+	var last btcec.ModNScalar
+	last.Set(r2)
+	for i := 0; i < n-1; i++ {
+		s, err := randomScalar(rng)
+		if err != nil {
+			return nil, err
+		}
+		shares[i] = s
+		var neg btcec.ModNScalar
+		neg.NegateVal(s)
+		last.Add(&neg)
+	}
+	if last.IsZero() {
+		// Probability 1/n; a zero share has no valid point
+		return splitAdditive(r2, n, rng)
+	}
+	shares[n-1] = &last
+	return shares, nil
+}
+
+// sumPoints adds SEC1 points, failing on malformed points and on infinity
+func sumPoints(points [][]byte) ([]byte, error) {
+	var sum btcec.JacobianPoint
+	for i, raw := range points {
+		pub, err := btcec.ParsePubKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: share %d point: %v", ErrShareInvalid, i, err)
+		}
+		var p btcec.JacobianPoint
+		pub.AsJacobian(&p)
+		btcec.AddNonConst(&sum, &p, &sum)
+	}
+	if (sum.X.IsZero() && sum.Y.IsZero()) || sum.Z.IsZero() {
+		return nil, fmt.Errorf("%w: share points sum to infinity", ErrShareInvalid)
+	}
+	sum.ToAffine()
+	return btcec.NewPublicKey(&sum.X, &sum.Y).SerializeCompressed(), nil
+}
+
+// splitShamir splits r2 into n shares f(1)..f(n) of a random polynomial f of
+// degree k-1 with f(0) = r2, and returns the Feldman commitments a_j·G to its
+// coefficients
+func splitShamir(r2 *btcec.ModNScalar, k, n int, rng io.Reader) ([]*btcec.ModNScalar, [][]byte, error) {
+	coeffs := []*btcec.ModNScalar{r2}
+	for len(coeffs) < k {
+		a, err := randomScalar(rng)
+		if err != nil {
+			return nil, nil, err
+		}
+		coeffs = append(coeffs, a)
+	}
+
+	shares := make([]*btcec.ModNScalar, n)
+	for i := range shares {
+		var x, y btcec.ModNScalar
+		x.SetInt(uint32(i + 1))
+		// Horner: y = a_0 + x(a_1 + x(a_2 + ...))
+		for j := len(coeffs) - 1; j >= 0; j-- {
+			y.Mul(&x).Add(coeffs[j])
+		}
+		if y.IsZero() {
+			// Negligible; a zero share has no valid point
+			return splitShamir(r2, k, n, rng)
+		}
+		shares[i] = &y
+	}
+
+	commitments := make([][]byte, len(coeffs))
+	for j, a := range coeffs {
+		commitments[j] = scalarPoint(a)
+	}
+	return shares, commitments, nil
+}
+
+// feldmanPoint evaluates the committed polynomial at x in the exponent:
+// sum of C_j·x^j, which is f(x)·G
+func feldmanPoint(commitments [][]byte, x uint32) ([]byte, error) {
+	var xs, power btcec.ModNScalar
+	xs.SetInt(x)
+	power.SetInt(1)
+	terms := make([][]byte, len(commitments))
+	for j, raw := range commitments {
+		pub, err := btcec.ParsePubKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%w: coefficient %d: %v", ErrShareInvalid, j, err)
+		}
+		var p, term btcec.JacobianPoint
+		pub.AsJacobian(&p)
+		btcec.ScalarMultNonConst(&power, &p, &term)
+		if term.Z.IsZero() {
+			return nil, fmt.Errorf("%w: coefficient %d term is infinity", ErrShareInvalid, j)
+		}
+		term.ToAffine()
+		terms[j] = btcec.NewPublicKey(&term.X, &term.Y).SerializeCompressed()
+		power.Mul(&xs)
+	}
+	return sumPoints(terms)
+}
+
+// interpolateZero returns f(0) from the shares ys[i] = f(xs[i]) by Lagrange
+// interpolation; the xs must be distinct and non-zero
+func interpolateZero(xs []uint32, ys []*btcec.ModNScalar) *btcec.ModNScalar {
+	var secret btcec.ModNScalar
+	for i := range xs {
+		// l_i(0) = prod_{j != i} x_j / (x_j - x_i)
+		var num, den btcec.ModNScalar
+		num.SetInt(1)
+		den.SetInt(1)
+		for j := range xs {
+			if j == i {
+				continue
+			}
+			var xj, diff btcec.ModNScalar
+			xj.SetInt(xs[j])
+			num.Mul(&xj)
+			diff.SetInt(xs[i]).Negate().Add(&xj)
+			den.Mul(&diff)
+		}
+		var term btcec.ModNScalar
+		term.Mul2(ys[i], &num).Mul(den.InverseNonConst())
+		secret.Add(&term)
+	}
+	return &secret
+}
+
+// verifyFeldman checks a threshold lock against R2: k commitments, the first
+// being R2, and every share point equal to the committed polynomial at its
+// distinct non-zero index
+func verifyFeldman(lock *LockInfo, r2Point []byte) error {
+	if lock.Threshold < 1 || lock.Threshold > len(lock.Capsules) {
+		return fmt.Errorf("%w: threshold %d out of range 1..%d", ErrShareInvalid, lock.Threshold, len(lock.Capsules))
+	}
+	if len(lock.Coefficients) != lock.Threshold {
+		return fmt.Errorf("%w: %d coefficient commitments for threshold %d", ErrShareInvalid, len(lock.Coefficients), lock.Threshold)
+	}
+	if !bytes.Equal(lock.Coefficients[0], r2Point) {
+		return fmt.Errorf("%w: first coefficient commitment is not R2", ErrShareInvalid)
+	}
+	seen := make(map[uint32]bool)
+	for i, c := range lock.Capsules {
+		if seen[c.Share.Index] {
+			return fmt.Errorf("%w: capsule %d repeats share index %d", ErrShareInvalid, i, c.Share.Index)
+		}
+		seen[c.Share.Index] = true
+		expected, err := feldmanPoint(lock.Coefficients, c.Share.Index)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(expected, c.Share.Point) {
+			return fmt.Errorf("%w: capsule %d share point is not on the committed polynomial", ErrShareInvalid, i)
+		}
+	}
+	return nil
+}
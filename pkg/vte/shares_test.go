@@ -0,0 +1,45 @@
+package vte
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+func TestShamirAnySubset(t *testing.T) {
+	secret, err := parseScalar(PlaintextToR2("shamir"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shares, commitments, err := splitShamir(secret, 3, 5, NewSeededRand([]byte("shamir")))
+	if err != nil {
+		t.Fatalf("splitShamir failed: %v", err)
+	}
+	for i, share := range shares {
+		point, err := feldmanPoint(commitments, uint32(i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(point, scalarPoint(share)) {
+			t.Fatalf("Share %d is not on the committed polynomial", i+1)
+		}
+	}
+
+	// Every 3 of the 5 shares give the secret; 2 do not
+	for a := 0; a < 5; a++ {
+		for b := a + 1; b < 5; b++ {
+			pair := interpolateZero([]uint32{uint32(a + 1), uint32(b + 1)}, []*btcec.ModNScalar{shares[a], shares[b]})
+			if pair.Equals(secret) {
+				t.Fatalf("Shares %d and %d alone gave the secret", a+1, b+1)
+			}
+			for c := b + 1; c < 5; c++ {
+				xs := []uint32{uint32(c + 1), uint32(a + 1), uint32(b + 1)}
+				got := interpolateZero(xs, []*btcec.ModNScalar{shares[c], shares[a], shares[b]})
+				if !got.Equals(secret) {
+					t.Fatalf("Shares %v gave %v", xs, got)
+				}
+			}
+		}
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"time"
+
+	"github.com/drand/drand/v2/common"
 )
 
 // DrandNetworkInfo contains timing parameters for a drand network
@@ -18,30 +20,24 @@ type DrandNetworkInfo struct {
 // DefaultQuicknetInfo returns the drand Quicknet network parameters
 // Quicknet: ~3 second rounds, good for testing
 func DefaultQuicknetInfo() DrandNetworkInfo {
-	chainHash, _ := hexDecode("52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971")
-	return DrandNetworkInfo{
-		ChainHash:   chainHash,
-		GenesisTime: 1692803367, // August 23, 2023
-		Period:      3,          // 3 seconds
-		SchemeID:    "bls-unchained-g1-rfc9380",
+	info, err := LookupNetworkInfo("quicknet")
+	if err != nil {
+		panic(err) // built-in and pinned
 	}
+	return info
 }
 
-// TimeToRound calculates the drand round number for a given target time
+// TimeToRound calculates the drand round number for a given target time.
+// It is the latest round published at targetTime (drand's CurrentRound, 1
+// before genesis, as WasmNetwork.Current), so
+// its beacon can appear up to one period before targetTime; use a Scheduler
+// to align unlocks with a deadline.
 func (n *DrandNetworkInfo) TimeToRound(targetTime time.Time) uint64 {
-	targetUnix := targetTime.Unix()
-
-	if targetUnix <= n.GenesisTime {
-		return 1 // Minimum round
-	}
-
-	elapsed := targetUnix - n.GenesisTime
-	round := uint64(elapsed / n.Period)
-
-	return round + 1 // Round 1 is at genesis
+	return common.CurrentRound(targetTime.Unix(), time.Duration(n.Period)*time.Second, n.GenesisTime)
 }
 
-// RoundToTime calculates the approximate time when a round will be available
+// RoundToTime calculates the nominal time when a round will be available.
+// The beacon is never published earlier, but may arrive a little later.
 func (n *DrandNetworkInfo) RoundToTime(round uint64) time.Time {
 	if round <= 1 {
 		return time.Unix(n.GenesisTime, 0)
@@ -64,7 +60,9 @@ func PlaintextToR2(plaintext string) []byte {
 	return h[:]
 }
 
-// EncryptPlaintext is a convenience wrapper that encrypts plaintext with timelock
+// EncryptPlaintext is a convenience wrapper that encrypts plaintext with timelock.
+// It uses the endpoints of the registered network, or the public drand
+// endpoints for a chain the registry does not know.
 func EncryptPlaintext(plaintext string, targetTime time.Time, network DrandNetworkInfo) ([]byte, uint64, error) {
 	// Convert plaintext to r2
 	r2 := PlaintextToR2(plaintext)
@@ -73,7 +71,7 @@ func EncryptPlaintext(plaintext string, targetTime time.Time, network DrandNetwo
 	round := network.TimeToRound(targetTime)
 
 	// Real tlock encryption
-	capsule, err := Encrypt(context.Background(), network.ChainHash, round, r2, []string{"https://api.drand.sh"})
+	capsule, err := Encrypt(context.Background(), network.ChainHash, round, r2, endpointsFor(network.ChainHash))
 	if err != nil {
 		return nil, 0, fmt.Errorf("encryption failed: %w", err)
 	}
@@ -81,12 +79,11 @@ func EncryptPlaintext(plaintext string, targetTime time.Time, network DrandNetwo
 	return capsule, round, nil
 }
 
-func hexDecode(s string) ([]byte, error) {
-	result := make([]byte, len(s)/2)
-	for i := 0; i < len(s); i += 2 {
-		var b byte
-		fmt.Sscanf(s[i:i+2], "%02x", &b)
-		result[i/2] = b
+// endpointsFor returns the endpoints of a registered chain, falling back to
+// the public drand endpoints, which serve every League of Entropy chain
+func endpointsFor(chainHash []byte) []string {
+	if known, err := Networks.LookupHash(chainHash); err == nil {
+		return known.Endpoints
 	}
-	return result, nil
+	return mainnetEndpoints
 }
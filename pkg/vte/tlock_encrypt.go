@@ -0,0 +1,245 @@
+package vte
+
+import (
+	"bytes"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/crypto"
+	"github.com/drand/kyber"
+	bls "github.com/drand/kyber-bls12381"
+	"github.com/drand/kyber/encrypt/ibe"
+	"github.com/drand/kyber/group/mod"
+	"github.com/drand/kyber/pairing"
+	"github.com/drand/tlock"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// encryptTlockRand produces the same age/tlock capsule as tlock.Encrypt, but
+// draws every random value (age file key, IBE sigma, STREAM nonce) from rng.
+// The read order matches tlock.Encrypt so a capsule is reproducible from the
+// reader alone. Output is decryptable by tlock.Decrypt.
+func encryptTlockRand(network tlock.Network, round uint64, payload []byte, rng io.Reader) ([]byte, error) {
+	// 1. Age file key
+	fileKey := make([]byte, 16)
+	if _, err := io.ReadFull(rng, fileKey); err != nil {
+		return nil, fmt.Errorf("failed to read file key: %w", err)
+	}
+
+	// 2. Wrap the file key with IBE for the round (tleRecipient.Wrap)
+	scheme := network.Scheme()
+	ciphertext, err := timeLockRand(scheme, network.PublicKey(), round, fileKey, rng)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt dek: %w", err)
+	}
+	body, err := tlock.CiphertextToBytes(scheme, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("bytes: %w", err)
+	}
+
+	// 3. Header with a single tlock stanza and its MAC
+	var header bytes.Buffer
+	header.WriteString("age-encryption.org/v1\n")
+	fmt.Fprintf(&header, "-> tlock %s %s\n", strconv.FormatUint(round, 10), network.ChainHash())
+	writeWrappedBase64(&header, body)
+	header.WriteString("---")
+
+	macKey, err := hkdf.Key(sha256.New, fileKey, nil, "header", 32)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(header.Bytes())
+
+	var out bytes.Buffer
+	out.Write(header.Bytes())
+	fmt.Fprintf(&out, " %s\n", base64.RawStdEncoding.EncodeToString(mac.Sum(nil)))
+
+	// 4. Payload nonce and STREAM encryption
+	nonce := make([]byte, 16)
+	if _, err := io.ReadFull(rng, nonce); err != nil {
+		return nil, fmt.Errorf("failed to read nonce: %w", err)
+	}
+	out.Write(nonce)
+
+	streamKey, err := hkdf.Key(sha256.New, fileKey, nonce, "payload", chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeStream(&out, streamKey, payload); err != nil {
+		return nil, err
+	}
+
+	return out.Bytes(), nil
+}
+
+// timeLockRand mirrors tlock.TimeLock with sigma drawn from rng
+func timeLockRand(scheme crypto.Scheme, publicKey kyber.Point, round uint64, data []byte, rng io.Reader) (*ibe.Ciphertext, error) {
+	if publicKey.Equal(publicKey.Null()) {
+		return nil, tlock.ErrInvalidPublicKey
+	}
+
+	id := scheme.DigestBeacon(&common.Beacon{Round: round})
+
+	sigma := make([]byte, len(data))
+	if _, err := io.ReadFull(rng, sigma); err != nil {
+		return nil, fmt.Errorf("err reading rand sigma: %w", err)
+	}
+
+	switch scheme.Name {
+	case crypto.ShortSigSchemeID:
+		// Same retro-compatible DST quirk as tlock
+		return ibeEncryptCCA(bls.NewBLS12381SuiteWithDST(bls.DefaultDomainG2(), bls.DefaultDomainG2()), false, publicKey, id, data, sigma)
+	case crypto.UnchainedSchemeID:
+		return ibeEncryptCCA(bls.NewBLS12381Suite(), true, publicKey, id, data, sigma)
+	case crypto.SigsOnG1ID:
+		return ibeEncryptCCA(bls.NewBLS12381Suite(), false, publicKey, id, data, sigma)
+	default:
+		return nil, fmt.Errorf("unsupported drand scheme '%s'", scheme.Name)
+	}
+}
+
+// ibeEncryptCCA is the Boneh-Franklin FullIdent encryption used by tlock
+// (kyber ibe.EncryptCCAonG1 / EncryptCCAonG2) with a caller-supplied sigma.
+// masterOnG1 selects the group of the master public key; identities and U
+// live in the other group.
+func ibeEncryptCCA(s pairing.Suite, masterOnG1 bool, master kyber.Point, id, msg, sigma []byte) (*ibe.Ciphertext, error) {
+	if len(msg) > s.Hash().Size() {
+		return nil, errors.New("plaintext too long for the hash function provided")
+	}
+
+	// 1. Gid = e(master, H(id)) or e(H(id), master)
+	var gid kyber.Point
+	var uGroup kyber.Group
+	if masterOnG1 {
+		hp, ok := s.G2().Point().(kyber.HashablePoint)
+		if !ok {
+			return nil, errors.New("point needs to implement `kyber.HashablePoint`")
+		}
+		gid = s.Pair(master, hp.Hash(id))
+		uGroup = s.G1()
+	} else {
+		hp, ok := s.G1().Point().(kyber.HashablePoint)
+		if !ok {
+			return nil, errors.New("point needs to implement `kyber.HashablePoint`")
+		}
+		gid = s.Pair(hp.Hash(id), master)
+		uGroup = s.G2()
+	}
+
+	// 2. r = H3(sigma, msg), U = rP
+	r, err := ibeH3(s, sigma, msg)
+	if err != nil {
+		return nil, err
+	}
+	u := uGroup.Point().Mul(r, nil)
+
+	// 3. V = sigma XOR H2(r*Gid)
+	rGid := gid.Mul(r, gid)
+	h := s.Hash()
+	h.Write([]byte("IBE-H2"))
+	if _, err := rGid.MarshalTo(h); err != nil {
+		return nil, errors.New("err marshalling gt to the hash function")
+	}
+	v := xorBytes(sigma, h.Sum(nil)[:len(msg)])
+
+	// 4. W = msg XOR H4(sigma)
+	h = s.Hash()
+	h.Write([]byte("IBE-H4"))
+	h.Write(sigma)
+	w := xorBytes(msg, h.Sum(nil)[:len(msg)])
+
+	return &ibe.Ciphertext{U: u, V: v, W: w}, nil
+}
+
+// ibeH3 derives the IBE scalar from sigma and msg by rejection sampling.
+// Must stay bit-compatible with kyber's h3, which decryption re-runs.
+func ibeH3(s pairing.Suite, sigma, msg []byte) (kyber.Scalar, error) {
+	h := s.Hash()
+	h.Write([]byte("IBE-H3"))
+	h.Write(sigma)
+	h.Write(msg)
+	buffer := h.Sum(nil)
+
+	scalar, ok := s.G1().Scalar().(*mod.Int)
+	if !ok {
+		return nil, fmt.Errorf("unable to instantiate scalar as a mod.Int")
+	}
+	toMask := scalar.MarshalSize()*8 - scalar.M.BitLen()
+
+	for i := uint16(1); i < 65535; i++ {
+		h.Reset()
+		var iter [2]byte
+		binary.LittleEndian.PutUint16(iter[:], i)
+		h.Write(iter[:])
+		h.Write(buffer)
+		hashed := h.Sum(nil)
+		if scalar.BO == mod.BigEndian {
+			hashed[0] >>= toMask
+		} else {
+			hashed[len(hashed)-1] >>= toMask
+		}
+		if err := scalar.UnmarshalBinary(hashed); err == nil {
+			return scalar, nil
+		}
+	}
+	return nil, fmt.Errorf("rejection sampling failure")
+}
+
+// writeWrappedBase64 writes an age stanza body: unpadded base64 wrapped at 64
+// columns, always terminated by a line shorter than 64 columns.
+func writeWrappedBase64(w *bytes.Buffer, body []byte) {
+	const columns = 64
+	enc := base64.RawStdEncoding.EncodeToString(body)
+	for len(enc) >= columns {
+		w.WriteString(enc[:columns])
+		w.WriteByte('\n')
+		enc = enc[columns:]
+	}
+	w.WriteString(enc)
+	w.WriteByte('\n')
+}
+
+// writeStream encrypts payload with age's STREAM construction: 64 KiB
+// ChaCha20-Poly1305 chunks, nonce = 11-byte counter || last-chunk flag.
+func writeStream(w *bytes.Buffer, key, payload []byte) error {
+	const chunkSize = 64 * 1024
+
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return err
+	}
+
+	var nonce [chacha20poly1305.NonceSize]byte
+	for counter := uint64(0); ; counter++ {
+		n := min(len(payload), chunkSize)
+		chunk := payload[:n]
+		payload = payload[n:]
+
+		binary.BigEndian.PutUint64(nonce[3:11], counter)
+		last := len(payload) == 0
+		if last {
+			nonce[11] = 1
+		}
+		w.Write(aead.Seal(nil, nonce[:], chunk, nil))
+		if last {
+			return nil
+		}
+	}
+}
+
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
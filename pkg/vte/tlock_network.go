@@ -0,0 +1,116 @@
+package vte
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/drand/tlock"
+)
+
+// EncryptWithNetwork encrypts the payload (r2) for a round on an already
+// constructed network. Encrypt and EncryptWithPrefetch both end up here once
+// they have resolved their network; callers holding a network (tests, offline
+// tooling) can use it directly.
+//
+// rng is optional. When nil the upstream tlock client is used with
+// crypto/rand; otherwise every random value of the capsule is read from rng,
+// so equal readers give byte-identical capsules.
+func EncryptWithNetwork(network tlock.Network, round uint64, payload []byte, rng io.Reader) ([]byte, error) {
+	if len(payload) != 32 {
+		return nil, fmt.Errorf("payload (r2) must be exactly 32 bytes")
+	}
+
+	if rng != nil {
+		capsule, err := encryptTlockRand(network, round, payload, rng)
+		if err != nil {
+			return nil, fmt.Errorf("tlock encryption failed: %w", err)
+		}
+		return capsule, nil
+	}
+
+	// Strict mode: never follow a chain hash other than the one we were given
+	client := tlock.New(network).Strict()
+
+	var buf bytes.Buffer
+	if err := client.Encrypt(&buf, bytes.NewReader(payload), round); err != nil {
+		return nil, fmt.Errorf("tlock encryption failed: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DecryptWithNetwork decrypts a capsule with the beacon signature served by
+// network. It is the counterpart of EncryptWithNetwork.
+func DecryptWithNetwork(network tlock.Network, capsule []byte) ([]byte, error) {
+	// Create tlock client in strict mode
+	client := tlock.New(network).Strict()
+
+	// Decrypt using the capsule (capsule contains round info internally)
+	var plaintext bytes.Buffer
+	if err := client.Decrypt(&plaintext, bytes.NewReader(capsule)); err != nil {
+		return nil, fmt.Errorf("tlock decryption failed: %w", err)
+	}
+
+	return plaintext.Bytes(), nil
+}
+
+// EncryptWithPrefetch encrypts using pre-fetched chain info.
+// NOTE: For ENCRYPTION, the beacon is NOT needed - only the chain's public key is required.
+// The beacon is only needed for DECRYPTION after the round has passed.
+// This allows encrypting for FUTURE rounds.
+func EncryptWithPrefetch(ctx context.Context, chainHash []byte, round uint64, payload []byte, chainInfoJSON string, beaconSignature string) ([]byte, error) {
+	if len(payload) != 32 {
+		return nil, fmt.Errorf("payload (r2) must be exactly 32 bytes")
+	}
+
+	chainHashHex := fmt.Sprintf("%x", chainHash)
+
+	// Create network from pre-fetched chain info
+	network, err := NewNetworkFromChainInfo(chainInfoJSON, chainHashHex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network from chain info: %w", err)
+	}
+
+	// NOTE: We do NOT set the beacon for encryption!
+	// tlock.Encrypt only needs the chain's public key (from chain info).
+	// The beacon is only used for DECRYPTION.
+	// This allows encrypting for future rounds that haven't occurred yet.
+
+	// Encrypt - this only uses public key, not beacon
+	return EncryptWithNetwork(network, round, payload, nil)
+}
+
+// dialNetwork creates a network for the chain from the endpoints. Chain info
+// is fetched from all endpoints and cross-checked (see resolveChainInfo).
+func dialNetwork(ctx context.Context, chainHash []byte, endpoints []string) (*WasmNetwork, error) {
+	info, err := resolveChainInfo(ctx, chainHash, endpoints)
+	if err != nil {
+		return nil, err
+	}
+	return newNetworkFromInfo(info)
+}
+
+// generateNetwork resolves the network GenerateVTE encrypts to: pinned chain
+// info (params, then registry), then pre-fetched chain info (required in WASM
+// for unknown chains), then the endpoints.
+func generateNetwork(params *GenerateVTEParams) (tlock.Network, error) {
+	if params.TrustedChain != nil {
+		if !bytes.Equal(params.TrustedChain.ChainHash, params.ChainHash) {
+			return nil, fmt.Errorf("%w: trusted chain %x, params chain %x", ErrNetworkMismatch, params.TrustedChain.ChainHash, params.ChainHash)
+		}
+		return params.TrustedChain.network()
+	}
+	if pinned := pinnedChain(params.ChainHash); pinned != nil {
+		return pinned.network()
+	}
+	if params.ChainInfoJSON != "" {
+		network, err := NewNetworkFromChainInfo(params.ChainInfoJSON, fmt.Sprintf("%x", params.ChainHash))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create network from chain info: %w", err)
+		}
+		return network, nil
+	}
+	return dialNetwork(context.Background(), params.ChainHash, params.DrandEndpoints)
+}
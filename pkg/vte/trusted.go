@@ -0,0 +1,167 @@
+package vte
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/drand/drand/v2/common"
+	"github.com/drand/drand/v2/common/chain"
+	"github.com/drand/drand/v2/crypto"
+)
+
+// TrustedChainInfo is drand chain info pinned by the caller (Invariant C).
+// When supplied, the public key and scheme come from here and never from an
+// endpoint: capsules are encrypted to the pinned key and every fetched beacon
+// is verified against it. Endpoints are only used to fetch signatures.
+//
+// The chain hash only commits to period, genesis time, public key, genesis
+// seed and beacon ID, so those must be pinned too for the hash check; the
+// scheme is not hashed and is trusted as given.
+type TrustedChainInfo struct {
+	ChainHash   []byte
+	PublicKey   []byte // Group public key, compressed
+	SchemeID    string
+	GenesisTime int64  // Unix timestamp of round 1
+	Period      int64  // Seconds between rounds
+	GenesisSeed []byte // "groupHash" in the drand /info response
+	BeaconID    string // Empty or "default" for the default beacon
+}
+
+// TrustedChainInfoFromJSON pins the chain info from a drand /info response,
+// after checking that it hashes to chainHash
+func TrustedChainInfoFromJSON(chainInfoJSON []byte, chainHash []byte) (*TrustedChainInfo, error) {
+	info, err := chain.InfoFromJSON(bytes.NewReader(chainInfoJSON))
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to parse chain info: %v", ErrInvalidInput, err)
+	}
+	if !bytes.Equal(info.Hash(), chainHash) {
+		return nil, fmt.Errorf("%w: chain info hashes to %s, expected %x", ErrChainInfoMismatch, info.HashString(), chainHash)
+	}
+
+	return trustedFromInfo(info)
+}
+
+// trustedFromInfo pins drand chain info that was already checked against its hash
+func trustedFromInfo(info *chain.Info) (*TrustedChainInfo, error) {
+	pubKey, err := info.PublicKey.MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	return &TrustedChainInfo{
+		ChainHash:   info.Hash(),
+		PublicKey:   pubKey,
+		SchemeID:    info.Scheme,
+		GenesisTime: info.GenesisTime,
+		Period:      int64(info.Period / time.Second),
+		GenesisSeed: info.GenesisSeed,
+		BeaconID:    info.ID,
+	}, nil
+}
+
+// Validate checks that the pinned fields hash to the pinned chain hash
+func (t *TrustedChainInfo) Validate() error {
+	_, err := t.chainInfo()
+	return err
+}
+
+// chainInfo converts the pinned fields to drand chain info and checks
+// sha256(info) == ChainHash
+func (t *TrustedChainInfo) chainInfo() (*chain.Info, error) {
+	if t == nil {
+		return nil, fmt.Errorf("%w: no trusted chain info", ErrInvalidInput)
+	}
+	if t.Period <= 0 {
+		return nil, fmt.Errorf("%w: trusted chain period must be positive", ErrInvalidInput)
+	}
+
+	scheme, err := crypto.SchemeFromName(t.SchemeID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown scheme %q", ErrInvalidInput, t.SchemeID)
+	}
+	pubKey := scheme.KeyGroup.Point()
+	if err := pubKey.UnmarshalBinary(t.PublicKey); err != nil {
+		return nil, fmt.Errorf("%w: invalid public key for scheme %s: %v", ErrInvalidInput, t.SchemeID, err)
+	}
+
+	info := &chain.Info{
+		PublicKey:   pubKey,
+		ID:          t.BeaconID,
+		Period:      time.Duration(t.Period) * time.Second,
+		Scheme:      scheme.Name,
+		GenesisTime: t.GenesisTime,
+		GenesisSeed: t.GenesisSeed,
+	}
+	if !bytes.Equal(info.Hash(), t.ChainHash) {
+		return nil, fmt.Errorf("%w: pinned fields hash to %s, pinned chain hash is %x", ErrChainInfoMismatch, info.HashString(), t.ChainHash)
+	}
+
+	return info, nil
+}
+
+// ChainInfoJSON encodes the pinned chain as a drand /info response
+func (t *TrustedChainInfo) ChainInfoJSON() ([]byte, error) {
+	info, err := t.chainInfo()
+	if err != nil {
+		return nil, err
+	}
+	return chainInfoJSON(info)
+}
+
+// VerifyBeacon checks a beacon signature for round against the pinned key
+func (t *TrustedChainInfo) VerifyBeacon(round uint64, signature []byte) error {
+	info, err := t.chainInfo()
+	if err != nil {
+		return err
+	}
+	return verifyBeacon(info, round, signature)
+}
+
+// EncryptWithTrustedChain encrypts the payload (r2) to the pinned public key.
+// No endpoint is contacted, so it also works in WASM.
+func EncryptWithTrustedChain(trusted *TrustedChainInfo, round uint64, payload []byte) ([]byte, error) {
+	network, err := trusted.network()
+	if err != nil {
+		return nil, err
+	}
+	return EncryptWithNetwork(network, round, payload, nil)
+}
+
+// DecryptWithTrustedChain decrypts a capsule with a beacon fetched from the
+// endpoints in order. Only a signature that verifies under the pinned key is used.
+func DecryptWithTrustedChain(ctx context.Context, trusted *TrustedChainInfo, round uint64, capsule []byte, endpoints []string) ([]byte, error) {
+	info, err := trusted.chainInfo()
+	if err != nil {
+		return nil, err
+	}
+	return Beacons.decryptWithInfo(ctx, info, round, capsule, endpoints)
+}
+
+// network builds an offline tlock network for the pinned chain
+func (t *TrustedChainInfo) network() (*WasmNetwork, error) {
+	info, err := t.chainInfo()
+	if err != nil {
+		return nil, err
+	}
+	return newNetworkFromInfo(info)
+}
+
+// verifyBeacon checks a beacon signature for round under the chain's key.
+// Chained schemes are refused: their beacons also sign the previous signature.
+func verifyBeacon(info *chain.Info, round uint64, signature []byte) error {
+	scheme, err := crypto.SchemeFromName(info.Scheme)
+	if err != nil {
+		return fmt.Errorf("unknown scheme %s: %w", info.Scheme, err)
+	}
+	if !UnchainedScheme(scheme.Name) {
+		return fmt.Errorf("%w: chain %s uses chained scheme %s, only unchained beacons are supported", ErrInvalidInput, hex.EncodeToString(info.Hash()), scheme.Name)
+	}
+	beacon := &common.Beacon{Round: round, Signature: signature}
+	if err := scheme.VerifyBeacon(beacon, info.PublicKey); err != nil {
+		return fmt.Errorf("%w: round %d on chain %s: %v", ErrBeaconInvalid, round, hex.EncodeToString(info.Hash()), err)
+	}
+	return nil
+}
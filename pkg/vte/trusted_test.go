@@ -0,0 +1,153 @@
+package vte
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/drand/drand/v2/crypto"
+
+	"vte-tlock/pkg/drandsim"
+)
+
+func trustedFromSim(t *testing.T, network *drandsim.Network) *TrustedChainInfo {
+	t.Helper()
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	trusted, err := TrustedChainInfoFromJSON([]byte(network.ChainInfoJSON()), chainHash)
+	if err != nil {
+		t.Fatalf("TrustedChainInfoFromJSON failed: %v", err)
+	}
+	return trusted
+}
+
+// TestTrustedChainInfoQuicknet pins the real quicknet parameters offline
+func TestTrustedChainInfoQuicknet(t *testing.T) {
+	mustHex := func(s string) []byte {
+		b, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	quicknet := &TrustedChainInfo{
+		ChainHash:   mustHex("52db9ba70e0cc0f6eaf7803dd07447a1f5477735fd3f661792ba94600c84e971"),
+		PublicKey:   mustHex("83cf0f2896adee7eb8b5f01fcad3912212c437e0073e911fb90022d3e760183c8c4b450b6a0a6c3ac6a5776a2d1064510d1fec758c921cc22b0e17e63aaf4bcb5ed66304de9cf809bd274ca73bab4af5a6e9c76a4bc09e76eae8991ef5ece45a"),
+		SchemeID:    crypto.SigsOnG1ID,
+		GenesisTime: 1692803367,
+		Period:      3,
+		GenesisSeed: mustHex("f477d5c89f21a17c863a7f937c6a6d15859414d2be09cd448d4279af331c5d3e"),
+		BeaconID:    "quicknet",
+	}
+	if err := quicknet.Validate(); err != nil {
+		t.Fatalf("Validate failed for quicknet: %v", err)
+	}
+
+	quicknet.Period = 30
+	if err := quicknet.Validate(); !errors.Is(err, ErrChainInfoMismatch) {
+		t.Fatalf("Expected ErrChainInfoMismatch for a tampered period, got %v", err)
+	}
+}
+
+func TestTrustedChainInfoFromJSON(t *testing.T) {
+	network, _, _ := simulatedDrand(t, crypto.UnchainedSchemeID)
+	trusted := trustedFromSim(t, network)
+	if err := trusted.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	other, err := drandsim.New(drandsim.Config{Seed: []byte("other")})
+	if err != nil {
+		t.Fatalf("drandsim.New failed: %v", err)
+	}
+	_, err = TrustedChainInfoFromJSON([]byte(other.ChainInfoJSON()), trusted.ChainHash)
+	if !errors.Is(err, ErrChainInfoMismatch) {
+		t.Fatalf("Expected ErrChainInfoMismatch, got %v", err)
+	}
+	if _, err := NewNetworkFromChainInfo(other.ChainInfoJSON(), network.ChainHash()); !errors.Is(err, ErrChainInfoMismatch) {
+		t.Fatalf("NewNetworkFromChainInfo accepted foreign chain info: %v", err)
+	}
+
+	tampered := *trusted
+	tampered.PublicKey = nil
+	if err := tampered.Validate(); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("Expected ErrInvalidInput for an empty key, got %v", err)
+	}
+}
+
+func TestTrustedChainEncryptDecrypt(t *testing.T) {
+	network, clock, good := simulatedDrand(t, crypto.SigsOnG1ID)
+	trusted := trustedFromSim(t, network)
+	forged := forgedBeaconEndpoint(t, network)
+
+	round := network.LatestRound() + 2
+	r2 := PlaintextToR2("pinned")
+	capsule, err := EncryptWithTrustedChain(trusted, round, r2)
+	if err != nil {
+		t.Fatalf("EncryptWithTrustedChain failed: %v", err)
+	}
+	clock.Advance(2 * network.Info().Period)
+
+	ctx := context.Background()
+	if _, err := DecryptWithTrustedChain(ctx, trusted, round, capsule, []string{forged}); !errors.Is(err, ErrBeaconInvalid) {
+		t.Fatalf("Expected ErrBeaconInvalid from forged endpoint, got %v", err)
+	}
+
+	got, err := DecryptWithTrustedChain(ctx, trusted, round, capsule, []string{forged, good})
+	if err != nil {
+		t.Fatalf("DecryptWithTrustedChain failed: %v", err)
+	}
+	if string(got) != string(r2) {
+		t.Fatalf("Decrypted %x, want %x", got, r2)
+	}
+
+	sig, _ := network.Signature(round)
+	if err := trusted.VerifyBeacon(round, sig); err != nil {
+		t.Fatalf("VerifyBeacon failed: %v", err)
+	}
+	if err := trusted.VerifyBeacon(round+1, sig); !errors.Is(err, ErrBeaconInvalid) {
+		t.Fatalf("Expected ErrBeaconInvalid for the wrong round, got %v", err)
+	}
+
+	prefetched, _ := NewNetworkFromChainInfo(network.ChainInfoJSON(), network.ChainHash())
+	if err := prefetched.(*WasmNetwork).SetPrefetchedBeacon(round+1, hex.EncodeToString(sig)); !errors.Is(err, ErrBeaconInvalid) {
+		t.Fatalf("SetPrefetchedBeacon accepted a beacon for the wrong round: %v", err)
+	}
+}
+
+func TestDecryptVTEWithTrustedChain(t *testing.T) {
+	network, clock, endpoint := simulatedDrand(t, crypto.SigsOnG1ID)
+	trusted := trustedFromSim(t, network)
+	round := network.LatestRound() + 3
+
+	pkg, err := GenerateVTE(&GenerateVTEParams{
+		Round:        round,
+		ChainHash:    trusted.ChainHash,
+		FormatID:     "tlock_v1_age_pairing",
+		SessionID:    "pinned",
+		R2:           PlaintextToR2("pinned secret"),
+		RefundTx:     []byte{0x02},
+		TrustedChain: trusted,
+		// Never contacted: the pinned key is used for encryption
+		DrandEndpoints: []string{deadEndpoint()},
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE failed: %v", err)
+	}
+	clock.Advance(3 * network.Info().Period)
+
+	result, err := DecryptVTEWithTrustedChain(context.Background(), pkg, trusted, []string{endpoint})
+	if err != nil {
+		t.Fatalf("DecryptVTEWithTrustedChain failed: %v", err)
+	}
+	if string(result.R2) != string(PlaintextToR2("pinned secret")) {
+		t.Fatalf("Decrypted wrong r2: %x", result.R2)
+	}
+
+	other, _ := drandsim.New(drandsim.Config{Seed: []byte("other")})
+	_, err = DecryptVTEWithTrustedChain(context.Background(), pkg, trustedFromSim(t, other), []string{endpoint})
+	if !errors.Is(err, ErrNetworkMismatch) {
+		t.Fatalf("Expected ErrNetworkMismatch, got %v", err)
+	}
+}
@@ -8,6 +8,7 @@ import (
 type VTEPackageV2 struct {
 	Version string      `json:"version"` // "vte-tlock/0.2"
 	Tlock   TlockInfo   `json:"tlock"`
+	Lock    *LockInfo   `json:"lock,omitempty"` // multi-network packages only
 	Context ContextInfo `json:"context"`
 	Public  PublicInfo  `json:"public"`
 	Proofs  ProofsInfo  `json:"proofs"`
@@ -22,12 +23,63 @@ type TlockInfo struct {
 	CapsuleHash        []byte `json:"capsule_hash"`         // SHA256(Capsule)
 }
 
+// LockMode says which capsules of a multi-network package open it
+type LockMode string
+
+const (
+	// LockAnyOf encrypts r2 itself to every capsule: any one opens the package
+	LockAnyOf LockMode = "any_of"
+
+	// LockAllOf splits r2 into additive shares, one per capsule: every
+	// capsule must be opened, so no single network can release r2 early
+	LockAllOf LockMode = "all_of"
+
+	// LockThreshold splits r2 into Shamir shares, one per capsule: any
+	// Threshold capsules open the package
+	LockThreshold LockMode = "threshold"
+)
+
+// LockInfo locks r2 to several drand (chain, round) pairs. Packages without
+// it have their single capsule in Tlock; any_of packages also mirror their
+// first capsule there for tools that only read Tlock, and share modes leave
+// Tlock empty since no single capsule holds r2.
+//
+// The per-capsule TLE evidence is never checked: there is no TLE verifier, so
+// nothing shows that an any_of capsule encrypts r2 or that a threshold
+// capsule encrypts its share. The TLE check reports every capsule in
+// UnverifiedCapsules; the swap package funds on the same trust.
+type LockInfo struct {
+	Mode     LockMode      `json:"mode"`
+	Capsules []CapsuleInfo `json:"capsules"`
+
+	// Threshold mode only: k, and the Feldman commitments a_j·G to the
+	// coefficients of the sharing polynomial, a_0·G being R2
+	Threshold    int      `json:"threshold,omitempty"`
+	Coefficients [][]byte `json:"coefficients,omitempty"`
+}
+
+// CapsuleInfo is one capsule of a multi-network package with its own TLE
+// evidence. Every capsule hash is bound into the shared ctx hash, so the
+// shared commitment covers all of them.
+type CapsuleInfo struct {
+	Tlock TlockInfo    `json:"tlock"`
+	Share *ShareInfo   `json:"share,omitempty"` // share modes only
+	TLE   TLEProofInfo `json:"tle"`
+}
+
+// ShareInfo is the public side of the secret share a capsule holds
+type ShareInfo struct {
+	Index uint32 `json:"index,omitempty"` // threshold mode: x of s_i = f(x)
+	Point []byte `json:"point"`           // S_i = s_i·G, SEC1 compressed
+}
+
 type ContextInfo struct {
-	Schema      string   `json:"schema"` // "ctx_v2"
-	Fields      []string `json:"fields"` // ["drand_chain_hash", "round", "capsule_hash", "session_id", "refund_tx_hex"]
-	SessionID   string   `json:"session_id,omitempty"`
-	RefundTxHex string   `json:"refund_tx_hex,omitempty"`
-	CtxHash     []byte   `json:"ctx_hash"` // The binding hash
+	Schema      string     `json:"schema"` // "ctx_v2" | "ctx_v3" | "ctx_v2_multi"
+	Fields      []string   `json:"fields"` // ["drand_chain_hash", "round", "capsule_hash", "session_id", "refund_tx_hex", ...]
+	SessionID   string     `json:"session_id,omitempty"`
+	RefundTxHex string     `json:"refund_tx_hex,omitempty"`
+	Values      []CtxField `json:"values,omitempty"` // ctx_v3 fields after the core ones
+	CtxHash     []byte     `json:"ctx_hash"`         // The binding hash
 }
 
 type PublicInfo struct {
@@ -60,7 +112,7 @@ type CommitmentPublicInputs struct {
 }
 
 type SecpSchnorrInfo struct {
-	Scheme       string   `json:"scheme"`      // "schnorr_fs_v1"
+	Scheme       string   `json:"scheme"`      // "schnorr_fs_v1" | "schnorr_fs_v2"
 	BindFields   []string `json:"bind_fields"` // ["R2", "commitment", "ctx_hash", "capsule_hash"]
 	SignatureB64 []byte   `json:"signature_b64"`
 }
@@ -76,8 +128,74 @@ type MetaInfo struct {
 
 // Validation errors
 var (
-	ErrVersionMismatch = errors.New("version mismatch")
-	ErrNetworkMismatch = errors.New("network/chain ID mismatch")
-	ErrRoundMismatch   = errors.New("round mismatch")
-	ErrCtxHashMismatch = errors.New("context hash mismatch")
+	ErrVersionMismatch     = errors.New("version mismatch")
+	ErrNetworkMismatch     = errors.New("network/chain ID mismatch")
+	ErrRoundMismatch       = errors.New("round mismatch")
+	ErrCtxHashMismatch     = errors.New("context hash mismatch")
+	ErrCapsuleHashMismatch = errors.New("capsule hash mismatch")
+	ErrSessionMismatch     = errors.New("session ID mismatch")
+	ErrRefundTxMismatch    = errors.New("refund tx mismatch")
+	ErrMissingProof        = errors.New("missing proof")
+	ErrCircuitIDMismatch   = errors.New("circuit ID mismatch")
+	ErrProofInvalid        = errors.New("proof verification failed")
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrChainInfoMismatch   = errors.New("drand chain info mismatch")
+	ErrBeaconInvalid       = errors.New("drand beacon invalid")
+	ErrRoundOutOfRange     = errors.New("round outside schedulable range")
+	ErrCommitmentMismatch  = errors.New("commitment mismatch")
+	ErrRelockMismatch      = errors.New("relock link mismatch")
+	ErrShareInvalid        = errors.New("secret share invalid")
+	ErrRefundTxInvalid     = errors.New("refund tx invalid")
 )
+
+// ErrorClass maps an error returned by this package to a stable class name.
+// Test vectors and tooling compare classes instead of error strings, which are
+// free to change. A nil error maps to "success".
+func ErrorClass(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, ErrVersionMismatch):
+		return "error_version_mismatch"
+	case errors.Is(err, ErrNetworkMismatch):
+		return "error_network_id_mismatch"
+	case errors.Is(err, ErrRoundMismatch):
+		return "error_round_mismatch"
+	case errors.Is(err, ErrFormatMismatch):
+		return "error_format_mismatch"
+	case errors.Is(err, ErrMalformedCapsule):
+		return "error_malformed_capsule"
+	case errors.Is(err, ErrCtxHashMismatch):
+		return "error_ctx_hash_mismatch"
+	case errors.Is(err, ErrCapsuleHashMismatch):
+		return "error_capsule_hash_mismatch"
+	case errors.Is(err, ErrSessionMismatch):
+		return "error_session_mismatch"
+	case errors.Is(err, ErrRefundTxMismatch):
+		return "error_refund_tx_mismatch"
+	case errors.Is(err, ErrMissingProof):
+		return "error_missing_proof"
+	case errors.Is(err, ErrCircuitIDMismatch):
+		return "error_circuit_id_mismatch"
+	case errors.Is(err, ErrProofInvalid):
+		return "error_proof_invalid"
+	case errors.Is(err, ErrInvalidInput):
+		return "error_invalid_input"
+	case errors.Is(err, ErrChainInfoMismatch):
+		return "error_chain_info_mismatch"
+	case errors.Is(err, ErrBeaconInvalid):
+		return "error_beacon_invalid"
+	case errors.Is(err, ErrRoundOutOfRange):
+		return "error_round_out_of_range"
+	case errors.Is(err, ErrCommitmentMismatch):
+		return "error_commitment_mismatch"
+	case errors.Is(err, ErrRelockMismatch):
+		return "error_relock_mismatch"
+	case errors.Is(err, ErrShareInvalid):
+		return "error_share_invalid"
+	case errors.Is(err, ErrRefundTxInvalid):
+		return "error_refund_tx_invalid"
+	default:
+		return "error_other"
+	}
+}
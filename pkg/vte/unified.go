@@ -103,7 +103,7 @@ func GenerateVTEWithProofs(ctx context.Context, opts *GenerateVTEOptions) (*VTEP
 //   - Prover cannot forge proofs for a different circuit
 func VerifyCommitmentProof(pkg *VTEPackageV2) error {
 	if len(pkg.Proofs.Commitment.ProofB64) == 0 {
-		return fmt.Errorf("no commitment proof found in package")
+		return fmt.Errorf("%w: no commitment proof found in package", ErrMissingProof)
 	}
 
 	// Validate Circuit ID
@@ -111,15 +111,15 @@ func VerifyCommitmentProof(pkg *VTEPackageV2) error {
 	// In the future, this allows supporting multiple circuit versions
 	expectedID := commitment.GetEmbeddedCircuitID()
 	if pkg.Proofs.Commitment.CircuitID != expectedID {
-		return fmt.Errorf("circuit ID mismatch: package claims %s, verifiable only strictly with %s",
-			pkg.Proofs.Commitment.CircuitID, expectedID)
+		return fmt.Errorf("%w: package claims %s, verifiable only strictly with %s",
+			ErrCircuitIDMismatch, pkg.Proofs.Commitment.CircuitID, expectedID)
 	}
 
 	// Use TRUSTLESS verification with embedded VK
 	// This NEVER uses VK from the package - only embedded VK
 	err := commitment.VerifyWithEmbeddedVK(pkg.Proofs.Commitment.ProofB64, pkg.Public.Commitment, pkg.Context.CtxHash)
 	if err != nil {
-		return fmt.Errorf("commitment proof verification failed: %w", err)
+		return fmt.Errorf("%w: commitment proof: %v", ErrProofInvalid, err)
 	}
 
 	return nil
@@ -140,18 +140,90 @@ type DecryptResult struct {
 
 // DecryptVTE decrypts a VTEPackageV2 and returns the plaintext r2 secret.
 // This requires the timelock to have expired (round reached).
-// Verifier MUST supply trusted endpoints.
+// Verifier MUST supply trusted endpoints. Multi-network packages open with
+// the first capsule whose network has published; capsules on chains the
+// endpoints do not serve also try the registry endpoints of their chain.
 func DecryptVTE(ctx context.Context, pkg *VTEPackageV2, endpoints []string) (*DecryptResult, error) {
+	return Beacons.DecryptVTE(ctx, pkg, endpoints)
+}
+
+// DecryptVTE is the package-level DecryptVTE with c in place of the Beacons
+// cache
+func (c *BeaconCache) DecryptVTE(ctx context.Context, pkg *VTEPackageV2, endpoints []string) (*DecryptResult, error) {
 	if len(endpoints) == 0 {
 		return nil, fmt.Errorf("at least one drand endpoint must be provided")
 	}
 
+	if pkg.Lock != nil {
+		return decryptLocked(pkg, func(t *TlockInfo) ([]byte, error) {
+			return c.Decrypt(ctx, t.DrandChainHash, t.Round, t.Capsule, chainEndpoints(t.DrandChainHash, endpoints))
+		})
+	}
+
 	// Use real decryption
-	r2, err := Decrypt(ctx, pkg.Tlock.DrandChainHash, pkg.Tlock.Round, pkg.Tlock.Capsule, endpoints)
+	r2, err := c.Decrypt(ctx, pkg.Tlock.DrandChainHash, pkg.Tlock.Round, pkg.Tlock.Capsule, endpoints)
 	if err != nil {
 		return nil, fmt.Errorf("decryption failed: %w", err)
 	}
 
+	return checkDecrypted(pkg, r2)
+}
+
+// DecryptVTEWithTrustedChain is DecryptVTE with pinned chain info: the package
+// must be on the pinned chain and the beacon must verify under its key.
+// Capsules of multi-network packages on other chains are opened as in
+// DecryptVTE.
+func DecryptVTEWithTrustedChain(ctx context.Context, pkg *VTEPackageV2, trusted *TrustedChainInfo, endpoints []string) (*DecryptResult, error) {
+	if trusted == nil {
+		return nil, fmt.Errorf("%w: no trusted chain info", ErrInvalidInput)
+	}
+	if pkg.Lock != nil {
+		return decryptLocked(pkg, func(c *TlockInfo) ([]byte, error) {
+			if !bytes.Equal(c.DrandChainHash, trusted.ChainHash) {
+				return Decrypt(ctx, c.DrandChainHash, c.Round, c.Capsule, chainEndpoints(c.DrandChainHash, endpoints))
+			}
+			return DecryptWithTrustedChain(ctx, trusted, c.Round, c.Capsule, endpoints)
+		})
+	}
+	if !bytes.Equal(pkg.Tlock.DrandChainHash, trusted.ChainHash) {
+		return nil, fmt.Errorf("%w: package chain %x, trusted chain %x", ErrNetworkMismatch, pkg.Tlock.DrandChainHash, trusted.ChainHash)
+	}
+
+	r2, err := DecryptWithTrustedChain(ctx, trusted, pkg.Tlock.Round, pkg.Tlock.Capsule, endpoints)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %w", err)
+	}
+
+	return checkDecrypted(pkg, r2)
+}
+
+// DecryptVTEWithBeacon is DecryptVTE without network access: the caller
+// supplies drand chain info and the beacon signature for the package round
+// (see DecryptWithBeacon for how empty values fall back to the registry and
+// the Beacons cache). The chain info must hash to the package chain.
+func DecryptVTEWithBeacon(pkg *VTEPackageV2, chainInfoJSON string, beaconSignatureHex string) (*DecryptResult, error) {
+	if pkg.Lock != nil {
+		return decryptLocked(pkg, func(c *TlockInfo) ([]byte, error) {
+			r2, err := DecryptWithBeacon(c.DrandChainHash, c.Round, c.Capsule, chainInfoJSON, beaconSignatureHex)
+			if err != nil && (chainInfoJSON != "" || beaconSignatureHex != "") {
+				// The supplied beacon is for another capsule's chain
+				if cached, cacheErr := DecryptWithBeacon(c.DrandChainHash, c.Round, c.Capsule, "", ""); cacheErr == nil {
+					return cached, nil
+				}
+			}
+			return r2, err
+		})
+	}
+	r2, err := DecryptWithBeacon(pkg.Tlock.DrandChainHash, pkg.Tlock.Round, pkg.Tlock.Capsule, chainInfoJSON, beaconSignatureHex)
+	if err != nil {
+		return nil, fmt.Errorf("decryption failed: %w", err)
+	}
+
+	return checkDecrypted(pkg, r2)
+}
+
+// checkDecrypted verifies a decrypted r2 against the package commitment
+func checkDecrypted(pkg *VTEPackageV2, r2 []byte) (*DecryptResult, error) {
 	// Verify commitment using MiMC (matching GenerateVTE)
 	expectedC, err := commitment.ComputeCommitmentHash(r2, pkg.Context.CtxHash)
 	if err != nil {
@@ -159,7 +231,7 @@ func DecryptVTE(ctx context.Context, pkg *VTEPackageV2, endpoints []string) (*De
 	}
 
 	if !bytes.Equal(expectedC, pkg.Public.Commitment) {
-		return nil, fmt.Errorf("commitment verification failed: decrypted r2 does not match commitment")
+		return nil, fmt.Errorf("%w: decrypted r2 does not match commitment", ErrCommitmentMismatch)
 	}
 
 	return &DecryptResult{
@@ -27,7 +27,7 @@ func TestZKProofBeforeDecrypt(t *testing.T) {
 
 	// 2. Compute R2 point (this would be in the VTE package)
 	t.Log("\n--- Step 1: Compute R2 point from secret r2 ---")
-	r2Compressed, _, err := ComputeR2Point(r2)
+	r2Compressed, err := ComputeR2Point(r2)
 	if err != nil {
 		t.Fatalf("ComputeR2Point failed: %v", err)
 	}
@@ -55,13 +55,15 @@ func TestZKProofBeforeDecrypt(t *testing.T) {
 	t.Logf("Proof size: %d bytes", len(proofResult.Proof))
 
 	// 5. Create mock VTE package with proof
-	pkg := &VTEPackage{
-		CtxHash: ctxHash,
-		C:       cBytes,
-		ProofCommitment: &CommitmentProof{
-			System:    "groth16",
-			CircuitID: commitment.CircuitID,
-			Proof:     proofResult.Proof,
+	pkg := &VTEPackageV2{
+		Context: ContextInfo{CtxHash: ctxHash},
+		Public:  PublicInfo{Commitment: cBytes},
+		Proofs: ProofsInfo{
+			Commitment: CommitmentProofInfo{
+				System:    "groth16_bn254",
+				CircuitID: commitment.CircuitID,
+				ProofB64:  proofResult.Proof,
+			},
 		},
 	}
 
@@ -83,10 +85,10 @@ func TestZKProofBeforeDecrypt(t *testing.T) {
 // TestVerifyCommitmentProofMalformed tests that invalid proofs are rejected
 func TestVerifyCommitmentProofMalformed(t *testing.T) {
 	// Test with nil proof
-	pkg := &VTEPackage{
-		CtxHash:         make([]byte, 32),
-		C:               make([]byte, 32),
-		ProofCommitment: nil, // Empty
+	pkg := &VTEPackageV2{
+		Context: ContextInfo{CtxHash: make([]byte, 32)},
+		Public:  PublicInfo{Commitment: make([]byte, 32)},
+		// Proofs.Commitment left empty
 	}
 
 	err := VerifyCommitmentProof(pkg)
@@ -0,0 +1,146 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Result is what a Sink receives once a package is opened. R2 is the
+// decrypted secret: treat every sink as holding key material.
+type Result struct {
+	File        string    `json:"file"`
+	CtxHash     string    `json:"ctx_hash"`
+	ChainHash   string    `json:"drand_chain_hash"`
+	Round       uint64    `json:"round"`
+	SessionID   string    `json:"session_id,omitempty"`
+	R2          string    `json:"r2"`
+	Commitment  string    `json:"commitment"`
+	DecryptedAt time.Time `json:"decrypted_at"`
+}
+
+// Sink delivers results. Name must be stable across restarts: the watcher
+// records deliveries per sink name so a restart only retries the sinks that
+// have not acknowledged a result yet. Deliver may be called more than once for
+// one result and should be idempotent.
+type Sink interface {
+	Name() string
+	Deliver(ctx context.Context, result *Result) error
+}
+
+// FileSink writes each result to <Dir>/<ctx_hash>.json, readable by the owner only
+type FileSink struct {
+	Dir string
+}
+
+func (s *FileSink) Name() string { return "file:" + s.Dir }
+
+func (s *FileSink) Deliver(_ context.Context, result *Result) error {
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return err
+	}
+	return writeFileAtomic(filepath.Join(s.Dir, result.CtxHash+".json"), data, 0o600)
+}
+
+// LinesSink writes each result as one JSON line, e.g. to os.Stdout
+type LinesSink struct {
+	W io.Writer
+
+	mu sync.Mutex
+}
+
+// NewStdoutSink returns a LinesSink on standard output
+func NewStdoutSink() *LinesSink { return &LinesSink{W: os.Stdout} }
+
+func (s *LinesSink) Name() string { return "stdout" }
+
+func (s *LinesSink) Deliver(_ context.Context, result *Result) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.W.Write(append(data, '\n'))
+	return err
+}
+
+// WebhookSink POSTs each result as JSON to URL. Any non-2xx status is a
+// failed delivery and is retried. With a Secret, the body is signed in the
+// X-VTE-Signature header as "sha256=" + hex(HMAC-SHA256(Secret, body)).
+type WebhookSink struct {
+	URL    string
+	Secret []byte
+
+	// Client defaults to an http.Client with a 30 second timeout
+	Client *http.Client
+}
+
+func (s *WebhookSink) Name() string { return "webhook:" + s.URL }
+
+func (s *WebhookSink) Deliver(ctx context.Context, result *Result) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.Secret) > 0 {
+		mac := hmac.New(sha256.New, s.Secret)
+		mac.Write(body)
+		req.Header.Set("X-VTE-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s returned %s", s.URL, resp.Status)
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path so readers never see a partial file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
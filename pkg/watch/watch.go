@@ -0,0 +1,504 @@
+// Package watch opens stored VTE packages as soon as their drand round is
+// reached.
+//
+// A Watcher scans a directory of package files (*.json, VTEPackageV2), schedules
+// each package at the nominal time of its round (for multi-network packages,
+// the time enough capsules are open), decrypts it with
+// vte.DecryptVTE, which also checks r2 against the package commitment, and
+// hands the result to every Sink. Progress is kept in a state file, so after a
+// restart delivered packages are not delivered again and pending sinks are
+// retried. Decrypted secrets are never written to the state file: a package
+// that still has pending sinks is decrypted again, which the beacon cache
+// makes cheap.
+package watch
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/drand/tlock"
+
+	"vte-tlock/pkg/vte"
+)
+
+// StateVersion is the version tag of the state file
+const StateVersion = "vte-watch/1"
+
+// Config configures a Watcher
+type Config struct {
+	// Dir holds the package files. Dotfiles and non-.json files are ignored.
+	Dir string
+
+	// Endpoints are the drand endpoints used for every package. Empty uses the
+	// endpoints of the package's chain in vte.Networks.
+	Endpoints []string
+
+	// Cache holds chain info and beacons. Nil uses vte.Beacons.
+	Cache *vte.BeaconCache
+
+	// Sinks receive every opened package; at least one is required
+	Sinks []Sink
+
+	// StatePath is the state file. Empty uses <Dir>/.vte-watch-state.json.
+	StatePath string
+
+	// PollInterval is how often Dir is rescanned (default 10s)
+	PollInterval time.Duration
+
+	// RetryInterval is the first retry delay after a failure, doubled per
+	// consecutive failure up to MaxRetryInterval (defaults 5s and 10m). A beacon
+	// that is late after its nominal time is retried every RetryInterval.
+	RetryInterval    time.Duration
+	MaxRetryInterval time.Duration
+
+	// MaxAttempts gives up on a package after that many consecutive failures.
+	// Zero retries forever.
+	MaxAttempts int
+
+	// Logf reports progress and failures. Nil uses log.Printf.
+	Logf func(format string, args ...any)
+
+	// Now supplies the current time. Nil uses time.Now.
+	Now func() time.Time
+}
+
+// Status is the progress of one package
+type Status string
+
+const (
+	StatusWaiting    Status = "waiting"    // round not reached or not decrypted yet
+	StatusDelivering Status = "delivering" // decrypted, some sinks still pending
+	StatusDone       Status = "done"       // delivered to every sink
+	StatusFailed     Status = "failed"     // given up, see LastError
+)
+
+// Entry is the persisted state of one package, keyed by its ctx hash
+type Entry struct {
+	File        string    `json:"file"`
+	ChainHash   string    `json:"drand_chain_hash"`
+	Round       uint64    `json:"round"`
+	UnlockAt    time.Time `json:"unlock_at,omitempty"`
+	Status      Status    `json:"status"`
+	Attempts    int       `json:"attempts,omitempty"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	Delivered   []string  `json:"delivered,omitempty"`
+}
+
+type stateFile struct {
+	Version  string            `json:"version"`
+	Packages map[string]*Entry `json:"packages"`
+}
+
+// Watcher schedules, opens and delivers packages. Use Run for a daemon or
+// RunOnce to drive it from elsewhere.
+type Watcher struct {
+	cfg Config
+
+	mu      sync.Mutex
+	entries map[string]*Entry
+	timing  map[string]vte.DrandNetworkInfo
+	skipped map[string]time.Time // unusable files by mod time, logged once
+}
+
+// New validates the config and loads the state file, if any
+func New(cfg Config) (*Watcher, error) {
+	if cfg.Dir == "" {
+		return nil, fmt.Errorf("%w: a package directory is required", vte.ErrInvalidInput)
+	}
+	if len(cfg.Sinks) == 0 {
+		return nil, fmt.Errorf("%w: at least one sink is required", vte.ErrInvalidInput)
+	}
+	names := make(map[string]bool)
+	for _, sink := range cfg.Sinks {
+		if names[sink.Name()] {
+			return nil, fmt.Errorf("%w: duplicate sink %s", vte.ErrInvalidInput, sink.Name())
+		}
+		names[sink.Name()] = true
+	}
+	if cfg.StatePath == "" {
+		cfg.StatePath = filepath.Join(cfg.Dir, ".vte-watch-state.json")
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = 10 * time.Second
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = 5 * time.Second
+	}
+	if cfg.MaxRetryInterval < cfg.RetryInterval {
+		cfg.MaxRetryInterval = max(10*time.Minute, cfg.RetryInterval)
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = log.Printf
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.Cache == nil {
+		cfg.Cache = vte.Beacons
+	}
+
+	w := &Watcher{
+		cfg:     cfg,
+		entries: make(map[string]*Entry),
+		timing:  make(map[string]vte.DrandNetworkInfo),
+		skipped: make(map[string]time.Time),
+	}
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Entries returns a copy of the state of every known package by ctx hash
+func (w *Watcher) Entries() map[string]Entry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make(map[string]Entry, len(w.entries))
+	for key, e := range w.entries {
+		c := *e
+		c.Delivered = append([]string(nil), e.Delivered...)
+		out[key] = c
+	}
+	return out
+}
+
+// Run scans and processes packages until ctx is done. It returns ctx.Err(),
+// or the error if the state file cannot be written.
+func (w *Watcher) Run(ctx context.Context) error {
+	for {
+		if err := w.RunOnce(ctx); err != nil {
+			return err
+		}
+		timer := time.NewTimer(w.nextWake())
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// RunOnce rescans Dir, processes every package that is due and saves the
+// state. Package failures are recorded and retried, not returned.
+func (w *Watcher) RunOnce(ctx context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.scan(); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(w.entries))
+	for key := range w.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	now := w.cfg.Now()
+	for _, key := range keys {
+		e := w.entries[key]
+		if (e.Status == StatusWaiting || e.Status == StatusDelivering) && !now.Before(e.NextAttempt) {
+			w.process(ctx, key, e)
+		}
+	}
+	return w.save()
+}
+
+// nextWake is the delay until the next due package or rescan
+func (w *Watcher) nextWake() time.Duration {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	wait := w.cfg.PollInterval
+	now := w.cfg.Now()
+	for _, e := range w.entries {
+		if e.Status == StatusWaiting || e.Status == StatusDelivering {
+			wait = min(wait, e.NextAttempt.Sub(now))
+		}
+	}
+	return max(wait, 0)
+}
+
+// scan adds new package files and forgets waiting packages whose file is gone
+func (w *Watcher) scan() error {
+	dirEntries, err := os.ReadDir(w.cfg.Dir)
+	if err != nil {
+		return fmt.Errorf("read package directory: %w", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, de := range dirEntries {
+		name := de.Name()
+		if de.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != ".json" {
+			continue
+		}
+		path := filepath.Join(w.cfg.Dir, name)
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		if mod, ok := w.skipped[path]; ok && mod.Equal(info.ModTime()) {
+			continue
+		}
+
+		pkg, err := readPackage(path)
+		if err != nil {
+			w.skipped[path] = info.ModTime()
+			w.cfg.Logf("vte-watch: skipping %s: %v", name, err)
+			continue
+		}
+		delete(w.skipped, path)
+
+		key := hex.EncodeToString(pkg.Context.CtxHash)
+		seen[key] = true
+		if e, ok := w.entries[key]; ok {
+			e.File = name
+			continue
+		}
+		first := pkg.Capsules()[0]
+		w.entries[key] = &Entry{
+			File:        name,
+			ChainHash:   hex.EncodeToString(first.DrandChainHash),
+			Round:       first.Round,
+			Status:      StatusWaiting,
+			NextAttempt: w.cfg.Now(),
+		}
+		w.cfg.Logf("vte-watch: tracking %s (round %d)", name, first.Round)
+	}
+
+	for key, e := range w.entries {
+		if e.Status == StatusWaiting && !seen[key] {
+			w.cfg.Logf("vte-watch: %s was removed before its round, forgetting it", e.File)
+			delete(w.entries, key)
+		}
+	}
+	return nil
+}
+
+// process takes one package a step further: schedule, decrypt, deliver
+func (w *Watcher) process(ctx context.Context, key string, e *Entry) {
+	now := w.cfg.Now()
+
+	pkg, err := readPackage(filepath.Join(w.cfg.Dir, e.File))
+	if err == nil && hex.EncodeToString(pkg.Context.CtxHash) != key {
+		err = fmt.Errorf("%s no longer holds package %s", e.File, key)
+	}
+	if err != nil {
+		w.fail(e, err)
+		return
+	}
+
+	if e.UnlockAt.IsZero() {
+		gate, unlockAt, err := w.unlockTime(ctx, pkg)
+		if err != nil {
+			w.fail(e, fmt.Errorf("chain info: %w", err))
+			return
+		}
+		e.ChainHash = hex.EncodeToString(gate.DrandChainHash)
+		e.Round = gate.Round
+		e.UnlockAt = unlockAt
+		e.NextAttempt = e.UnlockAt
+		w.cfg.Logf("vte-watch: %s unlocks at %s", e.File, e.UnlockAt.UTC().Format(time.RFC3339))
+		if now.Before(e.UnlockAt) {
+			return
+		}
+	}
+
+	endpoints := w.cfg.Endpoints
+	if pkg.Lock == nil {
+		endpoints = w.endpoints(pkg.Tlock.DrandChainHash)
+	}
+	result, err := w.cfg.Cache.DecryptVTE(ctx, pkg, endpoints)
+	switch {
+	case errors.Is(err, tlock.ErrTooEarly):
+		// Nominal time reached but the beacon is not out yet
+		e.NextAttempt = now.Add(w.cfg.RetryInterval)
+		return
+	case errors.Is(err, vte.ErrCommitmentMismatch), errors.Is(err, vte.ErrMalformedCapsule), errors.Is(err, vte.ErrFormatMismatch):
+		e.Status = StatusFailed
+		e.LastError = err.Error()
+		w.cfg.Logf("vte-watch: %s cannot be opened: %v", e.File, err)
+		return
+	case err != nil:
+		w.fail(e, err)
+		return
+	}
+
+	e.Status = StatusDelivering
+	out := &Result{
+		File:        e.File,
+		CtxHash:     key,
+		ChainHash:   e.ChainHash,
+		Round:       e.Round,
+		SessionID:   pkg.Context.SessionID,
+		R2:          hex.EncodeToString(result.R2),
+		Commitment:  hex.EncodeToString(result.Commitment),
+		DecryptedAt: now.UTC(),
+	}
+	var failed []error
+	for _, sink := range w.cfg.Sinks {
+		if slices.Contains(e.Delivered, sink.Name()) {
+			continue
+		}
+		if err := sink.Deliver(ctx, out); err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", sink.Name(), err))
+			continue
+		}
+		e.Delivered = append(e.Delivered, sink.Name())
+		e.Attempts = 0
+	}
+	if len(failed) > 0 {
+		w.fail(e, errors.Join(failed...))
+		return
+	}
+
+	e.Status = StatusDone
+	e.Attempts = 0
+	e.LastError = ""
+	w.cfg.Logf("vte-watch: %s opened and delivered", e.File)
+}
+
+// fail records a retryable failure and schedules the retry with backoff
+func (w *Watcher) fail(e *Entry, err error) {
+	e.Attempts++
+	e.LastError = err.Error()
+	if w.cfg.MaxAttempts > 0 && e.Attempts >= w.cfg.MaxAttempts {
+		e.Status = StatusFailed
+		w.cfg.Logf("vte-watch: giving up on %s after %d attempts: %v", e.File, e.Attempts, err)
+		return
+	}
+
+	delay := w.cfg.RetryInterval
+	for i := 1; i < e.Attempts && delay < w.cfg.MaxRetryInterval; i++ {
+		delay *= 2
+	}
+	delay = min(delay, w.cfg.MaxRetryInterval)
+	e.NextAttempt = w.cfg.Now().Add(delay)
+	w.cfg.Logf("vte-watch: %s attempt %d failed, retrying in %s: %v", e.File, e.Attempts, delay, err)
+}
+
+// unlockTime returns the capsule that gates the package and its nominal
+// time: with k capsules needed to open it (see vte.LockInfo.Needed), the k-th
+// earliest
+func (w *Watcher) unlockTime(ctx context.Context, pkg *vte.VTEPackageV2) (vte.TlockInfo, time.Time, error) {
+	type scheduled struct {
+		capsule vte.TlockInfo
+		at      time.Time
+	}
+	var capsules []scheduled
+	for _, c := range pkg.Capsules() {
+		timing, err := w.chainTiming(ctx, c.DrandChainHash)
+		if err != nil {
+			return vte.TlockInfo{}, time.Time{}, err
+		}
+		capsules = append(capsules, scheduled{c, timing.RoundToTime(c.Round)})
+	}
+	sort.SliceStable(capsules, func(i, j int) bool { return capsules[i].at.Before(capsules[j].at) })
+
+	need := 1
+	if pkg.Lock != nil {
+		need = min(max(pkg.Lock.Needed(), 1), len(capsules))
+	}
+	gate := capsules[need-1]
+	return gate.capsule, gate.at, nil
+}
+
+// chainTiming returns the round timing of a chain from the registry, the
+// beacon cache or the endpoints
+func (w *Watcher) chainTiming(ctx context.Context, chainHash []byte) (vte.DrandNetworkInfo, error) {
+	key := hex.EncodeToString(chainHash)
+	if timing, ok := w.timing[key]; ok {
+		return timing, nil
+	}
+
+	trusted, err := w.cfg.Cache.ChainInfo(chainHash)
+	if err != nil {
+		if trusted, err = vte.FetchChainInfo(ctx, chainHash, w.endpoints(chainHash)); err != nil {
+			return vte.DrandNetworkInfo{}, err
+		}
+	}
+	timing := vte.DrandNetworkInfo{
+		ChainHash:   trusted.ChainHash,
+		GenesisTime: trusted.GenesisTime,
+		Period:      trusted.Period,
+		SchemeID:    trusted.SchemeID,
+	}
+	w.timing[key] = timing
+	return timing, nil
+}
+
+func (w *Watcher) endpoints(chainHash []byte) []string {
+	if len(w.cfg.Endpoints) > 0 {
+		return w.cfg.Endpoints
+	}
+	if n, err := vte.Networks.LookupHash(chainHash); err == nil {
+		return n.Endpoints
+	}
+	return nil
+}
+
+func (w *Watcher) load() error {
+	data, err := os.ReadFile(w.cfg.StatePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read state: %w", err)
+	}
+	var state stateFile
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("%w: state file %s: %v", vte.ErrInvalidInput, w.cfg.StatePath, err)
+	}
+	if state.Version != StateVersion {
+		return fmt.Errorf("%w: state file %s is %q, expected %q", vte.ErrVersionMismatch, w.cfg.StatePath, state.Version, StateVersion)
+	}
+	if state.Packages != nil {
+		w.entries = state.Packages
+	}
+	return nil
+}
+
+func (w *Watcher) save() error {
+	data, err := json.MarshalIndent(stateFile{Version: StateVersion, Packages: w.entries}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(w.cfg.StatePath, data, 0o600); err != nil {
+		return fmt.Errorf("write state: %w", err)
+	}
+	return nil
+}
+
+// readPackage loads a package file and checks its ctx hash binding, so the
+// ctx hash it is tracked under is the one the package commits to
+func readPackage(path string) (*vte.VTEPackageV2, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var pkg vte.VTEPackageV2
+	if err := json.Unmarshal(data, &pkg); err != nil {
+		return nil, fmt.Errorf("%w: not a VTE package: %v", vte.ErrInvalidInput, err)
+	}
+	for _, c := range pkg.Capsules() {
+		if len(c.DrandChainHash) == 0 || c.Round == 0 || len(c.Capsule) == 0 {
+			return nil, fmt.Errorf("%w: not a VTE package: missing tlock fields", vte.ErrInvalidInput)
+		}
+	}
+	if err := vte.VerifyCtxHashBinding(&pkg); err != nil {
+		return nil, err
+	}
+	return &pkg, nil
+}
@@ -0,0 +1,257 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/drand/drand/v2/crypto"
+
+	"vte-tlock/internal/drandtest"
+	"vte-tlock/pkg/drandsim"
+	"vte-tlock/pkg/vte"
+)
+
+func simulated(t *testing.T) (*drandsim.Network, *drandsim.ManualClock, string) {
+	t.Helper()
+	saved := vte.Beacons
+	vte.Beacons = vte.NewBeaconCache(vte.NewMemoryBeaconStore())
+	t.Cleanup(func() { vte.Beacons = saved })
+
+	network, clock, server := drandtest.Start(t, drandsim.Config{Scheme: crypto.SigsOnG1ID, Seed: []byte("watch")})
+	clock.Advance(time.Hour)
+	return network, clock, server.URL
+}
+
+// writePackage generates a package for round and stores it as dir/name
+func writePackage(t *testing.T, network *drandsim.Network, endpoint, dir, name string, round uint64) *vte.VTEPackageV2 {
+	t.Helper()
+	chainHash, _ := hex.DecodeString(network.ChainHash())
+	pkg, err := vte.GenerateVTE(&vte.GenerateVTEParams{
+		Round:          round,
+		ChainHash:      chainHash,
+		FormatID:       "tlock_v1_age_pairing",
+		SessionID:      name,
+		R2:             vte.PlaintextToR2(name),
+		DrandEndpoints: []string{endpoint},
+	})
+	if err != nil {
+		t.Fatalf("GenerateVTE failed: %v", err)
+	}
+	savePackage(t, filepath.Join(dir, name), pkg)
+	return pkg
+}
+
+func savePackage(t *testing.T, path string, pkg *vte.VTEPackageV2) {
+	t.Helper()
+	data, _ := json.Marshal(pkg)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherDeliversAcrossRestart(t *testing.T) {
+	network, clock, endpoint := simulated(t)
+	dir, out := t.TempDir(), t.TempDir()
+	round := network.LatestRound() + 3
+	pkg := writePackage(t, network, endpoint, dir, "switch.json", round)
+	key := hex.EncodeToString(pkg.Context.CtxHash)
+
+	// The webhook is down for its first delivery
+	var calls atomic.Int32
+	var body []byte
+	var signature string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			http.Error(w, "down", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-VTE-Signature")
+	}))
+	defer hook.Close()
+
+	var lines bytes.Buffer
+	sinks := []Sink{&FileSink{Dir: out}, &LinesSink{W: &lines}, &WebhookSink{URL: hook.URL, Secret: []byte("s3cret")}}
+	cfg := Config{Dir: dir, Endpoints: []string{endpoint}, Sinks: sinks, Now: clock.Now, Logf: t.Logf}
+	ctx := context.Background()
+
+	w, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if err := w.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	e := w.Entries()[key]
+	if e.Status != StatusWaiting || e.Round != round {
+		t.Fatalf("Before the round: %+v", e)
+	}
+	if want := network.Info().GenesisTime + int64(round-1)*int64(network.Info().Period/time.Second); e.UnlockAt.Unix() != want {
+		t.Fatalf("UnlockAt = %d, want %d", e.UnlockAt.Unix(), want)
+	}
+
+	clock.Set(e.UnlockAt)
+	if err := w.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	e = w.Entries()[key]
+	if e.Status != StatusDelivering || len(e.Delivered) != 2 || e.Attempts != 1 {
+		t.Fatalf("After a failed webhook: %+v", e)
+	}
+	var result Result
+	if err := json.Unmarshal(lines.Bytes(), &result); err != nil {
+		t.Fatalf("stdout line: %v", err)
+	}
+	if result.R2 != hex.EncodeToString(vte.PlaintextToR2("switch.json")) || result.CtxHash != key {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if _, err := os.Stat(filepath.Join(out, key+".json")); err != nil {
+		t.Fatalf("File sink: %v", err)
+	}
+
+	// A restarted watcher only retries the webhook, after the backoff
+	w, err = New(cfg)
+	if err != nil {
+		t.Fatalf("New from state failed: %v", err)
+	}
+	clock.Advance(5 * time.Second)
+	if err := w.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if e := w.Entries()[key]; e.Status != StatusDone || e.LastError != "" {
+		t.Fatalf("After restart: %+v", e)
+	}
+	if n := strings.Count(lines.String(), "\n"); n != 1 {
+		t.Fatalf("stdout sink got %d lines, want 1", n)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	if signature != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Fatalf("Bad webhook signature %q", signature)
+	}
+
+	// Done packages stay done
+	if err := w.RunOnce(ctx); err != nil || calls.Load() != 2 {
+		t.Fatalf("Webhook called %d times, err %v", calls.Load(), err)
+	}
+}
+
+func TestWatcherFailures(t *testing.T) {
+	network, clock, endpoint := simulated(t)
+	dir := t.TempDir()
+	round := network.LatestRound() + 1
+
+	// Wrong commitment: decrypts, then fails the check for good
+	bad := writePackage(t, network, endpoint, dir, "tampered.json", round)
+	bad.Public.Commitment = vte.PlaintextToR2("not the commitment")
+	savePackage(t, filepath.Join(dir, "tampered.json"), bad)
+
+	// Removed before its round: forgotten
+	later := writePackage(t, network, endpoint, dir, "withdrawn.json", round+100)
+
+	// Not a package: skipped
+	if err := os.WriteFile(filepath.Join(dir, "notes.json"), []byte(`{"hello":1}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines bytes.Buffer
+	w, err := New(Config{Dir: dir, Endpoints: []string{endpoint}, Sinks: []Sink{&LinesSink{W: &lines}}, Now: clock.Now, Logf: t.Logf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := w.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(w.Entries()); n != 2 {
+		t.Fatalf("Tracking %d packages, want 2", n)
+	}
+
+	clock.Advance(network.Info().Period)
+	if err := os.Remove(filepath.Join(dir, "withdrawn.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.RunOnce(ctx); err != nil {
+		t.Fatal(err)
+	}
+	entries := w.Entries()
+	if _, ok := entries[hex.EncodeToString(later.Context.CtxHash)]; ok {
+		t.Fatal("Removed package is still tracked")
+	}
+	e := entries[hex.EncodeToString(bad.Context.CtxHash)]
+	if e.Status != StatusFailed || !strings.Contains(e.LastError, vte.ErrCommitmentMismatch.Error()) {
+		t.Fatalf("Tampered package: %+v", e)
+	}
+	if lines.Len() != 0 {
+		t.Fatalf("Tampered package was delivered: %s", lines.String())
+	}
+}
+
+func TestWatcherGivesUp(t *testing.T) {
+	network, clock, endpoint := simulated(t)
+	dir := t.TempDir()
+	pkg := writePackage(t, network, endpoint, dir, "unreachable.json", network.LatestRound()+1)
+	clock.Advance(network.Info().Period)
+
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	w, err := New(Config{
+		Dir:           dir,
+		Endpoints:     []string{dead.URL},
+		Sinks:         []Sink{&LinesSink{W: &bytes.Buffer{}}},
+		RetryInterval: time.Second,
+		MaxAttempts:   3,
+		Now:           clock.Now,
+		Logf:          t.Logf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := hex.EncodeToString(pkg.Context.CtxHash)
+	for i, wait := range []time.Duration{0, time.Second, 2 * time.Second} {
+		clock.Advance(wait)
+		if err := w.RunOnce(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if e := w.Entries()[key]; e.Attempts != i+1 {
+			t.Fatalf("Attempt %d: %+v", i+1, e)
+		}
+	}
+	if e := w.Entries()[key]; e.Status != StatusFailed {
+		t.Fatalf("Expected to give up, got %+v", e)
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	dir := t.TempDir()
+	for _, cfg := range []Config{
+		{Sinks: []Sink{NewStdoutSink()}},
+		{Dir: dir},
+		{Dir: dir, Sinks: []Sink{NewStdoutSink(), NewStdoutSink()}},
+	} {
+		if _, err := New(cfg); err == nil {
+			t.Errorf("New(%+v) should fail", cfg)
+		}
+	}
+
+	state := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(state, []byte(`{"version":"vte-watch/0"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Config{Dir: dir, StatePath: state, Sinks: []Sink{NewStdoutSink()}}); err == nil {
+		t.Error("Expected an unknown state version to be rejected")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"vte-tlock/circuits/commitment"
+	"vte-tlock/vectors"
+)
+
+// This tool regenerates the conformance vectors in vectors/
+// Run: go run -tags detproof vectors/cmd/genvectors/main.go
+func main() {
+	seed := flag.String("seed", vectors.DefaultSeed, "seed all vector randomness is derived from")
+	outDir := flag.String("out", "vectors", "output directory")
+	flag.Parse()
+
+	if !commitment.DeterministicProofs {
+		fmt.Println("Groth16 proofs are only reproducible in detproof builds: run with -tags detproof")
+		os.Exit(1)
+	}
+
+	fmt.Printf("Generating vectors (seed %q)...\n", *seed)
+
+	suites, err := vectors.Generate(*seed)
+	if err != nil {
+		fmt.Printf("Generation failed: %v\n", err)
+		os.Exit(1)
+	}
+
+	names := make([]string, 0, len(suites))
+	for name := range suites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := vectors.Marshal(suites[name])
+		if err != nil {
+			fmt.Printf("Failed to encode %s: %v\n", name, err)
+			os.Exit(1)
+		}
+		path := filepath.Join(*outDir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			fmt.Printf("Failed to write %s: %v\n", path, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s: %d vectors\n", path, len(suites[name].Vectors))
+	}
+
+	fmt.Println("\n✅ Done!")
+}
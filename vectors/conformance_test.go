@@ -0,0 +1,96 @@
+package vectors
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"vte-tlock/circuits/commitment"
+	"vte-tlock/pkg/vte"
+)
+
+var vectorFiles = []string{EncodingFile, TlockFile, ProofFile}
+
+// TestConformance replays every checked-in vector against the implementation
+func TestConformance(t *testing.T) {
+	for _, name := range vectorFiles {
+		suite, err := Load(name)
+		if err != nil {
+			t.Fatalf("Load %s failed: %v", name, err)
+		}
+		if suite.Suite != SuiteName {
+			t.Fatalf("%s: suite %q, want %q", name, suite.Suite, SuiteName)
+		}
+		if len(suite.Vectors) == 0 {
+			t.Fatalf("%s: no vectors", name)
+		}
+
+		for i := range suite.Vectors {
+			v := &suite.Vectors[i]
+			t.Run(v.ID, func(t *testing.T) {
+				if err := Replay(v); err != nil {
+					t.Errorf("%s: %v", v.Description, err)
+				}
+			})
+		}
+	}
+}
+
+// TestVectorsUpToDate regenerates the vectors from DefaultSeed and checks the
+// result is byte-identical to the checked-in files. Without -tags detproof the
+// Groth16 proofs are random and are left out of the comparison.
+func TestVectorsUpToDate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping vector regeneration in short mode")
+	}
+
+	suites, err := Generate(DefaultSeed)
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	for _, name := range vectorFiles {
+		want, err := Marshal(withoutRandomProofs(t, suites[name]))
+		if err != nil {
+			t.Fatalf("Marshal %s failed: %v", name, err)
+		}
+		suite, err := Load(name)
+		if err != nil {
+			t.Fatalf("Load %s failed: %v", name, err)
+		}
+		have, err := Marshal(withoutRandomProofs(t, suite))
+		if err != nil {
+			t.Fatalf("Marshal %s failed: %v", name, err)
+		}
+		if !bytes.Equal(have, want) {
+			t.Errorf("%s is stale: run go run -tags detproof vectors/cmd/genvectors/main.go", name)
+		}
+	}
+}
+
+// withoutRandomProofs strips the Groth16 commitment proofs from a suite unless
+// they are deterministic in this build
+func withoutRandomProofs(t *testing.T, s *Suite) *Suite {
+	if commitment.DeterministicProofs {
+		return s
+	}
+	out := &Suite{Suite: s.Suite, Vectors: append([]Vector(nil), s.Vectors...)}
+	for i := range out.Vectors {
+		v := &out.Vectors[i]
+		v.Outputs.ProofCommitmentBase64 = ""
+		if v.Inputs.Package == nil {
+			continue
+		}
+		var pkg vte.VTEPackageV2
+		if err := json.Unmarshal(v.Inputs.Package, &pkg); err != nil {
+			t.Fatalf("%s: %v", v.ID, err)
+		}
+		pkg.Proofs.Commitment.ProofB64 = nil
+		raw, err := json.Marshal(&pkg)
+		if err != nil {
+			t.Fatalf("%s: %v", v.ID, err)
+		}
+		v.Inputs.Package = raw
+	}
+	return out
+}
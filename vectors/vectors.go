@@ -0,0 +1,307 @@
+// Package vectors holds the VTE v0.2.1 conformance vectors (spec/testvectors.md)
+// together with the code that generates and replays them.
+package vectors
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"vte-tlock/circuits/commitment"
+	"vte-tlock/pkg/vte"
+)
+
+// SuiteName identifies the spec revision the vectors were generated for
+const SuiteName = "vte_v0.2.1"
+
+// Vector files, relative to the vectors/ directory
+const (
+	EncodingFile = "encoding_vectors.json"
+	TlockFile    = "tlock_vectors.json"
+	ProofFile    = "proof_vectors.json"
+)
+
+// Operations replayed by Replay
+const (
+	OpR2Point      = "r2_point"      // ComputeR2Point
+	OpCommitment   = "commitment"    // commitment.ComputeCommitmentHash
+	OpCtxHash      = "ctx_hash"      // ComputeFullCtxHash
+	OpParseCapsule = "parse_capsule" // ParseCapsule
+	OpVerify       = "verify_vte"    // VerifyVTE
+)
+
+// Suite is the content of one vectors/*.json file
+type Suite struct {
+	Suite   string   `json:"suite"`
+	Vectors []Vector `json:"vectors"`
+}
+
+// Vector is a single conformance case. Byte values are hex unless the field
+// name says base64.
+type Vector struct {
+	ID          string  `json:"id"`
+	Description string  `json:"description"`
+	Operation   string  `json:"operation"`
+	Inputs      Inputs  `json:"inputs"`
+	Outputs     Outputs `json:"outputs"`
+}
+
+type Inputs struct {
+	Round         uint64          `json:"round,omitempty"`
+	ChainHash     string          `json:"chainhash,omitempty"`
+	R2            string          `json:"r2,omitempty"`
+	SessionID     string          `json:"session_id,omitempty"`
+	RefundTx      string          `json:"refund_tx,omitempty"`
+	CapsuleHash   string          `json:"capsule_hash,omitempty"`
+	CtxHash       string          `json:"ctx_hash,omitempty"`
+	FormatID      string          `json:"format_id,omitempty"`
+	CapsuleBase64 string          `json:"capsule_base64,omitempty"`
+	Package       json.RawMessage `json:"package,omitempty"`
+	Expected      *Expectations   `json:"expected,omitempty"`
+}
+
+// Expectations are the verifier-supplied facts passed to VerifyVTE
+type Expectations struct {
+	Round     uint64 `json:"round,omitempty"`
+	ChainHash string `json:"chainhash,omitempty"`
+	FormatID  string `json:"format_id,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	RefundTx  string `json:"refund_tx,omitempty"`
+}
+
+type Outputs struct {
+	CtxHash               string           `json:"ctx_hash,omitempty"`
+	C                     string           `json:"C,omitempty"`
+	R2                    string           `json:"param_R2,omitempty"`
+	CapsuleBase64         string           `json:"capsule_base64,omitempty"`
+	CipherFields          *CipherFieldsHex `json:"cipher_fields,omitempty"`
+	ProofSecpBase64       string           `json:"proof_secp_base64,omitempty"`
+	ProofCommitmentBase64 string           `json:"proof_commitment_base64,omitempty"`
+	ProofTLEBase64        string           `json:"proof_tle_base64,omitempty"`
+	Result                string           `json:"result"` // vte.ErrorClass of the operation
+}
+
+// CipherFieldsHex mirrors vte.CipherFields with hex encoded members
+type CipherFieldsHex struct {
+	EphemeralPubKey string `json:"ephemeral_pub_key"`
+	Mask            string `json:"mask"`
+	Tag             string `json:"tag"`
+	Ciphertext      string `json:"ciphertext"`
+}
+
+// Load reads a suite from disk
+func Load(path string) (*Suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Suite
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Marshal renders a suite in the canonical on-disk form
+func Marshal(s *Suite) ([]byte, error) {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// Replay runs a vector through the implementation and returns an error if the
+// error class or any expected output differs.
+func Replay(v *Vector) error {
+	switch v.Operation {
+	case OpR2Point:
+		return replayR2Point(v)
+	case OpCommitment:
+		return replayCommitment(v)
+	case OpCtxHash:
+		return replayCtxHash(v)
+	case OpParseCapsule:
+		return replayParseCapsule(v)
+	case OpVerify:
+		return replayVerify(v)
+	default:
+		return fmt.Errorf("unknown operation %q", v.Operation)
+	}
+}
+
+func replayR2Point(v *Vector) error {
+	r2, err := hex.DecodeString(v.Inputs.R2)
+	if err != nil {
+		return fmt.Errorf("bad r2 hex: %w", err)
+	}
+	R2, err := vte.ComputeR2Point(r2)
+	if err := checkResult(v, err); err != nil || v.Outputs.Result != "success" {
+		return err
+	}
+	return checkHex("param_R2", v.Outputs.R2, R2)
+}
+
+func replayCommitment(v *Vector) error {
+	r2, err := hex.DecodeString(v.Inputs.R2)
+	if err != nil {
+		return fmt.Errorf("bad r2 hex: %w", err)
+	}
+	ctxHash, err := hex.DecodeString(v.Inputs.CtxHash)
+	if err != nil {
+		return fmt.Errorf("bad ctx_hash hex: %w", err)
+	}
+	c, err := commitment.ComputeCommitmentHash(r2, ctxHash)
+	if err := checkResult(v, err); err != nil || v.Outputs.Result != "success" {
+		return err
+	}
+	return checkHex("C", v.Outputs.C, c)
+}
+
+func replayCtxHash(v *Vector) error {
+	params, err := ctxParams(&v.Inputs)
+	if err != nil {
+		return err
+	}
+	ctxHash, err := vte.ComputeFullCtxHash(params)
+	if err := checkResult(v, err); err != nil || v.Outputs.Result != "success" {
+		return err
+	}
+	return checkHex("ctx_hash", v.Outputs.CtxHash, ctxHash)
+}
+
+func replayParseCapsule(v *Vector) error {
+	capsule, err := base64.StdEncoding.DecodeString(v.Inputs.CapsuleBase64)
+	if err != nil {
+		return fmt.Errorf("bad capsule base64: %w", err)
+	}
+	fields, err := vte.ParseCapsule(capsule, v.Inputs.FormatID)
+	if err := checkResult(v, err); err != nil || v.Outputs.Result != "success" {
+		return err
+	}
+	if v.Outputs.CipherFields == nil {
+		return fmt.Errorf("vector has no expected cipher_fields")
+	}
+	want := v.Outputs.CipherFields
+	if err := checkHex("ephemeral_pub_key", want.EphemeralPubKey, fields.EphemeralPubKey); err != nil {
+		return err
+	}
+	if err := checkHex("mask", want.Mask, fields.Mask); err != nil {
+		return err
+	}
+	if err := checkHex("tag", want.Tag, fields.Tag); err != nil {
+		return err
+	}
+	return checkHex("ciphertext", want.Ciphertext, fields.Ciphertext)
+}
+
+func replayVerify(v *Vector) error {
+	var pkg vte.VTEPackageV2
+	if err := json.Unmarshal(v.Inputs.Package, &pkg); err != nil {
+		return fmt.Errorf("bad package JSON: %w", err)
+	}
+
+	exp := v.Inputs.Expected
+	if exp == nil {
+		exp = &Expectations{}
+	}
+	chainHash, err := hex.DecodeString(exp.ChainHash)
+	if err != nil {
+		return fmt.Errorf("bad expected chainhash hex: %w", err)
+	}
+	refundTx, err := hex.DecodeString(exp.RefundTx)
+	if err != nil {
+		return fmt.Errorf("bad expected refund_tx hex: %w", err)
+	}
+
+	verr := vte.VerifyVTE(&pkg, exp.Round, chainHash, exp.FormatID, exp.SessionID, refundTx)
+	if err := checkResult(v, verr); err != nil || v.Outputs.Result != "success" {
+		return err
+	}
+
+	// A passing package must also reproduce every published intermediate value
+	params, err := ctxParams(&v.Inputs)
+	if err != nil {
+		return err
+	}
+	ctxHash, err := vte.ComputeFullCtxHash(params)
+	if err != nil {
+		return fmt.Errorf("ctx_hash recomputation failed: %w", err)
+	}
+	if err := checkHex("ctx_hash", v.Outputs.CtxHash, ctxHash); err != nil {
+		return err
+	}
+	if !bytes.Equal(ctxHash, pkg.Context.CtxHash) {
+		return fmt.Errorf("package ctx_hash %x differs from inputs %x", pkg.Context.CtxHash, ctxHash)
+	}
+
+	r2, err := hex.DecodeString(v.Inputs.R2)
+	if err != nil {
+		return fmt.Errorf("bad r2 hex: %w", err)
+	}
+	R2, err := vte.ComputeR2Point(r2)
+	if err != nil {
+		return err
+	}
+	if err := checkHex("param_R2", v.Outputs.R2, R2); err != nil {
+		return err
+	}
+	c, err := commitment.ComputeCommitmentHash(r2, ctxHash)
+	if err != nil {
+		return err
+	}
+	if err := checkHex("C", v.Outputs.C, c); err != nil {
+		return err
+	}
+	if got := base64.StdEncoding.EncodeToString(pkg.Tlock.Capsule); got != v.Outputs.CapsuleBase64 {
+		return fmt.Errorf("capsule_base64 mismatch")
+	}
+	if got := base64.StdEncoding.EncodeToString(pkg.Proofs.SecpSchnorr.SignatureB64); got != v.Outputs.ProofSecpBase64 {
+		return fmt.Errorf("proof_secp_base64 mismatch")
+	}
+	if got := base64.StdEncoding.EncodeToString(pkg.Proofs.Commitment.ProofB64); got != v.Outputs.ProofCommitmentBase64 {
+		return fmt.Errorf("proof_commitment_base64 mismatch")
+	}
+	return nil
+}
+
+// ctxParams builds ComputeFullCtxHash input from vector inputs
+func ctxParams(in *Inputs) (*vte.CtxHashParams, error) {
+	chainHash, err := hex.DecodeString(in.ChainHash)
+	if err != nil {
+		return nil, fmt.Errorf("bad chainhash hex: %w", err)
+	}
+	refundTx, err := hex.DecodeString(in.RefundTx)
+	if err != nil {
+		return nil, fmt.Errorf("bad refund_tx hex: %w", err)
+	}
+	capsuleHash, err := hex.DecodeString(in.CapsuleHash)
+	if err != nil {
+		return nil, fmt.Errorf("bad capsule_hash hex: %w", err)
+	}
+	return &vte.CtxHashParams{
+		SessionID:   in.SessionID,
+		RefundTx:    refundTx,
+		ChainHash:   chainHash,
+		Round:       in.Round,
+		CapsuleHash: capsuleHash,
+	}, nil
+}
+
+// checkResult compares the error class of an operation with the vector
+func checkResult(v *Vector, err error) error {
+	if got := vte.ErrorClass(err); got != v.Outputs.Result {
+		return fmt.Errorf("result mismatch: have %s, want %s (err: %v)", got, v.Outputs.Result, err)
+	}
+	return nil
+}
+
+func checkHex(name, want string, got []byte) error {
+	if hex.EncodeToString(got) != want {
+		return fmt.Errorf("%s mismatch: have %x, want %s", name, got, want)
+	}
+	return nil
+}
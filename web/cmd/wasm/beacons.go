@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"syscall/js"
+
+	"vte-tlock/pkg/vte"
+)
+
+// importBeacons adds a beacon bundle to the in-memory beacon cache, so
+// decryptVTE works without reaching a drand endpoint
+// Args: bundleJSON (string)
+// Returns: {imported: number, error?: string}
+func importBeacons(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return errorResponse("args: bundleJSON")
+	}
+
+	n, err := vte.Beacons.Import(strings.NewReader(args[0].String()))
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+	return map[string]interface{}{"imported": n}
+}
+
+// exportBeacons returns every cached beacon of a chain as a bundle
+// Args: chainHashOrName (string)
+// Returns: {bundle: string, error?: string}
+func exportBeacons(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return errorResponse("args: chainHashOrName")
+	}
+
+	chainHash, err := vte.ResolveChainHash(args[0].String())
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+	var buf bytes.Buffer
+	if err := vte.Beacons.Export(&buf, chainHash, nil); err != nil {
+		return errorResponse(err.Error())
+	}
+	return map[string]interface{}{"bundle": buf.String()}
+}
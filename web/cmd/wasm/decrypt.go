@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -10,29 +9,23 @@ import (
 	"vte-tlock/pkg/vte"
 )
 
-// decryptVTE decrypts a VTE package and returns the plaintext secret
-// Args: pkgJSON (string), endpoints (string[])
+// decryptVTE decrypts a VTE package and returns the plaintext secret.
+// Chain info and beacon are fetched by the caller (blocking HTTP would
+// deadlock the JS event loop); nothing here touches the network.
+// Args: pkgJSON (string), chainInfoJSON (string), beaconSignatureHex (string)
+// Either may be empty when the chain is registered or the beacon was imported.
 // Returns: {plaintext: base64, error?: string}
 func decryptVTE(this js.Value, args []js.Value) interface{} {
-	if len(args) < 2 {
-		return errorResponse("missing arguments: pkgJSON, endpoints")
-	}
-
-	pkgJSON := args[0].String()
-	jsEndpoints := args[1]
-	endpoints := make([]string, jsEndpoints.Length())
-	for i := 0; i < jsEndpoints.Length(); i++ {
-		endpoints[i] = jsEndpoints.Index(i).String()
+	if len(args) < 3 {
+		return errorResponse("missing arguments: pkgJSON, chainInfoJSON, beaconSignatureHex")
 	}
 
 	var pkg vte.VTEPackageV2
-	if err := json.Unmarshal([]byte(pkgJSON), &pkg); err != nil {
+	if err := json.Unmarshal([]byte(args[0].String()), &pkg); err != nil {
 		return errorResponse(fmt.Sprintf("invalid package JSON: %v", err))
 	}
 
-	// Call real decryption
-	ctx := context.Background()
-	result, err := vte.DecryptVTE(ctx, &pkg, endpoints)
+	result, err := vte.DecryptVTEWithBeacon(&pkg, args[1].String(), args[2].String())
 	if err != nil {
 		return errorResponse(fmt.Sprintf("decryption failed: %v", err))
 	}
@@ -22,9 +22,10 @@ func verifyVTE(this js.Value, args []js.Value) interface{} {
 	}
 
 	round := uint64(args[1].Int())
-	chainHash, err := hex.DecodeString(args[2].String())
+	// Network name (e.g. "quicknet") or chain hash hex
+	chainHash, err := vte.ResolveChainHash(args[2].String())
 	if err != nil {
-		return errorResponse("invalid chainhash hex")
+		return errorResponse(err.Error())
 	}
 	formatID := args[3].String()
 	sessionID := args[4].String()
@@ -33,13 +34,16 @@ func verifyVTE(this js.Value, args []js.Value) interface{} {
 		return errorResponse("invalid refund tx hex")
 	}
 
-	// VerifyVTE now takes structured params
-	err = vte.VerifyVTE(&pkg, round, chainHash, formatID, sessionID, refundTx)
-	if err != nil {
-		return map[string]interface{}{"success": false, "error": err.Error()}
-	}
+	// Every check runs; "error" is the first failure, "report" has them all
+	report := vte.VerifyVTEReport(&pkg, round, chainHash, formatID, sessionID, refundTx)
+	reportJSON, _ := json.Marshal(report)
+	var reportObj interface{}
+	_ = json.Unmarshal(reportJSON, &reportObj)
 
-	return map[string]interface{}{"success": true}
+	if err := report.Err(); err != nil {
+		return map[string]interface{}{"success": false, "error": err.Error(), "report": reportObj}
+	}
+	return map[string]interface{}{"success": true, "report": reportObj}
 }
 
 func parseCapsule(this js.Value, args []js.Value) interface{} {
@@ -70,7 +74,11 @@ func generateVTE(this js.Value, args []js.Value) interface{} {
 	}
 
 	round := uint64(args[0].Int())
-	chainHash, _ := hex.DecodeString(args[1].String())
+	// Network name (e.g. "quicknet") or chain hash hex
+	chainHash, err := vte.ResolveChainHash(args[1].String())
+	if err != nil {
+		return errorResponse(err.Error())
+	}
 	formatID := args[2].String()
 	r2, _ := hex.DecodeString(args[3].String())
 	refundTx, _ := hex.DecodeString(args[4].String())
@@ -86,10 +94,12 @@ func generateVTE(this js.Value, args []js.Value) interface{} {
 	// 7: Strategy (ignored for now)
 	// strategyStr := args[7].String()
 
-	// 8: Chain Info JSON (pre-fetched for WASM)
+	// 8: Chain Info JSON (pre-fetched for WASM, optional for registered networks)
 	chainInfoJSON := args[8].String()
 	if chainInfoJSON == "" {
-		return errorResponse("WASM Error: ChainInfoJSON argument is empty. Ensure worker fetched it.")
+		if n, err := vte.Networks.LookupHash(chainHash); err != nil || !n.Pinned() {
+			return errorResponse("WASM Error: ChainInfoJSON argument is empty. Ensure worker fetched it.")
+		}
 	}
 
 	// 9: Beacon Signature Hex
@@ -168,6 +178,37 @@ func computeR2Point(this js.Value, args []js.Value) interface{} {
 	}
 }
 
+// lookupNetwork returns a registered drand network by name or chain hash
+// Args: nameOrHash (string)
+func lookupNetwork(this js.Value, args []js.Value) interface{} {
+	if len(args) < 1 {
+		return errorResponse("args: nameOrHash")
+	}
+
+	n, err := vte.Networks.Lookup(args[0].String())
+	if err != nil {
+		return errorResponse(err.Error())
+	}
+
+	endpoints := make([]interface{}, len(n.Endpoints))
+	for i, e := range n.Endpoints {
+		endpoints[i] = e
+	}
+	result := map[string]interface{}{
+		"name":       n.Name,
+		"chain_hash": hex.EncodeToString(n.ChainHash),
+		"scheme":     n.SchemeID,
+		"endpoints":  endpoints,
+		"pinned":     n.Pinned(),
+		"tlock":      n.Tlock(),
+	}
+	if info, err := n.NetworkInfo(); err == nil {
+		result["period"] = info.Period
+		result["genesis_time"] = info.GenesisTime
+	}
+	return result
+}
+
 func errorResponse(msg string) map[string]interface{} {
 	return map[string]interface{}{"error": msg}
 }
@@ -180,5 +221,8 @@ func main() {
 	js.Global().Set("computeCtxHash", js.FuncOf(computeCtxHash))
 	js.Global().Set("computeR2Point", js.FuncOf(computeR2Point))
 	js.Global().Set("decryptVTE", js.FuncOf(decryptVTE))
+	js.Global().Set("lookupNetwork", js.FuncOf(lookupNetwork))
+	js.Global().Set("importBeacons", js.FuncOf(importBeacons))
+	js.Global().Set("exportBeacons", js.FuncOf(exportBeacons))
 	<-c
 }
@@ -108,11 +108,20 @@ export default function Verifier() {
                 refundTxHex: refundTx
             });
 
+            // Each UI check fails if any of its report checks failed
+            if (res.report) {
+                const groups: Record<string, string[]> = {
+                    network: ['version', 'chain', 'round', 'unlock_horizon', 'policy'],
+                    capsule: ['format', 'ctx_binding', 'capsule_hash'],
+                    commitment: ['commitment_proof'],
+                    schnorr: ['schnorr'],
+                };
+                for (const [id, names] of Object.entries(groups)) {
+                    const failed = res.report.checks.some(c => names.includes(c.name) && c.status === 'fail');
+                    updateCheck(id, failed ? 'error' : 'success');
+                }
+            }
             if (res.error) {
-                if (res.error.includes("network")) updateCheck('network', 'error');
-                else if (res.error.includes("capsule") || res.error.includes("cipher")) updateCheck('capsule', 'error');
-                else if (res.error.includes("ZK proof")) updateCheck('commitment', 'error');
-                else if (res.error.includes("schnorr")) updateCheck('schnorr', 'error');
                 throw new Error(res.error);
             }
 
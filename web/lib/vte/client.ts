@@ -1,5 +1,5 @@
 
-import { WorkerResponse } from './types';
+import { VerificationReport, WorkerResponse } from './types';
 
 class VTEClient {
     private worker: Worker | null = null;
@@ -80,6 +80,11 @@ class VTEClient {
         return this.send('DECRYPT_VTE', { packageJSON, endpoints });
     }
 
+    // Decrypts with a beacon the caller already has; no network access
+    async decryptWithBeacon(packageJSON: string, chainInfoJSON: string, beaconSignatureHex: string) {
+        return this.send('DECRYPT_VTE', { packageJSON, chainInfoJSON, beaconSignatureHex });
+    }
+
     async verifyVTE(params: {
         jsonInput: string;
         round: number;
@@ -87,7 +92,7 @@ class VTEClient {
         formatId: string;
         sessionId: string;
         refundTxHex: string;
-    }) {
+    }): Promise<{ success?: boolean; error?: string; report?: VerificationReport }> {
         return this.send('VERIFY_VTE', params);
     }
 
@@ -98,6 +103,29 @@ class VTEClient {
     async computeR2Point(r2Hex: string): Promise<{ R2?: string; error?: string }> {
         return this.send('COMPUTE_R2_POINT', { r2Hex });
     }
+
+    async lookupNetwork(nameOrHash: string): Promise<{
+        name?: string;
+        chain_hash?: string;
+        scheme?: string;
+        endpoints?: string[];
+        pinned?: boolean;
+        tlock?: boolean;
+        period?: number;
+        genesis_time?: number;
+        error?: string;
+    }> {
+        return this.send('LOOKUP_NETWORK', { nameOrHash });
+    }
+
+    // Beacon bundles let decryptVTE run without reaching a drand endpoint
+    async importBeacons(bundleJSON: string): Promise<{ imported?: number; error?: string }> {
+        return this.send('IMPORT_BEACONS', { bundleJSON });
+    }
+
+    async exportBeacons(chainHashOrName: string): Promise<{ bundle?: string; error?: string }> {
+        return this.send('EXPORT_BEACONS', { chainHashOrName });
+    }
 }
 
 // Export a singleton instance
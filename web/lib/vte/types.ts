@@ -36,6 +36,25 @@ export interface VTEPackage {
     proof_tle: string;            // Base64
 }
 
+// VerifyVTEReport output (pkg/vte/report.go)
+export interface VerificationCheck {
+    name: string;                 // "version" | "chain" | "round" | "format" | "ctx_binding" | ...
+    status: 'pass' | 'fail' | 'skipped';
+    reason?: string;
+    error_class?: string;
+    duration_us: number;
+    circuit_id?: string;
+}
+
+export interface VerificationReport {
+    version: string;              // "vte-verify-report/1"
+    ok: boolean;
+    error_class: string;          // "success" or the class of the first failure
+    ctx_hash: string;             // Hex
+    duration_us: number;
+    checks: VerificationCheck[];
+}
+
 // Worker Protocol Types
 export type WorkerRequestType = 'INIT' | 'GEN_SECP' | 'GEN_TLE' | 'VERIFY_VTE' | 'DECRYPT';
 
@@ -112,9 +112,32 @@ self.onmessage = async (e: MessageEvent) => {
 
             case 'DECRYPT_VTE': {
                 if (!wasmReady) throw new Error("WASM not initialized");
+
+                // Pre-fetch chain info and beacon in JS (HTTP from WASM deadlocks).
+                // Callers may pass them directly, e.g. from an air-gapped bundle.
+                let chainInfoJSON: string = payload.chainInfoJSON || '';
+                let beaconSignatureHex: string = payload.beaconSignatureHex || '';
+                if (!beaconSignatureHex && payload.endpoints?.length) {
+                    const tlock = JSON.parse(payload.packageJSON).tlock;
+                    const chainHash = Array.from(atob(tlock.drand_chain_hash), c => c.charCodeAt(0).toString(16).padStart(2, '0')).join('');
+                    for (const endpoint of payload.endpoints) {
+                        try {
+                            const [infoResp, beaconResp] = await Promise.all([
+                                fetch(`${endpoint}/${chainHash}/info`),
+                                fetch(`${endpoint}/${chainHash}/public/${tlock.round}`),
+                            ]);
+                            if (!infoResp.ok || !beaconResp.ok) continue;
+                            chainInfoJSON = await infoResp.text();
+                            beaconSignatureHex = (await beaconResp.json()).signature;
+                            break;
+                        } catch {
+                            // Try the next endpoint; WASM verifies whatever we pass
+                        }
+                    }
+                }
+
                 // @ts-ignore
-                // V2 requires endpoints provided by caller
-                const result = self.decryptVTE(payload.packageJSON, payload.endpoints);
+                const result = self.decryptVTE(payload.packageJSON, chainInfoJSON, beaconSignatureHex);
                 if (result.error) {
                     self.postMessage({ id, type: 'ERR', error: result.error });
                 } else {
@@ -150,6 +173,27 @@ self.onmessage = async (e: MessageEvent) => {
                 self.postMessage({ id, type: 'OK', payload: res });
                 break;
             }
+            case 'LOOKUP_NETWORK': {
+                if (!wasmReady) throw new Error("WASM not initialized");
+                // @ts-ignore
+                const res = self.lookupNetwork(payload.nameOrHash);
+                self.postMessage({ id, type: 'OK', payload: res });
+                break;
+            }
+            case 'IMPORT_BEACONS': {
+                if (!wasmReady) throw new Error("WASM not initialized");
+                // @ts-ignore
+                const res = self.importBeacons(payload.bundleJSON);
+                self.postMessage({ id, type: 'OK', payload: res });
+                break;
+            }
+            case 'EXPORT_BEACONS': {
+                if (!wasmReady) throw new Error("WASM not initialized");
+                // @ts-ignore
+                const res = self.exportBeacons(payload.chainHashOrName);
+                self.postMessage({ id, type: 'OK', payload: res });
+                break;
+            }
             default:
                 throw new Error(`Unknown message type: ${type}`);
         }